@@ -0,0 +1,74 @@
+package jitsi
+
+import (
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// maxActiveMeetings limits the meetings listed by the active subcommand.
+const maxActiveMeetings = 20
+
+// live returns whether the meeting has not ended, expired or been called
+// off.
+func (m *MeetingRecord) live() bool {
+	return (m.Status == MeetingStarted || m.Status == MeetingActive) && !m.expired(time.Now())
+}
+
+// activeMeetings selects the meetings that currently have participants from
+// meetings sorted most recent first.
+func activeMeetings(meetings []*MeetingRecord) []*MeetingRecord {
+	var active []*MeetingRecord
+	for _, meeting := range meetings {
+		if len(active) == maxActiveMeetings {
+			break
+		}
+		if meeting.Status == MeetingActive && len(meeting.Participants) > 0 {
+			active = append(active, meeting)
+		}
+	}
+	return active
+}
+
+// publicMeetings leaves out the meetings started from private channels and
+// direct messages, which not everyone in the workspace may know about.
+// Meetings of channels that cannot be looked up are left out as well.
+func publicMeetings(token string, meetings []*MeetingRecord) []*MeetingRecord {
+	api := slack.New(token)
+	public := make(map[string]bool)
+	var shown []*MeetingRecord
+	for _, meeting := range meetings {
+		ok, seen := public[meeting.ChannelID]
+		if !seen {
+			channel, err := api.GetConversationInfo(meeting.ChannelID, false)
+			ok = err == nil && !channel.IsPrivate && !channel.IsIM && !channel.IsMpIM
+			public[meeting.ChannelID] = ok
+		}
+		if ok {
+			shown = append(shown, meeting)
+		}
+	}
+	return shown
+}
+
+// activeSummary lists the meetings that have participants with the links to
+// join them.
+func activeSummary(locale string, meetings []*MeetingRecord, joinURL func(*MeetingRecord) string) string {
+	if len(meetings) == 0 {
+		return tr(locale, "active.none")
+	}
+	lines := []string{tr(locale, "active.title")}
+	for _, meeting := range meetings {
+		lines = append(lines, tr(
+			locale,
+			"active.item",
+			joinURL(meeting),
+			meeting.RoomName,
+			meeting.ChannelID,
+			len(meeting.Participants),
+			participantList(locale, meeting.Participants),
+		))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,98 @@
+package jitsi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/slack-go/slack"
+)
+
+// asyncCommand returns whether the command starts a meeting, which is the
+// case for commands without a subcommand and for async subcommands.
+func (s *SlashCommandHandlers) asyncCommand(cmd *Command) bool {
+	if sub, ok := s.lookupSubcommand(cmd.Name); ok {
+		return sub.async
+	}
+	return true
+}
+
+// handleAsync handles a command that was acknowledged and delivers the
+// response through the response url of the command.
+func (s *SlashCommandHandlers) handleAsync(r *http.Request, cmd *Command) {
+	log := hlog.FromRequest(r)
+	// the request is done, so only its logger is kept
+	r = r.WithContext(log.WithContext(context.Background()))
+	resp := newCommandResponse()
+	s.handleCommand(resp, r, cmd)
+	msg := resp.msg()
+	if msg == nil {
+		return
+	}
+	err := postResponse(r.PostFormValue("response_url"), msg)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("delivering command response")
+	}
+}
+
+// commandResponse collects the response of a command that was acknowledged
+// so that it can be delivered through the response url of the command.
+type commandResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newCommandResponse() *commandResponse {
+	return &commandResponse{header: make(http.Header)}
+}
+
+// Header returns the headers of the response.
+func (c *commandResponse) Header() http.Header {
+	return c.header
+}
+
+// Write adds to the body of the response.
+func (c *commandResponse) Write(b []byte) (int, error) {
+	c.WriteHeader(http.StatusOK)
+	return c.body.Write(b)
+}
+
+// WriteHeader records the status of the response. Only the first status is
+// recorded.
+func (c *commandResponse) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+// msg returns the message the response is delivered as. Messages are
+// delivered as they were written and text is delivered as an ephemeral
+// message, like slack shows the responses of slash commands. It is nil when
+// there is nothing to deliver, e.g. when a modal was opened instead.
+func (c *commandResponse) msg() *slack.Msg {
+	if c.status != 0 && c.status != http.StatusOK {
+		return &slack.Msg{
+			ResponseType: slack.ResponseTypeEphemeral,
+			Text:         tr(DefaultLocale(), "error.generic"),
+		}
+	}
+	if c.body.Len() == 0 {
+		return nil
+	}
+	if strings.HasPrefix(c.header.Get("Content-Type"), ContentTypeJSON) {
+		var msg slack.Msg
+		if json.Unmarshal(c.body.Bytes(), &msg) == nil {
+			return &msg
+		}
+	}
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         c.body.String(),
+	}
+}
@@ -0,0 +1,303 @@
+package jitsi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// KeyAuditTeamID is the dynamo key for the team of an audit event. This
+	// key is the partition key.
+	KeyAuditTeamID = "team-id"
+	// KeyAuditEventID is the dynamo key for the audit event id. This key is
+	// the sort key and sorts events by creation time.
+	KeyAuditEventID = "event-id"
+
+	// AuditInstall, AuditUninstall and AuditTokensRevoked are recorded when
+	// a workspace installs the app, uninstalls it or revokes its tokens.
+	AuditInstall       = "install"
+	AuditUninstall     = "uninstall"
+	AuditTokensRevoked = "tokens_revoked"
+	// AuditServerConfig is recorded when the server configuration of a team
+	// changes. The target is the setting that changed.
+	AuditServerConfig = "server_config"
+	// AuditAdminCommand is recorded when a workspace admin runs a command
+	// only admins may run. The target is the command.
+	AuditAdminCommand = "admin_command"
+	// AuditCalendarConnected and AuditCalendarTokenRefreshed are recorded
+	// when a user connects a calendar and when its token is refreshed. The
+	// target is the calendar provider.
+	AuditCalendarConnected      = "calendar_connected"
+	AuditCalendarTokenRefreshed = "calendar_token_refreshed"
+	// AuditConfigRollback is recorded when a change to the configuration of
+	// a team is rolled back. The target is the setting that changed.
+	AuditConfigRollback = "config_rollback"
+
+	errDuplicateAuditEvent = "duplicate_audit_event"
+)
+
+// AuditEvent records a security relevant action taken in a team. Events are
+// never changed once recorded.
+type AuditEvent struct {
+	TeamID  string `json:"team_id" dynamodbav:"team-id"`
+	EventID string `json:"event_id" dynamodbav:"event-id"`
+	Action  string `json:"action" dynamodbav:"action"`
+	// ActorID is the slack user that took the action. It is empty for
+	// actions slack or the service took, e.g. an uninstall.
+	ActorID string `json:"actor_id,omitempty" dynamodbav:"actor,omitempty"`
+	// Target is what the action applied to, e.g. the setting that changed.
+	Target string `json:"target,omitempty" dynamodbav:"target,omitempty"`
+	// Before and After are the values the action changed.
+	Before    AuditValue `json:"before,omitempty" dynamodbav:"before,omitempty"`
+	After     AuditValue `json:"after,omitempty" dynamodbav:"after,omitempty"`
+	CreatedAt int64      `json:"created_at" dynamodbav:"created-at"`
+}
+
+// AuditValue is a json encoded value of an audit event. It is stored as a
+// string and exported as the json it encodes.
+type AuditValue string
+
+// MarshalJSON returns the encoded value.
+func (v AuditValue) MarshalJSON() ([]byte, error) {
+	if v == "" {
+		return []byte("null"), nil
+	}
+	return []byte(v), nil
+}
+
+// AuditWriter provides an interface for recording audit events.
+type AuditWriter interface {
+	Record(event *AuditEvent) error
+}
+
+// AuditReader provides an interface for reading the audit events of teams.
+type AuditReader interface {
+	Since(teamID string, since time.Time) ([]*AuditEvent, error)
+}
+
+// newAuditEvent creates an audit event. The values before and after the
+// action are optional and must encode to json.
+func newAuditEvent(teamID, actorID, action, target string, before, after interface{}) *AuditEvent {
+	now := time.Now()
+	return &AuditEvent{
+		TeamID:    teamID,
+		EventID:   xid.NewWithTime(now).String(),
+		Action:    action,
+		ActorID:   actorID,
+		Target:    target,
+		Before:    auditValue(before),
+		After:     auditValue(after),
+		CreatedAt: now.Unix(),
+	}
+}
+
+// auditValue encodes a value of an audit event. Missing values stay empty.
+func auditValue(value interface{}) AuditValue {
+	if value == nil {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return AuditValue(data)
+}
+
+// recordAudit stores an audit event when the audit log is enabled. Failing
+// to record the event does not affect the action, but it is logged.
+func recordAudit(log *zerolog.Logger, audit AuditWriter, event *AuditEvent) {
+	if audit == nil {
+		return
+	}
+	err := audit.Record(event)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("action", event.Action).
+			Str("team", event.TeamID).
+			Msg("recording audit event")
+	}
+}
+
+// installAudit is the part of an install that is audited. The token itself
+// is never recorded.
+func installAudit(data *TokenData) map[string]string {
+	return map[string]string{
+		"app_id":        data.AppID,
+		"scope":         data.Scope,
+		"bot_user_id":   data.BotUserID,
+		"enterprise_id": data.EnterpriseID,
+	}
+}
+
+// changeServerConfig applies a change to the server configuration of a
+// team and records it with the configuration before and after the change
+// when the audit log or the config history is enabled.
+func changeServerConfig(
+	r *http.Request,
+	audit AuditWriter,
+	history *ConfigHistory,
+	cfg ServerConfigReader,
+	teamID, actorID, setting string,
+	change func() error,
+) error {
+	if audit == nil && history == nil {
+		return change()
+	}
+	before, err := cfg.Get(teamID)
+	if err != nil {
+		return err
+	}
+	err = change()
+	if err != nil {
+		return err
+	}
+	after, err := cfg.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("retrieving changed server config")
+		return nil
+	}
+	recordAudit(hlog.FromRequest(r), audit, newAuditEvent(teamID, actorID, AuditServerConfig, setting, before, after))
+	history.recordServerCfg(hlog.FromRequest(r), teamID, actorID, setting, before, after)
+	return nil
+}
+
+// AuditStore stores and retrieves audit events from aws dynamodb. Events
+// can only be added, so the table is append-only for the service.
+type AuditStore struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+// Record will persist the audit event. Existing events are never
+// overwritten.
+func (a *AuditStore) Record(event *AuditEvent) error {
+	av, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		return err
+	}
+	cond := expression.AttributeNotExists(expression.Name(KeyAuditEventID))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+	_, err = a.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:                aws.String(a.TableName),
+		Item:                     av,
+		ConditionExpression:      expr.Condition(),
+		ExpressionAttributeNames: expr.Names(),
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return errors.New(errDuplicateAuditEvent)
+	}
+	return err
+}
+
+// Since retrieves the audit events of the team recorded since the provided
+// time, oldest first. All events of the team are retrieved when the time is
+// zero.
+func (a *AuditStore) Since(teamID string, since time.Time) ([]*AuditEvent, error) {
+	keyCond := expression.Key(KeyAuditTeamID).Equal(expression.Value(teamID))
+	if !since.IsZero() {
+		keyCond = keyCond.And(expression.Key(KeyAuditEventID).GreaterThanEqual(expression.Value(xid.NewWithTime(since).String())))
+	}
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*AuditEvent
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := a.DB.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:                 aws.String(a.TableName),
+			KeyConditionExpression:    expr.KeyCondition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var page []*AuditEvent
+		err = attributevalue.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return events, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// AuditExportHandler exports the audit log of a team for compliance
+// reviews, e.g. GET /admin/audit?team=T123&since=2021-01-01T00:00:00Z
+// Events are written as json lines, oldest first.
+type AuditExportHandler struct {
+	// Secret is the bearer token exports are authorized with.
+	Secret string
+	Audit  AuditReader
+}
+
+// Handle writes the audit events of the team since the time of the since
+// parameter, or all of them when it is missing.
+func (a *AuditExportHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizedEvent(r, a.Secret) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	teamID := r.URL.Query().Get("team")
+	if teamID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := a.Audit.Since(teamID, since)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving audit events")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	hlog.FromRequest(r).Info().
+		Str("team", teamID).
+		Int("events", len(events)).
+		Msg("exporting audit events")
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for _, event := range events {
+		enc.Encode(event)
+	}
+}
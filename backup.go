@@ -0,0 +1,320 @@
+package jitsi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// BackupTeamToken, BackupUserToken and BackupServerConfig are the types
+	// of backup records.
+	BackupTeamToken    = "team_token"
+	BackupUserToken    = "user_token"
+	BackupServerConfig = "server_config"
+
+	// MaxBackupSize limits the size of a restored backup, which holds the
+	// records of up to maxBackupTeams teams.
+	MaxBackupSize = 64 << 20
+	// maxBackupRecord is the size of the longest backup record that is
+	// restored.
+	maxBackupRecord = 1 << 20
+	// defaultBackupTeams and maxBackupTeams are how many teams a page of a
+	// backup has by default and at most, which keeps pages within the
+	// timeouts of the server.
+	defaultBackupTeams = 200
+	maxBackupTeams     = 1000
+
+	errUnsupportedBackupRecord = "unsupported_backup_record"
+	errUnlistableTokens        = "unlistable_tokens"
+)
+
+// TokenLister provides an interface for listing the tokens of a store, so
+// that they can be backed up.
+type TokenLister interface {
+	// TeamIDs lists the teams with a stored token.
+	TeamIDs() ([]string, error)
+	// UserIDs lists the users of a team with a stored user token.
+	UserIDs(teamID string) ([]string, error)
+}
+
+// BackupRecord is a line of a backup, which holds one of a team token, a
+// user token or the server configuration of a team.
+type BackupRecord struct {
+	Type         string           `json:"type"`
+	Token        *TokenData       `json:"token,omitempty"`
+	UserToken    *UserTokenData   `json:"user_token,omitempty"`
+	ServerConfig *BackupServerCfg `json:"server_config,omitempty"`
+}
+
+// BackupServerCfg is the stored server configuration of a team. What the
+// deployment derives from it, e.g. whether urls are tenant scoped, is not
+// backed up.
+type BackupServerCfg struct {
+	TeamID string `json:"team_id"`
+	// Server is empty when the team uses the default server of the
+	// deployment that was backed up.
+	Server            string            `json:"server,omitempty"`
+	RoomNaming        string            `json:"room_naming,omitempty"`
+	Words             *BackupWordlists  `json:"words,omitempty"`
+	JWTLifetime       int64             `json:"jwt_lifetime,omitempty"`
+	OpenServerChanges bool              `json:"open_server_changes,omitempty"`
+	Permissions       map[string]string `json:"permissions,omitempty"`
+	URLConfig         []string          `json:"url_config,omitempty"`
+}
+
+// BackupWordlists are the words of a team for random room names.
+type BackupWordlists struct {
+	Adjectives []string `json:"adjectives,omitempty"`
+	Nouns      []string `json:"nouns,omitempty"`
+	Verbs      []string `json:"verbs,omitempty"`
+	Adverbs    []string `json:"adverbs,omitempty"`
+	Blocked    []string `json:"blocked,omitempty"`
+}
+
+// BackupHandler backs up and restores the tokens and server configuration
+// of every team as json lines, e.g. to take a backup before an upgrade or to
+// move to another region or storage backend. GET /admin/backup?after=T123
+// writes a page of the backup with the teams sorting after the team, and
+// POST /admin/backup restores the backup in the body, replacing the stored
+// tokens of the teams in it and storing their settings. Backups hold the
+// access tokens in plain text.
+type BackupHandler struct {
+	// Secret is the bearer token backups are authorized with.
+	Secret       string
+	Tokens       TokenReadWriter
+	ServerConfig ServerConfigReadWriter
+	// DefaultServer is the default server of the deployment, which is not
+	// backed up as the server of the teams using it.
+	DefaultServer string
+}
+
+// Handle backs up or restores depending on the method.
+func (b *BackupHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if !authorizedEvent(r, b.Secret) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		b.backup(w, r)
+	case http.MethodPost:
+		b.restore(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (b *BackupHandler) backup(w http.ResponseWriter, r *http.Request) {
+	lister, ok := b.Tokens.(TokenLister)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	limit := defaultBackupTeams
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxBackupTeams {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	teamIDs, err := lister.TeamIDs()
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("listing teams")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sort.Strings(teamIDs)
+	after := r.URL.Query().Get("after")
+	teamIDs = teamIDs[sort.SearchStrings(teamIDs, after):]
+	if len(teamIDs) > 0 && teamIDs[0] == after {
+		teamIDs = teamIDs[1:]
+	}
+	if len(teamIDs) > limit {
+		teamIDs = teamIDs[:limit]
+	}
+
+	// the response has started once the first record is written, so teams
+	// failing later end the backup early, which the count of teams in the
+	// log tells apart.
+	if len(teamIDs) == limit {
+		w.Header().Set("X-Backup-Next", teamIDs[limit-1])
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for n, teamID := range teamIDs {
+		err = b.backupTeam(enc, lister, teamID)
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Str("team", teamID).
+				Int("teams", n).
+				Msg("backing up team")
+			return
+		}
+	}
+	hlog.FromRequest(r).Info().
+		Int("teams", len(teamIDs)).
+		Msg("backed up teams")
+}
+
+func (b *BackupHandler) backupTeam(enc *json.Encoder, lister TokenLister, teamID string) error {
+	token, err := b.Tokens.GetTokenForTeam(teamID)
+	if err != nil {
+		return err
+	}
+	err = enc.Encode(&BackupRecord{Type: BackupTeamToken, Token: token})
+	if err != nil {
+		return err
+	}
+	userIDs, err := lister.UserIDs(teamID)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		userToken, err := b.Tokens.GetTokenForUser(teamID, userID)
+		if err != nil {
+			return err
+		}
+		err = enc.Encode(&BackupRecord{Type: BackupUserToken, UserToken: userToken})
+		if err != nil {
+			return err
+		}
+	}
+
+	srv, err := b.ServerConfig.Get(teamID)
+	if err != nil {
+		return err
+	}
+	cfg := storedServerCfg(teamID, srv, b.DefaultServer)
+	return enc.Encode(&BackupRecord{Type: BackupServerConfig, ServerConfig: cfg})
+}
+
+// storedServerCfg returns the settings of the team's server configuration,
+// leaving out the server when it is the default server of the deployment.
+func storedServerCfg(teamID string, srv ServerCfg, defaultServer string) *BackupServerCfg {
+	cfg := &BackupServerCfg{
+		TeamID:            teamID,
+		RoomNaming:        srv.RoomNaming,
+		JWTLifetime:       int64(srv.JWTLifetime / time.Second),
+		OpenServerChanges: srv.OpenServerChanges,
+		Permissions:       srv.Permissions,
+		URLConfig:         srv.URLConfig,
+	}
+	if srv.Server != defaultServer {
+		cfg.Server = srv.Server
+	}
+	if !emptyWordlists(srv.Words) {
+		words := BackupWordlists(srv.Words)
+		cfg.Words = &words
+	}
+	return cfg
+}
+
+// restore stores the records of the backup in order, so the token of a team
+// is stored before the user tokens of its users. The backup is read before
+// it is stored, so storing it does not count against the read timeout.
+func (b *BackupHandler) restore(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("reading backup")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, maxBackupRecord)
+	var restored int
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record BackupRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err == nil {
+			err = b.restoreRecord(&record)
+		}
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Int("line", restored+1).
+				Msg("restoring backup")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		restored++
+	}
+	if err = scanner.Err(); err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Int("line", restored+1).
+			Msg("reading backup")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	hlog.FromRequest(r).Info().
+		Int("records", restored).
+		Msg("restored backup")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (b *BackupHandler) restoreRecord(record *BackupRecord) error {
+	switch {
+	case record.Type == BackupTeamToken && record.Token != nil:
+		return b.Tokens.Store(record.Token)
+	case record.Type == BackupUserToken && record.UserToken != nil:
+		return b.Tokens.StoreUserToken(record.UserToken)
+	case record.Type == BackupServerConfig && record.ServerConfig != nil:
+		return b.restoreServerCfg(record.ServerConfig)
+	}
+	return errors.New(errUnsupportedBackupRecord)
+}
+
+// restoreServerCfg stores the settings of the team in the backup. Settings
+// the team never changed are not stored, so they are left as they are.
+func (b *BackupHandler) restoreServerCfg(cfg *BackupServerCfg) error {
+	srv := b.ServerConfig
+	var err error
+	if cfg.Server != "" {
+		err = srv.Store(&ServerCfgData{TeamID: cfg.TeamID, Server: cfg.Server})
+	}
+	if err == nil && cfg.RoomNaming != "" {
+		err = srv.SetRoomNaming(cfg.TeamID, cfg.RoomNaming)
+	}
+	if err == nil && cfg.Words != nil {
+		err = srv.SetWordlists(cfg.TeamID, Wordlists(*cfg.Words))
+	}
+	if err == nil && cfg.JWTLifetime > 0 {
+		err = srv.SetJWTLifetime(cfg.TeamID, time.Duration(cfg.JWTLifetime)*time.Second)
+	}
+	if err == nil && cfg.OpenServerChanges {
+		err = srv.SetOpenServerChanges(cfg.TeamID, true)
+	}
+	if err == nil && len(cfg.Permissions) > 0 {
+		err = srv.SetPermissions(cfg.TeamID, cfg.Permissions)
+	}
+	if err == nil && len(cfg.URLConfig) > 0 {
+		err = srv.SetURLConfig(cfg.TeamID, cfg.URLConfig)
+	}
+	return err
+}
+
+// emptyWordlists returns whether the team has no words of its own.
+func emptyWordlists(words Wordlists) bool {
+	return len(words.Adjectives) == 0 && len(words.Nouns) == 0 && len(words.Verbs) == 0 &&
+		len(words.Adverbs) == 0 && len(words.Blocked) == 0
+}
@@ -0,0 +1,443 @@
+package jitsi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// StoreBackendBolt stores tokens and server configuration in a bbolt
+	// data file, so the service runs without any external database.
+	StoreBackendBolt = "bolt"
+
+	// boltOpenTimeout limits how long opening the data file waits for
+	// another process to release it.
+	boltOpenTimeout = 5 * time.Second
+)
+
+var (
+	// boltTokens holds the token of each team by team id and the user tokens
+	// of its users by team/user, like the dynamodb token table.
+	boltTokens = []byte("tokens")
+	// boltServerCfg holds the server configuration of each team by team id.
+	boltServerCfg = []byte("server-cfg")
+)
+
+// OpenBoltDB opens the bbolt data file at the path, creating it and its
+// buckets when they are missing.
+func OpenBoltDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltTokens, boltServerCfg} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// boltGet unmarshals the json value of the key into v. It returns whether
+// the key exists.
+func boltGet(tx *bolt.Tx, bucket []byte, key string, v interface{}) (bool, error) {
+	b := tx.Bucket(bucket).Get([]byte(key))
+	if b == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// boltPut stores v as the json value of the key.
+func boltPut(tx *bolt.Tx, bucket []byte, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucket).Put([]byte(key), b)
+}
+
+// boltToken is a token as it is stored in the data file. The access token
+// is replaced by its ciphertext when tokens are encrypted.
+type boltToken struct {
+	AccessToken string `json:"access-token,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+	// BotUserID, AppID, AuthedUserID and EnterpriseID are only stored for
+	// the tokens of teams.
+	BotUserID    string `json:"bot-user-id,omitempty"`
+	AppID        string `json:"app-id,omitempty"`
+	AuthedUserID string `json:"authed-user-id,omitempty"`
+	EnterpriseID string `json:"enterprise-id,omitempty"`
+	KeyID        string `json:"key-id,omitempty"`
+	DataKey      []byte `json:"data-key,omitempty"`
+	Ciphertext   []byte `json:"ciphertext,omitempty"`
+}
+
+// BoltTokenStore stores and retrieves access tokens from a bbolt data file
+// opened with OpenBoltDB.
+type BoltTokenStore struct {
+	DB *bolt.DB
+	// Cipher is optional and encrypts the access tokens that are stored.
+	// Tokens stored before they were encrypted are still read.
+	Cipher TokenCipher
+}
+
+// encrypt replaces the access token with its ciphertext when tokens are
+// encrypted.
+func (b *BoltTokenStore) encrypt(id string, token *boltToken) error {
+	if b.Cipher == nil {
+		return nil
+	}
+	enc, err := b.Cipher.Encrypt(id, token.AccessToken)
+	if err != nil {
+		return err
+	}
+	token.AccessToken = ""
+	token.KeyID, token.DataKey, token.Ciphertext = enc.KeyID, enc.DataKey, enc.Ciphertext
+	return nil
+}
+
+// decrypt returns the access token. Tokens without a key id were stored in
+// plaintext.
+func (b *BoltTokenStore) decrypt(id string, token *boltToken) (string, error) {
+	if token.KeyID == "" {
+		return token.AccessToken, nil
+	}
+	if b.Cipher == nil {
+		return "", errors.New(errMissingTokenCipher)
+	}
+	return b.Cipher.Decrypt(id, &EncryptedToken{
+		KeyID:      token.KeyID,
+		DataKey:    token.DataKey,
+		Ciphertext: token.Ciphertext,
+	})
+}
+
+// GetTokenForTeam retrieves the access token stored with the provided team
+// id.
+func (b *BoltTokenStore) GetTokenForTeam(teamID string) (*TokenData, error) {
+	var token boltToken
+	var found bool
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		found, err = boltGet(tx, boltTokens, teamID, &token)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New(errMissingAuthToken)
+	}
+	accessToken, err := b.decrypt(teamID, &token)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenData{
+		TeamID:       teamID,
+		AccessToken:  accessToken,
+		Scope:        token.Scope,
+		BotUserID:    token.BotUserID,
+		AppID:        token.AppID,
+		AuthedUserID: token.AuthedUserID,
+		EnterpriseID: token.EnterpriseID,
+	}, nil
+}
+
+// Store will store access token data, replacing the previous token of the
+// team. The user tokens of its users are kept.
+func (b *BoltTokenStore) Store(data *TokenData) error {
+	token := &boltToken{
+		AccessToken:  data.AccessToken,
+		Scope:        data.Scope,
+		BotUserID:    data.BotUserID,
+		AppID:        data.AppID,
+		AuthedUserID: data.AuthedUserID,
+		EnterpriseID: data.EnterpriseID,
+	}
+	err := b.encrypt(data.TeamID, token)
+	if err != nil {
+		return err
+	}
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		return boltPut(tx, boltTokens, data.TeamID, token)
+	})
+}
+
+// Remove will remove access token data for the team, including the user
+// tokens of its users.
+func (b *BoltTokenStore) Remove(teamID string) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltTokens)
+		// user tokens are keyed by team/user and sort after the team
+		prefix := []byte(userTokenID(teamID, ""))
+		keys := [][]byte{[]byte(teamID)}
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			err := bucket.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetTokenForUser retrieves the user token stored for the user of a team.
+func (b *BoltTokenStore) GetTokenForUser(teamID, userID string) (*UserTokenData, error) {
+	id := userTokenID(teamID, userID)
+	var token boltToken
+	var found bool
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		found, err = boltGet(tx, boltTokens, id, &token)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New(errMissingUserToken)
+	}
+	accessToken, err := b.decrypt(id, &token)
+	if err != nil {
+		return nil, err
+	}
+	return &UserTokenData{
+		TeamID:      teamID,
+		UserID:      userID,
+		AccessToken: accessToken,
+		Scope:       token.Scope,
+	}, nil
+}
+
+// StoreUserToken will store the user token of a user. The token of the team
+// must be stored first.
+func (b *BoltTokenStore) StoreUserToken(data *UserTokenData) error {
+	id := userTokenID(data.TeamID, data.UserID)
+	token := &boltToken{
+		AccessToken: data.AccessToken,
+		Scope:       data.Scope,
+	}
+	err := b.encrypt(id, token)
+	if err != nil {
+		return err
+	}
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltTokens).Get([]byte(data.TeamID)) == nil {
+			return errors.New(errMissingAuthToken)
+		}
+		return boltPut(tx, boltTokens, id, token)
+	})
+}
+
+// RemoveUserToken will remove the user token of a user.
+func (b *BoltTokenStore) RemoveUserToken(teamID, userID string) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltTokens).Delete([]byte(userTokenID(teamID, userID)))
+	})
+}
+
+// RemoveTeam will remove the token of a team along with the user tokens of
+// its users.
+func (b *BoltTokenStore) RemoveTeam(teamID string) error {
+	return b.Remove(teamID)
+}
+
+// RemoveUser will remove the user token of a user.
+func (b *BoltTokenStore) RemoveUser(teamID, userID string) error {
+	return b.RemoveUserToken(teamID, userID)
+}
+
+// ExportTeam will export the install of a team. The token is not exported.
+func (b *BoltTokenStore) ExportTeam(teamID string) (interface{}, error) {
+	data, err := b.GetTokenForTeam(teamID)
+	if err != nil {
+		return nil, err
+	}
+	install := installAudit(data)
+	install["authed_user_id"] = data.AuthedUserID
+	return install, nil
+}
+
+// TeamIDs lists the teams with a stored token.
+func (b *BoltTokenStore) TeamIDs() ([]string, error) {
+	var teamIDs []string
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltTokens).ForEach(func(k, _ []byte) error {
+			// user tokens are keyed by team/user
+			if !bytes.ContainsRune(k, '/') {
+				teamIDs = append(teamIDs, string(k))
+			}
+			return nil
+		})
+	})
+	return teamIDs, err
+}
+
+// UserIDs lists the users of a team with a stored user token.
+func (b *BoltTokenStore) UserIDs(teamID string) ([]string, error) {
+	var userIDs []string
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		prefix := []byte(userTokenID(teamID, ""))
+		c := tx.Bucket(boltTokens).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			userIDs = append(userIDs, string(k[len(prefix):]))
+		}
+		return nil
+	})
+	return userIDs, err
+}
+
+// boltServerCfgData is the server configuration of a team as it is stored
+// in the data file.
+type boltServerCfgData struct {
+	Server            string            `json:"server-url,omitempty"`
+	RoomNaming        string            `json:"room-naming,omitempty"`
+	Words             Wordlists         `json:"wordlists"`
+	JWTLifetime       int64             `json:"jwt-lifetime,omitempty"`
+	OpenServerChanges bool              `json:"open-server-changes,omitempty"`
+	Permissions       map[string]string `json:"permissions,omitempty"`
+	URLConfig         []string          `json:"url-config,omitempty"`
+	UpdatedAt         int64             `json:"updated-at,omitempty"`
+}
+
+// BoltServerCfgStore stores the server configuration of teams in a bbolt
+// data file opened with OpenBoltDB.
+type BoltServerCfgStore struct {
+	DB *bolt.DB
+	ServerDefaults
+}
+
+// Store will persist the server of a team.
+func (b *BoltServerCfgStore) Store(data *ServerCfgData) error {
+	return b.update(data.TeamID, func(cfg *boltServerCfgData) {
+		cfg.Server = data.Server
+	})
+}
+
+// Remove will remove the configured server for a team. That team will use
+// the default server while keeping its other settings.
+func (b *BoltServerCfgStore) Remove(teamID string) error {
+	return b.update(teamID, func(cfg *boltServerCfgData) {
+		cfg.Server = ""
+	})
+}
+
+// SetWordlists will persist the words random room names of a team are
+// generated from.
+func (b *BoltServerCfgStore) SetWordlists(teamID string, words Wordlists) error {
+	return b.update(teamID, func(cfg *boltServerCfgData) {
+		cfg.Words = words
+	})
+}
+
+// SetJWTLifetime will persist the lifetime of the team's meeting tokens. A
+// zero lifetime restores the default.
+func (b *BoltServerCfgStore) SetJWTLifetime(teamID string, lifetime time.Duration) error {
+	return b.update(teamID, func(cfg *boltServerCfgData) {
+		cfg.JWTLifetime = 0
+		if lifetime > 0 {
+			cfg.JWTLifetime = int64(lifetime.Seconds())
+		}
+	})
+}
+
+// SetOpenServerChanges will persist whether everyone may change the server
+// of a team.
+func (b *BoltServerCfgStore) SetOpenServerChanges(teamID string, open bool) error {
+	return b.update(teamID, func(cfg *boltServerCfgData) {
+		cfg.OpenServerChanges = open
+	})
+}
+
+// SetPermissions will persist who the subcommands of a team are limited to.
+func (b *BoltServerCfgStore) SetPermissions(teamID string, permissions map[string]string) error {
+	return b.update(teamID, func(cfg *boltServerCfgData) {
+		cfg.Permissions = permissions
+	})
+}
+
+// SetURLConfig will persist the conference config overrides of a team's
+// meeting links. No overrides restore the defaults of the server.
+func (b *BoltServerCfgStore) SetURLConfig(teamID string, overrides []string) error {
+	return b.update(teamID, func(cfg *boltServerCfgData) {
+		cfg.URLConfig = overrides
+	})
+}
+
+// SetRoomNaming will persist how rooms of a team are named.
+func (b *BoltServerCfgStore) SetRoomNaming(teamID, naming string) error {
+	return b.update(teamID, func(cfg *boltServerCfgData) {
+		cfg.RoomNaming = naming
+	})
+}
+
+// update changes the stored configuration of a team and records when it was
+// changed.
+func (b *BoltServerCfgStore) update(teamID string, change func(*boltServerCfgData)) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		var cfg boltServerCfgData
+		_, err := boltGet(tx, boltServerCfg, teamID, &cfg)
+		if err != nil {
+			return err
+		}
+		change(&cfg)
+		cfg.UpdatedAt = time.Now().Unix()
+		return boltPut(tx, boltServerCfg, teamID, &cfg)
+	})
+}
+
+// Get retrieves the server configuration for a team. This will provide
+// the default if no configuration is stored for the team.
+func (b *BoltServerCfgStore) Get(teamID string) (ServerCfg, error) {
+	var data boltServerCfgData
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		_, err := boltGet(tx, boltServerCfg, teamID, &data)
+		return err
+	})
+	if err != nil {
+		return ServerCfg{}, err
+	}
+	var updatedAt time.Time
+	if data.UpdatedAt > 0 {
+		updatedAt = time.Unix(data.UpdatedAt, 0)
+	}
+	return b.apply(ServerCfg{
+		Server:            data.Server,
+		RoomNaming:        data.RoomNaming,
+		Words:             data.Words,
+		JWTLifetime:       time.Duration(data.JWTLifetime) * time.Second,
+		OpenServerChanges: data.OpenServerChanges,
+		Permissions:       data.Permissions,
+		URLConfig:         data.URLConfig,
+		UpdatedAt:         updatedAt,
+	}), nil
+}
+
+// RemoveTeam will remove the server configuration of a team.
+func (b *BoltServerCfgStore) RemoveTeam(teamID string) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltServerCfg).Delete([]byte(teamID))
+	})
+}
+
+// ExportTeam will export the server configuration of a team.
+func (b *BoltServerCfgStore) ExportTeam(teamID string) (interface{}, error) {
+	return b.Get(teamID)
+}
@@ -0,0 +1,87 @@
+package jitsi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rs/xid"
+	"github.com/slack-go/slack"
+)
+
+// maxBreakoutRooms limits the breakout rooms of a meeting.
+const maxBreakoutRooms = 10
+
+// breakoutCount parses the number of breakout rooms. It is zero when the
+// number is invalid.
+func breakoutCount(arg string) int {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > maxBreakoutRooms {
+		return 0
+	}
+	return n
+}
+
+// assignBreakoutRooms spreads the users over the rooms in the order they
+// were mentioned, e.g. the first, fourth and seventh user share the first of
+// three rooms.
+func assignBreakoutRooms(userIDs []string, rooms int) [][]string {
+	assignments := make([][]string, rooms)
+	seen := make(map[string]bool)
+	i := 0
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		assignments[i%rooms] = append(assignments[i%rooms], userID)
+		i++
+	}
+	return assignments
+}
+
+// Breakouts generates the breakout rooms of a meeting on the server the main
+// room is hosted on. They are named after the main room, e.g.
+// GreenFoxesRun-breakout-1
+func (m *MeetingGenerator) Breakouts(teamID, teamName, hostID string, main *Meeting, count int) ([]Meeting, error) {
+	srv, err := m.hostServer(teamID, hostID)
+	if err != nil {
+		return nil, err
+	}
+	rooms := make([]Meeting, count)
+	for i := range rooms {
+		roomName := fmt.Sprintf("%s-breakout-%d", main.RoomName, i+1)
+		rooms[i] = m.forServer(srv, xid.New().String(), teamID, teamName, roomName)
+	}
+	return rooms, nil
+}
+
+// sendBreakoutInvite sends a user the link to their breakout room along with
+// the link to the main room.
+func sendBreakoutInvite(token, hostID, userID string, main, room *Meeting, number int, style messageStyle) error {
+	invite, err := prepareInvite(token, hostID, userID, room)
+	if err != nil {
+		return err
+	}
+	mainURL, err := userMeetingURL(token, userID, main)
+	if err != nil {
+		return err
+	}
+	msg := tr(invite.Locale, "breakout.invite", hostID, number, mainURL)
+	_, _, err = slack.New(token).PostMessage(invite.Channel, inviteMsgOptions(invite, msg, style)...)
+	return err
+}
+
+// breakoutSummary lists the rooms of a meeting and who is assigned to them
+// for the host.
+func breakoutSummary(locale, mainURL string, roomURLs []string, assignments [][]string) string {
+	lines := []string{tr(locale, "breakout.main", mainURL)}
+	for i, userIDs := range assignments {
+		mentions := make([]string, len(userIDs))
+		for j, userID := range userIDs {
+			mentions[j] = "<@" + userID + ">"
+		}
+		lines = append(lines, tr(locale, "breakout.room", roomURLs[i], i+1, strings.Join(mentions, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
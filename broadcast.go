@@ -0,0 +1,87 @@
+package jitsi
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/slack-go/slack"
+)
+
+// actionRequestInvite is the action id of the button on broadcast meeting
+// messages that channel members click to opt in to a personal invite. The
+// value of the button is a json encoded meetingRef.
+const actionRequestInvite = "request_invite"
+
+// broadcastRE matches @here, @channel and @everyone in slash command text.
+var broadcastRE = regexp.MustCompile(`<!(here|channel|everyone)(\|[^>]*)?>|(^|\s)@(here|channel|everyone)\b`)
+
+// meetingRef carries enough information to recreate a meeting from an
+// interactive callback.
+type meetingRef struct {
+	MeetingID string `json:"m"`
+	TeamName  string `json:"n"`
+	RoomName  string `json:"r"`
+	HostID    string `json:"h"`
+}
+
+// broadcastKeyword returns the broadcast mention (here, channel or everyone)
+// used in the text.
+func broadcastKeyword(text string) string {
+	m := broadcastRE.FindStringSubmatch(text)
+	if m == nil {
+		return ""
+	}
+	if m[1] != "" {
+		return m[1]
+	}
+	return m[4]
+}
+
+// broadcastMsg creates a prominent in channel meeting announcement which
+// notifies the channel and lets members opt in to a personal invite.
+func broadcastMsg(locale, hostID, teamName, keyword string, meeting *Meeting, style messageStyle) (*slack.Msg, error) {
+	ref, err := json.Marshal(meetingRef{
+		MeetingID: meeting.ID,
+		TeamName:  teamName,
+		RoomName:  meeting.RoomName,
+		HostID:    hostID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	text := style.render(
+		tr(locale, "broadcast.text", keyword, hostID, meeting.Host),
+		"<@"+hostID+">",
+		meeting.URL,
+		meeting.RoomName,
+	)
+	if style.Text != "" {
+		// custom text still notifies the channel
+		text = "<!" + keyword + "> " + text
+	}
+	join := slack.NewButtonBlockElement(
+		actionJoinMeeting,
+		meeting.ID,
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "button.join"), false, false),
+	)
+	join.URL = meeting.URL
+	join.Style = slack.StylePrimary
+	dm := slack.NewButtonBlockElement(
+		actionRequestInvite,
+		string(ref),
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "broadcast.button"), false, false),
+	)
+
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeInChannel,
+		Text:         text,
+		Blocks: slack.Blocks{
+			BlockSet: []slack.Block{
+				slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "broadcast.header"), true, false)),
+				slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+				slack.NewActionBlock("", join, dm),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,307 @@
+package jitsi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/oauth2"
+)
+
+const (
+	errMissingCalendarToken = "missing_calendar_token"
+	errInvalidStartTime     = "invalid_start_time"
+
+	googleEventsURL     = "https://www.googleapis.com/calendar/v3/calendars/primary/events?sendUpdates=all"
+	googleCalendarScope = "https://www.googleapis.com/auth/calendar.events"
+
+	// calendarStateLifetime is how long a user has to complete the
+	// calendar oauth flow after requesting it.
+	calendarStateLifetime = 15 * time.Minute
+	// calendarEventLength is the length of events created for meetings.
+	calendarEventLength = 30 * time.Minute
+)
+
+var (
+	startTimeRE = regexp.MustCompile(`(?i)\b(tomorrow\s+)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)?\b`)
+	mentionRE   = regexp.MustCompile(`<[@!][^>]*>`)
+)
+
+// CalendarTokenReadWriter provides an interface for reading and writing
+// per-user calendar tokens.
+type CalendarTokenReadWriter interface {
+	Get(teamID, userID, provider string) (*CalendarTokenData, error)
+	Store(*CalendarTokenData) error
+}
+
+// CalendarProvider provides an interface for creating meeting events on the
+// calendars of users who have connected their calendar account.
+type CalendarProvider interface {
+	Name() string
+	AuthURL(teamID, userID string) string
+	Connect(ctx context.Context, state, code string) error
+	CreateEvent(teamID, userID string, ev CalendarEvent) (string, error)
+}
+
+// CalendarEvent is a calendar event created for a meeting.
+type CalendarEvent struct {
+	Title     string
+	Start     time.Time
+	End       time.Time
+	URL       string
+	Attendees []string
+}
+
+// NewGoogleOAuthConfig creates the oauth client configuration used to access
+// the calendars of Google users.
+func NewGoogleOAuthConfig(clientID, clientSecret, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{googleCalendarScope},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+			TokenURL: "https://oauth2.googleapis.com/token",
+		},
+	}
+}
+
+// GoogleCalendar creates events on the primary Google calendar of users
+// who have connected their Google account.
+type GoogleCalendar struct {
+	OAuthConfig *oauth2.Config
+	TokenStore  CalendarTokenReadWriter
+	// StateSecret is used to sign the oauth state so the callback can
+	// trust which slack user is connecting their calendar.
+	StateSecret string
+	// Audit is optional and records connected calendars and refreshed
+	// tokens.
+	Audit AuditWriter
+	// Gate is optional and denies connecting calendars of teams that may
+	// not use the service.
+	Gate *TeamGate
+	Log  zerolog.Logger
+}
+
+// Name is the name of the calendar shown to users.
+func (g *GoogleCalendar) Name() string {
+	return "Google Calendar"
+}
+
+// AuthURL returns the url a slack user visits to connect their calendar.
+func (g *GoogleCalendar) AuthURL(teamID, userID string) string {
+	return calendarAuthURL(
+		g.OAuthConfig,
+		g.StateSecret,
+		teamID,
+		userID,
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("prompt", "consent"),
+	)
+}
+
+// Connect exchanges an oauth code for tokens and stores them for the slack
+// user encoded in the state.
+func (g *GoogleCalendar) Connect(ctx context.Context, state, code string) error {
+	return connectCalendar(ctx, g.OAuthConfig, g.TokenStore, g.Audit, g.Gate, &g.Log, g.StateSecret, CalendarProviderGoogle, state, code)
+}
+
+// CreateEvent creates a calendar event for the user and returns a link to
+// the event.
+func (g *GoogleCalendar) CreateEvent(teamID, userID string, ev CalendarEvent) (string, error) {
+	ctx := context.Background()
+	client, err := calendarClient(ctx, g.OAuthConfig, g.TokenStore, g.Audit, &g.Log, teamID, userID, CalendarProviderGoogle)
+	if err != nil {
+		return "", err
+	}
+
+	type eventTime struct {
+		DateTime string `json:"dateTime"`
+	}
+	type attendee struct {
+		Email string `json:"email"`
+	}
+	body := struct {
+		Summary     string     `json:"summary"`
+		Description string     `json:"description"`
+		Location    string     `json:"location"`
+		Start       eventTime  `json:"start"`
+		End         eventTime  `json:"end"`
+		Attendees   []attendee `json:"attendees,omitempty"`
+	}{
+		Summary:     ev.Title,
+		Description: fmt.Sprintf("Join the meeting: %s", ev.URL),
+		Location:    ev.URL,
+		Start:       eventTime{DateTime: ev.Start.Format(time.RFC3339)},
+		End:         eventTime{DateTime: ev.End.Format(time.RFC3339)},
+	}
+	for _, email := range ev.Attendees {
+		body.Attendees = append(body.Attendees, attendee{Email: email})
+	}
+
+	var created struct {
+		HTMLLink string `json:"htmlLink"`
+	}
+	err = postCalendarJSON(client, googleEventsURL, body, &created)
+	if err != nil {
+		return "", err
+	}
+	return created.HTMLLink, nil
+}
+
+func calendarAuthURL(
+	cfg *oauth2.Config,
+	secret, teamID, userID string,
+	opts ...oauth2.AuthCodeOption,
+) string {
+	state := signState(secret, url.Values{
+		"team": {teamID},
+		"user": {userID},
+	}, calendarStateLifetime)
+	return cfg.AuthCodeURL(state, opts...)
+}
+
+func connectCalendar(
+	ctx context.Context,
+	cfg *oauth2.Config,
+	store CalendarTokenReadWriter,
+	audit AuditWriter,
+	gate *TeamGate,
+	log *zerolog.Logger,
+	secret, provider, state, code string,
+) error {
+	values, err := verifyState(secret, state)
+	if err != nil {
+		return err
+	}
+	teamID, userID := values.Get("team"), values.Get("user")
+	if gate != nil && !gate.Allowed(log, teamID) {
+		return errors.New(errTeamDenied)
+	}
+	tok, err := cfg.Exchange(ctx, code)
+	if err != nil {
+		return err
+	}
+	err = store.Store(&CalendarTokenData{
+		TeamID:       teamID,
+		UserID:       userID,
+		Provider:     provider,
+		AccessToken:  tok.AccessToken,
+		RefreshToken: tok.RefreshToken,
+		Expiry:       tok.Expiry,
+	})
+	if err != nil {
+		return err
+	}
+	recordAudit(log, audit, newAuditEvent(teamID, userID, AuditCalendarConnected, provider, nil, nil))
+	return nil
+}
+
+// calendarClient creates an http client authorized with the stored token
+// for the user. Refreshed tokens are written back to the token store.
+func calendarClient(
+	ctx context.Context,
+	cfg *oauth2.Config,
+	store CalendarTokenReadWriter,
+	audit AuditWriter,
+	log *zerolog.Logger,
+	teamID, userID, provider string,
+) (*http.Client, error) {
+	data, err := store.Get(teamID, userID, provider)
+	if err != nil {
+		return nil, err
+	}
+	tok := &oauth2.Token{
+		AccessToken:  data.AccessToken,
+		RefreshToken: data.RefreshToken,
+		Expiry:       data.Expiry,
+	}
+	fresh, err := cfg.TokenSource(ctx, tok).Token()
+	if err != nil {
+		return nil, err
+	}
+	if fresh.AccessToken != tok.AccessToken {
+		if fresh.RefreshToken == "" {
+			fresh.RefreshToken = tok.RefreshToken
+		}
+		err = store.Store(&CalendarTokenData{
+			TeamID:       teamID,
+			UserID:       userID,
+			Provider:     provider,
+			AccessToken:  fresh.AccessToken,
+			RefreshToken: fresh.RefreshToken,
+			Expiry:       fresh.Expiry,
+		})
+		if err != nil {
+			return nil, err
+		}
+		recordAudit(log, audit, newAuditEvent(teamID, userID, AuditCalendarTokenRefreshed, provider,
+			map[string]time.Time{"expiry": tok.Expiry}, map[string]time.Time{"expiry": fresh.Expiry}))
+	}
+	return oauth2.NewClient(ctx, oauth2.StaticTokenSource(fresh)), nil
+}
+
+func postCalendarJSON(client *http.Client, endpoint string, in, out interface{}) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("calendar api status %d: %s", resp.StatusCode, respBody)
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// parseStartTime finds a start time such as "3pm", "3:30pm", "15:00" or
+// "tomorrow 9am" in the text. The time is interpreted in the location of
+// now and a time earlier than now is moved to the following day.
+func parseStartTime(text string, now time.Time) (time.Time, error) {
+	m := startTimeRE.FindStringSubmatch(text)
+	if m == nil || (m[3] == "" && m[4] == "") {
+		return time.Time{}, errors.New(errInvalidStartTime)
+	}
+	hour, _ := strconv.Atoi(m[2])
+	minute := 0
+	if m[3] != "" {
+		minute, _ = strconv.Atoi(m[3])
+	}
+	switch strings.ToLower(m[4]) {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return time.Time{}, errors.New(errInvalidStartTime)
+		}
+		hour = hour % 12
+		if strings.ToLower(m[4]) == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}, errors.New(errInvalidStartTime)
+	}
+
+	start := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if m[1] != "" || start.Before(now) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start, nil
+}
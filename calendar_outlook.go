@@ -0,0 +1,128 @@
+package jitsi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/oauth2"
+)
+
+const (
+	graphEventsURL = "https://graph.microsoft.com/v1.0/me/events"
+	// graphDateTime is the layout microsoft graph uses for event times.
+	graphDateTime = "2006-01-02T15:04:05"
+)
+
+// NewMicrosoftOAuthConfig creates the oauth client configuration used to
+// access the calendars of Microsoft 365 users. The tenant is usually
+// "common" for a multi-tenant app or the id of a single azure ad tenant.
+func NewMicrosoftOAuthConfig(clientID, clientSecret, redirectURL, tenant string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"offline_access", "Calendars.ReadWrite"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/authorize", tenant),
+			TokenURL: fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", tenant),
+		},
+	}
+}
+
+// OutlookCalendar creates events on the Outlook calendar of Microsoft 365
+// users who have connected their account, via Microsoft Graph.
+type OutlookCalendar struct {
+	OAuthConfig *oauth2.Config
+	TokenStore  CalendarTokenReadWriter
+	// StateSecret is used to sign the oauth state so the callback can
+	// trust which slack user is connecting their calendar.
+	StateSecret string
+	// Audit is optional and records connected calendars and refreshed
+	// tokens.
+	Audit AuditWriter
+	// Gate is optional and denies connecting calendars of teams that may
+	// not use the service.
+	Gate *TeamGate
+	Log  zerolog.Logger
+}
+
+// Name is the name of the calendar shown to users.
+func (o *OutlookCalendar) Name() string {
+	return "Outlook Calendar"
+}
+
+// AuthURL returns the url a slack user visits to connect their calendar.
+func (o *OutlookCalendar) AuthURL(teamID, userID string) string {
+	return calendarAuthURL(o.OAuthConfig, o.StateSecret, teamID, userID)
+}
+
+// Connect exchanges an oauth code for tokens and stores them for the slack
+// user encoded in the state.
+func (o *OutlookCalendar) Connect(ctx context.Context, state, code string) error {
+	return connectCalendar(ctx, o.OAuthConfig, o.TokenStore, o.Audit, o.Gate, &o.Log, o.StateSecret, CalendarProviderMicrosoft, state, code)
+}
+
+// CreateEvent creates a calendar event for the user with the meeting url as
+// the online meeting url and returns a link to the event.
+func (o *OutlookCalendar) CreateEvent(teamID, userID string, ev CalendarEvent) (string, error) {
+	ctx := context.Background()
+	client, err := calendarClient(ctx, o.OAuthConfig, o.TokenStore, o.Audit, &o.Log, teamID, userID, CalendarProviderMicrosoft)
+	if err != nil {
+		return "", err
+	}
+
+	type eventTime struct {
+		DateTime string `json:"dateTime"`
+		TimeZone string `json:"timeZone"`
+	}
+	type emailAddress struct {
+		Address string `json:"address"`
+	}
+	type attendee struct {
+		EmailAddress emailAddress `json:"emailAddress"`
+		Type         string       `json:"type"`
+	}
+	type itemBody struct {
+		ContentType string `json:"contentType"`
+		Content     string `json:"content"`
+	}
+	type location struct {
+		DisplayName string `json:"displayName"`
+		LocationURI string `json:"locationUri"`
+	}
+	body := struct {
+		Subject          string     `json:"subject"`
+		Body             itemBody   `json:"body"`
+		Start            eventTime  `json:"start"`
+		End              eventTime  `json:"end"`
+		Location         location   `json:"location"`
+		OnlineMeetingURL string     `json:"onlineMeetingUrl"`
+		Attendees        []attendee `json:"attendees,omitempty"`
+	}{
+		Subject: ev.Title,
+		Body: itemBody{
+			ContentType: "HTML",
+			Content:     fmt.Sprintf(`Join the meeting: <a href="%s">%s</a>`, ev.URL, ev.URL),
+		},
+		Start:            eventTime{DateTime: ev.Start.UTC().Format(graphDateTime), TimeZone: "UTC"},
+		End:              eventTime{DateTime: ev.End.UTC().Format(graphDateTime), TimeZone: "UTC"},
+		Location:         location{DisplayName: ev.URL, LocationURI: ev.URL},
+		OnlineMeetingURL: ev.URL,
+	}
+	for _, email := range ev.Attendees {
+		body.Attendees = append(body.Attendees, attendee{
+			EmailAddress: emailAddress{Address: email},
+			Type:         "required",
+		})
+	}
+
+	var created struct {
+		WebLink string `json:"webLink"`
+	}
+	err = postCalendarJSON(client, graphEventsURL, body, &created)
+	if err != nil {
+		return "", err
+	}
+	return created.WebLink, nil
+}
@@ -0,0 +1,129 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const (
+	// KeyCalendarTokenID is the dynamo key for a calendar token. This key is
+	// the primary index and is composed of the team, user and provider.
+	KeyCalendarTokenID = "token-id"
+	// KeyCalendarAccessToken is the dynamo key for the oauth access token.
+	KeyCalendarAccessToken = "access-token"
+	// KeyCalendarRefreshToken is the dynamo key for the oauth refresh token.
+	KeyCalendarRefreshToken = "refresh-token"
+	// KeyCalendarExpiry is the dynamo key for the access token expiry.
+	KeyCalendarExpiry = "expiry"
+
+	// CalendarProviderGoogle identifies tokens issued by Google.
+	CalendarProviderGoogle = "google"
+	// CalendarProviderMicrosoft identifies tokens issued by Microsoft.
+	CalendarProviderMicrosoft = "microsoft"
+)
+
+// CalendarTokenData is the oauth token data stored for a user's calendar.
+type CalendarTokenData struct {
+	TeamID       string
+	UserID       string
+	Provider     string
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+// CalendarTokenStore stores and retrieves per-user calendar oauth tokens
+// from aws dynamodb.
+type CalendarTokenStore struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+func calendarTokenID(teamID, userID, provider string) string {
+	return fmt.Sprintf("%s/%s/%s", teamID, userID, provider)
+}
+
+// Get retrieves the calendar token stored for the user of a team.
+func (c *CalendarTokenStore) Get(teamID, userID, provider string) (*CalendarTokenData, error) {
+	id := calendarTokenID(teamID, userID, provider)
+	keyCond := expression.Key(KeyCalendarTokenID).Equal(expression.Value(id))
+	builder := expression.NewBuilder().WithKeyCondition(keyCond)
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	queryInput := &dynamodb.QueryInput{
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		TableName:                 aws.String(c.TableName),
+	}
+	result, err := c.DB.Query(context.TODO(), queryInput)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) < 1 {
+		return nil, errors.New(errMissingCalendarToken)
+	}
+
+	var item map[string]string
+	err = attributevalue.UnmarshalMap(result.Items[0], &item)
+	if err != nil {
+		return nil, err
+	}
+	expiry, err := time.Parse(time.RFC3339, item[KeyCalendarExpiry])
+	if err != nil {
+		return nil, err
+	}
+
+	return &CalendarTokenData{
+		TeamID:       teamID,
+		UserID:       userID,
+		Provider:     provider,
+		AccessToken:  item[KeyCalendarAccessToken],
+		RefreshToken: item[KeyCalendarRefreshToken],
+		Expiry:       expiry,
+	}, nil
+}
+
+// Store will store calendar token data for a user.
+func (c *CalendarTokenStore) Store(data *CalendarTokenData) error {
+	av, err := attributevalue.MarshalMap(map[string]string{
+		KeyCalendarTokenID:      calendarTokenID(data.TeamID, data.UserID, data.Provider),
+		KeyCalendarAccessToken:  data.AccessToken,
+		KeyCalendarRefreshToken: data.RefreshToken,
+		KeyCalendarExpiry:       data.Expiry.Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(c.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// Remove will remove the calendar token data for a user.
+func (c *CalendarTokenStore) Remove(teamID, userID, provider string) error {
+	av, err := attributevalue.MarshalMap(map[string]string{
+		KeyCalendarTokenID: calendarTokenID(teamID, userID, provider),
+	})
+	if err != nil {
+		return err
+	}
+	dii := &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.TableName),
+		Key:       av,
+	}
+	_, err = c.DB.DeleteItem(context.TODO(), dii)
+	return err
+}
@@ -0,0 +1,121 @@
+package jitsi
+
+import (
+	"encoding/json"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// callbackConfirmChannelInvite is the callback id of the modal asking a
+	// host to confirm inviting a large channel. The private metadata of the
+	// modal is a json encoded channelInviteRequest.
+	callbackConfirmChannelInvite = "confirm_channel_invite"
+
+	// channelMembersPageSize is the page size used to list channel members.
+	channelMembersPageSize = 200
+	// usersInfoBatchSize is the number of users looked up per request.
+	usersInfoBatchSize = 30
+)
+
+// channelInviteRequest is a pending request to invite the members of a
+// channel to a meeting.
+type channelInviteRequest struct {
+	ChannelID   string `json:"c"`
+	ChannelName string `json:"cn"`
+	TeamName    string `json:"n"`
+	HostID      string `json:"h"`
+}
+
+// channelMembers lists the human members of a channel other than the host.
+func channelMembers(token, channelID, hostID string) ([]string, error) {
+	slackClient := slack.New(token)
+	var ids []string
+	cursor := ""
+	for {
+		page, next, err := slackClient.GetUsersInConversation(&slack.GetUsersInConversationParameters{
+			ChannelID: channelID,
+			Cursor:    cursor,
+			Limit:     channelMembersPageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	var members []string
+	for start := 0; start < len(ids); start += usersInfoBatchSize {
+		end := start + usersInfoBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		users, err := slackClient.GetUsersInfo(ids[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range *users {
+			if user.IsBot || user.Deleted || user.ID == "USLACKBOT" || user.ID == hostID {
+				continue
+			}
+			members = append(members, user.ID)
+		}
+	}
+	return members, nil
+}
+
+// inviteMembers sends personal invites to each member, or queues them when
+// a queue is configured, and returns the invites that were sent along with
+// the number of members that were invited. The error of the last failed
+// invite is returned alongside the invites that were sent.
+func inviteMembers(queue InviteQueue, token, teamID, hostID string, members []string, meeting *Meeting, style messageStyle) ([]*Invite, int, error) {
+	var invites []*Invite
+	var lastErr error
+	invited := 0
+	for _, userID := range members {
+		invite, err := sendOrQueueInvite(queue, token, teamID, hostID, userID, meeting, style)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		invited++
+		if invite != nil {
+			invites = append(invites, invite)
+		}
+	}
+	return invites, invited, lastErr
+}
+
+// confirmChannelInviteView creates the modal asking a host to confirm
+// sending invites to every member of a large channel.
+func confirmChannelInviteView(locale string, req channelInviteRequest, memberCount int) (slack.ModalViewRequest, error) {
+	metadata, err := json.Marshal(req)
+	if err != nil {
+		return slack.ModalViewRequest{}, err
+	}
+	msg := tr(locale, "channel.confirm.text", memberCount, req.ChannelID)
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      callbackConfirmChannelInvite,
+		PrivateMetadata: string(metadata),
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "channel.confirm.title"), false, false),
+		Submit:          slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "channel.confirm.submit"), false, false),
+		Close:           slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "button.cancel"), false, false),
+		Blocks: slack.Blocks{
+			BlockSet: []slack.Block{
+				slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, msg, false, false), nil, nil),
+			},
+		},
+	}, nil
+}
+
+func channelInviteSummary(locale string, sent, members int) []slack.Block {
+	msg := tr(locale, "channel.summary", sent, members)
+	return []slack.Block{
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, msg, false, false)),
+	}
+}
@@ -0,0 +1,131 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// KeyChannelRoomTeamID is the dynamo key for the team of a channel
+	// room. This key is the partition key.
+	KeyChannelRoomTeamID = "team-id"
+	// KeyChannelRoomChannelID is the dynamo key for the channel a room is
+	// bound to. This key is the sort key.
+	KeyChannelRoomChannelID = "channel-id"
+
+	errMissingChannelRoom = "missing_channel_room"
+	errChannelRoomExists  = "channel_room_exists"
+)
+
+// ChannelRoom is the standing room of a channel.
+type ChannelRoom struct {
+	TeamID    string `dynamodbav:"team-id"`
+	ChannelID string `dynamodbav:"channel-id"`
+	RoomName  string `dynamodbav:"room"`
+	CreatedAt int64  `dynamodbav:"created-at"`
+}
+
+// ChannelRoomReadWriter provides an interface for reading and creating the
+// standing rooms of channels.
+type ChannelRoomReadWriter interface {
+	Get(teamID, channelID string) (*ChannelRoom, error)
+	Create(room *ChannelRoom) error
+}
+
+// newChannelRoom creates the standing room of a channel. The room is named
+// after the channel with a random suffix so the name cannot be guessed and
+// renaming the channel keeps the room.
+func newChannelRoom(teamID, channelID, channelName string) *ChannelRoom {
+	name, err := sanitizeRoomName(channelName)
+	if err != nil {
+		name, _ = sanitizeRoomName(channelID)
+	}
+	return &ChannelRoom{
+		TeamID:    teamID,
+		ChannelID: channelID,
+		RoomName:  uniqueRoomName(name),
+		CreatedAt: time.Now().Unix(),
+	}
+}
+
+// channelRoom retrieves the standing room of a channel, creating it on first
+// use.
+func channelRoom(rooms ChannelRoomReadWriter, teamID, channelID, channelName string) (*ChannelRoom, error) {
+	room, err := rooms.Get(teamID, channelID)
+	if err == nil || err.Error() != errMissingChannelRoom {
+		return room, err
+	}
+	room = newChannelRoom(teamID, channelID, channelName)
+	err = rooms.Create(room)
+	if err != nil && err.Error() == errChannelRoomExists {
+		// another request created the room first
+		return rooms.Get(teamID, channelID)
+	}
+	return room, err
+}
+
+// ChannelRoomStore stores and retrieves channel rooms from aws dynamodb.
+type ChannelRoomStore struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+// Get retrieves the standing room of a channel.
+func (c *ChannelRoomStore) Get(teamID, channelID string) (*ChannelRoom, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyChannelRoomTeamID:    teamID,
+		KeyChannelRoomChannelID: channelID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.DB.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(c.TableName),
+		Key:       key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, errors.New(errMissingChannelRoom)
+	}
+
+	var room ChannelRoom
+	err = attributevalue.UnmarshalMap(result.Item, &room)
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// Create persists a new channel room. The room of a channel is never
+// replaced so recurring calls keep landing in the same place.
+func (c *ChannelRoomStore) Create(room *ChannelRoom) error {
+	av, err := attributevalue.MarshalMap(room)
+	if err != nil {
+		return err
+	}
+	cond := expression.AttributeNotExists(expression.Name(KeyChannelRoomChannelID))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+	_, err = c.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:                aws.String(c.TableName),
+		Item:                     av,
+		ConditionExpression:      expr.Condition(),
+		ExpressionAttributeNames: expr.Names(),
+	})
+	var exists *types.ConditionalCheckFailedException
+	if errors.As(err, &exists) {
+		return errors.New(errChannelRoomExists)
+	}
+	return err
+}
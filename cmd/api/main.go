@@ -7,11 +7,20 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"time"
+	_ "time/tzdata" // user timezones are needed in minimal containers
 
+	"cloud.google.com/go/firestore"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	env "github.com/caarlos0/env/v6"
+	"github.com/go-redis/redis/v8"
 	jitsi "github.com/jitsi/jitsi-slack"
 	stats "github.com/jitsi/prometheus-stats"
 	"github.com/justinas/alice"
@@ -27,16 +36,147 @@ type appCfg struct {
 	SlackClientSecret   string `env:"SLACK_CLIENT_SECRET,required"`
 	SlackAppID          string `env:"SLACK_APP_ID,required"`
 	SlackAppSharableURL string `env:"SLACK_APP_SHARABLE_URL,required"`
+	SlackAuthorizeURL   string `env:"SLACK_AUTHORIZE_URL"`
+	// additional apps as app-id:client-id:client-secret:signing-secret (optional)
+	SlackApps []string `env:"SLACK_APPS" envSeparator:","`
+	// previous signing secret accepted while rotating it (optional)
+	SlackSecondarySigningSecret string `env:"SLACK_SECONDARY_SIGNING_SECRET"`
+	// scopes a reinstall is asked for when missing (optional)
+	SlackRequiredScopes []string `env:"SLACK_REQUIRED_SCOPES" envSeparator:","`
 	// jitsi configuration
 	JitsiTokenSigningKey string `env:"JITSI_TOKEN_SIGNING_KEY,required"`
 	JitsiTokenKid        string `env:"JITSI_TOKEN_KID,required"`
 	JitsiTokenIssuer     string `env:"JITSI_TOKEN_ISS,required"`
 	JitsiTokenAudience   string `env:"JITSI_TOKEN_AUD,required"`
 	JitsiConferenceHost  string `env:"JITSI_CONFERENCE_HOST,required"`
+	// room collision avoidance on shared servers (optional)
+	TenantScopedServers []string `env:"TENANT_SCOPED_SERVERS" envSeparator:","`
+	RoomTeamPrefix      bool     `env:"ROOM_TEAM_PREFIX"`
+	// end meeting api configuration (optional)
+	JitsiEndMeetingURL string `env:"JITSI_END_MEETING_URL"`
+	JitsiMUCDomain     string `env:"JITSI_MUC_DOMAIN"`
+	// room password configuration (optional)
+	JitsiRoomPasswordURL string        `env:"JITSI_ROOM_PASSWORD_URL"`
+	JitsiLiveStreamURL   string        `env:"JITSI_LIVE_STREAM_URL"`
+	JitsiTranscription   bool          `env:"JITSI_TRANSCRIPTION"`
+	MeetingTTL           time.Duration `env:"MEETING_TTL"`
+	// dial-in configuration (optional)
+	JitsiConferenceMapperURL string `env:"JITSI_CONFERENCE_MAPPER_URL"`
+	JitsiPhoneNumberListURL  string `env:"JITSI_PHONE_NUMBER_LIST_URL"`
+	// storage backend configuration
+	StoreBackend string `env:"STORE_BACKEND" envDefault:"dynamodb"`
+	// redis configuration for the redis backend or cache (optional)
+	RedisURL    string        `env:"REDIS_URL"`
+	RedisPrefix string        `env:"REDIS_PREFIX"`
+	RedisTTL    time.Duration `env:"REDIS_TTL"`
+	RedisCache  bool          `env:"REDIS_CACHE"`
+	// data file of the bolt backend
+	BoltPath string `env:"BOLT_PATH" envDefault:"jitsi-slack.db"`
+	// google cloud project of the firestore backend, detected from the
+	// credentials when empty (optional)
+	FirestoreProject string `env:"FIRESTORE_PROJECT"`
+	// connection string and database of the mongodb backend
+	MongoURI      string `env:"MONGO_URI"`
+	MongoDatabase string `env:"MONGO_DATABASE"`
 	// dynamodb configuration
-	TokenTable     string `env:"TOKEN_TABLE,required"`
-	ServerCfgTable string `env:"SERVER_CFG_TABLE,required"`
-	DynamoRegion   string `env:"DYNAMO_REGION,required"`
+	TokenTable     string `env:"TOKEN_TABLE"`
+	ServerCfgTable string `env:"SERVER_CFG_TABLE"`
+	DynamoRegion   string `env:"DYNAMO_REGION"`
+	// regions of the global tables including the region of the instance,
+	// which enable checking its replica in health checks (optional)
+	DynamoReplicaRegions []string `env:"DYNAMO_REPLICA_REGIONS" envSeparator:","`
+	// strongly consistent reads of the token and server config tables
+	// (optional)
+	DynamoConsistentReads bool `env:"DYNAMO_CONSISTENT_READS"`
+	// retries of throttled dynamodb requests
+	DynamoMaxAttempts int           `env:"DYNAMO_MAX_ATTEMPTS" envDefault:"5"`
+	DynamoMaxBackoff  time.Duration `env:"DYNAMO_MAX_BACKOFF" envDefault:"1s"`
+	// dax cluster caching the token and server config tables (optional)
+	DAXEndpoint string `env:"DAX_ENDPOINT"`
+	// in-process cache of the server configuration of teams, invalidated by
+	// the stream of the server config table when configured (optional)
+	ServerCfgCacheTTL           time.Duration `env:"SERVER_CFG_CACHE_TTL"`
+	ServerCfgStreamARN          string        `env:"SERVER_CFG_STREAM_ARN"`
+	ServerCfgStreamPollInterval time.Duration `env:"SERVER_CFG_STREAM_POLL_INTERVAL" envDefault:"5s"`
+	// how often secrets referenced in secrets manager or ssm are refreshed
+	SecretRefreshInterval time.Duration `env:"SECRET_REFRESH_INTERVAL" envDefault:"5m"`
+	// vault secrets may be referenced once configured (optional)
+	VaultAddr      string `env:"VAULT_ADDR"`
+	VaultToken     string `env:"VAULT_TOKEN"`
+	VaultNamespace string `env:"VAULT_NAMESPACE"`
+	// kms key stored tokens are encrypted with (optional)
+	TokenKMSKeyID string `env:"TOKEN_KMS_KEY_ID"`
+	// google calendar configuration (optional)
+	GoogleClientID     string `env:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret string `env:"GOOGLE_CLIENT_SECRET"`
+	GoogleRedirectURL  string `env:"GOOGLE_REDIRECT_URL"`
+	// microsoft 365 calendar configuration (optional)
+	MicrosoftClientID     string `env:"MICROSOFT_CLIENT_ID"`
+	MicrosoftClientSecret string `env:"MICROSOFT_CLIENT_SECRET"`
+	MicrosoftRedirectURL  string `env:"MICROSOFT_REDIRECT_URL"`
+	MicrosoftTenant       string `env:"MICROSOFT_TENANT" envDefault:"common"`
+	CalendarTokenTable    string `env:"CALENDAR_TOKEN_TABLE"`
+	// invite reminder configuration (optional)
+	InviteTable         string        `env:"INVITE_TABLE"`
+	InviteReminderDelay time.Duration `env:"INVITE_REMINDER_DELAY" envDefault:"5m"`
+	InviteRetention     time.Duration `env:"INVITE_RETENTION" envDefault:"720h"`
+	// durable invite queue configuration (optional)
+	InviteQueueURL     string `env:"INVITE_QUEUE_URL"`
+	InviteDLQURL       string `env:"INVITE_DLQ_URL"`
+	InviteMaxAttempts  int    `env:"INVITE_MAX_ATTEMPTS" envDefault:"5"`
+	InviteQueueWorkers int    `env:"INVITE_QUEUE_WORKERS" envDefault:"4"`
+	// meeting tracking configuration (optional)
+	MeetingTable     string `env:"MEETING_TABLE"`
+	MeetingRoomIndex string `env:"MEETING_ROOM_INDEX" envDefault:"room-index"`
+	// how long meetings are kept before the table purges them (optional)
+	MeetingRetention time.Duration `env:"MEETING_RETENTION"`
+	// conference event configuration (optional)
+	ConferenceEventSecret string `env:"CONFERENCE_EVENT_SECRET"`
+	// personal room configuration (optional)
+	PersonalRoomTable string `env:"PERSONAL_ROOM_TABLE"`
+	ChannelRoomTable  string `env:"CHANNEL_ROOM_TABLE"`
+	// user preferences configuration (optional)
+	UserPrefsTable string `env:"USER_PREFS_TABLE"`
+	// identity mapping and sign in with slack configuration (optional)
+	IdentityTable       string `env:"IDENTITY_TABLE"`
+	SlackSignInRedirect string `env:"SLACK_SIGNIN_REDIRECT_URL"`
+	// audit log configuration (optional)
+	AuditTable     string `env:"AUDIT_TABLE"`
+	AdminAPISecret string `env:"ADMIN_API_SECRET"`
+	// config change history, which enables rolling changes back (optional)
+	ConfigHistoryTable     string        `env:"CONFIG_HISTORY_TABLE"`
+	ConfigHistoryRetention time.Duration `env:"CONFIG_HISTORY_RETENTION" envDefault:"2160h"`
+	// team blocklist and allowlist configuration (optional)
+	TeamAccessTable string `env:"TEAM_ACCESS_TABLE"`
+	TeamAllowlist   bool   `env:"TEAM_ALLOWLIST"`
+	// usage report configuration (optional)
+	UsageTable string `env:"USAGE_TABLE"`
+	// feedback configuration (optional)
+	FeedbackTable   string `env:"FEEDBACK_TABLE"`
+	FeedbackWebhook string `env:"FEEDBACK_WEBHOOK_URL"`
+	// message template configuration (optional)
+	MessageCfgTable string `env:"MESSAGE_CFG_TABLE"`
+	// channel invite configuration
+	ChannelInviteConfirmSize int `env:"CHANNEL_INVITE_CONFIRM_SIZE" envDefault:"25"`
+	// async command configuration
+	AsyncCommands bool `env:"ASYNC_COMMANDS" envDefault:"true"`
+	// retried delivery configuration
+	DeliveryTable string        `env:"DELIVERY_TABLE"`
+	DeliveryTTL   time.Duration `env:"DELIVERY_TTL" envDefault:"1h"`
+	// meeting and invite rate limit configuration (optional)
+	RateLimitTable   string        `env:"RATE_LIMIT_TABLE"`
+	RateLimitWindow  time.Duration `env:"RATE_LIMIT_WINDOW" envDefault:"1m"`
+	TeamMeetingLimit int           `env:"TEAM_MEETING_LIMIT"`
+	UserMeetingLimit int           `env:"USER_MEETING_LIMIT"`
+	TeamInviteLimit  int           `env:"TEAM_INVITE_LIMIT"`
+	UserInviteLimit  int           `env:"USER_INVITE_LIMIT"`
+	// room name configuration
+	RoomNameBlocklist []string `env:"ROOM_NAME_BLOCKLIST" envSeparator:","`
+	// localization configuration
+	DefaultLocale string `env:"DEFAULT_LOCALE" envDefault:"en"`
+	LocaleDir     string `env:"LOCALE_DIR"`
+	// install landing page overrides (optional)
+	PageDir string `env:"PAGE_DIR"`
 	// application configuration
 	HTTPPort  string `env:"HTTP_PORT" envDefault:"8080"`
 	StatsPort string `env:"STATS_PORT" envDefault:"0"`
@@ -49,6 +189,11 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		return
+	}
+
 	// Extract app configuration from env variables.
 	app := appCfg{}
 	err := env.Parse(&app)
@@ -56,15 +201,104 @@ func main() {
 		log.Fatal().Err(err).Msg("service is misconfigured")
 	}
 
-	// set up acces to dynamodb stores
+	slackApps, err := jitsi.ParseSlackApps(app.SlackApps)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot parse slack apps")
+	}
+	jitsi.ExtendRoomNameBlocklist(app.RoomNameBlocklist)
+	jitsi.SetDefaultLocale(app.DefaultLocale)
+	if app.LocaleDir != "" {
+		err = jitsi.LoadTranslations(app.LocaleDir)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot load translations")
+		}
+	}
+	if app.PageDir != "" {
+		err = jitsi.LoadPages(app.PageDir)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot load pages")
+		}
+	}
+
+	// set up acces to dynamodb stores, which the dynamodb backend and the
+	// tables of the optional features require
+	if app.DynamoRegion == "" && (app.StoreBackend == jitsi.StoreBackendDynamoDB || app.StoreBackend == "") {
+		log.Fatal().Msg("service is misconfigured: DYNAMO_REGION is required")
+	}
+	if tables := featureTables(&app); app.DynamoRegion == "" && len(tables) > 0 {
+		log.Fatal().Msgf("service is misconfigured: DYNAMO_REGION is required by %s", strings.Join(tables, ", "))
+	}
+	// With global tables, every instance reads and writes the replica of its
+	// region.
+	var replicaRegion string
+	if len(app.DynamoReplicaRegions) > 0 {
+		if !hasRegion(app.DynamoReplicaRegions, app.DynamoRegion) {
+			log.Fatal().Msg("service is misconfigured: DYNAMO_REGION is not one of DYNAMO_REPLICA_REGIONS")
+		}
+		replicaRegion = app.DynamoRegion
+	}
 	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(app.DynamoRegion))
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot start service w/o aws session")
 	}
-	svc := dynamodb.NewFromConfig(cfg)
-	tokenStore := jitsi.TokenStore{
-		TableName: app.TokenTable,
-		DB:        svc,
+	// throttled requests are retried with jittered backoff
+	svc := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		o.Retryer = jitsi.NewDynamoRetryer(app.DynamoMaxAttempts, app.DynamoMaxBackoff)
+	})
+
+	// Secrets may be referenced in secrets manager, ssm parameter store or,
+	// once configured, vault instead of being set directly and are refreshed
+	// until shutdown.
+	secrets := &jitsi.SecretLoader{
+		Sources: map[string]jitsi.SecretSource{
+			jitsi.SchemeSecretsManager: &jitsi.SecretsManagerSource{Client: secretsmanager.NewFromConfig(cfg)},
+			jitsi.SchemeSSM:            &jitsi.SSMSource{Client: ssm.NewFromConfig(cfg)},
+		},
+		Interval: app.SecretRefreshInterval,
+		Log:      log,
+	}
+	var vault *jitsi.VaultSource
+	if app.VaultAddr != "" {
+		vault = &jitsi.VaultSource{
+			Address:   app.VaultAddr,
+			Token:     app.VaultToken,
+			Namespace: app.VaultNamespace,
+			Log:       log,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ttl, err := vault.Validate(ctx)
+		cancel()
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot validate vault token")
+		}
+		log.Info().Dur("ttl", ttl).Msg("vault token validated")
+		vault.Start()
+		secrets.Sources[jitsi.SchemeVault] = vault
+	}
+	signingSecret, err := secrets.Load(app.SlackSigningSecret)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load slack signing secret")
+	}
+	clientSecret, err := secrets.Load(app.SlackClientSecret)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load slack client secret")
+	}
+	tokenSigningKey, err := secrets.Load(app.JitsiTokenSigningKey)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load jitsi token signing key")
+	}
+	secrets.Start()
+	// States are signed with the signing secret the service started with so
+	// that pending states stay valid when it is rotated.
+	stateSecret := signingSecret.Value()
+
+	// Tokens are only encrypted at rest once configured.
+	var tokenCipher jitsi.TokenCipher
+	if app.TokenKMSKeyID != "" {
+		tokenCipher = &jitsi.KMSTokenCipher{
+			Client: kms.NewFromConfig(cfg),
+			KeyID:  app.TokenKMSKeyID,
+		}
 	}
 
 	authTenantSupportTest := func(srv string) bool {
@@ -74,45 +308,608 @@ func main() {
 		return false
 	}
 
-	srvCfgStore := jitsi.ServerCfgStore{
-		TableName:               app.ServerCfgTable,
-		DB:                      svc,
-		DefaultServer:           app.JitsiConferenceHost,
-		TenantScopedURLs:        authTenantSupportTest,
-		AuthenticatedURLSupport: authTenantSupportTest,
+	tenantScopedTest := func(srv string) bool {
+		for _, s := range app.TenantScopedServers {
+			if strings.TrimSuffix(s, "/") == srv {
+				return true
+			}
+		}
+		return authTenantSupportTest(srv)
+	}
+
+	// Tokens and server configuration are stored by the configured storage
+	// backend, which redis may cache.
+	var redisClient *redis.Client
+	if app.RedisURL != "" {
+		opts, err := redis.ParseURL(app.RedisURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot parse redis url")
+		}
+		redisClient = redis.NewClient(opts)
+	}
+	storeCfg := jitsi.StoreConfig{
+		Backend:           app.StoreBackend,
+		DB:                svc,
+		TokenTable:        app.TokenTable,
+		ServerCfgTable:    app.ServerCfgTable,
+		ConsistentReads:   app.DynamoConsistentReads,
+		RedisPrefix:       app.RedisPrefix,
+		RedisTTL:          app.RedisTTL,
+		RedisCache:        app.RedisCache,
+		ServerCfgCacheTTL: app.ServerCfgCacheTTL,
+		Cipher:            tokenCipher,
+		ServerDefaults: jitsi.ServerDefaults{
+			DefaultServer:           app.JitsiConferenceHost,
+			TenantScopedURLs:        tenantScopedTest,
+			AuthenticatedURLSupport: authTenantSupportTest,
+			TeamRoomPrefix:          app.RoomTeamPrefix,
+		},
+	}
+	if redisClient != nil {
+		storeCfg.Redis = redisClient
+	}
+	var daxClient *jitsi.DAXClient
+	if app.DAXEndpoint != "" {
+		daxClient, err = jitsi.NewDAXClient(app.DAXEndpoint, app.DynamoRegion)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot connect to dax cluster")
+		}
+		storeCfg.DAX = daxClient
+	}
+	if app.StoreBackend == jitsi.StoreBackendBolt {
+		storeCfg.Bolt, err = jitsi.OpenBoltDB(app.BoltPath)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", app.BoltPath).Msg("cannot open data file")
+		}
+	}
+	if app.StoreBackend == jitsi.StoreBackendFirestore {
+		project := app.FirestoreProject
+		if project == "" {
+			project = firestore.DetectProjectID
+		}
+		storeCfg.Firestore, err = firestore.NewClient(context.Background(), project)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot create firestore client")
+		}
+	}
+	if app.StoreBackend == jitsi.StoreBackendMongoDB {
+		storeCfg.Mongo, err = jitsi.ConnectMongoDB(app.MongoURI, app.MongoDatabase)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot connect to mongodb")
+		}
+	}
+	stores, err := jitsi.NewStores(storeCfg)
+	if err != nil {
+		log.Fatal().Err(err).Str("backend", app.StoreBackend).Msg("cannot set up stores")
+	}
+	tokenStore, srvCfgStore := stores.Tokens, stores.ServerConfig
+
+	// Cached server configuration is only invalidated from the stream of
+	// the server config table once configured, which lets every instance
+	// see changes made by the others before the cache expires.
+	var srvCfgInvalidator *jitsi.ServerCfgStreamInvalidator
+	if app.ServerCfgStreamARN != "" {
+		cache, ok := srvCfgStore.(*jitsi.MemoryServerCfgCache)
+		if !ok {
+			log.Fatal().Msg("server config stream requires SERVER_CFG_CACHE_TTL")
+		}
+		srvCfgInvalidator = &jitsi.ServerCfgStreamInvalidator{
+			Client:       dynamodbstreams.NewFromConfig(cfg),
+			StreamARN:    app.ServerCfgStreamARN,
+			Cache:        cache,
+			PollInterval: app.ServerCfgStreamPollInterval,
+			Log:          log,
+		}
+		srvCfgInvalidator.Start()
+	}
+
+	// Security relevant actions are only audited once configured.
+	var audit jitsi.AuditWriter
+	var auditExport *jitsi.AuditExportHandler
+	if app.AuditTable != "" {
+		auditStore := &jitsi.AuditStore{
+			TableName: app.AuditTable,
+			DB:        svc,
+		}
+		audit = auditStore
+		if app.AdminAPISecret != "" {
+			auditExport = &jitsi.AuditExportHandler{
+				Secret: app.AdminAPISecret,
+				Audit:  auditStore,
+			}
+		}
+	}
+
+	// Teams are only blocked or restricted to an allowlist once configured.
+	var gate *jitsi.TeamGate
+	var teamAccess *jitsi.TeamAccessHandler
+	if app.TeamAccessTable != "" {
+		gate = &jitsi.TeamGate{
+			Access: &jitsi.TeamAccessStore{
+				TableName: app.TeamAccessTable,
+				DB:        svc,
+			},
+			Allowlist: app.TeamAllowlist,
+		}
+		if app.AdminAPISecret != "" {
+			teamAccess = &jitsi.TeamAccessHandler{
+				Secret: app.AdminAPISecret,
+				Gate:   gate,
+				Audit:  audit,
+			}
+		}
+	}
+
+	// Calendar integrations are only available once configured.
+	calendarTokenStore := jitsi.CalendarTokenStore{
+		TableName: app.CalendarTokenTable,
+		DB:        svc,
+	}
+	var googleCalendar, outlookCalendar jitsi.CalendarProvider
+	var calendars []jitsi.CalendarProvider
+	if app.GoogleClientID != "" {
+		googleCalendar = &jitsi.GoogleCalendar{
+			OAuthConfig: jitsi.NewGoogleOAuthConfig(
+				app.GoogleClientID,
+				app.GoogleClientSecret,
+				app.GoogleRedirectURL,
+			),
+			TokenStore:  &calendarTokenStore,
+			StateSecret: stateSecret,
+			Audit:       audit,
+			Gate:        gate,
+			Log:         log,
+		}
+		calendars = append(calendars, googleCalendar)
+	}
+	if app.MicrosoftClientID != "" {
+		outlookCalendar = &jitsi.OutlookCalendar{
+			OAuthConfig: jitsi.NewMicrosoftOAuthConfig(
+				app.MicrosoftClientID,
+				app.MicrosoftClientSecret,
+				app.MicrosoftRedirectURL,
+				app.MicrosoftTenant,
+			),
+			TokenStore:  &calendarTokenStore,
+			StateSecret: stateSecret,
+			Audit:       audit,
+			Gate:        gate,
+			Log:         log,
+		}
+		calendars = append(calendars, outlookCalendar)
+	}
+
+	// Message templates and branding are only available once configured.
+	var messageCfg jitsi.MessageConfigReadWriter
+	if app.MessageCfgTable != "" {
+		messageCfg = &jitsi.MessageCfgStore{
+			TableName: app.MessageCfgTable,
+			DB:        svc,
+		}
+	}
+
+	// Config changes are only recorded, and can only be rolled back, once
+	// configured.
+	var history *jitsi.ConfigHistory
+	var configChanges jitsi.ConfigChangeReadWriter
+	if app.ConfigHistoryTable != "" {
+		configChanges = &jitsi.ConfigHistoryStore{
+			TableName: app.ConfigHistoryTable,
+			DB:        svc,
+			Retention: app.ConfigHistoryRetention,
+		}
+		history = &jitsi.ConfigHistory{
+			Changes:       configChanges,
+			ServerConfig:  srvCfgStore,
+			MessageConfig: messageCfg,
+			DefaultServer: app.JitsiConferenceHost,
+		}
+	}
+
+	// Meeting tracking is only available once configured.
+	var meetings jitsi.MeetingReadWriter
+	if app.MeetingTable != "" {
+		meetings = &jitsi.MeetingStore{
+			TableName: app.MeetingTable,
+			RoomIndex: app.MeetingRoomIndex,
+			Retention: app.MeetingRetention,
+			DB:        svc,
+		}
+	}
+
+	// Personal rooms are only available once configured.
+	var personalRooms jitsi.PersonalRoomReadWriter
+	if app.PersonalRoomTable != "" {
+		personalRooms = &jitsi.PersonalRoomStore{
+			TableName: app.PersonalRoomTable,
+			DB:        svc,
+		}
+	}
+
+	// User preferences are only available once configured.
+	var userPrefs jitsi.UserPrefsReadWriter
+	if app.UserPrefsTable != "" {
+		userPrefs = &jitsi.UserPrefsStore{
+			TableName: app.UserPrefsTable,
+			DB:        svc,
+		}
+	}
+
+	// Identity mapping is only available once configured and users may only
+	// link their slack identity once sign in is also configured.
+	var identities jitsi.IdentityReadWriter
+	var signIn *jitsi.SlackSignIn
+	if app.IdentityTable != "" {
+		identities = &jitsi.IdentityStore{
+			TableName: app.IdentityTable,
+			DB:        svc,
+		}
+	}
+	if identities != nil && app.SlackSignInRedirect != "" {
+		signIn = &jitsi.SlackSignIn{
+			ClientID:     app.SlackClientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  app.SlackSignInRedirect,
+			StateSecret:  stateSecret,
+			Identities:   identities,
+			Gate:         gate,
+		}
+	}
+
+	// Usage reports are only available once configured.
+	var usage jitsi.UsageReadWriter
+	if app.UsageTable != "" {
+		usage = &jitsi.UsageStore{
+			TableName: app.UsageTable,
+			DB:        svc,
+		}
+	}
+
+	// Feedback is only collected once configured and only forwarded when
+	// it is also stored.
+	var feedback, feedbackWebhook jitsi.FeedbackWriter
+	if app.FeedbackTable != "" {
+		feedback = &jitsi.FeedbackStore{
+			TableName: app.FeedbackTable,
+			DB:        svc,
+		}
+		if app.FeedbackWebhook != "" {
+			feedbackWebhook = &jitsi.FeedbackWebhook{URL: app.FeedbackWebhook}
+		}
+	}
+
+	// Channel rooms are only available once configured.
+	var channelRooms jitsi.ChannelRoomReadWriter
+	if app.ChannelRoomTable != "" {
+		channelRooms = &jitsi.ChannelRoomStore{
+			TableName: app.ChannelRoomTable,
+			DB:        svc,
+		}
+	}
+
+	// Invite tracking is only available once configured.
+	tasks := &jitsi.DelayedTasks{}
+	// The settings of teams that uninstall the app are removed from every
+	// configured store.
+	var teamData []jitsi.TeamDataRemover
+	for _, store := range []interface{}{srvCfgStore, messageCfg, personalRooms, userPrefs, channelRooms, identities, configChanges} {
+		if remover, ok := store.(jitsi.TeamDataRemover); ok {
+			teamData = append(teamData, remover)
+		}
+	}
+
+	var inviteTracker *jitsi.InviteTracker
+	if app.InviteTable != "" {
+		inviteTracker = &jitsi.InviteTracker{
+			Invites: &jitsi.InviteStore{
+				TableName: app.InviteTable,
+				Retention: app.InviteRetention,
+				DB:        svc,
+			},
+			TokenReader:   tokenStore,
+			Tasks:         tasks,
+			ReminderDelay: app.InviteReminderDelay,
+			MessageConfig: messageCfg,
+			Log:           log,
+		}
+	}
+
+	// Personal invites are only queued once a queue is configured, so that
+	// they are sent even when the service restarts or the slack api fails.
+	var inviteQueue jitsi.InviteQueue
+	var inviteDispatcher *jitsi.InviteDispatcher
+	if app.InviteQueueURL != "" {
+		inviteQueue = &jitsi.SQSInviteQueue{
+			Client:        sqs.NewFromConfig(cfg),
+			QueueURL:      app.InviteQueueURL,
+			DeadLetterURL: app.InviteDLQURL,
+		}
+		inviteDispatcher = &jitsi.InviteDispatcher{
+			Queue:         inviteQueue,
+			TokenReader:   tokenStore,
+			MessageConfig: messageCfg,
+			InviteTracker: inviteTracker,
+			Meetings:      meetings,
+			MaxAttempts:   app.InviteMaxAttempts,
+			Workers:       app.InviteQueueWorkers,
+			Log:           log,
+		}
+		inviteDispatcher.Start()
+	}
+
+	// Meetings and invites are only rate limited once a limit is configured.
+	// The limits are shared by every instance when they are counted in a
+	// table or in mongodb.
+	var limits *jitsi.MeetingLimits
+	if app.TeamMeetingLimit > 0 || app.UserMeetingLimit > 0 || app.TeamInviteLimit > 0 || app.UserInviteLimit > 0 {
+		var limiter jitsi.RateLimiter = &jitsi.MemoryRateLimiter{}
+		if app.RateLimitTable != "" {
+			limiter = &jitsi.DynamoRateLimiter{
+				TableName: app.RateLimitTable,
+				DB:        svc,
+				Region:    replicaRegion,
+			}
+		} else if storeCfg.Mongo != nil {
+			limiter = &jitsi.MongoRateLimiter{DB: storeCfg.Mongo}
+		}
+		limits = &jitsi.MeetingLimits{
+			Limiter:      limiter,
+			TeamMeetings: jitsi.RateLimit{Count: app.TeamMeetingLimit, Window: app.RateLimitWindow},
+			UserMeetings: jitsi.RateLimit{Count: app.UserMeetingLimit, Window: app.RateLimitWindow},
+			TeamInvites:  jitsi.RateLimit{Count: app.TeamInviteLimit, Window: app.RateLimitWindow},
+			UserInvites:  jitsi.RateLimit{Count: app.UserInviteLimit, Window: app.RateLimitWindow},
+		}
+	}
+
+	// Data deletion requests delete the data of a team or a user from every
+	// configured store and export requests export the data of a team from
+	// them. The audit log is kept and records the deletion.
+	var calendarTokens, invites interface{}
+	if app.CalendarTokenTable != "" {
+		calendarTokens = &calendarTokenStore
+	}
+	if inviteTracker != nil {
+		invites = inviteTracker.Invites
+	}
+	var dataStores []jitsi.DataStore
+	for _, store := range []jitsi.DataStore{
+		{Name: "tokens", Store: tokenStore},
+		{Name: "server_config", Store: srvCfgStore},
+		{Name: "message_config", Store: messageCfg},
+		{Name: "config_history", Store: configChanges},
+		{Name: "calendar_tokens", Store: calendarTokens},
+		{Name: "meetings", Store: meetings},
+		{Name: "invites", Store: invites},
+		{Name: "personal_rooms", Store: personalRooms},
+		{Name: "channel_rooms", Store: channelRooms},
+		{Name: "preferences", Store: userPrefs},
+		{Name: "identities", Store: identities},
+		{Name: "usage", Store: usage},
+		{Name: "feedback", Store: feedback},
+	} {
+		if store.Store != nil {
+			dataStores = append(dataStores, store)
+		}
+	}
+	eraser := &jitsi.DataEraser{
+		Stores: dataStores,
+		Audit:  audit,
+	}
+	var dataDeletion *jitsi.DataDeletionHandler
+	var dataExport *jitsi.DataExportHandler
+	var backup *jitsi.BackupHandler
+	var configHistory *jitsi.ConfigHistoryHandler
+	if app.AdminAPISecret != "" {
+		dataDeletion = &jitsi.DataDeletionHandler{
+			Secret: app.AdminAPISecret,
+			Eraser: eraser,
+		}
+		dataExport = &jitsi.DataExportHandler{
+			Secret:   app.AdminAPISecret,
+			Exporter: &jitsi.DataExporter{Stores: dataStores},
+		}
+		backup = &jitsi.BackupHandler{
+			Secret:        app.AdminAPISecret,
+			Tokens:        tokenStore,
+			ServerConfig:  srvCfgStore,
+			DefaultServer: app.JitsiConferenceHost,
+		}
+		if history != nil {
+			configHistory = &jitsi.ConfigHistoryHandler{
+				Secret:  app.AdminAPISecret,
+				History: history,
+				Audit:   audit,
+			}
+		}
 	}
 
 	// Setup handlers for slash commands.
+	tokenGenerator := jitsi.TokenGenerator{
+		Lifetime:   time.Hour * 24,
+		PrivateKey: tokenSigningKey,
+		Issuer:     app.JitsiTokenIssuer,
+		Audience:   app.JitsiTokenAudience,
+		Kid:        app.JitsiTokenKid,
+	}
+	meetingGenerator := &jitsi.MeetingGenerator{
+		ServerConfigReader:    srvCfgStore,
+		MeetingTokenGenerator: tokenGenerator,
+		UserPrefs:             userPrefs,
+		Identities:            identities,
+		MeetingTTL:            app.MeetingTTL,
+	}
+	// Dial-in information is only available once configured.
+	if app.JitsiConferenceMapperURL != "" && app.JitsiPhoneNumberListURL != "" {
+		meetingGenerator.DialIn = &jitsi.ConferenceMapper{
+			Server:     app.JitsiConferenceHost,
+			MapperURL:  app.JitsiConferenceMapperURL,
+			NumbersURL: app.JitsiPhoneNumberListURL,
+			MUCDomain:  app.JitsiMUCDomain,
+		}
+	}
+
+	// Ending meetings on the server is only available once configured.
+	var roomEnder jitsi.RoomEnder
+	if app.JitsiEndMeetingURL != "" {
+		roomEnder = &jitsi.EndMeetingAPI{
+			Server:                app.JitsiConferenceHost,
+			Endpoint:              app.JitsiEndMeetingURL,
+			MUCDomain:             app.JitsiMUCDomain,
+			MeetingTokenGenerator: tokenGenerator,
+		}
+	}
+
+	// Meeting passcodes are only available once configured.
+	var roomLocker jitsi.RoomLocker
+	if app.JitsiRoomPasswordURL != "" {
+		roomLocker = &jitsi.RoomPasswordAPI{
+			Server:                app.JitsiConferenceHost,
+			Endpoint:              app.JitsiRoomPasswordURL,
+			MUCDomain:             app.JitsiMUCDomain,
+			MeetingTokenGenerator: tokenGenerator,
+		}
+	}
+	// Live streams are only available once configured.
+	var roomStreamer jitsi.RoomStreamer
+	if app.JitsiLiveStreamURL != "" {
+		roomStreamer = &jitsi.LiveStreamAPI{
+			Server:                app.JitsiConferenceHost,
+			Endpoint:              app.JitsiLiveStreamURL,
+			MUCDomain:             app.JitsiMUCDomain,
+			MeetingTokenGenerator: tokenGenerator,
+		}
+	}
+	// Announcements are only edited once meetings expire when expiry is
+	// configured and meetings are tracked.
+	var expiry *jitsi.MeetingExpiry
+	if app.MeetingTTL > 0 && meetings != nil {
+		expiry = &jitsi.MeetingExpiry{
+			Meetings:      meetings,
+			TokenReader:   tokenStore,
+			Tasks:         tasks,
+			MessageConfig: messageCfg,
+			Log:           log,
+		}
+	}
+	// install prompts only lead back to their channel when installs start
+	// at /slack/install
+	var installStateSecret string
+	if app.SlackAuthorizeURL != "" {
+		installStateSecret = stateSecret
+	}
 	slashCmd := jitsi.SlashCommandHandlers{
-		MeetingGenerator: &jitsi.MeetingGenerator{
-			ServerConfigReader: &srvCfgStore,
-			MeetingTokenGenerator: jitsi.TokenGenerator{
-				Lifetime:   time.Hour * 24,
-				PrivateKey: app.JitsiTokenSigningKey,
-				Issuer:     app.JitsiTokenIssuer,
-				Audience:   app.JitsiTokenAudience,
-				Kid:        app.JitsiTokenKid,
-			},
-		},
-		SlackSigningSecret: app.SlackSigningSecret,
-		SharableURL:        app.SlackAppSharableURL,
-		TokenReader:        &tokenStore,
-		TokenWriter:        &tokenStore,
-		ServerConfigWriter: &srvCfgStore,
+		MeetingGenerator:         meetingGenerator,
+		SharableURL:              app.SlackAppSharableURL,
+		RequiredScopes:           app.SlackRequiredScopes,
+		InstallStateSecret:       installStateSecret,
+		TokenReader:              tokenStore,
+		TokenWriter:              tokenStore,
+		ServerConfigWriter:       srvCfgStore,
+		InviteTracker:            inviteTracker,
+		ChannelInviteConfirmSize: app.ChannelInviteConfirmSize,
+		Calendars:                calendars,
+		MessageConfig:            messageCfg,
+		Meetings:                 meetings,
+		RoomEnder:                roomEnder,
+		RoomLocker:               roomLocker,
+		RoomStreamer:             roomStreamer,
+		Expiry:                   expiry,
+		Tasks:                    tasks,
+		Transcription:            app.JitsiTranscription,
+		PersonalRooms:            personalRooms,
+		ChannelRooms:             channelRooms,
+		UserPrefs:                userPrefs,
+		Usage:                    usage,
+		Feedback:                 feedback,
+		Identities:               identities,
+		SignIn:                   signIn,
+		Audit:                    audit,
+		History:                  history,
+		Eraser:                   eraser,
+		Limits:                   limits,
+		InviteQueue:              inviteQueue,
+		AsyncCommands:            app.AsyncCommands,
+	}
+
+	workflowStep := &jitsi.WorkflowStep{
+		TokenReader:      tokenStore,
+		MeetingGenerator: meetingGenerator,
+		Usage:            usage,
 	}
 
 	evHandle := jitsi.EventHandler{
-		SlackSigningSecret: app.SlackSigningSecret,
-		TokenWriter:        &tokenStore,
+		TokenWriter:  tokenStore,
+		TokenReader:  tokenStore,
+		WorkflowStep: workflowStep,
+		TeamData:     teamData,
+		UserTokens:   tokenStore,
+		Audit:        audit,
 	}
 
 	oauthHandler := jitsi.SlackOAuthHandlers{
 		ClientID:     app.SlackClientID,
-		ClientSecret: app.SlackClientSecret,
+		ClientSecret: clientSecret,
 		AppID:        app.SlackAppID,
-		TokenWriter:  &tokenStore,
+		TokenWriter:  tokenStore,
+		AuthorizeURL: app.SlackAuthorizeURL,
+		StateSecret:  stateSecret,
+		Apps:         slackApps,
+		UserTokens:   tokenStore,
+		Audit:        audit,
+		Gate:         gate,
+	}
+
+	interactionHandle := jitsi.InteractionHandler{
+		TokenReader:        tokenStore,
+		MeetingGenerator:   meetingGenerator,
+		InviteTracker:      inviteTracker,
+		ServerConfigWriter: srvCfgStore,
+		DefaultServer:      app.JitsiConferenceHost,
+		MessageConfig:      messageCfg,
+		Meetings:           meetings,
+		Usage:              usage,
+		Feedback:           feedback,
+		FeedbackWebhook:    feedbackWebhook,
+		WorkflowStep:       workflowStep,
+		Audit:              audit,
+		History:            history,
+		Limits:             limits,
+		InviteQueue:        inviteQueue,
+	}
+
+	// Conference and recording events are only accepted once configured.
+	var confEvents *jitsi.ConferenceEventHandler
+	var recordings *jitsi.RecordingHandler
+	var streams *jitsi.StreamHandler
+	var transcripts *jitsi.TranscriptHandler
+	if app.ConferenceEventSecret != "" && meetings != nil {
+		confEvents = &jitsi.ConferenceEventHandler{
+			Secret:        app.ConferenceEventSecret,
+			Meetings:      meetings,
+			TokenReader:   tokenStore,
+			MessageConfig: messageCfg,
+		}
+		recordings = &jitsi.RecordingHandler{
+			Secret:      app.ConferenceEventSecret,
+			Meetings:    meetings,
+			TokenReader: tokenStore,
+		}
+		streams = &jitsi.StreamHandler{
+			Secret:      app.ConferenceEventSecret,
+			Meetings:    meetings,
+			TokenReader: tokenStore,
+		}
+		transcripts = &jitsi.TranscriptHandler{
+			Secret:      app.ConferenceEventSecret,
+			Meetings:    meetings,
+			TokenReader: tokenStore,
+		}
+		slashCmd.LiveAnnouncements = true
 	}
 
+	googleOAuth := jitsi.CalendarOAuthHandlers{Calendar: googleCalendar}
+	microsoftOAuth := jitsi.CalendarOAuthHandlers{Calendar: outlookCalendar}
+
 	// Create an http mux and a server for that mux.
 	handler := http.NewServeMux()
 	addr := fmt.Sprintf(":%s", app.HTTPPort)
@@ -147,10 +944,87 @@ func main() {
 		hlog.RequestIDHandler("req_id", "Request-Id"),
 	)
 
+	// Requests from slack are verified before they reach the handlers.
+	verifier := &jitsi.RequestVerifier{
+		SigningSecret:          signingSecret,
+		SecondarySigningSecret: app.SlackSecondarySigningSecret,
+		Apps:                   slackApps,
+	}
+	// Bodies are limited and their content type checked before any parsing.
+	slashChain := chain.Append(jitsi.LimitRequest(jitsi.DefaultMaxBodySize, jitsi.ContentTypeForm), verifier.Verify)
+	eventChain := chain.Append(jitsi.LimitRequest(jitsi.DefaultMaxBodySize, jitsi.ContentTypeJSON), verifier.Verify)
+	// Verified requests of teams that may not use the service are denied.
+	if gate != nil {
+		slashChain = slashChain.Append(gate.Check)
+		eventChain = eventChain.Append(gate.Check)
+	}
+	// Retried deliveries are acknowledged without being handled again. They
+	// are recognized by every instance when deliveries are kept in a table
+	// or in mongodb.
+	var deliveries jitsi.DeliveryCache = &jitsi.MemoryDeliveryCache{}
+	if app.DeliveryTable != "" {
+		deliveries = &jitsi.DynamoDeliveryCache{
+			TableName: app.DeliveryTable,
+			DB:        svc,
+		}
+	} else if storeCfg.Mongo != nil {
+		deliveries = &jitsi.MongoDeliveryCache{DB: storeCfg.Mongo}
+	}
+	dedupe := &jitsi.Deduplicator{
+		Cache: deliveries,
+		TTL:   app.DeliveryTTL,
+	}
+	slashChain = slashChain.Append(dedupe.Dedupe)
+	eventChain = eventChain.Append(dedupe.Dedupe)
+	oauthChain := chain.Append(jitsi.LimitRequest(0))
+	// Webhooks of the conference server and the admin api take json bodies,
+	// except for backup restores, which are larger and json lines.
+	jsonChain := chain.Append(jitsi.LimitRequest(jitsi.DefaultMaxBodySize, jitsi.ContentTypeJSON))
+	backupChain := chain.Append(jitsi.LimitRequest(jitsi.MaxBackupSize))
+
 	// Wrap handlers with middleware chain.
-	slashJitsi := stats.WrapHTTPHandler("slashJitsi", chain.ThenFunc(slashCmd.Jitsi))
-	slackOAuth := stats.WrapHTTPHandler("slackOAuth", chain.ThenFunc(oauthHandler.Auth))
-	slackEvent := stats.WrapHTTPHandler("slackEvent", chain.ThenFunc(evHandle.Handle))
+	slashJitsi := stats.WrapHTTPHandler("slashJitsi", slashChain.ThenFunc(slashCmd.Jitsi))
+	slackOAuth := stats.WrapHTTPHandler("slackOAuth", oauthChain.ThenFunc(oauthHandler.Auth))
+	slackInstall := stats.WrapHTTPHandler("slackInstall", oauthChain.ThenFunc(oauthHandler.Install))
+	slackEvent := stats.WrapHTTPHandler("slackEvent", eventChain.ThenFunc(evHandle.Handle))
+	slackInteraction := stats.WrapHTTPHandler("slackInteraction", slashChain.ThenFunc(interactionHandle.Handle))
+	googleAuth := stats.WrapHTTPHandler("googleAuth", oauthChain.ThenFunc(googleOAuth.Auth))
+	microsoftAuth := stats.WrapHTTPHandler("microsoftAuth", oauthChain.ThenFunc(microsoftOAuth.Auth))
+	var slackSignIn http.Handler
+	if signIn != nil {
+		slackSignIn = stats.WrapHTTPHandler("slackSignIn", oauthChain.ThenFunc(signIn.Auth))
+	}
+	var dataDeletionHandler http.Handler
+	if dataDeletion != nil {
+		dataDeletionHandler = stats.WrapHTTPHandler("dataDeletion", jsonChain.ThenFunc(dataDeletion.Handle))
+	}
+	var teamAccessHandler http.Handler
+	if teamAccess != nil {
+		teamAccessHandler = stats.WrapHTTPHandler("teamAccess", jsonChain.ThenFunc(teamAccess.Handle))
+	}
+	var dataExportHandler http.Handler
+	if dataExport != nil {
+		dataExportHandler = stats.WrapHTTPHandler("dataExport", jsonChain.ThenFunc(dataExport.Handle))
+	}
+	var backupHandler http.Handler
+	if backup != nil {
+		backupHandler = stats.WrapHTTPHandler("backup", backupChain.ThenFunc(backup.Handle))
+	}
+	var configHistoryHandler http.Handler
+	if configHistory != nil {
+		configHistoryHandler = stats.WrapHTTPHandler("configHistory", jsonChain.ThenFunc(configHistory.Handle))
+	}
+	var auditExportHandler http.Handler
+	if auditExport != nil {
+		auditExportHandler = stats.WrapHTTPHandler("auditExport", jsonChain.ThenFunc(auditExport.Handle))
+	}
+	var conferenceEvent, recordingEvent, streamEvent, transcriptEvent http.Handler
+	if confEvents != nil {
+		conferenceEvent = stats.WrapHTTPHandler("conferenceEvent", jsonChain.ThenFunc(confEvents.Handle))
+		recordingEvent = stats.WrapHTTPHandler("recordingEvent", jsonChain.ThenFunc(recordings.Handle))
+		streamEvent = stats.WrapHTTPHandler("streamEvent", jsonChain.ThenFunc(streams.Handle))
+		transcriptEvent = stats.WrapHTTPHandler("transcriptEvent", jsonChain.ThenFunc(transcripts.Handle))
+	}
 
 	// wrap metrics collection and publish endpoint
 	statsPort, err := strconv.ParseInt(app.StatsPort, 10, 16)
@@ -161,17 +1035,66 @@ func main() {
 		slashJitsi = stats.WrapHTTPHandler("slashJitsi", slashJitsi)
 		slackOAuth = stats.WrapHTTPHandler("slackOAuth", slackOAuth)
 		slackEvent = stats.WrapHTTPHandler("slackEvent", slackEvent)
+		slackInteraction = stats.WrapHTTPHandler("slackInteraction", slackInteraction)
 		http.Handle("/metrics", promhttp.Handler())
 	}
 
 	// Add routes and wrapped handlers to mux.
-	handler.Handle("/slash/jitsi", slashJitsi) // slash command handler
-	handler.Handle("/slack/auth", slackOAuth)  // handles "Add to Slack"
-	handler.Handle("/slack/event", slackEvent) // handles workspace removal of app
-	handler.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprint(w, "health check passed")
-	})
+	handler.Handle("/slash/jitsi", slashJitsi)             // slash command handler
+	handler.Handle("/slack/auth", slackOAuth)              // handles "Add to Slack"
+	handler.Handle("/slack/event", slackEvent)             // handles workspace removal of app
+	handler.Handle("/slack/interactive", slackInteraction) // handles buttons and modals
+	if app.SlackAuthorizeURL != "" {
+		handler.Handle("/slack/install", slackInstall) // starts "Add to Slack" with a signed state
+	}
+	if slackSignIn != nil {
+		handler.Handle("/slack/signin", slackSignIn) // handles sign in with slack
+	}
+	if googleCalendar != nil {
+		handler.Handle("/google/auth", googleAuth) // handles google calendar connect
+	}
+	if outlookCalendar != nil {
+		handler.Handle("/microsoft/auth", microsoftAuth) // handles outlook calendar connect
+	}
+	if conferenceEvent != nil {
+		handler.Handle("/jitsi/events", conferenceEvent)      // handles conference room events
+		handler.Handle("/jitsi/recordings", recordingEvent)   // handles finished recordings
+		handler.Handle("/jitsi/streams", streamEvent)         // handles live streams going live
+		handler.Handle("/jitsi/transcripts", transcriptEvent) // handles finished transcripts
+	}
+	if dataDeletionHandler != nil {
+		handler.Handle("/admin/data", dataDeletionHandler) // deletes the data of a team or a user
+	}
+	if teamAccessHandler != nil {
+		handler.Handle("/admin/teams", teamAccessHandler) // blocks, allows or unlists teams
+	}
+	if dataExportHandler != nil {
+		handler.Handle("/admin/export", dataExportHandler) // exports the data of a team
+	}
+	if backupHandler != nil {
+		handler.Handle("/admin/backup", backupHandler) // backs up and restores tokens and server config
+	}
+	if configHistoryHandler != nil {
+		handler.Handle("/admin/config-history", configHistoryHandler) // lists and rolls back config changes
+	}
+	if auditExportHandler != nil {
+		handler.Handle("/admin/audit", auditExportHandler) // exports the audit log of a team
+	}
+	if replicaRegion != "" && (app.StoreBackend == jitsi.StoreBackendDynamoDB || app.StoreBackend == "") {
+		// fails while the tokens or server config are unavailable in the
+		// replica of the region
+		replicaHealth := &jitsi.ReplicaHealthCheck{
+			DB:     svc,
+			Region: replicaRegion,
+			Tables: []string{app.TokenTable, app.ServerCfgTable},
+		}
+		handler.Handle("/health", hlog.NewHandler(log)(http.HandlerFunc(replicaHealth.Handle)))
+	} else {
+		handler.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, "health check passed")
+		})
+	}
 
 	// Register stats handler on default http handler.
 	http.Handle("/metrics", promhttp.Handler())
@@ -194,10 +1117,65 @@ func main() {
 	}
 	<-stop
 	log.Info().Msg("shutting server down")
+	if inviteDispatcher != nil {
+		inviteDispatcher.Stop()
+	}
+	if srvCfgInvalidator != nil {
+		srvCfgInvalidator.Stop()
+	}
+	tasks.Stop()
+	secrets.Stop()
+	if vault != nil {
+		vault.Stop()
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 	err = srv.Shutdown(ctx)
 	if err != nil {
 		log.Fatal().Err(err).Msg("unable to shutdown cleanly")
 	}
+	if redisClient != nil {
+		redisClient.Close()
+	}
+	if storeCfg.Bolt != nil {
+		storeCfg.Bolt.Close()
+	}
+	if storeCfg.Firestore != nil {
+		storeCfg.Firestore.Close()
+	}
+	if storeCfg.Mongo != nil {
+		storeCfg.Mongo.Client().Disconnect(context.Background())
+	}
+	if daxClient != nil {
+		daxClient.Close()
+	}
+}
+
+// featureTables returns the variables of the dynamodb tables configured for
+// optional features. Their stores are dynamodb tables with every storage
+// backend.
+func featureTables(app *appCfg) []string {
+	var set []string
+	for _, table := range []struct{ name, value string }{
+		{"CALENDAR_TOKEN_TABLE", app.CalendarTokenTable},
+		{"INVITE_TABLE", app.InviteTable},
+		{"MEETING_TABLE", app.MeetingTable},
+		{"PERSONAL_ROOM_TABLE", app.PersonalRoomTable},
+		{"CHANNEL_ROOM_TABLE", app.ChannelRoomTable},
+		{"USER_PREFS_TABLE", app.UserPrefsTable},
+		{"IDENTITY_TABLE", app.IdentityTable},
+		{"AUDIT_TABLE", app.AuditTable},
+		{"CONFIG_HISTORY_TABLE", app.ConfigHistoryTable},
+		{"TEAM_ACCESS_TABLE", app.TeamAccessTable},
+		{"USAGE_TABLE", app.UsageTable},
+		{"FEEDBACK_TABLE", app.FeedbackTable},
+		{"MESSAGE_CFG_TABLE", app.MessageCfgTable},
+		{"DELIVERY_TABLE", app.DeliveryTable},
+		{"RATE_LIMIT_TABLE", app.RateLimitTable},
+	} {
+		if table.value != "" {
+			set = append(set, table.name)
+		}
+	}
+	return set
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	env "github.com/caarlos0/env/v6"
+	jitsi "github.com/jitsi/jitsi-slack"
+)
+
+// migrateCfg is the configuration of the migrate command, which reads the
+// table names the service is configured with.
+type migrateCfg struct {
+	DynamoRegion         string   `env:"DYNAMO_REGION,required"`
+	DynamoReplicaRegions []string `env:"DYNAMO_REPLICA_REGIONS" envSeparator:","`
+	TokenTable           string   `env:"TOKEN_TABLE"`
+	ServerCfgTable       string   `env:"SERVER_CFG_TABLE"`
+	ServerCfgStreamARN   string   `env:"SERVER_CFG_STREAM_ARN"`
+	CalendarTokenTable   string   `env:"CALENDAR_TOKEN_TABLE"`
+	InviteTable          string   `env:"INVITE_TABLE"`
+	MeetingTable         string   `env:"MEETING_TABLE"`
+	MeetingRoomIndex     string   `env:"MEETING_ROOM_INDEX" envDefault:"room-index"`
+	PersonalRoomTable    string   `env:"PERSONAL_ROOM_TABLE"`
+	ChannelRoomTable     string   `env:"CHANNEL_ROOM_TABLE"`
+	UserPrefsTable       string   `env:"USER_PREFS_TABLE"`
+	IdentityTable        string   `env:"IDENTITY_TABLE"`
+	AuditTable           string   `env:"AUDIT_TABLE"`
+	TeamAccessTable      string   `env:"TEAM_ACCESS_TABLE"`
+	UsageTable           string   `env:"USAGE_TABLE"`
+	FeedbackTable        string   `env:"FEEDBACK_TABLE"`
+	MessageCfgTable      string   `env:"MESSAGE_CFG_TABLE"`
+	DeliveryTable        string   `env:"DELIVERY_TABLE"`
+	RateLimitTable       string   `env:"RATE_LIMIT_TABLE"`
+	ConfigHistoryTable   string   `env:"CONFIG_HISTORY_TABLE"`
+}
+
+// migrate creates the configured dynamodb tables and brings them up to date
+// with the schema of this version, e.g. `main migrate -dry-run`. Tables in
+// DYNAMO_REGION are replicated to the other DYNAMO_REPLICA_REGIONS.
+func migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only log the changes to the tables")
+	serverCfgStream := flags.Bool("server-cfg-stream", false, "enable the stream of the server config table")
+	flags.Parse(args)
+
+	mig := migrateCfg{}
+	err := env.Parse(&mig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("migration is misconfigured")
+	}
+	if len(mig.DynamoReplicaRegions) > 0 && !hasRegion(mig.DynamoReplicaRegions, mig.DynamoRegion) {
+		log.Fatal().Msg("migration is misconfigured: DYNAMO_REGION is not one of DYNAMO_REPLICA_REGIONS")
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(mig.DynamoRegion))
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot migrate w/o aws session")
+	}
+	tables := jitsi.TableNames{
+		Token:            mig.TokenTable,
+		ServerCfg:        mig.ServerCfgTable,
+		CalendarToken:    mig.CalendarTokenTable,
+		Invite:           mig.InviteTable,
+		Meeting:          mig.MeetingTable,
+		MeetingRoomIndex: mig.MeetingRoomIndex,
+		PersonalRoom:     mig.PersonalRoomTable,
+		ChannelRoom:      mig.ChannelRoomTable,
+		UserPrefs:        mig.UserPrefsTable,
+		Identity:         mig.IdentityTable,
+		Audit:            mig.AuditTable,
+		TeamAccess:       mig.TeamAccessTable,
+		Usage:            mig.UsageTable,
+		Feedback:         mig.FeedbackTable,
+		MessageCfg:       mig.MessageCfgTable,
+		Delivery:         mig.DeliveryTable,
+		RateLimit:        mig.RateLimitTable,
+		ConfigHistory:    mig.ConfigHistoryTable,
+		ServerCfgStream:  *serverCfgStream || mig.ServerCfgStreamARN != "",
+		ReplicaRegions:   otherRegions(mig.DynamoReplicaRegions, mig.DynamoRegion),
+	}
+	migrator := &jitsi.TableMigrator{
+		DB:     dynamodb.NewFromConfig(cfg),
+		DryRun: *dryRun,
+		Log:    log,
+	}
+	err = migrator.Migrate(context.Background(), tables.Schemas())
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot migrate tables")
+	}
+}
+
+// hasRegion returns whether the region is one of the regions.
+func hasRegion(regions []string, region string) bool {
+	for _, r := range regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// otherRegions returns the regions besides the region.
+func otherRegions(regions []string, region string) []string {
+	var other []string
+	for _, r := range regions {
+		if r != region {
+			other = append(other, r)
+		}
+	}
+	return other
+}
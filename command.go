@@ -0,0 +1,185 @@
+package jitsi
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// defaultSlashCommand is the slash command the app is documented with.
+// Workspaces may point other commands, e.g. /meet, at the same handler.
+const defaultSlashCommand = "/jitsi"
+
+var (
+	// slashCommandRE matches the names of slack slash commands.
+	slashCommandRE = regexp.MustCompile(`^/[\p{L}\p{N}_-]{1,31}$`)
+	// defaultSlashCommandRE matches the default slash command in help text,
+	// but not in urls such as https://[server]/slash/jitsi
+	defaultSlashCommandRE = regexp.MustCompile(`(^|[\s` + "`" + `'"(])/jitsi\b`)
+)
+
+// Command is a parsed slash command, e.g.
+// /jitsi room "design sync" @alice --passcode
+type Command struct {
+	// Name is the lower cased subcommand. It is empty when the text does not
+	// start with a word, e.g. /jitsi @alice
+	Name string
+	// Args are the arguments following the subcommand without mentions and
+	// flags. Quotes are removed from quoted arguments.
+	Args []string
+	// Mentions are the ids of the users mentioned in the command.
+	Mentions []string
+	// Flags are the flags of the command by name, e.g. --lobby or
+	// --lobby=on. Flags without a value map to an empty string.
+	Flags map[string]string
+	// Text is the text of the command as sent by slack.
+	Text string
+	// Slash is the slash command that was run, e.g. /jitsi or an alias the
+	// workspace set up such as /meet.
+	Slash string
+
+	// argStarts are the offsets of the args in the text.
+	argStarts []int
+}
+
+// token is a word of command text.
+type token struct {
+	value  string
+	start  int
+	quoted bool
+}
+
+// parseCommand parses the text of a slash command.
+func parseCommand(text string) Command {
+	cmd := Command{
+		Flags: make(map[string]string),
+		Text:  text,
+	}
+	for i, tok := range tokenize(text) {
+		switch {
+		case !tok.quoted && strings.HasPrefix(tok.value, "<@"):
+			if m := atMentionRE.FindStringSubmatch(tok.value); m != nil {
+				cmd.Mentions = append(cmd.Mentions, m[1])
+			}
+		case !tok.quoted && isFlag(tok.value):
+			name := strings.TrimPrefix(tok.value, "--")
+			value := ""
+			if j := strings.Index(name, "="); j >= 0 {
+				name, value = name[:j], name[j+1:]
+			}
+			cmd.Flags[strings.ToLower(name)] = value
+		case i == 0 && !tok.quoted && !strings.HasPrefix(tok.value, "<"):
+			cmd.Name = strings.ToLower(tok.value)
+		default:
+			cmd.Args = append(cmd.Args, tok.value)
+			cmd.argStarts = append(cmd.argStarts, tok.start)
+		}
+	}
+	return cmd
+}
+
+// slashCommand returns the slash command of a payload, falling back to the
+// default command when it is missing or malformed.
+func slashCommand(command string) string {
+	if !slashCommandRE.MatchString(command) {
+		return defaultSlashCommand
+	}
+	return strings.ToLower(command)
+}
+
+// withSlashCommand words text mentioning the default slash command with the
+// command that was run.
+func withSlashCommand(text, slash string) string {
+	if slash == "" || slash == defaultSlashCommand {
+		return text
+	}
+	return defaultSlashCommandRE.ReplaceAllString(text, "${1}"+slash)
+}
+
+// Arg returns the argument at the index or an empty string when there are
+// fewer arguments.
+func (c *Command) Arg(i int) string {
+	if i < len(c.Args) {
+		return c.Args[i]
+	}
+	return ""
+}
+
+// Rest returns the text from the argument at the index on, e.g. free text
+// like a message template. A single remaining argument is returned without
+// its quotes.
+func (c *Command) Rest(i int) string {
+	switch {
+	case i >= len(c.Args):
+		return ""
+	case i == len(c.Args)-1:
+		return c.Args[i]
+	}
+	return strings.TrimSpace(c.Text[c.argStarts[i]:])
+}
+
+// Flag returns whether the flag is set.
+func (c *Command) Flag(name string) bool {
+	_, ok := c.Flags[name]
+	return ok
+}
+
+// isFlag returns whether the word is a flag, e.g. --passcode
+func isFlag(word string) bool {
+	name := strings.TrimPrefix(word, "--")
+	return name != word && name != "" && unicode.IsLetter(rune(name[0]))
+}
+
+// tokenize splits command text into words. Double quotes, including the
+// curly quotes slack may substitute, group words and text within <> such as
+// mentions and links is never split.
+func tokenize(text string) []token {
+	var tokens []token
+	var cur strings.Builder
+	start, inToken, quoted := 0, false, false
+	var closing rune
+	flush := func() {
+		if inToken {
+			tokens = append(tokens, token{value: cur.String(), start: start, quoted: quoted})
+		}
+		cur.Reset()
+		inToken, quoted = false, false
+	}
+	for i, c := range text {
+		switch {
+		case closing != 0:
+			if c == closing {
+				closing = 0
+				if c == '>' {
+					cur.WriteRune(c)
+				}
+				continue
+			}
+			cur.WriteRune(c)
+		case c == '"' || c == '“':
+			if !inToken {
+				start, inToken = i, true
+			}
+			quoted = true
+			closing = '"'
+			if c == '“' {
+				closing = '”'
+			}
+		case c == '<':
+			if !inToken {
+				start, inToken = i, true
+			}
+			closing = '>'
+			cur.WriteRune(c)
+		case unicode.IsSpace(c):
+			flush()
+		default:
+			if !inToken {
+				start, inToken = i, true
+			}
+			cur.WriteRune(c)
+		}
+	}
+	flush()
+	return tokens
+}
@@ -0,0 +1,228 @@
+package jitsi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		cmdName  string
+		args     []string
+		mentions []string
+		flags    map[string]string
+	}{
+		{
+			name: "empty",
+			text: "",
+		},
+		{
+			name:    "subcommand is lower cased",
+			text:    "Room Design",
+			cmdName: "room",
+			args:    []string{"Design"},
+		},
+		{
+			name:    "quoted argument",
+			text:    `room "design sync" next`,
+			cmdName: "room",
+			args:    []string{"design sync", "next"},
+		},
+		{
+			name:    "curly quotes",
+			text:    "room “design sync” next",
+			cmdName: "room",
+			args:    []string{"design sync", "next"},
+		},
+		{
+			name:    "unbalanced quote takes the rest of the text",
+			text:    `room "design sync @alice`,
+			cmdName: "room",
+			args:    []string{"design sync @alice"},
+		},
+		{
+			name:    "unbalanced curly quote takes the rest of the text",
+			text:    "room “design sync",
+			cmdName: "room",
+			args:    []string{"design sync"},
+		},
+		{
+			name:    "quotes within a word",
+			text:    `room design"sync now"`,
+			cmdName: "room",
+			args:    []string{"designsync now"},
+		},
+		{
+			name: "quoted first word is not a subcommand",
+			text: `"room" next`,
+			args: []string{"room", "next"},
+		},
+		{
+			name:     "mentions",
+			text:     "<@U123> <@U456>",
+			mentions: []string{"U123", "U456"},
+		},
+		{
+			name:     "mentions with pipes",
+			text:     "<@U123|alice> <@U456|bob smith>",
+			mentions: []string{"U123", "U456"},
+		},
+		{
+			name:     "mentions after a subcommand",
+			text:     "breakout 2 <@U123|alice> <@U456>",
+			cmdName:  "breakout",
+			args:     []string{"2"},
+			mentions: []string{"U123", "U456"},
+		},
+		{
+			name:    "quoted mention is an argument",
+			text:    `room "<@U123>"`,
+			cmdName: "room",
+			args:    []string{"<@U123>"},
+		},
+		{
+			name: "links are arguments",
+			text: "<https://meet.example.com|meet> <#C123|general>",
+			args: []string{"<https://meet.example.com|meet>", "<#C123|general>"},
+		},
+		{
+			name:     "flags before arguments",
+			text:     "--lobby --passcode=1234 <@U123> now",
+			args:     []string{"now"},
+			mentions: []string{"U123"},
+			flags:    map[string]string{"lobby": "", "passcode": "1234"},
+		},
+		{
+			name:     "flags after arguments",
+			text:     "record <@U123> --Muted --server=https://meet.example.com",
+			cmdName:  "record",
+			mentions: []string{"U123"},
+			flags:    map[string]string{"muted": "", "server": "https://meet.example.com"},
+		},
+		{
+			name:    "flags between arguments",
+			text:    "schedule tomorrow --e2ee 10am",
+			cmdName: "schedule",
+			args:    []string{"tomorrow", "10am"},
+			flags:   map[string]string{"e2ee": ""},
+		},
+		{
+			name:    "flag with an empty value",
+			text:    "room --passcode=",
+			cmdName: "room",
+			flags:   map[string]string{"passcode": ""},
+		},
+		{
+			name:    "dashes without a name are arguments",
+			text:    "room -- --1 -x",
+			cmdName: "room",
+			args:    []string{"--", "--1", "-x"},
+		},
+		{
+			name:    "quoted flag is an argument",
+			text:    `room "--lobby"`,
+			cmdName: "room",
+			args:    []string{"--lobby"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := parseCommand(test.text)
+			if cmd.Name != test.cmdName {
+				t.Errorf("name = %q, want %q", cmd.Name, test.cmdName)
+			}
+			if !reflect.DeepEqual(cmd.Args, test.args) {
+				t.Errorf("args = %q, want %q", cmd.Args, test.args)
+			}
+			if !reflect.DeepEqual(cmd.Mentions, test.mentions) {
+				t.Errorf("mentions = %q, want %q", cmd.Mentions, test.mentions)
+			}
+			flags := test.flags
+			if flags == nil {
+				flags = map[string]string{}
+			}
+			if !reflect.DeepEqual(cmd.Flags, flags) {
+				t.Errorf("flags = %q, want %q", cmd.Flags, flags)
+			}
+			if cmd.Text != test.text {
+				t.Errorf("text = %q, want %q", cmd.Text, test.text)
+			}
+		})
+	}
+}
+
+func TestCommandRest(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		from int
+		want string
+	}{
+		{
+			name: "keeps the spacing of the text",
+			text: "template  invite   Join  {{room}}\tnow ",
+			from: 1,
+			want: "Join  {{room}}\tnow",
+		},
+		{
+			name: "keeps quotes of several arguments",
+			text: `template invite "Join us" in {{room}}`,
+			from: 1,
+			want: `"Join us" in {{room}}`,
+		},
+		{
+			name: "removes the quotes of a single argument",
+			text: `template invite "Join  us"`,
+			from: 1,
+			want: "Join  us",
+		},
+		{
+			name: "keeps curly quotes of several arguments",
+			text: "template invite “Join us” now",
+			from: 1,
+			want: "“Join us” now",
+		},
+		{
+			name: "starts at the argument after a mention",
+			text: "template <@U123> invite Join us",
+			from: 1,
+			want: "Join us",
+		},
+		{
+			name: "keeps flags and mentions after the argument",
+			text: "template invite Join <@U123> --lobby now",
+			from: 1,
+			want: "Join <@U123> --lobby now",
+		},
+		{
+			name: "argument out of range",
+			text: "template invite",
+			from: 1,
+			want: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := parseCommand(test.text)
+			if got := cmd.Rest(test.from); got != test.want {
+				t.Errorf("Rest(%d) = %q, want %q", test.from, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCommandArg(t *testing.T) {
+	cmd := parseCommand("room design sync")
+	if got := cmd.Arg(1); got != "sync" {
+		t.Errorf("Arg(1) = %q, want %q", got, "sync")
+	}
+	if got := cmd.Arg(2); got != "" {
+		t.Errorf("Arg(2) = %q, want empty", got)
+	}
+	cmd = parseCommand("--lobby")
+	if !cmd.Flag("lobby") {
+		t.Error("Flag(lobby) = false, want true")
+	}
+}
@@ -0,0 +1,279 @@
+package jitsi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// event names sent by the prosody mod_event_sync module
+	eventRoomCreated    = "muc-room-created"
+	eventOccupantJoined = "muc-occupant-joined"
+	eventOccupantLeft   = "muc-occupant-left"
+	eventRoomDestroyed  = "muc-room-destroyed"
+)
+
+// slackUserIDRE matches the slack user ids that authenticated participants
+// join with.
+var slackUserIDRE = regexp.MustCompile(`^[UW][A-Z0-9]{2,}$`)
+
+// ConferenceOccupant is a participant of a conference event.
+type ConferenceOccupant struct {
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	ID          string `json:"id"`
+	OccupantJID string `json:"occupant_jid"`
+	JoinedAt    int64  `json:"joined_at"`
+	LeftAt      int64  `json:"left_at"`
+}
+
+// ConferenceEvent is a room event sent by the conference server.
+type ConferenceEvent struct {
+	EventName    string               `json:"event_name"`
+	RoomName     string               `json:"room_name"`
+	RoomJID      string               `json:"room_jid"`
+	IsBreakout   bool                 `json:"is_breakout"`
+	Occupant     ConferenceOccupant   `json:"occupant"`
+	CreatedAt    int64                `json:"created_at"`
+	DestroyedAt  int64                `json:"destroyed_at"`
+	AllOccupants []ConferenceOccupant `json:"all_occupants"`
+}
+
+// room returns the name of the room without the tenant the conference server
+// may prefix it with, e.g. [tenant]room.
+func (e *ConferenceEvent) room() string {
+	return roomWithoutTenant(e.RoomName)
+}
+
+// roomWithoutTenant removes the tenant prefix of a room name, e.g.
+// [tenant]room.
+func roomWithoutTenant(room string) string {
+	if i := strings.Index(room, "]"); strings.HasPrefix(room, "[") && i > 0 {
+		room = room[i+1:]
+	}
+	return room
+}
+
+// authorizedEvent returns whether an event of the conference server carries
+// the secret as bearer token.
+func authorizedEvent(r *http.Request, secret string) bool {
+	auth := r.Header.Get("Authorization")
+	return subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+secret)) == 1
+}
+
+// ConferenceEventHandler is used to handle room events from the conference
+// server to track who is in a meeting.
+type ConferenceEventHandler struct {
+	// Secret is the bearer token the conference server authorizes events with.
+	Secret   string
+	Meetings MeetingReadWriter
+	// TokenReader is optional and enables updating the announcements of
+	// meetings posted by the app as participants join and leave.
+	TokenReader TokenReader
+	// MessageConfig is optional and enables team customized messages.
+	MessageConfig MessageConfigReader
+}
+
+// Handle handles room events posted by the conference server.
+func (c *ConferenceEventHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if !authorizedEvent(r, c.Secret) {
+		hlog.FromRequest(r).Warn().Msg("conference event unauthorized")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var event ConferenceEvent
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		hlog.FromRequest(r).Warn().Err(err).Msg("malformed conference event")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if event.IsBreakout {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	switch event.EventName {
+	case eventOccupantJoined, eventOccupantLeft, eventRoomDestroyed:
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	meeting, ok := meetingForEvent(w, r, c.Meetings, event.RoomName)
+	if !ok {
+		return
+	}
+
+	var token *TokenData
+	if c.TokenReader != nil && meeting.MessageTS != "" {
+		token, err = c.TokenReader.GetTokenForTeam(meeting.TeamID)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("retrieving token")
+		}
+	}
+	if event.EventName == eventRoomDestroyed {
+		c.endMeeting(w, r, &event, meeting, token)
+		return
+	}
+
+	if event.EventName == eventOccupantJoined {
+		participant := Participant{
+			ID:   event.Occupant.ID,
+			Name: event.Occupant.Name,
+		}
+		if token != nil && slackUserIDRE.MatchString(participant.ID) {
+			participant.Avatar = userAvatar(token.AccessToken, participant.ID)
+		}
+		meeting, err = c.Meetings.AddParticipant(meeting.TeamID, meeting.MeetingID, event.Occupant.OccupantJID, participant)
+	} else {
+		meeting, err = c.Meetings.RemoveParticipant(meeting.TeamID, meeting.MeetingID, event.Occupant.OccupantJID)
+	}
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("event", event.EventName).
+			Msg("updating meeting participants")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	meeting, err = c.updateStatus(meeting)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("meeting_id", meeting.MeetingID).
+			Msg("updating meeting status")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if token != nil && meeting.live() {
+		msgCfg := messageConfig(r, c.MessageConfig, meeting.TeamID)
+		_, _, _, err = slack.New(token.AccessToken).UpdateMessage(
+			meeting.ChannelID,
+			meeting.MessageTS,
+			liveRoomMsgOptions(meeting, msgCfg.announcementStyle())...,
+		)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Str("meeting_id", meeting.MeetingID).
+				Msg("updating live announcement")
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// updateStatus marks a meeting active while participants are in it and as
+// started again once everyone left. Meetings that ended or were called off
+// keep their status.
+func (c *ConferenceEventHandler) updateStatus(meeting *MeetingRecord) (*MeetingRecord, error) {
+	status := meeting.Status
+	switch {
+	case status == MeetingStarted && len(meeting.Participants) > 0:
+		status = MeetingActive
+	case status == MeetingActive && len(meeting.Participants) == 0:
+		status = MeetingStarted
+	default:
+		return meeting, nil
+	}
+	err := c.Meetings.SetStatus(meeting.TeamID, meeting.MeetingID, status)
+	if err != nil {
+		return meeting, err
+	}
+	meeting.Status = status
+	return meeting, nil
+}
+
+// endMeeting marks the meeting of a destroyed room as ended and replaces the
+// announcement with a summary of the meeting.
+func (c *ConferenceEventHandler) endMeeting(w http.ResponseWriter, r *http.Request, event *ConferenceEvent, meeting *MeetingRecord, token *TokenData) {
+	if meeting.Status == MeetingCancelled {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	err := c.Meetings.SetStatus(meeting.TeamID, meeting.MeetingID, MeetingEnded)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("meeting_id", meeting.MeetingID).
+			Msg("marking meeting ended")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	duration := time.Since(time.Unix(meeting.CreatedAt, 0))
+	if event.CreatedAt > 0 && event.DestroyedAt > event.CreatedAt {
+		duration = time.Duration(event.DestroyedAt-event.CreatedAt) * time.Second
+	}
+	msgCfg := messageConfig(r, c.MessageConfig, meeting.TeamID)
+	style := msgCfg.announcementStyle()
+	if token != nil {
+		_, _, _, err = slack.New(token.AccessToken).UpdateMessage(
+			meeting.ChannelID,
+			meeting.MessageTS,
+			endedRoomMsgOptions(meeting, duration, style)...,
+		)
+	} else if meeting.ResponseURL != "" && time.Since(time.Unix(meeting.CreatedAt, 0)) < responseURLLifetime {
+		err = replaceOriginal(meeting.ResponseURL, endedRoomMsg(meeting, duration, style))
+	}
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Str("meeting_id", meeting.MeetingID).
+			Msg("updating ended announcement")
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// userAvatar returns the avatar of a slack user or an empty string when it
+// cannot be retrieved.
+func userAvatar(token, userID string) string {
+	user, err := slack.New(token).GetUserInfo(userID)
+	if err != nil {
+		return ""
+	}
+	return user.Profile.Image48
+}
+
+// participantList renders the participants of a meeting. Participants that
+// joined from slack are mentioned, others are listed by their display name.
+func participantList(locale string, participants map[string]Participant) string {
+	names := make([]string, 0, len(participants))
+	for _, p := range sortedParticipants(participants) {
+		switch {
+		case slackUserIDRE.MatchString(p.ID):
+			names = append(names, "<@"+p.ID+">")
+		case p.Name != "":
+			names = append(names, p.Name)
+		default:
+			names = append(names, tr(locale, "who.guest"))
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// sortedParticipants orders the participants of a meeting by name.
+func sortedParticipants(participants map[string]Participant) []Participant {
+	sorted := make([]Participant, 0, len(participants))
+	for _, p := range participants {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
@@ -0,0 +1,524 @@
+package jitsi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// KeyConfigChangeTeamID is the dynamo key for the team of a config
+	// change. This key is the partition key.
+	KeyConfigChangeTeamID = "team-id"
+	// KeyConfigChangeID is the dynamo key for the change id. This key is the
+	// sort key and sorts changes by creation time.
+	KeyConfigChangeID = "change-id"
+	// KeyConfigChangeUndone is the dynamo key for whether a change was
+	// rolled back.
+	KeyConfigChangeUndone = "undone"
+	// KeyConfigChangePurgeAt is the dynamo key for when a change is purged.
+	// It is the ttl attribute of the table.
+	KeyConfigChangePurgeAt = "purge-at"
+
+	// ConfigChangeServer and ConfigChangeMessages are the kinds of config
+	// changes, to the server configuration and to the message templates and
+	// branding of a team.
+	ConfigChangeServer   = "server_config"
+	ConfigChangeMessages = "message_config"
+	// settingTemplate and settingBranding are the settings of message
+	// customization changes.
+	settingTemplate = "template"
+	settingBranding = "branding"
+
+	// configUndoDepth is how many of the latest changes of a team are looked
+	// at for one that was not rolled back yet.
+	configUndoDepth = 50
+	// defaultConfigChanges and maxConfigChanges are how many changes the
+	// admin api lists by default and at most.
+	defaultConfigChanges = 50
+	maxConfigChanges     = 1000
+
+	errMissingConfigChange     = "missing_config_change"
+	errConfigChangeUndone      = "config_change_undone"
+	errUnsupportedConfigChange = "unsupported_config_change"
+)
+
+// ConfigChange records a change to the configuration of a team with the
+// values before and after the change, so that it can be rolled back.
+type ConfigChange struct {
+	TeamID   string `json:"team_id" dynamodbav:"team-id"`
+	ChangeID string `json:"change_id" dynamodbav:"change-id"`
+	Kind     string `json:"kind" dynamodbav:"kind"`
+	// Setting is the setting that changed, e.g. server-url or template.
+	Setting string `json:"setting" dynamodbav:"setting"`
+	// ActorID is the slack user that made the change.
+	ActorID string `json:"actor_id,omitempty" dynamodbav:"actor,omitempty"`
+	// Before and After are the json encoded configuration of the kind
+	// before and after the change.
+	Before AuditValue `json:"before" dynamodbav:"before"`
+	After  AuditValue `json:"after" dynamodbav:"after"`
+	// Undone is whether the change was rolled back.
+	Undone    bool  `json:"undone,omitempty" dynamodbav:"undone,omitempty"`
+	CreatedAt int64 `json:"created_at" dynamodbav:"created-at"`
+	// PurgeAt is the ttl attribute the change is purged by. It is zero when
+	// changes are kept.
+	PurgeAt int64 `json:"-" dynamodbav:"purge-at,omitempty"`
+}
+
+// ConfigChangeReadWriter provides an interface for recording the config
+// changes of teams and reading them back.
+type ConfigChangeReadWriter interface {
+	Record(change *ConfigChange) error
+	Get(teamID, changeID string) (*ConfigChange, error)
+	// Recent retrieves up to limit of the latest changes of a team, newest
+	// first.
+	Recent(teamID string, limit int) ([]*ConfigChange, error)
+	SetUndone(teamID, changeID string) error
+}
+
+// ConfigHistory records the changes made to the server configuration and
+// message customization of teams and rolls them back.
+type ConfigHistory struct {
+	Changes      ConfigChangeReadWriter
+	ServerConfig ServerConfigReadWriter
+	// MessageConfig is optional and rolls back changes to the message
+	// templates and branding.
+	MessageConfig MessageConfigReadWriter
+	// DefaultServer is the default server of the deployment, which teams
+	// using it are restored to when a change of their server is rolled back.
+	DefaultServer string
+}
+
+// newConfigChange creates a change of the kind. The configuration before
+// and after the change must encode to json.
+func newConfigChange(teamID, actorID, kind, setting string, before, after interface{}) *ConfigChange {
+	now := time.Now()
+	return &ConfigChange{
+		TeamID:    teamID,
+		ChangeID:  xid.NewWithTime(now).String(),
+		Kind:      kind,
+		Setting:   setting,
+		ActorID:   actorID,
+		Before:    auditValue(before),
+		After:     auditValue(after),
+		CreatedAt: now.Unix(),
+	}
+}
+
+// record stores a change when the history is enabled. Failing to record the
+// change does not affect it, but it is logged.
+func (h *ConfigHistory) record(log *zerolog.Logger, change *ConfigChange) {
+	if h == nil {
+		return
+	}
+	err := h.Changes.Record(change)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("kind", change.Kind).
+			Str("team", change.TeamID).
+			Msg("recording config change")
+	}
+}
+
+// recordServerCfg records a change to the server configuration of a team.
+func (h *ConfigHistory) recordServerCfg(log *zerolog.Logger, teamID, actorID, setting string, before, after ServerCfg) {
+	if h == nil {
+		return
+	}
+	h.record(log, newConfigChange(teamID, actorID, ConfigChangeServer, setting,
+		storedServerCfg(teamID, before, h.DefaultServer),
+		storedServerCfg(teamID, after, h.DefaultServer),
+	))
+}
+
+// Undo rolls back the latest change of the team that was not rolled back
+// yet, so undoing again rolls back the change before it.
+func (h *ConfigHistory) Undo(teamID string) (*ConfigChange, error) {
+	changes, err := h.Changes.Recent(teamID, configUndoDepth)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if !change.Undone {
+			return change, h.Revert(change)
+		}
+	}
+	return nil, errors.New(errMissingConfigChange)
+}
+
+// Revert rolls back the change, restoring the values of the settings it
+// changed. Settings the change did not touch keep their current values.
+func (h *ConfigHistory) Revert(change *ConfigChange) error {
+	if change.Undone {
+		return errors.New(errConfigChangeUndone)
+	}
+	var err error
+	switch {
+	case change.Kind == ConfigChangeServer:
+		err = h.revertServerCfg(change)
+	case change.Kind == ConfigChangeMessages && h.MessageConfig != nil:
+		err = h.revertMessageCfg(change)
+	default:
+		err = errors.New(errUnsupportedConfigChange)
+	}
+	if err != nil {
+		return err
+	}
+	change.Undone = true
+	return h.Changes.SetUndone(change.TeamID, change.ChangeID)
+}
+
+func (h *ConfigHistory) revertServerCfg(change *ConfigChange) error {
+	var before, after BackupServerCfg
+	err := json.Unmarshal([]byte(change.Before), &before)
+	if err == nil {
+		err = json.Unmarshal([]byte(change.After), &after)
+	}
+	if err != nil {
+		return err
+	}
+	teamID := change.TeamID
+	srv := h.ServerConfig
+	if before.Server != after.Server {
+		if before.Server == "" {
+			err = srv.Remove(teamID)
+		} else {
+			err = srv.Store(&ServerCfgData{TeamID: teamID, Server: before.Server})
+		}
+	}
+	if err == nil && before.RoomNaming != after.RoomNaming {
+		err = srv.SetRoomNaming(teamID, before.RoomNaming)
+	}
+	if err == nil && !sameWordlists(before.wordlists(), after.wordlists()) {
+		err = srv.SetWordlists(teamID, before.wordlists())
+	}
+	if err == nil && before.JWTLifetime != after.JWTLifetime {
+		err = srv.SetJWTLifetime(teamID, time.Duration(before.JWTLifetime)*time.Second)
+	}
+	if err == nil && before.OpenServerChanges != after.OpenServerChanges {
+		err = srv.SetOpenServerChanges(teamID, before.OpenServerChanges)
+	}
+	if err == nil && !samePermissions(before.Permissions, after.Permissions) {
+		err = srv.SetPermissions(teamID, before.Permissions)
+	}
+	if err == nil && !sameStrings(before.URLConfig, after.URLConfig) {
+		err = srv.SetURLConfig(teamID, before.URLConfig)
+	}
+	return err
+}
+
+func (h *ConfigHistory) revertMessageCfg(change *ConfigChange) error {
+	var before, after MessageCfg
+	err := json.Unmarshal([]byte(change.Before), &before)
+	if err == nil {
+		err = json.Unmarshal([]byte(change.After), &after)
+	}
+	if err != nil {
+		return err
+	}
+	cfg, err := h.MessageConfig.Get(change.TeamID)
+	if err != nil {
+		return err
+	}
+	cfg.TeamID = change.TeamID
+	if before.Invite != after.Invite {
+		cfg.Invite = before.Invite
+	}
+	if before.Announcement != after.Announcement {
+		cfg.Announcement = before.Announcement
+	}
+	if before.Branding != after.Branding {
+		cfg.Branding = before.Branding
+	}
+	return h.MessageConfig.Store(&cfg)
+}
+
+// changeMessageConfig stores the changed message customization of a team
+// and records it with the customization before the change when the history
+// is enabled.
+func changeMessageConfig(r *http.Request, history *ConfigHistory, store MessageConfigReadWriter, actorID, setting string, cfg *MessageCfg) error {
+	if history == nil {
+		return store.Store(cfg)
+	}
+	before, err := store.Get(cfg.TeamID)
+	if err != nil {
+		return err
+	}
+	err = store.Store(cfg)
+	if err != nil {
+		return err
+	}
+	history.record(hlog.FromRequest(r), newConfigChange(cfg.TeamID, actorID, ConfigChangeMessages, setting, before, cfg))
+	return nil
+}
+
+// wordlists returns the words of the configuration, which are empty when
+// the team has none of its own.
+func (b *BackupServerCfg) wordlists() Wordlists {
+	if b.Words == nil {
+		return Wordlists{}
+	}
+	return Wordlists(*b.Words)
+}
+
+func sameWordlists(a, b Wordlists) bool {
+	return sameStrings(a.Adjectives, b.Adjectives) && sameStrings(a.Nouns, b.Nouns) &&
+		sameStrings(a.Verbs, b.Verbs) && sameStrings(a.Adverbs, b.Adverbs) &&
+		sameStrings(a.Blocked, b.Blocked)
+}
+
+func samePermissions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// sameStrings returns whether the lists hold the same strings in the same
+// order. Missing and empty lists are the same.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ConfigHistoryStore stores and retrieves config changes from aws dynamodb.
+type ConfigHistoryStore struct {
+	TableName string
+	DB        *dynamodb.Client
+	// Retention is optional and purges changes that long after they were
+	// made.
+	Retention time.Duration
+}
+
+// Record will persist the config change.
+func (c *ConfigHistoryStore) Record(change *ConfigChange) error {
+	if c.Retention > 0 {
+		change.PurgeAt = time.Unix(change.CreatedAt, 0).Add(c.Retention).Unix()
+	}
+	av, err := attributevalue.MarshalMap(change)
+	if err != nil {
+		return err
+	}
+	_, err = c.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(c.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// Get retrieves a config change of a team.
+func (c *ConfigHistoryStore) Get(teamID, changeID string) (*ConfigChange, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyConfigChangeTeamID: teamID,
+		KeyConfigChangeID:     changeID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.DB.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(c.TableName),
+		Key:       key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, errors.New(errMissingConfigChange)
+	}
+	var change ConfigChange
+	err = attributevalue.UnmarshalMap(result.Item, &change)
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// Recent retrieves up to limit of the latest changes of a team, newest
+// first.
+func (c *ConfigHistoryStore) Recent(teamID string, limit int) ([]*ConfigChange, error) {
+	keyCond := expression.Key(KeyConfigChangeTeamID).Equal(expression.Value(teamID))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+	var changes []*ConfigChange
+	var startKey map[string]types.AttributeValue
+	for len(changes) < limit {
+		result, err := c.DB.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:                 aws.String(c.TableName),
+			KeyConditionExpression:    expr.KeyCondition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ScanIndexForward:          aws.Bool(false),
+			Limit:                     aws.Int32(int32(limit - len(changes))),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var page []*ConfigChange
+		err = attributevalue.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+	return changes, nil
+}
+
+// SetUndone records that a config change was rolled back.
+func (c *ConfigHistoryStore) SetUndone(teamID, changeID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyConfigChangeTeamID: teamID,
+		KeyConfigChangeID:     changeID,
+	})
+	if err != nil {
+		return err
+	}
+	update := expression.Set(expression.Name(KeyConfigChangeUndone), expression.Value(true))
+	cond := expression.AttributeExists(expression.Name(KeyConfigChangeID))
+	expr, err := expression.NewBuilder().
+		WithUpdate(update).
+		WithCondition(cond).
+		Build()
+	if err != nil {
+		return err
+	}
+	_, err = c.DB.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(c.TableName),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	var missing *types.ConditionalCheckFailedException
+	if errors.As(err, &missing) {
+		return errors.New(errMissingConfigChange)
+	}
+	return err
+}
+
+// ConfigHistoryHandler lists and rolls back the config changes of a team,
+// e.g. GET /admin/config-history?team=T123 lists the latest changes newest
+// first as json lines, and POST /admin/config-history?team=T123&change=c0ffee
+// rolls back the change, or the latest change not rolled back yet when no
+// change is given. The rolled back change is returned.
+type ConfigHistoryHandler struct {
+	// Secret is the bearer token requests are authorized with.
+	Secret  string
+	History *ConfigHistory
+	// Audit is optional and records the changes that are rolled back.
+	Audit AuditWriter
+}
+
+// Handle lists or rolls back changes depending on the method.
+func (c *ConfigHistoryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if !authorizedEvent(r, c.Secret) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	teamID := r.URL.Query().Get("team")
+	if teamID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		c.list(w, r, teamID)
+	case http.MethodPost:
+		c.rollback(w, r, teamID)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *ConfigHistoryHandler) list(w http.ResponseWriter, r *http.Request, teamID string) {
+	limit := defaultConfigChanges
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxConfigChanges {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	changes, err := c.History.Changes.Recent(teamID, limit)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving config changes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for _, change := range changes {
+		enc.Encode(change)
+	}
+}
+
+func (c *ConfigHistoryHandler) rollback(w http.ResponseWriter, r *http.Request, teamID string) {
+	var change *ConfigChange
+	var err error
+	if changeID := r.URL.Query().Get("change"); changeID != "" {
+		change, err = c.History.Changes.Get(teamID, changeID)
+		if err == nil {
+			err = c.History.Revert(change)
+		}
+	} else {
+		change, err = c.History.Undo(teamID)
+	}
+	if err != nil {
+		switch err.Error() {
+		case errMissingConfigChange:
+			w.WriteHeader(http.StatusNotFound)
+		case errConfigChangeUndone:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("rolling back config change")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	recordAudit(hlog.FromRequest(r), c.Audit, newAuditEvent(teamID, "", AuditConfigRollback, change.Setting, change.After, change.Before))
+	hlog.FromRequest(r).Info().
+		Str("team", teamID).
+		Str("change_id", change.ChangeID).
+		Msg("rolled back config change")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(change)
+}
@@ -0,0 +1,62 @@
+package jitsi
+
+import (
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// isExternalUser returns whether the user belongs to another organization,
+// e.g. a member of a Slack Connect channel. The app cannot message external
+// users directly. Users of other workspaces of the same enterprise grid
+// organization are not external.
+func isExternalUser(token *TokenData, user *slack.User) bool {
+	if user.IsStranger {
+		return true
+	}
+	if user.TeamID == "" || user.TeamID == token.TeamID {
+		return false
+	}
+	if token.EnterpriseID != "" &&
+		(user.TeamID == token.EnterpriseID || user.Enterprise.EnterpriseID == token.EnterpriseID) {
+		return false
+	}
+	return true
+}
+
+// sendChannelInvite sends the invite of an external user as a message only
+// they see in the shared channel the meeting was started in. The invite
+// cannot be updated later, so it has no RSVP buttons.
+func sendChannelInvite(token, hostID string, user *slack.User, channelID string, meeting *Meeting, style messageStyle) error {
+	meetingURL, err := meeting.AuthenticatedURL(
+		user.ID,
+		user.Name,
+		user.Profile.Image192,
+	)
+	if err != nil {
+		return err
+	}
+	invite := newInvite(token, hostID, user.ID, channelID, meetingURL, meeting)
+	_, err = slack.New(token).PostEphemeral(
+		channelID,
+		user.ID,
+		inviteMsgOptions(invite, inviteText(invite, style), style)...,
+	)
+	return err
+}
+
+// externalNotice creates the blocks telling a host which invitees are in
+// another organization and got their invite in the channel.
+func externalNotice(locale string, userIDs []string) []slack.Block {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	mentions := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		mentions[i] = "<@" + userID + ">"
+	}
+	msg := tr(locale, "connect.external", strings.Join(mentions, ", "))
+	return []slack.Block{
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, msg, false, false)),
+	}
+}
@@ -0,0 +1,153 @@
+package jitsi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+// AuditDataDeleted is recorded when the data of a team or a user is deleted
+// on request. The target is the user whose data was deleted and the receipt
+// is recorded as the value after the deletion.
+const AuditDataDeleted = "data_deleted"
+
+// DataStore is a store the data of teams or users is deleted from on request.
+// The store implements TeamDataRemover, UserDataRemover or both.
+type DataStore struct {
+	// Name names the store in deletion receipts, e.g. preferences.
+	Name  string
+	Store interface{}
+}
+
+// DeletionReceipt confirms the deletion of the data of a team or a user.
+type DeletionReceipt struct {
+	ReceiptID string `json:"receipt_id"`
+	TeamID    string `json:"team_id"`
+	// UserID is empty when the data of the whole team was deleted.
+	UserID string `json:"user_id,omitempty"`
+	// Deleted are the stores the data was deleted from.
+	Deleted []string `json:"deleted"`
+	// Failed are the stores the data could not be deleted from. The
+	// deletion may be requested again to retry them.
+	Failed    []string  `json:"failed,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// DataEraser deletes everything stored for a team or a user of a team, e.g.
+// for data deletion requests. The audit log is kept and records the
+// deletion.
+type DataEraser struct {
+	Stores []DataStore
+	// Audit is optional and records the receipts of deletions.
+	Audit AuditWriter
+}
+
+// EraseTeam deletes the data of the team from every store holding data of
+// teams. The actor is the user that requested the deletion and is empty for
+// requests through the admin api.
+func (d *DataEraser) EraseTeam(log *zerolog.Logger, teamID, actorID string) *DeletionReceipt {
+	receipt := newDeletionReceipt(teamID, "")
+	for _, store := range d.Stores {
+		remover, ok := store.Store.(TeamDataRemover)
+		if !ok {
+			continue
+		}
+		receipt.add(log, store.Name, remover.RemoveTeam(teamID))
+	}
+	recordAudit(log, d.Audit, newAuditEvent(teamID, actorID, AuditDataDeleted, "", nil, receipt))
+	return receipt
+}
+
+// EraseUser deletes the data of the user of the team from every store
+// holding data of users.
+func (d *DataEraser) EraseUser(log *zerolog.Logger, teamID, userID, actorID string) *DeletionReceipt {
+	receipt := newDeletionReceipt(teamID, userID)
+	for _, store := range d.Stores {
+		remover, ok := store.Store.(UserDataRemover)
+		if !ok {
+			continue
+		}
+		receipt.add(log, store.Name, remover.RemoveUser(teamID, userID))
+	}
+	recordAudit(log, d.Audit, newAuditEvent(teamID, actorID, AuditDataDeleted, userID, nil, receipt))
+	return receipt
+}
+
+func newDeletionReceipt(teamID, userID string) *DeletionReceipt {
+	now := time.Now()
+	return &DeletionReceipt{
+		ReceiptID: xid.NewWithTime(now).String(),
+		TeamID:    teamID,
+		UserID:    userID,
+		Deleted:   []string{},
+		DeletedAt: now.UTC(),
+	}
+}
+
+// add records whether the data was deleted from the store.
+func (d *DeletionReceipt) add(log *zerolog.Logger, store string, err error) {
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("store", store).
+			Str("team", d.TeamID).
+			Str("user", d.UserID).
+			Msg("deleting data")
+		d.Failed = append(d.Failed, store)
+		return
+	}
+	d.Deleted = append(d.Deleted, store)
+}
+
+// DataDeletionHandler deletes the data of a team or of a user of a team on
+// request, e.g. DELETE /admin/data?team=T123&user=U123
+// The deletion receipt is written as json.
+type DataDeletionHandler struct {
+	// Secret is the bearer token deletions are authorized with.
+	Secret string
+	Eraser *DataEraser
+}
+
+// Handle deletes the data of the user of the user parameter, or of the whole
+// team when it is missing. The response is an internal server error when
+// the data could not be deleted from a store.
+func (d *DataDeletionHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizedEvent(r, d.Secret) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	teamID, userID := r.URL.Query().Get("team"), r.URL.Query().Get("user")
+	if teamID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var receipt *DeletionReceipt
+	if userID == "" {
+		receipt = d.Eraser.EraseTeam(hlog.FromRequest(r), teamID, "")
+	} else {
+		receipt = d.Eraser.EraseUser(hlog.FromRequest(r), teamID, userID, "")
+	}
+	hlog.FromRequest(r).Info().
+		Str("receipt", receipt.ReceiptID).
+		Str("team", teamID).
+		Str("user", userID).
+		Int("failed", len(receipt.Failed)).
+		Msg("deleted data")
+
+	status := http.StatusOK
+	if len(receipt.Failed) > 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(receipt)
+}
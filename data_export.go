@@ -0,0 +1,216 @@
+package jitsi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+// TeamDataExporter provides an interface for exporting the data stored for
+// a team, e.g. for data portability requests. Secrets such as tokens are
+// never exported.
+type TeamDataExporter interface {
+	ExportTeam(teamID string) (interface{}, error)
+}
+
+// TeamExport is everything stored for a team by the store it is stored in.
+type TeamExport struct {
+	TeamID string `json:"team_id"`
+	// Data is the exported data by the name of the store it was exported
+	// from.
+	Data map[string]interface{} `json:"data"`
+	// Failed are the stores the data could not be exported from.
+	Failed     []string  `json:"failed,omitempty"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// DataExporter exports everything stored for a team from the stores that
+// hold data of teams.
+type DataExporter struct {
+	Stores []DataStore
+}
+
+// ExportTeam exports the data of the team from every store holding data of
+// teams. A store failing to export the data does not keep the others from
+// exporting it.
+func (d *DataExporter) ExportTeam(log *zerolog.Logger, teamID string) *TeamExport {
+	export := &TeamExport{
+		TeamID:     teamID,
+		Data:       make(map[string]interface{}),
+		ExportedAt: time.Now().UTC(),
+	}
+	for _, store := range d.Stores {
+		exporter, ok := store.Store.(TeamDataExporter)
+		if !ok {
+			continue
+		}
+		data, err := exporter.ExportTeam(teamID)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("store", store.Name).
+				Str("team", teamID).
+				Msg("exporting data")
+			export.Failed = append(export.Failed, store.Name)
+			continue
+		}
+		export.Data[store.Name] = data
+	}
+	return export
+}
+
+// DataExportHandler exports everything stored for a team for data
+// portability requests and for debugging the issues of a team, e.g.
+// GET /admin/export?team=T123
+// The export is written as json.
+type DataExportHandler struct {
+	// Secret is the bearer token exports are authorized with.
+	Secret   string
+	Exporter *DataExporter
+}
+
+// Handle writes the export of the team of the team parameter. The response
+// is an internal server error when the data could not be exported from a
+// store.
+func (d *DataExportHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizedEvent(r, d.Secret) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	teamID := r.URL.Query().Get("team")
+	if teamID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	export := d.Exporter.ExportTeam(hlog.FromRequest(r), teamID)
+	hlog.FromRequest(r).Info().
+		Str("team", teamID).
+		Int("stores", len(export.Data)).
+		Int("failed", len(export.Failed)).
+		Msg("exporting team data")
+
+	status := http.StatusOK
+	if len(export.Failed) > 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(export)
+}
+
+// queryTeamItems retrieves the items of a team from a table partitioned by
+// the team and unmarshals them into out, which must point to a slice.
+func queryTeamItems(db *dynamodb.Client, table, teamKey, teamID string, out interface{}) error {
+	keyCond := expression.Key(teamKey).Equal(expression.Value(teamID))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return err
+	}
+
+	var items []map[string]types.AttributeValue
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := db.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:                 aws.String(table),
+			KeyConditionExpression:    expr.KeyCondition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return err
+		}
+		items = append(items, result.Items...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return attributevalue.UnmarshalListOfMaps(items, out)
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// ExportTeam will export the install of a team. The token is not exported.
+func (t *TokenStore) ExportTeam(teamID string) (interface{}, error) {
+	data, err := t.GetTokenForTeam(teamID)
+	if err != nil {
+		return nil, err
+	}
+	install := installAudit(data)
+	install["authed_user_id"] = data.AuthedUserID
+	return install, nil
+}
+
+// ExportTeam will export the server configuration of a team.
+func (s *ServerCfgStore) ExportTeam(teamID string) (interface{}, error) {
+	return s.Get(teamID)
+}
+
+// ExportTeam will export the message configuration of a team.
+func (m *MessageCfgStore) ExportTeam(teamID string) (interface{}, error) {
+	return m.Get(teamID)
+}
+
+// ExportTeam will export the config changes of a team.
+func (c *ConfigHistoryStore) ExportTeam(teamID string) (interface{}, error) {
+	changes := []*ConfigChange{}
+	err := queryTeamItems(c.DB, c.TableName, KeyConfigChangeTeamID, teamID, &changes)
+	return changes, err
+}
+
+// ExportTeam will export the preferences of the users of a team.
+func (u *UserPrefsStore) ExportTeam(teamID string) (interface{}, error) {
+	prefs := []*UserPrefs{}
+	err := queryTeamItems(u.DB, u.TableName, KeyUserPrefsTeamID, teamID, &prefs)
+	return prefs, err
+}
+
+// ExportTeam will export the personal rooms of the users of a team.
+func (p *PersonalRoomStore) ExportTeam(teamID string) (interface{}, error) {
+	rooms := []*PersonalRoom{}
+	err := queryTeamItems(p.DB, p.TableName, KeyPersonalRoomTeamID, teamID, &rooms)
+	return rooms, err
+}
+
+// ExportTeam will export the standing rooms of the channels of a team.
+func (c *ChannelRoomStore) ExportTeam(teamID string) (interface{}, error) {
+	rooms := []*ChannelRoom{}
+	err := queryTeamItems(c.DB, c.TableName, KeyChannelRoomTeamID, teamID, &rooms)
+	return rooms, err
+}
+
+// ExportTeam will export the identities the users of a team linked.
+func (i *IdentityStore) ExportTeam(teamID string) (interface{}, error) {
+	identities := []*SlackIdentity{}
+	err := queryTeamItems(i.DB, i.TableName, KeyIdentityTeamID, teamID, &identities)
+	return identities, err
+}
+
+// ExportTeam will export the meeting history of a team, most recent first.
+func (m *MeetingStore) ExportTeam(teamID string) (interface{}, error) {
+	return m.Recent(teamID, time.Unix(0, 0))
+}
+
+// ExportTeam will export the usage history of a team.
+func (u *UsageStore) ExportTeam(teamID string) (interface{}, error) {
+	return u.Since(teamID, time.Unix(0, 0))
+}
+
+// ExportTeam will export the feedback the users of a team submitted.
+func (f *FeedbackStore) ExportTeam(teamID string) (interface{}, error) {
+	feedback := []*Feedback{}
+	err := queryTeamItems(f.DB, f.TableName, KeyFeedbackTeamID, teamID, &feedback)
+	return feedback, err
+}
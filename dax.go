@@ -0,0 +1,235 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	dynamodbv1 "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/smithy-go"
+)
+
+// DynamoItemAPI provides an interface for the item requests of the token
+// and server config stores, which both dynamodb and a DAX cluster serve.
+type DynamoItemAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DAXClient serves the item requests of the stores from a DAX cluster, so
+// lookups are answered from its item cache. Writes go through the cluster as
+// well, which keeps the cache current. The DAX client only speaks the v1
+// aws sdk, so requests, responses and errors are translated. The client
+// options of requests are ignored.
+type DAXClient struct {
+	Dax *dax.Dax
+}
+
+// NewDAXClient connects to the DAX cluster at the endpoint, e.g.
+// dax://my-cluster.abc123.dax-clusters.us-east-1.amazonaws.com or daxs://
+// for clusters with encryption in transit. Credentials are looked up like
+// they are for every other aws client.
+func NewDAXClient(endpoint, region string) (*DAXClient, error) {
+	cfg := dax.DefaultConfig()
+	cfg.HostPorts = []string{endpoint}
+	cfg.Region = region
+	client, err := dax.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &DAXClient{Dax: client}, nil
+}
+
+// Close closes the connections to the cluster.
+func (d *DAXClient) Close() error {
+	return d.Dax.Close()
+}
+
+// GetItem retrieves an item through the cluster.
+func (d *DAXClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	result, err := d.Dax.GetItemWithContext(ctx, &dynamodbv1.GetItemInput{
+		TableName:                params.TableName,
+		Key:                      toAttributeMapV1(params.Key),
+		ConsistentRead:           params.ConsistentRead,
+		ProjectionExpression:     params.ProjectionExpression,
+		ExpressionAttributeNames: namesV1(params.ExpressionAttributeNames),
+	})
+	if err != nil {
+		return nil, fromErrorV1(err)
+	}
+	return &dynamodb.GetItemOutput{Item: fromAttributeMapV1(result.Item)}, nil
+}
+
+// PutItem writes an item through the cluster.
+func (d *DAXClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	result, err := d.Dax.PutItemWithContext(ctx, &dynamodbv1.PutItemInput{
+		TableName:                 params.TableName,
+		Item:                      toAttributeMapV1(params.Item),
+		ConditionExpression:       params.ConditionExpression,
+		ExpressionAttributeNames:  namesV1(params.ExpressionAttributeNames),
+		ExpressionAttributeValues: toAttributeMapV1(params.ExpressionAttributeValues),
+		ReturnValues:              returnValueV1(params.ReturnValues),
+	})
+	if err != nil {
+		return nil, fromErrorV1(err)
+	}
+	return &dynamodb.PutItemOutput{Attributes: fromAttributeMapV1(result.Attributes)}, nil
+}
+
+// UpdateItem updates an item through the cluster.
+func (d *DAXClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	result, err := d.Dax.UpdateItemWithContext(ctx, &dynamodbv1.UpdateItemInput{
+		TableName:                 params.TableName,
+		Key:                       toAttributeMapV1(params.Key),
+		UpdateExpression:          params.UpdateExpression,
+		ConditionExpression:       params.ConditionExpression,
+		ExpressionAttributeNames:  namesV1(params.ExpressionAttributeNames),
+		ExpressionAttributeValues: toAttributeMapV1(params.ExpressionAttributeValues),
+		ReturnValues:              returnValueV1(params.ReturnValues),
+	})
+	if err != nil {
+		return nil, fromErrorV1(err)
+	}
+	return &dynamodb.UpdateItemOutput{Attributes: fromAttributeMapV1(result.Attributes)}, nil
+}
+
+// DeleteItem deletes an item through the cluster.
+func (d *DAXClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	result, err := d.Dax.DeleteItemWithContext(ctx, &dynamodbv1.DeleteItemInput{
+		TableName:                 params.TableName,
+		Key:                       toAttributeMapV1(params.Key),
+		ConditionExpression:       params.ConditionExpression,
+		ExpressionAttributeNames:  namesV1(params.ExpressionAttributeNames),
+		ExpressionAttributeValues: toAttributeMapV1(params.ExpressionAttributeValues),
+		ReturnValues:              returnValueV1(params.ReturnValues),
+	})
+	if err != nil {
+		return nil, fromErrorV1(err)
+	}
+	return &dynamodb.DeleteItemOutput{Attributes: fromAttributeMapV1(result.Attributes)}, nil
+}
+
+// namesV1 translates expression attribute names, which must be missing
+// rather than empty.
+func namesV1(names map[string]string) map[string]*string {
+	if len(names) == 0 {
+		return nil
+	}
+	return awsv1.StringMap(names)
+}
+
+func returnValueV1(v types.ReturnValue) *string {
+	if v == "" {
+		return nil
+	}
+	return awsv1.String(string(v))
+}
+
+// fromErrorV1 translates the errors of the DAX client, so that conditional
+// check failures and throttling are recognized like they are for dynamodb.
+func fromErrorV1(err error) error {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return err
+	}
+	switch awsErr.Code() {
+	case dynamodbv1.ErrCodeConditionalCheckFailedException:
+		return &types.ConditionalCheckFailedException{Message: aws.String(awsErr.Message())}
+	case dynamodbv1.ErrCodeResourceNotFoundException:
+		return &types.ResourceNotFoundException{Message: aws.String(awsErr.Message())}
+	}
+	return &smithy.GenericAPIError{Code: awsErr.Code(), Message: awsErr.Message()}
+}
+
+// toAttributeMapV1 translates the attributes of a request, which must be
+// missing rather than empty.
+func toAttributeMapV1(m map[string]types.AttributeValue) map[string]*dynamodbv1.AttributeValue {
+	if len(m) == 0 {
+		return nil
+	}
+	return toMapV1(m)
+}
+
+func toMapV1(m map[string]types.AttributeValue) map[string]*dynamodbv1.AttributeValue {
+	av := make(map[string]*dynamodbv1.AttributeValue, len(m))
+	for k, v := range m {
+		av[k] = toAttributeV1(v)
+	}
+	return av
+}
+
+func toAttributeV1(v types.AttributeValue) *dynamodbv1.AttributeValue {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return &dynamodbv1.AttributeValue{S: awsv1.String(v.Value)}
+	case *types.AttributeValueMemberN:
+		return &dynamodbv1.AttributeValue{N: awsv1.String(v.Value)}
+	case *types.AttributeValueMemberB:
+		return &dynamodbv1.AttributeValue{B: v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return &dynamodbv1.AttributeValue{BOOL: awsv1.Bool(v.Value)}
+	case *types.AttributeValueMemberNULL:
+		return &dynamodbv1.AttributeValue{NULL: awsv1.Bool(v.Value)}
+	case *types.AttributeValueMemberSS:
+		return &dynamodbv1.AttributeValue{SS: awsv1.StringSlice(v.Value)}
+	case *types.AttributeValueMemberNS:
+		return &dynamodbv1.AttributeValue{NS: awsv1.StringSlice(v.Value)}
+	case *types.AttributeValueMemberBS:
+		return &dynamodbv1.AttributeValue{BS: v.Value}
+	case *types.AttributeValueMemberM:
+		return &dynamodbv1.AttributeValue{M: toMapV1(v.Value)}
+	case *types.AttributeValueMemberL:
+		l := make([]*dynamodbv1.AttributeValue, len(v.Value))
+		for i, e := range v.Value {
+			l[i] = toAttributeV1(e)
+		}
+		return &dynamodbv1.AttributeValue{L: l}
+	}
+	return &dynamodbv1.AttributeValue{NULL: awsv1.Bool(true)}
+}
+
+func fromAttributeMapV1(m map[string]*dynamodbv1.AttributeValue) map[string]types.AttributeValue {
+	if m == nil {
+		return nil
+	}
+	av := make(map[string]types.AttributeValue, len(m))
+	for k, v := range m {
+		av[k] = fromAttributeV1(v)
+	}
+	return av
+}
+
+func fromAttributeV1(v *dynamodbv1.AttributeValue) types.AttributeValue {
+	switch {
+	case v.S != nil:
+		return &types.AttributeValueMemberS{Value: *v.S}
+	case v.N != nil:
+		return &types.AttributeValueMemberN{Value: *v.N}
+	case v.B != nil:
+		return &types.AttributeValueMemberB{Value: v.B}
+	case v.BOOL != nil:
+		return &types.AttributeValueMemberBOOL{Value: *v.BOOL}
+	case v.SS != nil:
+		return &types.AttributeValueMemberSS{Value: awsv1.StringValueSlice(v.SS)}
+	case v.NS != nil:
+		return &types.AttributeValueMemberNS{Value: awsv1.StringValueSlice(v.NS)}
+	case v.BS != nil:
+		return &types.AttributeValueMemberBS{Value: v.BS}
+	case v.M != nil:
+		return &types.AttributeValueMemberM{Value: fromAttributeMapV1(v.M)}
+	case v.L != nil:
+		l := make([]types.AttributeValue, len(v.L))
+		for i, e := range v.L {
+			l[i] = fromAttributeV1(e)
+		}
+		return &types.AttributeValueMemberL{Value: l}
+	}
+	return &types.AttributeValueMemberNULL{Value: true}
+}
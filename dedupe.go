@@ -0,0 +1,216 @@
+package jitsi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// RetryNumHeader is the header slack sets on retried deliveries with
+	// the number of the retry.
+	RetryNumHeader = "X-Slack-Retry-Num"
+	// RetryReasonHeader is the header slack sets on retried deliveries with
+	// the reason of the retry, e.g. http_timeout.
+	RetryReasonHeader = "X-Slack-Retry-Reason"
+
+	// KeyDeliveryID is the dynamo key for a slack delivery. This key is the
+	// partition key.
+	KeyDeliveryID = "delivery-id"
+	// KeyDeliveryExpiresAt is the dynamo key for when a delivery is
+	// forgotten. It is meant to be the time to live attribute of the table.
+	KeyDeliveryExpiresAt = "expires-at"
+
+	// DefaultDeliveryTTL is how long deliveries are remembered when no time
+	// is configured. Slack retries events for up to an hour.
+	DefaultDeliveryTTL = time.Hour
+)
+
+// DeliveryCache provides an interface for remembering slack deliveries so
+// that retried deliveries are recognized.
+type DeliveryCache interface {
+	// Seen records the delivery and returns whether it was recorded before
+	// within the time to live.
+	Seen(key string, ttl time.Duration) (bool, error)
+}
+
+// Deduplicator is middleware that acknowledges retried slack deliveries
+// without handling them again, so that retries of slow responses do not
+// send direct messages twice. Events are recognized by their event id, and
+// slash commands and interactions by their team and trigger id. Requests
+// must be verified by a RequestVerifier first.
+type Deduplicator struct {
+	Cache DeliveryCache
+	// TTL is how long deliveries are remembered. DefaultDeliveryTTL is used
+	// when it is zero.
+	TTL time.Duration
+}
+
+// Dedupe wraps a handler so that it only handles the first delivery of a
+// request. Deliveries that cannot be recorded are handled.
+func (d *Deduplicator) Dedupe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("reading request body")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		key := deliveryKey(r.Header.Get("Content-Type"), body)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ttl := d.TTL
+		if ttl <= 0 {
+			ttl = DefaultDeliveryTTL
+		}
+		seen, err := d.Cache.Seen(key, ttl)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Str("delivery", key).
+				Msg("recording delivery")
+		}
+		if !seen {
+			next.ServeHTTP(w, r)
+			return
+		}
+		hlog.FromRequest(r).Info().
+			Str("delivery", key).
+			Str("retry", r.Header.Get(RetryNumHeader)).
+			Str("reason", r.Header.Get(RetryReasonHeader)).
+			Msg("acknowledging retried delivery")
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// deliveryKey returns the key a slack delivery is remembered by. It is empty
+// for deliveries that cannot be recognized, e.g. url verifications.
+func deliveryKey(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != ContentTypeForm {
+		var event struct {
+			EventID string `json:"event_id"`
+		}
+		json.Unmarshal(body, &event)
+		if event.EventID == "" {
+			return ""
+		}
+		return "event/" + event.EventID
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	if payload := form.Get("payload"); payload != "" {
+		var interaction struct {
+			TriggerID string `json:"trigger_id"`
+			Team      struct {
+				ID string `json:"id"`
+			} `json:"team"`
+		}
+		json.Unmarshal([]byte(payload), &interaction)
+		if interaction.TriggerID == "" {
+			return ""
+		}
+		return "interaction/" + interaction.Team.ID + "/" + interaction.TriggerID
+	}
+	if form.Get("trigger_id") == "" {
+		return ""
+	}
+	return "command/" + form.Get("team_id") + "/" + form.Get("trigger_id")
+}
+
+// MemoryDeliveryCache remembers deliveries in memory, so each instance of
+// the service recognizes the retries it receives. See DynamoDeliveryCache
+// for deliveries shared by every instance.
+type MemoryDeliveryCache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+// Seen records the delivery and returns whether it was recorded before.
+func (m *MemoryDeliveryCache) Seen(key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seen == nil {
+		m.seen = make(map[string]time.Time)
+	}
+	if now.Sub(m.pruned) > time.Minute {
+		for k, expires := range m.seen {
+			if now.After(expires) {
+				delete(m.seen, k)
+			}
+		}
+		m.pruned = now
+	}
+	if expires, ok := m.seen[key]; ok && now.Before(expires) {
+		return true, nil
+	}
+	m.seen[key] = now.Add(ttl)
+	return false, nil
+}
+
+// DynamoDeliveryCache remembers deliveries in aws dynamodb, so that retries
+// are recognized by every instance of the service. Deliveries expire through
+// the time to live of the table.
+type DynamoDeliveryCache struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+// Seen records the delivery and returns whether it was recorded before. The
+// delivery is only recorded when it is missing or expired, so concurrent
+// deliveries are recorded once.
+func (d *DynamoDeliveryCache) Seen(key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	av, err := attributevalue.MarshalMap(map[string]interface{}{
+		KeyDeliveryID:        key,
+		KeyDeliveryExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return false, err
+	}
+	// items are only removed by the time to live some time after expiring
+	cond := expression.AttributeNotExists(expression.Name(KeyDeliveryID)).
+		Or(expression.Name(KeyDeliveryExpiresAt).LessThan(expression.Value(now.Unix())))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return false, err
+	}
+	_, err = d.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:                 aws.String(d.TableName),
+		Item:                      av,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	var seen *types.ConditionalCheckFailedException
+	if errors.As(err, &seen) {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,140 @@
+package jitsi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// maxDialInNumbers limits the phone numbers shown in an invite.
+	maxDialInNumbers = 3
+	// dialInTimeout is how long the dial-in services have to respond since
+	// meetings are created while slack waits for the command response.
+	dialInTimeout = time.Second
+)
+
+// DialIn is the information for joining a meeting by phone.
+type DialIn struct {
+	Numbers []DialInNumber `dynamodbav:"numbers" json:"n"`
+	// PIN is the conference id entered after dialing a number.
+	PIN string `dynamodbav:"pin" json:"p"`
+}
+
+// DialInNumber is a phone number of the dial-in service.
+type DialInNumber struct {
+	Country string `dynamodbav:"country" json:"c"`
+	Number  string `dynamodbav:"number" json:"n"`
+}
+
+// DialInProvider provides the dial-in information of a room.
+type DialInProvider interface {
+	DialIn(server, roomName string) (*DialIn, error)
+}
+
+// ConferenceMapper provides dial-in information from the jitsi conference
+// mapper and phone number list services.
+// (see https://github.com/jitsi/jitsi-meet/blob/master/resources/cloud-api.swagger)
+type ConferenceMapper struct {
+	// Server is the conference server the dial-in service is available for.
+	Server string
+	// MapperURL is the url of the conference mapper.
+	// (e.g. https://jitsi-api.jitsi.net/conferenceMapper)
+	MapperURL string
+	// NumbersURL is the url of the phone number list.
+	// (e.g. https://jitsi-api.jitsi.net/phoneNumberList)
+	NumbersURL string
+	// MUCDomain is the domain of the conference rooms.
+	MUCDomain string
+}
+
+type conferenceMapping struct {
+	ID json.Number `json:"id"`
+}
+
+type phoneNumberList struct {
+	NumbersEnabled bool                `json:"numbersEnabled"`
+	Numbers        map[string][]string `json:"numbers"`
+}
+
+// DialIn retrieves the dial-in information of the room. No information is
+// provided for rooms on other servers or when dial-in is not enabled.
+func (c *ConferenceMapper) DialIn(server, roomName string) (*DialIn, error) {
+	if server != c.Server {
+		return nil, nil
+	}
+	query := "?" + url.Values{
+		"conference": {strings.ToLower(roomName) + "@" + c.MUCDomain},
+	}.Encode()
+
+	var numbers phoneNumberList
+	err := getJSON(c.NumbersURL+query, &numbers)
+	if err != nil {
+		return nil, err
+	}
+	if !numbers.NumbersEnabled || len(numbers.Numbers) == 0 {
+		return nil, nil
+	}
+	var mapping conferenceMapping
+	err = getJSON(c.MapperURL+query, &mapping)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := strconv.ParseInt(mapping.ID.String(), 10, 64); err != nil {
+		return nil, fmt.Errorf("conference mapper: invalid id %q", mapping.ID)
+	}
+
+	countries := make([]string, 0, len(numbers.Numbers))
+	for country := range numbers.Numbers {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+	dialIn := DialIn{PIN: mapping.ID.String()}
+	for _, country := range countries {
+		if len(dialIn.Numbers) == maxDialInNumbers {
+			break
+		}
+		if len(numbers.Numbers[country]) == 0 {
+			continue
+		}
+		dialIn.Numbers = append(dialIn.Numbers, DialInNumber{
+			Country: country,
+			Number:  numbers.Numbers[country][0],
+		})
+	}
+	return &dialIn, nil
+}
+
+func getJSON(endpoint string, v interface{}) error {
+	client := http.Client{Timeout: dialInTimeout}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("dial-in info: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// dialInBlock creates the block telling an invitee how to join by phone.
+func dialInBlock(locale string, dialIn *DialIn) slack.Block {
+	numbers := make([]string, 0, len(dialIn.Numbers))
+	for _, n := range dialIn.Numbers {
+		numbers = append(numbers, fmt.Sprintf("%s (%s)", n.Number, n.Country))
+	}
+	return slack.NewContextBlock("", slack.NewTextBlockObject(
+		slack.MarkdownType,
+		tr(locale, "dialin.text", strings.Join(numbers, ", "), dialIn.PIN),
+		false,
+		false,
+	))
+}
@@ -0,0 +1,122 @@
+package jitsi
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// actionScheduleInvite is the action id of the button offered to a host
+// when an invitee is in do not disturb. The value of the button is a json
+// encoded scheduledInvite.
+const actionScheduleInvite = "schedule_invite"
+
+// scheduledInvite is an invite that is held back until the invitee's do not
+// disturb ends.
+type scheduledInvite struct {
+	MeetingID string  `json:"m"`
+	UserID    string  `json:"u"`
+	HostID    string  `json:"h"`
+	Host      string  `json:"s"`
+	URL       string  `json:"l"`
+	RoomName  string  `json:"r"`
+	Channel   string  `json:"c"`
+	Locale    string  `json:"o"`
+	DialIn    *DialIn `json:"d,omitempty"`
+	Passcode  string  `json:"p,omitempty"`
+	PostAt    int64   `json:"t"`
+}
+
+// dndUntil returns when the user's do not disturb ends or the zero time if
+// the user is not in do not disturb.
+func dndUntil(slackClient *slack.Client, userID string, now time.Time) (time.Time, error) {
+	status, err := slackClient.GetDNDInfo(&userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if status.SnoozeEnabled && int64(status.SnoozeEndTime) > now.Unix() {
+		return time.Unix(int64(status.SnoozeEndTime), 0), nil
+	}
+	if status.Enabled &&
+		int64(status.NextStartTimestamp) <= now.Unix() &&
+		int64(status.NextEndTimestamp) > now.Unix() {
+		return time.Unix(int64(status.NextEndTimestamp), 0), nil
+	}
+	return time.Time{}, nil
+}
+
+// dndNotice creates the blocks telling a host that an invite was held back
+// and offering to send it when do not disturb ends.
+func dndNotice(locale string, invite *Invite, until time.Time) ([]slack.Block, error) {
+	value, err := json.Marshal(scheduledInvite{
+		MeetingID: invite.MeetingID,
+		UserID:    invite.UserID,
+		HostID:    invite.HostID,
+		Host:      invite.Host,
+		URL:       invite.URL,
+		RoomName:  invite.RoomName,
+		Channel:   invite.Channel,
+		Locale:    invite.Locale,
+		DialIn:    invite.DialIn,
+		Passcode:  invite.Passcode,
+		PostAt:    until.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg := tr(
+		locale,
+		"dnd.notice",
+		invite.UserID,
+		slackDate(locale, until),
+	)
+	schedule := slack.NewButtonBlockElement(
+		actionScheduleInvite,
+		string(value),
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "dnd.button"), false, false),
+	)
+	return []slack.Block{
+		slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, msg, false, false),
+			nil,
+			slack.NewAccessory(schedule),
+		),
+	}, nil
+}
+
+// scheduleInvite schedules a held back invite to be delivered when the
+// invitee's do not disturb ends.
+func scheduleInvite(token, value string, style messageStyle) (*scheduledInvite, error) {
+	var si scheduledInvite
+	err := json.Unmarshal([]byte(value), &si)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &Invite{
+		MeetingID: si.MeetingID,
+		UserID:    si.UserID,
+		HostID:    si.HostID,
+		Host:      si.Host,
+		URL:       si.URL,
+		RoomName:  si.RoomName,
+		Channel:   si.Channel,
+		Locale:    si.Locale,
+		DialIn:    si.DialIn,
+		Passcode:  si.Passcode,
+	}
+	msg := inviteText(invite, style)
+	slackClient := slack.New(token)
+	_, _, err = slackClient.ScheduleMessage(
+		si.Channel,
+		strconv.FormatInt(si.PostAt, 10),
+		inviteMsgOptions(invite, msg, style)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &si, nil
+}
@@ -0,0 +1,78 @@
+package jitsi
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// DefaultDynamoMaxAttempts is how often dynamodb requests are attempted
+	// when throttled or failing with a retryable error.
+	DefaultDynamoMaxAttempts = 5
+	// DefaultDynamoMaxBackoff is the longest wait between attempts, which
+	// keeps retried slash commands within the time slack waits for them.
+	DefaultDynamoMaxBackoff = time.Second
+
+	// dynamoBaseBackoff is the wait before the first retry, which doubles
+	// with every attempt up to the max backoff.
+	dynamoBaseBackoff = 25 * time.Millisecond
+)
+
+// dynamoThrottlingCodes are the error codes of dynamodb requests rejected
+// because a table or the account is briefly over its capacity.
+var dynamoThrottlingCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+}
+
+// NewDynamoRetryer creates the retryer of dynamodb clients. It retries
+// throttled and other retryable requests up to maxAttempts times with
+// exponential backoff and full jitter, so that instances retrying a hot
+// table do not retry in lockstep.
+func NewDynamoRetryer(maxAttempts int, maxBackoff time.Duration) aws.Retryer {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultDynamoMaxAttempts
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultDynamoMaxBackoff
+	}
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = maxAttempts
+		o.MaxBackoff = maxBackoff
+		o.Backoff = jitterBackoff{base: dynamoBaseBackoff, max: maxBackoff}
+	})
+}
+
+// jitterBackoff waits a random duration of up to base doubled by the attempt,
+// capped at max.
+type jitterBackoff struct {
+	base, max time.Duration
+}
+
+// BackoffDelay returns how long to wait before the attempt.
+func (j jitterBackoff) BackoffDelay(attempt int, err error) (time.Duration, error) {
+	ceiling := j.max
+	if attempt < 32 && j.base<<uint(attempt) < ceiling {
+		ceiling = j.base << uint(attempt)
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1)), nil
+}
+
+// throttled reports whether a request failed because dynamodb throttled it
+// after every attempt, or because the retries of the client ran out, so the
+// caller may succeed when trying again shortly.
+func throttled(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && dynamoThrottlingCodes[apiErr.ErrorCode()] {
+		return true
+	}
+	var quotaErr ratelimit.QuotaExceededError
+	return errors.As(err, &quotaErr)
+}
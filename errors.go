@@ -0,0 +1,45 @@
+package jitsi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// renderError responds to a slash command with an ephemeral message
+// explaining the failure. Slack shows an unhelpful generic error for
+// responses other than 200 so failures are rendered instead. The details of
+// the failure should be logged by the caller.
+func renderError(w http.ResponseWriter, locale, key string, args ...interface{}) {
+	writeMsg(w, &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         tr(locale, key, args...),
+	})
+}
+
+// renderStoreError responds to a slash command like renderError when a store
+// failed. Callers are asked to try again shortly instead when the store was
+// throttled, since a briefly hot table usually recovers within seconds.
+func renderStoreError(w http.ResponseWriter, locale, key string, err error) {
+	if throttled(err) {
+		key = "error.throttled"
+	}
+	renderError(w, locale, key)
+}
+
+// inviteFailures creates the blocks telling a host which users could not be
+// sent an invite.
+func inviteFailures(locale string, userIDs []string) []slack.Block {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	mentions := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		mentions[i] = "<@" + userID + ">"
+	}
+	msg := tr(locale, "error.invite_failed", strings.Join(mentions, ", "))
+	return []slack.Block{
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, msg, false, false)),
+	}
+}
@@ -0,0 +1,113 @@
+package jitsi
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+)
+
+// expired returns whether the links of the meeting stopped being valid.
+func (m *MeetingRecord) expired(now time.Time) bool {
+	return m.ExpiresAt > 0 && now.Unix() >= m.ExpiresAt
+}
+
+// MeetingExpiry marks meetings as expired once their links stopped being
+// valid and edits their announcements so they no longer look joinable.
+// Expiry is scheduled in-process, stored meetings are purged by the table's
+// ttl on the purge-at attribute.
+type MeetingExpiry struct {
+	Meetings    MeetingReadWriter
+	TokenReader TokenReader
+	Tasks       *DelayedTasks
+	// MessageConfig is optional and applies the team's branding to the
+	// edited announcements.
+	MessageConfig MessageConfigReader
+	Log           zerolog.Logger
+}
+
+// Schedule edits the announcement of the meeting once it expires. Meetings
+// without an expiry or an announcement posted by the app are skipped.
+func (e *MeetingExpiry) Schedule(record *MeetingRecord) {
+	if record.ExpiresAt == 0 || record.MessageTS == "" {
+		return
+	}
+	teamID, meetingID := record.TeamID, record.MeetingID
+	e.Tasks.After(time.Until(time.Unix(record.ExpiresAt, 0)), func() {
+		e.expire(teamID, meetingID)
+	})
+}
+
+func (e *MeetingExpiry) expire(teamID, meetingID string) {
+	meeting, err := e.Meetings.Get(teamID, meetingID)
+	if err != nil && err.Error() == errMissingMeeting {
+		// the meeting was already purged
+		return
+	}
+	if err != nil {
+		e.Log.Error().
+			Err(err).
+			Str("meeting_id", meetingID).
+			Msg("retrieving meeting for expiry")
+		return
+	}
+	// ended and cancelled meetings no longer offer to join
+	if meeting.Status != MeetingStarted && meeting.Status != MeetingActive {
+		return
+	}
+	err = e.Meetings.SetStatus(teamID, meetingID, MeetingExpired)
+	if err != nil {
+		e.Log.Error().
+			Err(err).
+			Str("meeting_id", meetingID).
+			Msg("marking meeting expired")
+		return
+	}
+
+	token, err := e.TokenReader.GetTokenForTeam(teamID)
+	if err != nil {
+		e.Log.Warn().
+			Err(err).
+			Str("team_id", teamID).
+			Msg("retrieving token for expiry")
+		return
+	}
+	cfg := MessageCfg{TeamID: teamID}
+	if e.MessageConfig != nil {
+		cfg, err = e.MessageConfig.Get(teamID)
+		if err != nil {
+			e.Log.Warn().
+				Err(err).
+				Str("team_id", teamID).
+				Msg("retrieving message config for expiry")
+		}
+	}
+	_, _, _, err = slack.New(token.AccessToken).UpdateMessage(
+		meeting.ChannelID,
+		meeting.MessageTS,
+		expiredRoomMsgOptions(meeting, cfg.announcementStyle())...,
+	)
+	if err != nil {
+		e.Log.Warn().
+			Err(err).
+			Str("meeting_id", meetingID).
+			Msg("updating expired announcement")
+	}
+}
+
+// expiredRoomMsgOptions replaces the join button of a meeting's announcement
+// with a notice that the meeting expired.
+func expiredRoomMsgOptions(meeting *MeetingRecord, style messageStyle) []slack.MsgOption {
+	title := announcementTitle(meeting, style)
+	return []slack.MsgOption{
+		slack.MsgOptionText(title, false),
+		slack.MsgOptionAttachments(slack.Attachment{
+			Color:    style.color(),
+			Fallback: title,
+			Blocks: slack.Blocks{BlockSet: []slack.Block{
+				slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, title, false, false), nil, nil),
+				slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, tr(meeting.Locale, "expired.summary"), false, false)),
+			}},
+		}),
+	}
+}
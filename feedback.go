@@ -0,0 +1,151 @@
+package jitsi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/rs/xid"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// KeyFeedbackTeamID is the dynamo key for the team of the feedback. This
+	// key is the partition key.
+	KeyFeedbackTeamID = "team-id"
+	// KeyFeedbackID is the dynamo key for the feedback id. This key is the
+	// sort key and sorts feedback by creation time.
+	KeyFeedbackID = "feedback-id"
+
+	// callbackFeedback is the callback id of the feedback modal.
+	callbackFeedback = "feedback"
+
+	blockFeedbackText  = "feedback_text"
+	actionFeedbackText = "feedback_text"
+
+	// maxFeedbackTextLength limits the feedback users may submit at once.
+	maxFeedbackTextLength = 3000
+)
+
+// Feedback is the feedback a user submitted about the app.
+type Feedback struct {
+	TeamID     string `dynamodbav:"team-id" json:"team_id"`
+	FeedbackID string `dynamodbav:"feedback-id" json:"feedback_id"`
+	TeamName   string `dynamodbav:"team-name" json:"team_name"`
+	UserID     string `dynamodbav:"user-id" json:"user_id"`
+	UserName   string `dynamodbav:"user-name" json:"user_name"`
+	// ChannelID is the channel the feedback modal was opened from.
+	ChannelID string `dynamodbav:"channel,omitempty" json:"channel_id,omitempty"`
+	Text      string `dynamodbav:"text" json:"text"`
+	CreatedAt int64  `dynamodbav:"created-at" json:"created_at"`
+}
+
+// FeedbackWriter provides an interface for storing the feedback of users.
+type FeedbackWriter interface {
+	Store(feedback *Feedback) error
+}
+
+// newFeedback creates the feedback submitted by a user.
+func newFeedback(teamID, teamName, userID, userName, channelID, text string) *Feedback {
+	now := time.Now()
+	return &Feedback{
+		TeamID:     teamID,
+		FeedbackID: xid.NewWithTime(now).String(),
+		TeamName:   teamName,
+		UserID:     userID,
+		UserName:   userName,
+		ChannelID:  channelID,
+		Text:       text,
+		CreatedAt:  now.Unix(),
+	}
+}
+
+// feedbackView creates the modal users submit feedback in. The channel the
+// modal is opened from is kept as private metadata.
+func feedbackView(locale, channelID string) slack.ModalViewRequest {
+	input := slack.NewPlainTextInputBlockElement(
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "feedback.placeholder"), false, false),
+		actionFeedbackText,
+	)
+	input.Multiline = true
+	input.MaxLength = maxFeedbackTextLength
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      callbackFeedback,
+		PrivateMetadata: channelID,
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "feedback.title"), false, false),
+		Submit:          slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "feedback.submit"), false, false),
+		Close:           slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "button.cancel"), false, false),
+		Blocks: slack.Blocks{
+			BlockSet: []slack.Block{
+				slack.NewInputBlock(
+					blockFeedbackText,
+					slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "feedback.label"), false, false),
+					input,
+				),
+			},
+		},
+	}
+}
+
+// FeedbackStore stores feedback in aws dynamodb.
+type FeedbackStore struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+// Store will persist the feedback.
+func (f *FeedbackStore) Store(feedback *Feedback) error {
+	av, err := attributevalue.MarshalMap(feedback)
+	if err != nil {
+		return err
+	}
+	_, err = f.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(f.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// FeedbackWebhook forwards feedback to a webhook such as a slack incoming
+// webhook. The message text describes the feedback and the feedback itself
+// is included for other receivers.
+type FeedbackWebhook struct {
+	URL string
+}
+
+// Store forwards the feedback to the webhook.
+func (f *FeedbackWebhook) Store(feedback *Feedback) error {
+	body, err := json.Marshal(struct {
+		Text     string    `json:"text"`
+		Feedback *Feedback `json:"feedback"`
+	}{
+		Text: fmt.Sprintf(
+			"Feedback from %s (%s) in %s (%s):\n%s",
+			feedback.UserName,
+			feedback.UserID,
+			feedback.TeamName,
+			feedback.TeamID,
+			feedback.Text,
+		),
+		Feedback: feedback,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(f.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("feedback webhook: %s", resp.Status)
+	}
+	return nil
+}
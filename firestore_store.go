@@ -0,0 +1,397 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// StoreBackendFirestore stores tokens and server configuration in google
+	// cloud firestore, e.g. for deployments running on cloud run.
+	StoreBackendFirestore = "firestore"
+
+	// firestoreTokens holds the token of each team in a document by team id.
+	// The user tokens of its users are held in its firestoreUsers collection
+	// by user id.
+	firestoreTokens = "tokens"
+	firestoreUsers  = "users"
+	// firestoreServerCfg holds the server configuration of each team in a
+	// document by team id.
+	firestoreServerCfg = "server-cfg"
+)
+
+// firestoreMissing reports whether reading a document failed because it
+// does not exist.
+func firestoreMissing(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
+
+// firestoreToken is a token as it is stored in a document. The access token
+// is replaced by its ciphertext when tokens are encrypted.
+type firestoreToken struct {
+	AccessToken string `firestore:"access-token,omitempty"`
+	Scope       string `firestore:"scope,omitempty"`
+	// BotUserID, AppID, AuthedUserID and EnterpriseID are only stored for
+	// the tokens of teams.
+	BotUserID    string `firestore:"bot-user-id,omitempty"`
+	AppID        string `firestore:"app-id,omitempty"`
+	AuthedUserID string `firestore:"authed-user-id,omitempty"`
+	EnterpriseID string `firestore:"enterprise-id,omitempty"`
+	KeyID        string `firestore:"key-id,omitempty"`
+	DataKey      []byte `firestore:"data-key,omitempty"`
+	Ciphertext   []byte `firestore:"ciphertext,omitempty"`
+}
+
+// FirestoreTokenStore stores and retrieves access tokens from google cloud
+// firestore.
+type FirestoreTokenStore struct {
+	Client *firestore.Client
+	// Cipher is optional and encrypts the access tokens that are stored.
+	// Tokens stored before they were encrypted are still read.
+	Cipher TokenCipher
+}
+
+func (f *FirestoreTokenStore) team(teamID string) *firestore.DocumentRef {
+	return f.Client.Collection(firestoreTokens).Doc(teamID)
+}
+
+func (f *FirestoreTokenStore) user(teamID, userID string) *firestore.DocumentRef {
+	return f.team(teamID).Collection(firestoreUsers).Doc(userID)
+}
+
+// encrypt replaces the access token with its ciphertext when tokens are
+// encrypted.
+func (f *FirestoreTokenStore) encrypt(id string, token *firestoreToken) error {
+	if f.Cipher == nil {
+		return nil
+	}
+	enc, err := f.Cipher.Encrypt(id, token.AccessToken)
+	if err != nil {
+		return err
+	}
+	token.AccessToken = ""
+	token.KeyID, token.DataKey, token.Ciphertext = enc.KeyID, enc.DataKey, enc.Ciphertext
+	return nil
+}
+
+// decrypt returns the access token. Tokens without a key id were stored in
+// plaintext.
+func (f *FirestoreTokenStore) decrypt(id string, token *firestoreToken) (string, error) {
+	if token.KeyID == "" {
+		return token.AccessToken, nil
+	}
+	if f.Cipher == nil {
+		return "", errors.New(errMissingTokenCipher)
+	}
+	return f.Cipher.Decrypt(id, &EncryptedToken{
+		KeyID:      token.KeyID,
+		DataKey:    token.DataKey,
+		Ciphertext: token.Ciphertext,
+	})
+}
+
+// GetTokenForTeam retrieves the access token stored with the provided team
+// id.
+func (f *FirestoreTokenStore) GetTokenForTeam(teamID string) (*TokenData, error) {
+	snap, err := f.team(teamID).Get(context.TODO())
+	if firestoreMissing(err) {
+		return nil, errors.New(errMissingAuthToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token firestoreToken
+	err = snap.DataTo(&token)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := f.decrypt(teamID, &token)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenData{
+		TeamID:       teamID,
+		AccessToken:  accessToken,
+		Scope:        token.Scope,
+		BotUserID:    token.BotUserID,
+		AppID:        token.AppID,
+		AuthedUserID: token.AuthedUserID,
+		EnterpriseID: token.EnterpriseID,
+	}, nil
+}
+
+// Store will store access token data, replacing the previous token of the
+// team. The user tokens of its users are kept.
+func (f *FirestoreTokenStore) Store(data *TokenData) error {
+	token := &firestoreToken{
+		AccessToken:  data.AccessToken,
+		Scope:        data.Scope,
+		BotUserID:    data.BotUserID,
+		AppID:        data.AppID,
+		AuthedUserID: data.AuthedUserID,
+		EnterpriseID: data.EnterpriseID,
+	}
+	err := f.encrypt(data.TeamID, token)
+	if err != nil {
+		return err
+	}
+	_, err = f.team(data.TeamID).Set(context.TODO(), token)
+	return err
+}
+
+// Remove will remove access token data for the team, including the user
+// tokens of its users.
+func (f *FirestoreTokenStore) Remove(teamID string) error {
+	ctx := context.TODO()
+	// deleting a document does not delete its collections
+	users := f.team(teamID).Collection(firestoreUsers).DocumentRefs(ctx)
+	for {
+		doc, err := users.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		_, err = doc.Delete(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := f.team(teamID).Delete(ctx)
+	return err
+}
+
+// GetTokenForUser retrieves the user token stored for the user of a team.
+func (f *FirestoreTokenStore) GetTokenForUser(teamID, userID string) (*UserTokenData, error) {
+	snap, err := f.user(teamID, userID).Get(context.TODO())
+	if firestoreMissing(err) {
+		return nil, errors.New(errMissingUserToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token firestoreToken
+	err = snap.DataTo(&token)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := f.decrypt(userTokenID(teamID, userID), &token)
+	if err != nil {
+		return nil, err
+	}
+	return &UserTokenData{
+		TeamID:      teamID,
+		UserID:      userID,
+		AccessToken: accessToken,
+		Scope:       token.Scope,
+	}, nil
+}
+
+// StoreUserToken will store the user token of a user. The token of the team
+// must be stored first.
+func (f *FirestoreTokenStore) StoreUserToken(data *UserTokenData) error {
+	token := &firestoreToken{
+		AccessToken: data.AccessToken,
+		Scope:       data.Scope,
+	}
+	err := f.encrypt(userTokenID(data.TeamID, data.UserID), token)
+	if err != nil {
+		return err
+	}
+	return f.Client.RunTransaction(context.TODO(), func(ctx context.Context, tx *firestore.Transaction) error {
+		_, err := tx.Get(f.team(data.TeamID))
+		if firestoreMissing(err) {
+			return errors.New(errMissingAuthToken)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Set(f.user(data.TeamID, data.UserID), token)
+	})
+}
+
+// RemoveUserToken will remove the user token of a user.
+func (f *FirestoreTokenStore) RemoveUserToken(teamID, userID string) error {
+	_, err := f.user(teamID, userID).Delete(context.TODO())
+	return err
+}
+
+// RemoveTeam will remove the token of a team along with the user tokens of
+// its users.
+func (f *FirestoreTokenStore) RemoveTeam(teamID string) error {
+	return f.Remove(teamID)
+}
+
+// RemoveUser will remove the user token of a user.
+func (f *FirestoreTokenStore) RemoveUser(teamID, userID string) error {
+	return f.RemoveUserToken(teamID, userID)
+}
+
+// ExportTeam will export the install of a team. The token is not exported.
+func (f *FirestoreTokenStore) ExportTeam(teamID string) (interface{}, error) {
+	data, err := f.GetTokenForTeam(teamID)
+	if err != nil {
+		return nil, err
+	}
+	install := installAudit(data)
+	install["authed_user_id"] = data.AuthedUserID
+	return install, nil
+}
+
+// TeamIDs lists the teams with a stored token.
+func (f *FirestoreTokenStore) TeamIDs() ([]string, error) {
+	return firestoreIDs(f.Client.Collection(firestoreTokens).DocumentRefs(context.TODO()))
+}
+
+// UserIDs lists the users of a team with a stored user token.
+func (f *FirestoreTokenStore) UserIDs(teamID string) ([]string, error) {
+	return firestoreIDs(f.team(teamID).Collection(firestoreUsers).DocumentRefs(context.TODO()))
+}
+
+// firestoreIDs returns the ids of the documents of a collection.
+func firestoreIDs(docs *firestore.DocumentRefIterator) ([]string, error) {
+	var ids []string
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.ID)
+	}
+}
+
+// firestoreServerCfgData is the server configuration of a team as it is
+// stored in a document.
+type firestoreServerCfgData struct {
+	Server            string            `firestore:"server-url,omitempty"`
+	RoomNaming        string            `firestore:"room-naming,omitempty"`
+	Words             Wordlists         `firestore:"wordlists"`
+	JWTLifetime       int64             `firestore:"jwt-lifetime,omitempty"`
+	OpenServerChanges bool              `firestore:"open-server-changes,omitempty"`
+	Permissions       map[string]string `firestore:"permissions,omitempty"`
+	URLConfig         []string          `firestore:"url-config,omitempty"`
+	UpdatedAt         time.Time         `firestore:"updated-at,omitempty"`
+}
+
+// FirestoreServerCfgStore stores the server configuration of teams in google
+// cloud firestore.
+type FirestoreServerCfgStore struct {
+	Client *firestore.Client
+	ServerDefaults
+}
+
+// Store will persist the server of a team.
+func (f *FirestoreServerCfgStore) Store(data *ServerCfgData) error {
+	return f.update(data.TeamID, "server-url", data.Server)
+}
+
+// Remove will remove the configured server for a team. That team will use
+// the default server while keeping its other settings.
+func (f *FirestoreServerCfgStore) Remove(teamID string) error {
+	return f.update(teamID, "server-url", firestore.Delete)
+}
+
+// SetWordlists will persist the words random room names of a team are
+// generated from.
+func (f *FirestoreServerCfgStore) SetWordlists(teamID string, words Wordlists) error {
+	return f.update(teamID, "wordlists", words)
+}
+
+// SetJWTLifetime will persist the lifetime of the team's meeting tokens. A
+// zero lifetime restores the default.
+func (f *FirestoreServerCfgStore) SetJWTLifetime(teamID string, lifetime time.Duration) error {
+	if lifetime <= 0 {
+		return f.update(teamID, "jwt-lifetime", firestore.Delete)
+	}
+	return f.update(teamID, "jwt-lifetime", int64(lifetime.Seconds()))
+}
+
+// SetOpenServerChanges will persist whether everyone may change the server
+// of a team.
+func (f *FirestoreServerCfgStore) SetOpenServerChanges(teamID string, open bool) error {
+	return f.update(teamID, "open-server-changes", open)
+}
+
+// SetPermissions will persist who the subcommands of a team are limited to.
+func (f *FirestoreServerCfgStore) SetPermissions(teamID string, permissions map[string]string) error {
+	if len(permissions) == 0 {
+		return f.update(teamID, "permissions", firestore.Delete)
+	}
+	return f.update(teamID, "permissions", permissions)
+}
+
+// SetURLConfig will persist the conference config overrides of a team's
+// meeting links. No overrides restore the defaults of the server.
+func (f *FirestoreServerCfgStore) SetURLConfig(teamID string, overrides []string) error {
+	if len(overrides) == 0 {
+		return f.update(teamID, "url-config", firestore.Delete)
+	}
+	return f.update(teamID, "url-config", overrides)
+}
+
+// SetRoomNaming will persist how rooms of a team are named.
+func (f *FirestoreServerCfgStore) SetRoomNaming(teamID, naming string) error {
+	return f.update(teamID, "room-naming", naming)
+}
+
+// update sets a field of a team's configuration and records when it was
+// changed. The other fields are kept.
+func (f *FirestoreServerCfgStore) update(teamID, field string, value interface{}) error {
+	_, err := f.Client.Collection(firestoreServerCfg).Doc(teamID).Set(
+		context.TODO(),
+		map[string]interface{}{
+			field:        value,
+			"updated-at": time.Now(),
+		},
+		firestore.MergeAll,
+	)
+	return err
+}
+
+// Get retrieves the server configuration for a team. This will provide
+// the default if no configuration is stored for the team.
+func (f *FirestoreServerCfgStore) Get(teamID string) (ServerCfg, error) {
+	snap, err := f.Client.Collection(firestoreServerCfg).Doc(teamID).Get(context.TODO())
+	if firestoreMissing(err) {
+		return f.apply(ServerCfg{}), nil
+	}
+	if err != nil {
+		return ServerCfg{}, err
+	}
+	var data firestoreServerCfgData
+	err = snap.DataTo(&data)
+	if err != nil {
+		return ServerCfg{}, err
+	}
+	return f.apply(ServerCfg{
+		Server:            data.Server,
+		RoomNaming:        data.RoomNaming,
+		Words:             data.Words,
+		JWTLifetime:       time.Duration(data.JWTLifetime) * time.Second,
+		OpenServerChanges: data.OpenServerChanges,
+		Permissions:       data.Permissions,
+		URLConfig:         data.URLConfig,
+		UpdatedAt:         data.UpdatedAt,
+	}), nil
+}
+
+// RemoveTeam will remove the server configuration of a team.
+func (f *FirestoreServerCfgStore) RemoveTeam(teamID string) error {
+	_, err := f.Client.Collection(firestoreServerCfg).Doc(teamID).Delete(context.TODO())
+	return err
+}
+
+// ExportTeam will export the server configuration of a team.
+func (f *FirestoreServerCfgStore) ExportTeam(teamID string) (interface{}, error) {
+	return f.Get(teamID)
+}
@@ -3,18 +3,35 @@ module github.com/jitsi/jitsi-slack
 go 1.16
 
 require (
+	cloud.google.com/go/firestore v1.4.0
+	github.com/aws/aws-dax-go v1.2.8
+	github.com/aws/aws-sdk-go v1.36.22
 	github.com/aws/aws-sdk-go-v2 v1.2.0
 	github.com/aws/aws-sdk-go-v2/config v1.1.1
+	github.com/aws/aws-sdk-go-v2/credentials v1.1.1
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue v1.0.2
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression v1.0.2
 	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.1.1
+	github.com/aws/aws-sdk-go-v2/service/dynamodbstreams v1.1.1
+	github.com/aws/aws-sdk-go-v2/service/kms v1.1.1
+	github.com/aws/aws-sdk-go-v2/service/secretsmanager v1.1.1
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.1.1
+	github.com/aws/aws-sdk-go-v2/service/ssm v1.1.1
+	github.com/aws/smithy-go v1.1.0
 	github.com/caarlos0/env/v6 v6.5.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/go-redis/redis/v8 v8.4.4
 	github.com/jitsi/prometheus-stats v0.1.0
 	github.com/justinas/alice v1.2.0
 	github.com/prometheus/client_golang v1.9.0
+	github.com/rs/xid v1.2.1
 	github.com/rs/zerolog v1.20.0
 	github.com/slack-go/slack v0.8.1
 	github.com/vincent-petithory/dataurl v0.0.0-20191104211930-d1553a71de50
+	go.etcd.io/bbolt v1.3.3
+	go.mongodb.org/mongo-driver v1.4.6
+	golang.org/x/oauth2 v0.0.0-20210220000619-9bb904979d93
 	golang.org/x/sys v0.0.0-20210303074136-134d130e1a04 // indirect
+	google.golang.org/api v0.36.0
+	google.golang.org/grpc v1.33.2
 )
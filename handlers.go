@@ -1,7 +1,6 @@
 package jitsi
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,7 +9,10 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
@@ -26,12 +28,77 @@ const (
 )
 
 var (
-	atMentionRE    = regexp.MustCompile(`<@([^>|]+)`)
-	serverCmdRE    = regexp.MustCompile(`^server`)
-	serverConfigRE = regexp.MustCompile(`^server\s+(<https?:\/\/\S+>)`)
-	helpCmdRE      = regexp.MustCompile(`^help`)
+	atMentionRE = regexp.MustCompile(`<@([^>|]+)`)
+	serverURLRE = regexp.MustCompile(`^<(https?:\/\/[^>|]+)(\|[^>]*)?>$`)
 )
 
+// MessageConfigReader provides an interface for reading the message
+// customization of a team.
+type MessageConfigReader interface {
+	Get(teamID string) (MessageCfg, error)
+}
+
+// MessageConfigReadWriter provides an interface for reading and writing the
+// message customization of a team.
+type MessageConfigReadWriter interface {
+	MessageConfigReader
+	Store(cfg *MessageCfg) error
+	Remove(teamID string) error
+}
+
+// newMeetingRecord creates the record of a meeting started from a channel.
+func newMeetingRecord(locale, teamID, hostID, channelID, responseURL string, meeting *Meeting) *MeetingRecord {
+	record := &MeetingRecord{
+		TeamID:       teamID,
+		MeetingID:    meeting.ID,
+		HostID:       hostID,
+		RoomName:     meeting.RoomName,
+		RoomKey:      strings.ToLower(meeting.RoomName),
+		URL:          meeting.URL,
+		Server:       meeting.Host,
+		Locale:       locale,
+		ChannelID:    channelID,
+		ResponseURL:  responseURL,
+		Status:       MeetingStarted,
+		CreatedAt:    time.Now().Unix(),
+		Participants: map[string]Participant{},
+	}
+	if !meeting.Expires.IsZero() {
+		record.ExpiresAt = meeting.Expires.Unix()
+	}
+	return record
+}
+
+// recordMeeting stores a started meeting when meeting tracking is enabled.
+// Failing to record a meeting does not prevent it from being used.
+func recordMeeting(log *zerolog.Logger, meetings MeetingReadWriter, record *MeetingRecord) {
+	if meetings == nil {
+		return
+	}
+	err := meetings.Store(record)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Msg("recording meeting")
+	}
+}
+
+// messageConfig retrieves the message customization of a team. The default
+// messages are used when customization is disabled or cannot be retrieved.
+func messageConfig(r *http.Request, reader MessageConfigReader, teamID string) MessageCfg {
+	if reader == nil {
+		return MessageCfg{TeamID: teamID}
+	}
+	cfg, err := reader.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("retrieving message config")
+		return MessageCfg{TeamID: teamID}
+	}
+	return cfg
+}
+
 // TokenReader provides an interface for reading access token data from
 // a token store.
 type TokenReader interface {
@@ -43,52 +110,60 @@ type TokenReader interface {
 type ServerConfigWriter interface {
 	Store(*ServerCfgData) error
 	Remove(string) error
+	SetRoomNaming(teamID, naming string) error
+	SetWordlists(teamID string, words Wordlists) error
+	SetJWTLifetime(teamID string, lifetime time.Duration) error
+	SetOpenServerChanges(teamID string, open bool) error
+	SetPermissions(teamID string, permissions map[string]string) error
+	SetURLConfig(teamID string, overrides []string) error
 }
 
-func handleRequestValidation(w http.ResponseWriter, r *http.Request, SlackSigningSecret string) bool {
-	ts := r.Header.Get(RequestTimestampHeader)
-	sig := r.Header.Get(RequestSignatureHeader)
-	if ts == "" || sig == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		return false
-	}
+func install(w http.ResponseWriter, locale, sharableURL string) {
+	writeMsg(w, installMsg(locale, sharableURL))
+}
 
-	body, err := ioutil.ReadAll(r.Body)
+func writeMsg(w http.ResponseWriter, msg *slack.Msg) {
+	resp, err := json.Marshal(msg)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		return false
-	}
-	defer r.Body.Close()
-
-	if !ValidRequest(SlackSigningSecret, string(body), ts, sig) {
-		w.WriteHeader(http.StatusUnauthorized)
-		return false
+		return
 	}
-
-	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-	return true
-}
-
-func help(w http.ResponseWriter) {
 	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(helpMessage))
+	w.Write(resp)
 }
 
-func install(w http.ResponseWriter, sharableURL string) {
-	installMsg := fmt.Sprintf(installMessage, sharableURL)
+func writeViewResponse(w http.ResponseWriter, viewResp *slack.ViewSubmissionResponse) {
+	resp, err := json.Marshal(viewResp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(installMsg))
+	w.Write(resp)
 }
 
 // EventHandler is used to handle event callbacks from Slack api.
 type EventHandler struct {
-	SlackSigningSecret string
-	TokenWriter        TokenWriter
+	TokenWriter TokenWriter
+	// WorkflowStep is optional and runs the workflow builder step of the
+	// app.
+	WorkflowStep *WorkflowStep
+	// TeamData are the stores the data of teams is removed from when they
+	// uninstall the app.
+	TeamData []TeamDataRemover
+	// TokenReader is optional and is used to tell which app a team installed
+	// when serving several apps.
+	TokenReader TokenReader
+	// UserTokens is optional and removes the user tokens that are revoked.
+	UserTokens UserTokenReadWriter
+	// Audit is optional and records uninstalls and revoked tokens.
+	Audit AuditWriter
 }
 
-// Handle handles event callbacks for the integration.
+// Handle handles event callbacks for the integration. Requests must be
+// verified by a RequestVerifier.
 // adapated from https://github.com/slack-go/slack/blob/master/examples/eventsapi/events.go
 func (e *EventHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
@@ -99,240 +174,3045 @@ func (e *EventHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	sv, err := slack.NewSecretsVerifier(r.Header, e.SlackSigningSecret)
+	if event, ok := parseWorkflowStepExecute(body); ok && e.WorkflowStep != nil {
+		// the meeting is created once slack got its response since the
+		// event is retried when the response takes too long
+		w.WriteHeader(http.StatusOK)
+		go e.WorkflowStep.execute(hlog.FromRequest(r), event)
+		return
+	}
+	eventsAPIEvent, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		hlog.FromRequest(r).Warn().Err(err).Msg("evhandle: parse failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if eventsAPIEvent.Type == slackevents.URLVerification {
+		var cr *slackevents.ChallengeResponse
+		err := json.Unmarshal([]byte(body), &cr)
+		if err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Msg("evhandle: challenge resp failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "text")
+		w.Write([]byte(cr.Challenge))
+	}
+
+	if eventsAPIEvent.Type == slackevents.CallbackEvent {
+		innerEvent := eventsAPIEvent.InnerEvent
+		switch ev := innerEvent.Data.(type) {
+		case *slackevents.AppUninstalledEvent:
+			{
+				if e.installedApp(eventsAPIEvent.TeamID, eventsAPIEvent.APIAppID) {
+					e.removeToken(r, slackevents.AppUninstalled, eventsAPIEvent.TeamID)
+					removeTeamData(hlog.FromRequest(r), eventsAPIEvent.TeamID, e.TeamData)
+					recordAudit(hlog.FromRequest(r), e.Audit, newAuditEvent(eventsAPIEvent.TeamID, "", AuditUninstall, eventsAPIEvent.APIAppID, nil, nil))
+				}
+			}
+		case *slackevents.TokensRevokedEvent:
+			{
+				if !e.installedApp(eventsAPIEvent.TeamID, eventsAPIEvent.APIAppID) {
+					break
+				}
+				if len(ev.Tokens.Bot) > 0 {
+					e.removeToken(r, slackevents.TokensRevoked, eventsAPIEvent.TeamID)
+				}
+				if e.UserTokens != nil {
+					e.removeUserTokens(r, eventsAPIEvent.TeamID, ev.Tokens.Oauth)
+				}
+				recordAudit(hlog.FromRequest(r), e.Audit, newAuditEvent(eventsAPIEvent.TeamID, "", AuditTokensRevoked, "", nil, ev.Tokens))
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// installedApp returns whether the token of the team belongs to the app
+// an event is for. A team has a single token, so an event of another of the
+// apps served must not remove it.
+func (e *EventHandler) installedApp(teamID, appID string) bool {
+	if e.TokenReader == nil || appID == "" {
+		return true
+	}
+	token, err := e.TokenReader.GetTokenForTeam(teamID)
+	if err != nil || token.AppID == "" {
+		return true
+	}
+	return token.AppID == appID
+}
+
+// removeToken removes the token of a team that can no longer be used, so
+// the team is asked to install the app again.
+func (e *EventHandler) removeToken(r *http.Request, event, teamID string) {
+	err := e.TokenWriter.Remove(teamID)
+	// do not error out or return 500 since this failing is non-critical
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg(fmt.Sprintf("%s failed for: %s", event, teamID))
+	}
+}
+
+// removeUserTokens removes the revoked user tokens of the users of a team.
+func (e *EventHandler) removeUserTokens(r *http.Request, teamID string, userIDs []string) {
+	for _, userID := range userIDs {
+		err := e.UserTokens.RemoveUserToken(teamID, userID)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Str("user", userID).
+				Msg("removing user token")
+		}
+	}
+}
+
+// InteractionHandler is used to handle interactive component callbacks
+// from Slack api.
+type InteractionHandler struct {
+	TokenReader        TokenReader
+	MeetingGenerator   *MeetingGenerator
+	InviteTracker      *InviteTracker
+	ServerConfigWriter ServerConfigWriter
+	// DefaultServer is the conference server used by teams that have not
+	// configured one.
+	DefaultServer string
+	// MessageConfig is optional and enables team customized messages.
+	MessageConfig MessageConfigReadWriter
+	// Meetings is optional and tracks the meetings that are created.
+	Meetings MeetingReadWriter
+	// Usage is optional and records the meetings that are started for usage
+	// reports.
+	Usage UsageReadWriter
+	// Feedback is optional and stores the feedback users submit.
+	Feedback FeedbackWriter
+	// FeedbackWebhook is optional and forwards the feedback users submit.
+	FeedbackWebhook FeedbackWriter
+	// WorkflowStep is optional and lets workflow builders configure the
+	// workflow builder step of the app.
+	WorkflowStep *WorkflowStep
+	// Audit is optional and records changes to the server configuration
+	// made in the setup and settings modals.
+	Audit AuditWriter
+	// History is optional and records the changes made in the setup and
+	// settings modals, so that they can be rolled back.
+	History *ConfigHistory
+	// Limits is optional and limits the meetings teams and users start and
+	// the invites they send.
+	Limits *MeetingLimits
+	// InviteQueue is optional and queues the invites of confirmed channel
+	// invites to be sent by an InviteDispatcher.
+	InviteQueue InviteQueue
+}
+
+// Handle handles interactive component callbacks for the integration.
+// Requests must be verified by a RequestVerifier.
+func (i *InteractionHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	var payload slack.InteractionCallback
+	err := json.Unmarshal([]byte(r.PostFormValue("payload")), &payload)
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("interaction: parse failed")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if payload.Type == slack.InteractionTypeViewSubmission {
+		switch payload.View.CallbackID {
+		case callbackConfirmChannelInvite:
+			i.confirmChannelInvite(w, r, &payload)
+			return
+		case callbackSetup:
+			i.completeSetup(w, r, &payload)
+			return
+		case callbackSettings:
+			i.saveSettings(w, r, &payload)
+			return
+		case callbackFeedback:
+			i.submitFeedback(w, r, &payload)
+			return
+		case callbackWorkflowStep:
+			if i.WorkflowStep != nil {
+				i.WorkflowStep.save(w, r, &payload)
+				return
+			}
+		}
+	}
+
+	if payload.Type == interactionWorkflowStepEdit && payload.CallbackID == callbackWorkflowStep && i.WorkflowStep != nil {
+		i.WorkflowStep.edit(w, r, &payload)
+		return
+	}
+
+	if payload.Type == slack.InteractionTypeBlockActions {
+		for _, action := range payload.ActionCallback.BlockActions {
+			switch action.ActionID {
+			case actionJoinMeeting:
+				if i.InviteTracker == nil {
+					continue
+				}
+				// the host and channel members may also click join which
+				// is not tracked and fails the write condition
+				err := i.InviteTracker.Joined(action.Value, payload.User.ID)
+				if err != nil {
+					hlog.FromRequest(r).Info().
+						Err(err).
+						Msg("recording join")
+				}
+			case actionAcceptInvite, actionDeclineInvite:
+				i.respondToInvite(w, r, &payload, action.ActionID, action.Value)
+				return
+			case actionScheduleInvite:
+				i.scheduleInvite(w, r, &payload, action.Value)
+				return
+			case actionRequestInvite:
+				i.requestInvite(w, r, &payload, action.Value)
+				return
+			case actionOpenSetup:
+				i.openSetup(w, r, &payload)
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (i *InteractionHandler) scheduleInvite(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback, value string) {
+	token, err := i.TokenReader.GetTokenForTeam(payload.Team.ID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	locale := localeFor(token.AccessToken, payload.User.ID)
+	msgCfg := messageConfig(r, i.MessageConfig, payload.Team.ID)
+	si, err := scheduleInvite(token.AccessToken, value, msgCfg.inviteStyle())
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("scheduling invite")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	err = slack.PostWebhook(payload.ResponseURL, &slack.WebhookMessage{
+		Text: tr(locale, "dnd.scheduled", si.UserID),
+	})
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("confirming scheduled invite")
+	}
+}
+
+// respondToInvite records whether an invitee accepted or declined their
+// invite and updates the summary of responses in the host's confirmation.
+func (i *InteractionHandler) respondToInvite(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback, actionID, meetingID string) {
+	if i.InviteTracker == nil || i.Meetings == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	response := rsvpAccepted
+	if actionID == actionDeclineInvite {
+		response = rsvpDeclined
+	}
+	invites, err := i.InviteTracker.Respond(meetingID, payload.User.ID, response)
+	if err != nil {
+		// the invite may have been retracted
+		hlog.FromRequest(r).Info().
+			Err(err).
+			Msg("recording invite response")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	var locale string
+	for _, invite := range invites {
+		if invite.UserID == payload.User.ID {
+			locale = invite.Locale
+		}
+	}
+	err = slack.PostWebhook(payload.ResponseURL, &slack.WebhookMessage{
+		Text: tr(locale, "rsvp."+response),
+	})
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("confirming invite response")
+	}
+
+	meeting, err := i.Meetings.Get(payload.Team.ID, meetingID)
+	if err == nil {
+		err = updateRSVPSummary(meeting, invites)
+	}
+	if err != nil && err.Error() != errMissingHostMessage {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Str("meeting_id", meetingID).
+			Msg("updating rsvp summary")
+	}
+}
+
+// confirmChannelInvite invites the members of a large channel once the host
+// confirms. The modal is closed right away since inviting many members may
+// take longer than slack waits for a response.
+func (i *InteractionHandler) confirmChannelInvite(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback) {
+	var req channelInviteRequest
+	err := json.Unmarshal([]byte(payload.View.PrivateMetadata), &req)
 	if err != nil {
-		hlog.FromRequest(r).Warn().Err(err).Msg("evhandle: signature failed")
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("parsing channel invite request")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if _, err := sv.Write(body); err != nil {
-		hlog.FromRequest(r).Warn().Err(err).Msg("evhandle: write failed")
+	token, err := i.TokenReader.GetTokenForTeam(payload.Team.ID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	teamID := payload.Team.ID
+	msgCfg := messageConfig(r, i.MessageConfig, teamID)
+	log := hlog.FromRequest(r)
+	go func() {
+		locale := localeFor(token.AccessToken, req.HostID)
+		members, err := channelMembers(token.AccessToken, req.ChannelID, req.HostID)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("listing channel members")
+			return
+		}
+		if retry, most, ok := i.Limits.allow(log, teamID, req.HostID, len(members)); !ok {
+			_, err = slack.New(token.AccessToken).PostEphemeral(req.ChannelID, req.HostID, slack.MsgOptionText(limitedText(locale, retry, most), false))
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Msg("posting rate limit notice")
+			}
+			return
+		}
+		meeting, err := i.MeetingGenerator.New(teamID, req.TeamName, req.HostID, req.ChannelName)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("generating meeting")
+			return
+		}
+		recordMeeting(log, i.Meetings, newMeetingRecord(locale, teamID, req.HostID, req.ChannelID, "", &meeting))
+		invites, invited, err := inviteMembers(i.InviteQueue, token.AccessToken, teamID, req.HostID, members, &meeting, msgCfg.inviteStyle())
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Msg("inviting channel members")
+		}
+		recordUsage(log, i.Usage, newMeetingStarted(teamID, req.ChannelID, invited))
+		if i.InviteTracker != nil {
+			for _, invite := range invites {
+				invite.TeamID = teamID
+				err = i.InviteTracker.Track(invite)
+				if err != nil {
+					log.Warn().
+						Err(err).
+						Msg("tracking invite")
+				}
+			}
+		}
+
+		resp, err := joinPersonalMeetingMsg(token.AccessToken, locale, req.HostID, &meeting, msgCfg.brandStyle())
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("joinPersonalizedMeetingMsg error")
+			return
+		}
+		resp.Blocks.BlockSet = append(resp.Blocks.BlockSet, channelInviteSummary(locale, invited, len(members))...)
+		opts := append(
+			msgCfg.brandStyle().postOptions(),
+			slack.MsgOptionAttachments(resp.Attachments...),
+			slack.MsgOptionBlocks(resp.Blocks.BlockSet...),
+		)
+		_, err = slack.New(token.AccessToken).PostEphemeral(req.ChannelID, req.HostID, opts...)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Msg("posting channel invite summary")
+		}
+	}()
+}
+
+// openSetup opens the setup modal for the team with its current
+// configuration.
+func (i *InteractionHandler) openSetup(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback) {
+	teamID := payload.Team.ID
+	token, err := i.TokenReader.GetTokenForTeam(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	srvCfg, err := i.MeetingGenerator.ServerConfigReader.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving server config")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	locale := localeFor(token.AccessToken, payload.User.ID)
+	allowed, err := mayChangeServer(token.AccessToken, payload.User.ID, &srvCfg)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("checking admin")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusOK)
+		err = slack.PostWebhook(payload.ResponseURL, &slack.WebhookMessage{
+			Text: tr(locale, "admin.required"),
+		})
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("denying setup")
+		}
+		return
+	}
+	server := srvCfg.Server
+	if server == i.DefaultServer {
+		server = ""
+	}
+	var branding *Branding
+	if i.MessageConfig != nil {
+		msgCfg := messageConfig(r, i.MessageConfig, teamID)
+		branding = &msgCfg.Branding
+	}
+
+	_, err = slack.New(token.AccessToken).OpenView(payload.TriggerID, setupView(locale, server, branding))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("opening setup")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if err := sv.Ensure(); err != nil {
-		hlog.FromRequest(r).Warn().Err(err).Msg("ensure failed: secrets may be not loading")
-		w.WriteHeader(http.StatusUnauthorized)
+	w.WriteHeader(http.StatusOK)
+}
+
+// mayChangeServer returns whether the user may change the server of their
+// team, which workspace admins and owners may and everyone may once admins
+// allowed it.
+func mayChangeServer(token, userID string, srvCfg *ServerCfg) (bool, error) {
+	if srvCfg.OpenServerChanges {
+		return true, nil
+	}
+	return isWorkspaceAdmin(token, userID)
+}
+
+// changeServerConfig applies a change the user of an interaction made to the
+// server configuration of their team, see changeServerConfig.
+func (i *InteractionHandler) changeServerConfig(r *http.Request, payload *slack.InteractionCallback, setting string, change func() error) error {
+	return changeServerConfig(r, i.Audit, i.History, i.MeetingGenerator.ServerConfigReader,
+		payload.Team.ID, payload.User.ID, setting, change)
+}
+
+// completeSetup tests the server chosen in the setup modal and stores the
+// configuration. Problems are shown on the inputs of the modal.
+func (i *InteractionHandler) completeSetup(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback) {
+	teamID := payload.Team.ID
+	token, err := i.TokenReader.GetTokenForTeam(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	locale := localeFor(token.AccessToken, payload.User.ID)
+	srvCfg, err := i.MeetingGenerator.ServerConfigReader.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving server config")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// the submission is checked again since it does not prove that the
+	// modal was opened by a user who may change the server
+	allowed, err := mayChangeServer(token.AccessToken, payload.User.ID, &srvCfg)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("checking admin")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		writeViewResponse(w, slack.NewErrorsViewSubmissionResponse(map[string]string{
+			blockSetupServer: tr(locale, "admin.required"),
+		}))
+		return
+	}
+
+	state := payload.View.State
+	inputErrs := make(map[string]string)
+	server := setupValue(state, blockSetupServer, actionSetupServer)
+	if server != "" && server != i.DefaultServer {
+		server, err = checkServerURL(server)
+		if err == nil {
+			err = probeServer(server)
+		}
+		if err != nil {
+			inputErrs[blockSetupServer] = serverURLError(locale, setupValue(state, blockSetupServer, actionSetupServer), err)
+		}
+	}
+	color := setupValue(state, blockSetupColor, actionSetupColor)
+	if color != "" && !colorRE.MatchString(color) {
+		inputErrs[blockSetupColor] = tr(locale, "template.invalid_color")
+	}
+	name := setupValue(state, blockSetupName, actionSetupName)
+	if len(inputErrs) > 0 {
+		writeViewResponse(w, slack.NewErrorsViewSubmissionResponse(inputErrs))
+		return
+	}
+
+	if server == "" || server == i.DefaultServer {
+		server = i.DefaultServer
+	}
+	err = i.changeServerConfig(r, payload, KeyServer, func() error {
+		if server == i.DefaultServer {
+			return i.ServerConfigWriter.Remove(teamID)
+		}
+		return i.ServerConfigWriter.Store(&ServerCfgData{
+			TeamID: teamID,
+			Server: server,
+		})
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("storing setup server")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if i.MessageConfig != nil {
+		msgCfg, err := i.MessageConfig.Get(teamID)
+		if err == nil {
+			msgCfg.TeamID = teamID
+			msgCfg.Branding.Color = color
+			msgCfg.Branding.Username = name
+			err = changeMessageConfig(r, i.History, i.MessageConfig, payload.User.ID, settingBranding, &msgCfg)
+		}
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("storing setup branding")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	writeViewResponse(w, slack.NewUpdateViewSubmissionResponse(setupDoneView(locale, server)))
+}
+
+// saveSettings validates and stores the settings edited in the settings
+// modal. Problems are shown on the inputs of the modal.
+func (i *InteractionHandler) saveSettings(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback) {
+	teamID := payload.Team.ID
+	token, err := i.TokenReader.GetTokenForTeam(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	locale := localeFor(token.AccessToken, payload.User.ID)
+	// the settings modal is only opened for admins, but the submission
+	// does not prove that it was
+	admin, err := isWorkspaceAdmin(token.AccessToken, payload.User.ID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("checking admin")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !admin {
+		writeViewResponse(w, slack.NewErrorsViewSubmissionResponse(map[string]string{
+			blockSetupServer: tr(locale, "admin.required"),
+		}))
+		return
+	}
+
+	state := payload.View.State
+	inputErrs := make(map[string]string)
+	server := setupValue(state, blockSetupServer, actionSetupServer)
+	if server != "" && server != i.DefaultServer {
+		server, err = checkServerURL(server)
+		if err == nil {
+			err = probeServer(server)
+		}
+		if err != nil {
+			inputErrs[blockSetupServer] = serverURLError(locale, setupValue(state, blockSetupServer, actionSetupServer), err)
+		}
+	}
+	naming := settingsOption(state, blockSettingsNaming, actionSettingsNaming)
+	if _, ok := roomNamers[naming]; !ok {
+		inputErrs[blockSettingsNaming] = tr(locale, "naming.usage")
+	}
+	var lifetime time.Duration
+	if l := settingsOption(state, blockSettingsJWT, actionSettingsJWT); l != "" {
+		lifetime, err = time.ParseDuration(l)
+		if err != nil {
+			inputErrs[blockSettingsJWT] = tr(locale, "settings.jwt.hint")
+		}
+	}
+	inviteText := setupValue(state, blockSettingsInvite, actionSettingsInvite)
+	announcementText := setupValue(state, blockSettingsAnnouncement, actionSettingsAnnouncement)
+	for blockID, text := range map[string]string{blockSettingsInvite: inviteText, blockSettingsAnnouncement: announcementText} {
+		if len(text) > maxTemplateTextLength {
+			inputErrs[blockID] = tr(locale, "template.too_long", maxTemplateTextLength)
+		}
+	}
+	if len(inputErrs) > 0 {
+		writeViewResponse(w, slack.NewErrorsViewSubmissionResponse(inputErrs))
+		return
+	}
+
+	if server == "" || server == i.DefaultServer {
+		server = i.DefaultServer
+	}
+	err = i.changeServerConfig(r, payload, "settings", func() error {
+		var err error
+		if server == i.DefaultServer {
+			err = i.ServerConfigWriter.Remove(teamID)
+		} else {
+			err = i.ServerConfigWriter.Store(&ServerCfgData{
+				TeamID: teamID,
+				Server: server,
+			})
+		}
+		if err == nil {
+			err = i.ServerConfigWriter.SetRoomNaming(teamID, naming)
+		}
+		if err == nil && settingsHasInput(state, blockSettingsJWT) {
+			err = i.ServerConfigWriter.SetJWTLifetime(teamID, lifetime)
+		}
+		return err
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("storing settings")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if i.MessageConfig != nil && settingsHasInput(state, blockSettingsInvite) {
+		msgCfg, err := i.MessageConfig.Get(teamID)
+		if err == nil {
+			msgCfg.TeamID = teamID
+			msgCfg.Invite.Text = inviteText
+			msgCfg.Announcement.Text = announcementText
+			err = changeMessageConfig(r, i.History, i.MessageConfig, payload.User.ID, settingTemplate, &msgCfg)
+		}
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("storing settings templates")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	writeViewResponse(w, slack.NewUpdateViewSubmissionResponse(settingsDoneView(locale, server)))
+}
+
+// submitFeedback stores the feedback submitted in the feedback modal and
+// forwards it to the feedback webhook when configured.
+func (i *InteractionHandler) submitFeedback(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback) {
+	if i.Feedback == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	teamID := payload.Team.ID
+	token, err := i.TokenReader.GetTokenForTeam(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	locale := localeFor(token.AccessToken, payload.User.ID)
+
+	feedback := newFeedback(
+		teamID,
+		payload.Team.Domain,
+		payload.User.ID,
+		payload.User.Name,
+		payload.View.PrivateMetadata,
+		strings.TrimSpace(setupValue(payload.View.State, blockFeedbackText, actionFeedbackText)),
+	)
+	err = i.Feedback.Store(feedback)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("storing feedback")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if i.FeedbackWebhook != nil {
+		// the feedback is stored so failing to forward it is non-critical
+		err = i.FeedbackWebhook.Store(feedback)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("forwarding feedback")
+		}
+	}
+	writeViewResponse(w, slack.NewUpdateViewSubmissionResponse(
+		doneView(tr(locale, "feedback.title"), tr(locale, "setup.close"), tr(locale, "feedback.done")),
+	))
+}
+
+// requestInvite sends a personal invite to a channel member that opted in
+// from a broadcast meeting message.
+func (i *InteractionHandler) requestInvite(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback, value string) {
+	var ref meetingRef
+	err := json.Unmarshal([]byte(value), &ref)
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("parsing meeting reference")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	token, err := i.TokenReader.GetTokenForTeam(payload.Team.ID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	meeting, err := i.MeetingGenerator.ForRoom(ref.MeetingID, payload.Team.ID, ref.TeamName, ref.RoomName)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("recreating meeting")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	msgCfg := messageConfig(r, i.MessageConfig, payload.Team.ID)
+	invite, err := sendPersonalizedInvite(token.AccessToken, ref.HostID, payload.User.ID, &meeting, msgCfg.inviteStyle())
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("sending requested invite")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if i.InviteTracker != nil {
+		invite.TeamID = payload.Team.ID
+		err = i.InviteTracker.Track(invite)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("tracking invite")
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// SlashCommandHandlers provides http handlers for Slack slash commands
+// that integrate with Jitsi Meet.
+type SlashCommandHandlers struct {
+	MeetingGenerator *MeetingGenerator
+	TokenReader      TokenReader
+	TokenWriter      TokenWriter
+	SharableURL      string
+	// InstallStateSecret is optional and signs the channel and command of
+	// install prompts so installs started from their link lead back to the
+	// channel. It must be the StateSecret of the SlackOAuthHandlers and only
+	// be set when SharableURL points at SlackOAuthHandlers.Install.
+	InstallStateSecret string
+	// RequiredScopes are optional and are the scopes tokens must have been
+	// granted. Teams whose install lacks one are asked to reinstall.
+	RequiredScopes     []string
+	ServerConfigWriter ServerConfigWriter
+	// InviteTracker is optional and enables reminders for invitees that
+	// have not joined.
+	InviteTracker *InviteTracker
+	// InviteQueue is optional and queues personal invites to be sent by an
+	// InviteDispatcher, which should track them with the InviteTracker.
+	InviteQueue InviteQueue
+	// ChannelInviteConfirmSize is the number of channel members above which
+	// a host must confirm inviting the whole channel.
+	ChannelInviteConfirmSize int
+	// Calendars are optional and enable the calendar subcommand. Events are
+	// created on the first calendar the caller has connected.
+	Calendars []CalendarProvider
+	// MessageConfig is optional and enables the template subcommand.
+	MessageConfig MessageConfigReadWriter
+	// Meetings is optional and tracks the meetings that are created. It
+	// enables the end and who subcommands and along with the InviteTracker
+	// the cancel subcommand.
+	Meetings MeetingReadWriter
+	// RoomEnder is optional and ends ended meetings for their participants.
+	RoomEnder RoomEnder
+	// PersonalRooms is optional and enables the me subcommand.
+	PersonalRooms PersonalRoomReadWriter
+	// ChannelRooms is optional and enables the here subcommand.
+	ChannelRooms ChannelRoomReadWriter
+	// RoomLocker is optional and enables protecting meetings with personal
+	// invites with a passcode.
+	RoomLocker RoomLocker
+	// RoomStreamer is optional and enables the stream subcommand.
+	RoomStreamer RoomStreamer
+	// Expiry is optional and edits the announcements of meetings once their
+	// links expired.
+	Expiry *MeetingExpiry
+	// Tasks is optional and enables the schedule subcommand, which updates
+	// the messages of scheduled meetings once they start.
+	Tasks *DelayedTasks
+	// Transcription enables the transcribe flag for servers that support
+	// transcribing meetings.
+	Transcription bool
+	// LiveAnnouncements posts channel announcements as the app so they can
+	// be updated with the participants of the meeting. It requires Meetings.
+	LiveAnnouncements bool
+	// UserPrefs is optional and enables the prefs subcommand.
+	UserPrefs UserPrefsReadWriter
+	// Usage is optional and records the meetings that are started for the
+	// stats subcommand.
+	Usage UsageReadWriter
+	// Feedback is optional and enables the feedback subcommand.
+	Feedback FeedbackWriter
+	// Identities is optional and enables the identity subcommand.
+	Identities IdentityReadWriter
+	// SignIn is optional and enables the link subcommand.
+	SignIn *SlackSignIn
+	// Audit is optional and records admin commands and changes to the
+	// server configuration.
+	Audit AuditWriter
+	// History is optional and records changes to the server configuration
+	// and message customization, which enables /jitsi server undo.
+	History *ConfigHistory
+	// Eraser is optional and enables the forget-me subcommand.
+	Eraser *DataEraser
+	// Limits is optional and limits the meetings teams and users start and
+	// the invites they send.
+	Limits *MeetingLimits
+	// AsyncCommands acknowledges commands that start meetings right away
+	// and delivers their response through the response url of the command
+	// once the meeting was started and the invites were sent.
+	AsyncCommands bool
+
+	subcommands []subcommand
+}
+
+// SubcommandHandler handles a /jitsi subcommand. The locale is the locale of
+// the caller that responses should be shown in.
+type SubcommandHandler func(w http.ResponseWriter, r *http.Request, locale string, cmd *Command)
+
+// Register adds a /jitsi subcommand, e.g. Register("record", handler) for
+// /jitsi record. Registered subcommands take precedence over the built-in
+// ones. Subcommands must be registered before requests are served.
+func (s *SlashCommandHandlers) Register(name string, handler SubcommandHandler) {
+	s.RegisterWithHelp(name, "", "", handler)
+}
+
+// RegisterWithHelp adds a /jitsi subcommand like Register and lists its help
+// text under the help topic, e.g. RegisterWithHelp("record", "meetings",
+// "`/jitsi record` will record the meeting of the channel.", handler).
+// Subcommands without a topic are not listed and new topics are listed after
+// the built-in ones. The help text is shown as is in every locale.
+func (s *SlashCommandHandlers) RegisterWithHelp(name, topic, text string, handler SubcommandHandler) {
+	sub := subcommand{
+		name:    strings.ToLower(name),
+		handler: handler,
+		topic:   strings.ToLower(topic),
+		help: func(string) string {
+			return text
+		},
+	}
+	if i, ok := s.registered(sub.name); ok {
+		s.subcommands[i] = sub
+		return
+	}
+	s.subcommands = append(s.subcommands, sub)
+}
+
+// Jitsi will create a conference and dispatch an invite message to both users.
+// It is a slash command for Slack. Requests must be verified by a
+// RequestVerifier.
+func (s *SlashCommandHandlers) Jitsi(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("unable to parse form data")
+		renderError(w, DefaultLocale(), "error.generic")
+		return
+	}
+
+	cmd := parseCommand(r.PostFormValue("text"))
+	cmd.Slash = slashCommand(r.PostFormValue("command"))
+	if s.AsyncCommands && s.asyncCommand(&cmd) && r.PostFormValue("response_url") != "" {
+		// slack waits 3 seconds for the response, which large invites exceed
+		w.WriteHeader(http.StatusOK)
+		go s.handleAsync(r, &cmd)
+		return
+	}
+	s.handleCommand(w, r, &cmd)
+}
+
+// handleCommand handles a parsed command.
+func (s *SlashCommandHandlers) handleCommand(w http.ResponseWriter, r *http.Request, cmd *Command) {
+	locale := s.callerLocale(r)
+	if cmd.Name != "" && !s.permitSubcommand(w, r, locale, cmd.Name) {
+		return
+	}
+	if sub, ok := s.lookupSubcommand(cmd.Name); ok {
+		sub.handler(w, r, locale, cmd)
+		return
+	}
+	if broadcastRE.MatchString(cmd.Text) {
+		s.broadcastInvite(w, r, locale)
+		return
+	}
+	s.dispatchInvites(w, r, locale, cmd, func(teamID, teamName string) (Meeting, error) {
+		return s.MeetingGenerator.New(teamID, teamName, r.PostFormValue("user_id"), r.PostFormValue("channel_name"))
+	})
+}
+
+// permitSubcommand checks that the caller may run the subcommand when the
+// team limited it to admins or a user group. The response is written when
+// they may not.
+func (s *SlashCommandHandlers) permitSubcommand(w http.ResponseWriter, r *http.Request, locale, name string) bool {
+	teamID := r.PostFormValue("team_id")
+	srv, err := s.MeetingGenerator.ServerConfigReader.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving server config")
+		renderStoreError(w, locale, "error.config_store", err)
+		return false
+	}
+	role := srv.Permissions[name]
+	if role == "" {
+		return true
+	}
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return false
+	}
+	ok, err = permitted(token.AccessToken, r.PostFormValue("user_id"), role)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("checking permission")
+		renderError(w, locale, "error.slack")
+		return false
+	}
+	if !ok {
+		fmt.Fprint(w, tr(locale, "permissions.denied", name))
+	}
+	return ok
+}
+
+// permittedOptions reads the options of the meeting the caller starts with
+// the command and the flags they prefer. Recording is limited like the
+// record subcommand, so --record, or record as a preferred flag, is checked
+// against its permission, and the response is written when the caller may
+// not record.
+func (s *SlashCommandHandlers) permittedOptions(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) (MeetingOptions, bool) {
+	opts := meetingOptions(cmd, r.PostFormValue("user_id"), s.callerPrefs(r).Flags)
+	if cmd.Name != flagRecord && opts.Record && !s.permitSubcommand(w, r, locale, flagRecord) {
+		return opts, false
+	}
+	return opts, true
+}
+
+// callerLocale returns the locale of the user that ran the command, which
+// is the language they prefer or their slack locale. The default locale is
+// used when the workspace has no token yet.
+func (s *SlashCommandHandlers) callerLocale(r *http.Request) string {
+	if prefs := s.callerPrefs(r); prefs.Locale != "" {
+		return prefs.Locale
+	}
+	token, err := s.TokenReader.GetTokenForTeam(r.PostFormValue("team_id"))
+	if err != nil {
+		return DefaultLocale()
+	}
+	return localeFor(token.AccessToken, r.PostFormValue("user_id"))
+}
+
+// callerPrefs returns the preferences of the user that ran the command.
+// Empty preferences are returned when preferences are not enabled or
+// unavailable, so the defaults of the team apply.
+func (s *SlashCommandHandlers) callerPrefs(r *http.Request) UserPrefs {
+	if s.UserPrefs == nil {
+		return UserPrefs{}
+	}
+	prefs, err := s.UserPrefs.Get(r.PostFormValue("team_id"), r.PostFormValue("user_id"))
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("retrieving user prefs")
+		return UserPrefs{}
+	}
+	return prefs
+}
+
+// teamToken retrieves the oauth token for the slack workspace. The response
+// is written when no token is available.
+func (s *SlashCommandHandlers) teamToken(w http.ResponseWriter, r *http.Request, locale, teamID string) (*TokenData, bool) {
+	token, err := s.TokenReader.GetTokenForTeam(teamID)
+	if err != nil {
+		switch err.Error() {
+		case errMissingAuthToken:
+			hlog.FromRequest(r).Info().
+				Err(err).
+				Msg("missing auth token")
+			install(w, locale, s.installURL(r))
+		default:
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("retrieving token")
+			renderStoreError(w, locale, "error.token_store", err)
+		}
+		return nil, false
+	}
+	if missing := token.missingScopes(s.RequiredScopes); len(missing) > 0 {
+		hlog.FromRequest(r).Info().
+			Strs("scopes", missing).
+			Msg("token missing scopes")
+		writeMsg(w, reinstallMsg(locale, s.installURL(r), missing))
+		return nil, false
+	}
+	return token, true
+}
+
+// installURL returns the link install prompts for the command point at.
+func (s *SlashCommandHandlers) installURL(r *http.Request) string {
+	if s.InstallStateSecret == "" {
+		return s.SharableURL
+	}
+	u, err := url.Parse(s.SharableURL)
+	if err != nil {
+		return s.SharableURL
+	}
+	command := strings.TrimSpace(slashCommand(r.PostFormValue("command")) + " " + r.PostFormValue("text"))
+	params := u.Query()
+	params.Set(keyResume, resumeState(
+		s.InstallStateSecret,
+		r.PostFormValue("team_id"),
+		r.PostFormValue("channel_id"),
+		command,
+	))
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+func (s *SlashCommandHandlers) configureServer(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	teamID := r.PostFormValue("team_id")
+	srv, err := s.MeetingGenerator.ServerConfigReader.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving server config")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+
+	// Without a server the current configuration is shown.
+	if cmd.Arg(0) == "" {
+		fmt.Fprint(w, serverSummary(locale, r.PostFormValue("team_domain"), &srv))
+		return
+	}
+
+	// Only admins change the server unless they allowed everyone to.
+	if cmd.Arg(0) == "access" {
+		s.configureServerAccess(w, r, locale, cmd)
+		return
+	}
+	if cmd.Arg(0) == "undo" {
+		s.undoConfigChange(w, r, locale)
+		return
+	}
+	if !srv.OpenServerChanges && !s.requireAdmin(w, r, locale) {
+		return
+	}
+
+	if cmd.Arg(0) == "default" {
+		err := s.changeServerConfig(r, KeyServer, func() error {
+			return s.ServerConfigWriter.Remove(teamID)
+		})
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("defaulting server")
+			renderStoreError(w, locale, "error.config_store", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, tr(locale, "server.default"))
+		return
+	}
+
+	m := serverURLRE.FindStringSubmatch(cmd.Arg(0))
+	if m == nil {
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, tr(locale, "server.invalid"))
+		return
+	}
+
+	host, err := checkServerURL(m[1])
+	if err != nil {
+		fmt.Fprint(w, serverURLError(locale, m[1], err))
+		return
+	}
+
+	// The server is tested so a typo is not silently stored. Servers that do
+	// not appear to serve jitsi meet are only stored when forced.
+	probe, err := probeJitsi(host)
+	if err != nil {
+		fmt.Fprint(w, serverURLError(locale, host, err))
+		return
+	}
+	if !probe.Jitsi && !cmd.Flag(flagForce) {
+		fmt.Fprint(w, tr(locale, "server.not_jitsi_force", host, cmd.Slash))
+		return
+	}
+	err = s.changeServerConfig(r, KeyServer, func() error {
+		return s.ServerConfigWriter.Store(&ServerCfgData{
+			TeamID: teamID,
+			Server: host,
+		})
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("configuring server")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	msg := tr(locale, "server.configured", host)
+	if probe.Jitsi {
+		msg += "\n" + probeSummary(locale, probe, s.authenticatedURLs(teamID))
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, msg)
+}
+
+// undoConfigChange lets workspace admins roll back the latest change to the
+// configuration of their team, e.g. /jitsi server undo
+func (s *SlashCommandHandlers) undoConfigChange(w http.ResponseWriter, r *http.Request, locale string) {
+	if s.History == nil {
+		fmt.Fprint(w, tr(locale, "server.undo.disabled"))
+		return
+	}
+	if !s.requireAdmin(w, r, locale) {
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	change, err := s.History.Undo(teamID)
+	if err != nil && err.Error() == errMissingConfigChange {
+		fmt.Fprint(w, tr(locale, "server.undo.empty"))
+		return
+	}
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("rolling back config change")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	recordAudit(hlog.FromRequest(r), s.Audit, newAuditEvent(teamID, r.PostFormValue("user_id"), AuditConfigRollback, change.Setting, change.After, change.Before))
+	actor := tr(locale, "server.undo.unknown_actor")
+	if change.ActorID != "" {
+		actor = "<@" + change.ActorID + ">"
+	}
+	fmt.Fprint(w, tr(locale, "server.undo.done", change.Setting, actor, slackDate(locale, time.Unix(change.CreatedAt, 0))))
+}
+
+// authenticatedURLs returns whether the service issues tokens for the
+// server of the team.
+func (s *SlashCommandHandlers) authenticatedURLs(teamID string) bool {
+	srv, err := s.MeetingGenerator.ServerConfigReader.Get(teamID)
+	return err == nil && srv.AuthenticatedURLSupport
+}
+
+// configurePermissions limits who may run a subcommand of the team, e.g.
+// /jitsi permissions end admins or /jitsi permissions record @producers
+func (s *SlashCommandHandlers) configurePermissions(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	teamID := r.PostFormValue("team_id")
+	srv, err := s.MeetingGenerator.ServerConfigReader.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving server config")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	name, role := strings.ToLower(cmd.Arg(0)), parseRole(cmd.Arg(1))
+	if name == "" || role == "" {
+		fmt.Fprint(w, permissionsSummary(locale, srv.Permissions))
+		return
+	}
+	if !s.requireAdmin(w, r, locale) {
+		return
+	}
+
+	permissions := make(map[string]string)
+	for k, v := range srv.Permissions {
+		permissions[k] = v
+	}
+	if role == roleEveryone {
+		delete(permissions, name)
+	} else {
+		permissions[name] = role
+	}
+	err = s.changeServerConfig(r, KeyPermissions, func() error {
+		return s.ServerConfigWriter.SetPermissions(teamID, permissions)
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("configuring permissions")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	fmt.Fprint(w, tr(locale, "permissions.saved")+"\n"+permissionsSummary(locale, permissions))
+}
+
+// configureServerAccess sets whether everyone or only workspace admins may
+// change the server of the team, e.g. /jitsi server access everyone
+func (s *SlashCommandHandlers) configureServerAccess(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	access := strings.ToLower(cmd.Arg(1))
+	if access != "everyone" && access != "admins" {
+		fmt.Fprint(w, tr(locale, "server.access.usage"))
+		return
+	}
+	if !s.requireAdmin(w, r, locale) {
+		return
+	}
+	err := s.changeServerConfig(r, KeyOpenServerChanges, func() error {
+		return s.ServerConfigWriter.SetOpenServerChanges(r.PostFormValue("team_id"), access == "everyone")
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("configuring server access")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	fmt.Fprint(w, tr(locale, "server.access."+access))
+}
+
+// configureRoomNaming sets how the rooms of the team are named.
+func (s *SlashCommandHandlers) configureRoomNaming(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	naming := strings.ToLower(cmd.Arg(0))
+	if _, ok := roomNamers[naming]; !ok {
+		fmt.Fprint(w, tr(locale, "naming.usage"))
+		return
+	}
+	if !s.requireAdmin(w, r, locale) {
+		return
+	}
+	err := s.changeServerConfig(r, KeyRoomNaming, func() error {
+		return s.ServerConfigWriter.SetRoomNaming(r.PostFormValue("team_id"), naming)
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("configuring room naming")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	fmt.Fprint(w, tr(locale, "naming."+naming))
+}
+
+// configureWords sets the words random room names of the team are generated
+// from, e.g. /jitsi words nouns Foxes, Owls
+func (s *SlashCommandHandlers) configureWords(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	teamID := r.PostFormValue("team_id")
+	kind, value := strings.ToLower(cmd.Arg(0)), cmd.Rest(1)
+
+	srv, err := s.MeetingGenerator.ServerConfigReader.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving server config")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	words := srv.Words
+	list := words.list(kind)
+	if kind != "reset" && (list == nil || value == "") {
+		fmt.Fprint(w, wordsSummary(locale, &words))
+		return
+	}
+	if !s.requireAdmin(w, r, locale) {
+		return
+	}
+
+	switch {
+	case kind == "reset":
+		words = Wordlists{}
+	case value == "default":
+		*list = nil
+	default:
+		*list, err = parseWords(value)
+		if err != nil {
+			fmt.Fprint(w, tr(locale, "words.invalid", maxWordlistLength, maxWordLength))
+			return
+		}
+	}
+	err = s.changeServerConfig(r, KeyWordlists, func() error {
+		return s.ServerConfigWriter.SetWordlists(teamID, words)
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("configuring wordlists")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	fmt.Fprint(w, tr(locale, "words.saved")+"\n"+wordsSummary(locale, &words))
+}
+
+// configureURLConfig sets the conference config overrides of the team's
+// meeting links, e.g. /jitsi config startWithAudioMuted=true p2p.enabled=false
+func (s *SlashCommandHandlers) configureURLConfig(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	teamID := r.PostFormValue("team_id")
+	srv, err := s.MeetingGenerator.ServerConfigReader.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving server config")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	if len(cmd.Args) == 0 {
+		fmt.Fprint(w, urlConfigSummary(locale, srv.URLConfig))
+		return
+	}
+	if !s.requireAdmin(w, r, locale) {
+		return
+	}
+
+	overrides := srv.URLConfig
+	switch strings.ToLower(cmd.Arg(0)) {
+	case "reset":
+		overrides = nil
+	case "unset":
+		for _, arg := range cmd.Args[1:] {
+			key, err := parseURLConfigKey(arg)
+			if err != nil {
+				fmt.Fprint(w, tr(locale, "config.invalid", arg))
+				return
+			}
+			overrides = unsetURLConfig(overrides, key)
+		}
+	default:
+		for _, arg := range cmd.Args {
+			key, value, err := parseURLConfig(arg)
+			if err != nil {
+				fmt.Fprint(w, tr(locale, "config.invalid", arg))
+				return
+			}
+			overrides = setURLConfig(overrides, key, value)
+		}
+		if len(overrides) > maxURLConfigOverrides {
+			fmt.Fprint(w, tr(locale, "config.too_many", maxURLConfigOverrides))
+			return
+		}
+	}
+	err = s.changeServerConfig(r, KeyURLConfig, func() error {
+		return s.ServerConfigWriter.SetURLConfig(teamID, overrides)
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("configuring url config")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	fmt.Fprint(w, tr(locale, "config.saved")+"\n"+urlConfigSummary(locale, overrides))
+}
+
+// requireAdmin checks that the caller is a workspace admin or owner. The
+// response is written when they are not.
+func (s *SlashCommandHandlers) requireAdmin(w http.ResponseWriter, r *http.Request, locale string) bool {
+	token, ok := s.teamToken(w, r, locale, r.PostFormValue("team_id"))
+	if !ok {
+		return false
+	}
+	admin, err := isWorkspaceAdmin(token.AccessToken, r.PostFormValue("user_id"))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("checking admin")
+		renderError(w, locale, "error.slack")
+		return false
+	}
+	if !admin {
+		fmt.Fprint(w, tr(locale, "admin.required"))
+		return false
+	}
+	command := strings.TrimSpace(slashCommand(r.PostFormValue("command")) + " " + r.PostFormValue("text"))
+	recordAudit(hlog.FromRequest(r), s.Audit, newAuditEvent(r.PostFormValue("team_id"), r.PostFormValue("user_id"), AuditAdminCommand, command, nil, nil))
+	return true
+}
+
+// changeServerConfig applies a change to the server configuration of the
+// caller's team, see changeServerConfig.
+func (s *SlashCommandHandlers) changeServerConfig(r *http.Request, setting string, change func() error) error {
+	return changeServerConfig(r, s.Audit, s.History, s.MeetingGenerator.ServerConfigReader,
+		r.PostFormValue("team_id"), r.PostFormValue("user_id"), setting, change)
+}
+
+// adminMessageConfig retrieves the message customization of the caller's
+// team for changing it. The response is written when message customization
+// is disabled or the caller is not a workspace admin.
+func (s *SlashCommandHandlers) adminMessageConfig(w http.ResponseWriter, r *http.Request, locale string) (*MessageCfg, bool) {
+	if s.MessageConfig == nil {
+		fmt.Fprint(w, tr(locale, "template.disabled"))
+		return nil, false
+	}
+	teamID := r.PostFormValue("team_id")
+	if !s.requireAdmin(w, r, locale) {
+		return nil, false
+	}
+
+	cfg, err := s.MessageConfig.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving message config")
+		renderStoreError(w, locale, "error.config_store", err)
+		return nil, false
+	}
+	cfg.TeamID = teamID
+	return &cfg, true
+}
+
+// storeMessageConfig persists changed message customization and confirms
+// the change with the message.
+func (s *SlashCommandHandlers) storeMessageConfig(w http.ResponseWriter, r *http.Request, locale, setting string, cfg *MessageCfg, msg string) {
+	err := changeMessageConfig(r, s.History, s.MessageConfig, r.PostFormValue("user_id"), setting, cfg)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("storing message config")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	fmt.Fprint(w, msg)
+}
+
+// configureTemplate lets workspace admins customize the invite and channel
+// announcement messages of their team.
+func (s *SlashCommandHandlers) configureTemplate(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	cfg, ok := s.adminMessageConfig(w, r, locale)
+	if !ok {
+		return
+	}
+
+	kind, setting, value := strings.ToLower(cmd.Arg(0)), strings.ToLower(cmd.Arg(1)), cmd.Rest(2)
+	if kind == "" {
+		fmt.Fprint(w, templateSummary(locale, cfg))
+		return
+	}
+	if kind == "reset" && setting == "" {
+		cfg.Invite = MessageTemplate{}
+		cfg.Announcement = MessageTemplate{}
+		s.storeMessageConfig(w, r, locale, settingTemplate, cfg, tr(locale, "template.reset"))
+		return
+	}
+
+	tmpl := cfg.template(kind)
+	if tmpl == nil {
+		fmt.Fprint(w, tr(locale, "template.usage"))
+		return
+	}
+	switch setting {
+	case "text":
+		if value == "" {
+			fmt.Fprint(w, tr(locale, "template.usage"))
+			return
+		}
+		if len(value) > maxTemplateTextLength {
+			fmt.Fprint(w, tr(locale, "template.too_long", maxTemplateTextLength))
+			return
+		}
+		tmpl.Text = value
+	case "emoji":
+		if !emojiRE.MatchString(value) {
+			fmt.Fprint(w, tr(locale, "template.invalid_emoji"))
+			return
+		}
+		tmpl.Emoji = value
+	case "color":
+		if !colorRE.MatchString(value) {
+			fmt.Fprint(w, tr(locale, "template.invalid_color"))
+			return
+		}
+		tmpl.Color = value
+	case "reset":
+		*tmpl = MessageTemplate{}
+	default:
+		fmt.Fprint(w, tr(locale, "template.usage"))
+		return
+	}
+
+	s.storeMessageConfig(w, r, locale, settingTemplate, cfg, tr(locale, "template.saved", kind))
+}
+
+// configureBranding lets workspace admins change the color, icon and display
+// name of the messages of their team.
+func (s *SlashCommandHandlers) configureBranding(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	cfg, ok := s.adminMessageConfig(w, r, locale)
+	if !ok {
+		return
+	}
+
+	setting, value := strings.ToLower(cmd.Arg(0)), cmd.Rest(1)
+	switch setting {
+	case "":
+		fmt.Fprint(w, brandSummary(locale, &cfg.Branding))
+		return
+	case "color":
+		if !colorRE.MatchString(value) {
+			fmt.Fprint(w, tr(locale, "template.invalid_color"))
+			return
+		}
+		cfg.Branding.Color = value
+	case "emoji":
+		if !emojiRE.MatchString(value) {
+			fmt.Fprint(w, tr(locale, "template.invalid_emoji"))
+			return
+		}
+		cfg.Branding.IconEmoji = value
+	case "name":
+		if value == "" || len(value) > maxUsernameLength {
+			fmt.Fprint(w, tr(locale, "brand.invalid_name", maxUsernameLength))
+			return
+		}
+		cfg.Branding.Username = value
+	case "reset":
+		cfg.Branding = Branding{}
+	default:
+		fmt.Fprint(w, tr(locale, "brand.usage"))
+		return
+	}
+	s.storeMessageConfig(w, r, locale, settingBranding, cfg, tr(locale, "brand.saved"))
+}
+
+// usageStats shows workspace admins how their team used the app recently.
+func (s *SlashCommandHandlers) usageStats(w http.ResponseWriter, r *http.Request, locale string) {
+	if s.Usage == nil {
+		fmt.Fprint(w, tr(locale, "stats.disabled"))
+		return
+	}
+	if !s.requireAdmin(w, r, locale) {
+		return
+	}
+	now := time.Now()
+	events, err := s.Usage.Since(r.PostFormValue("team_id"), now.Add(-usageMonth))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving usage")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	report := newUsageReport(events, now)
+	fmt.Fprint(w, usageSummary(locale, &report))
+}
+
+// configurePrefs sets the defaults the caller prefers for their meetings,
+// e.g. /jitsi prefs muted on
+func (s *SlashCommandHandlers) configurePrefs(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	if s.UserPrefs == nil {
+		fmt.Fprint(w, tr(locale, "prefs.disabled"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	userID := r.PostFormValue("user_id")
+	prefs, err := s.UserPrefs.Get(teamID, userID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving user prefs")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	prefs.TeamID, prefs.UserID = teamID, userID
+
+	setting, value := strings.ToLower(cmd.Arg(0)), cmd.Arg(1)
+	switch {
+	case setting == "":
+		fmt.Fprint(w, prefsSummary(locale, &prefs))
+		return
+	case setting == "server" && value == "default":
+		prefs.Server = ""
+	case setting == "server":
+		m := serverURLRE.FindStringSubmatch(value)
+		if m == nil {
+			fmt.Fprint(w, tr(locale, "server.invalid"))
+			return
+		}
+		server, err := checkServerURL(m[1])
+		if err != nil {
+			fmt.Fprint(w, serverURLError(locale, m[1], err))
+			return
+		}
+		prefs.Server = server
+	case setting == "muted" && (value == "on" || value == "off"):
+		prefs.StartMuted = value == "on"
+	case setting == "language" && value == "default":
+		prefs.Locale = ""
+	case setting == "language" && localeRE.MatchString(value):
+		prefs.Locale = value
+	case setting == "flags" && value == "none":
+		prefs.Flags = nil
+	case setting == "flags" && value == "":
+		flags, ok := parsePreferredFlags(cmd)
+		if !ok {
+			fmt.Fprint(w, tr(locale, "prefs.usage"))
+			return
+		}
+		prefs.Flags = flags
+	case setting == "room" && value == "default":
+		prefs.RoomName = ""
+	case setting == "room" && value != "":
+		name, err := sanitizeRoomName(cmd.Rest(1))
+		if err != nil {
+			fmt.Fprint(w, tr(locale, "room.invalid"))
+			return
+		}
+		// the suffix keeps the room from being guessed like generated
+		// personal rooms
+		prefs.RoomName = uniqueRoomName(name)
+	default:
+		fmt.Fprint(w, tr(locale, "prefs.usage"))
+		return
+	}
+
+	err = s.UserPrefs.Store(&prefs)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("storing user prefs")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	if prefs.Locale != "" {
+		locale = prefs.Locale
+	}
+	fmt.Fprint(w, tr(locale, "prefs.saved")+"\n"+prefsSummary(locale, &prefs))
+}
+
+// linkIdentity links the identity of the caller by signing in with slack,
+// e.g. /jitsi link, or removes it, e.g. /jitsi link remove.
+func (s *SlashCommandHandlers) linkIdentity(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	if s.SignIn == nil {
+		fmt.Fprint(w, tr(locale, "link.disabled"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	userID := r.PostFormValue("user_id")
+
+	if strings.ToLower(cmd.Arg(0)) == "remove" {
+		err := unlinkIdentity(s.SignIn.Identities, teamID, userID)
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("removing identity")
+			renderStoreError(w, locale, "error.config_store", err)
+			return
+		}
+		fmt.Fprint(w, tr(locale, "link.removed"))
+		return
+	}
+
+	identity, err := lookupIdentity(s.SignIn.Identities, teamID, userID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving identity")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	if identity.Subject != "" {
+		email := identity.Email
+		if !identity.EmailVerified {
+			email = tr(locale, "link.unverified")
+		}
+		fmt.Fprint(w, tr(locale, "link.linked", email))
+		return
+	}
+	authURL, err := s.SignIn.AuthURL(teamID, userID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("creating sign in url")
+		renderError(w, locale, "error.generic")
+		return
+	}
+	fmt.Fprint(w, tr(locale, "link.connect", authURL))
+}
+
+// forgetMe deletes the data stored for the caller once they confirm it, e.g.
+// /jitsi forget-me confirm
+func (s *SlashCommandHandlers) forgetMe(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	if s.Eraser == nil {
+		fmt.Fprint(w, tr(locale, "forget.disabled"))
+		return
+	}
+	if strings.ToLower(cmd.Arg(0)) != "confirm" {
+		fmt.Fprint(w, tr(locale, "forget.confirm"))
+		return
+	}
+	userID := r.PostFormValue("user_id")
+	receipt := s.Eraser.EraseUser(hlog.FromRequest(r), r.PostFormValue("team_id"), userID, userID)
+	if len(receipt.Failed) > 0 {
+		fmt.Fprint(w, tr(locale, "forget.failed", receipt.ReceiptID))
+		return
+	}
+	fmt.Fprint(w, tr(locale, "forget.done", receipt.ReceiptID))
+}
+
+// configureIdentity shows or changes the identity a user is mapped to on the
+// conference server, e.g. /jitsi identity @alice username alice. Only
+// workspace admins may view and change identities.
+func (s *SlashCommandHandlers) configureIdentity(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	if s.Identities == nil {
+		fmt.Fprint(w, tr(locale, "identity.disabled"))
+		return
+	}
+	if len(cmd.Mentions) != 1 {
+		fmt.Fprint(w, tr(locale, "identity.usage"))
+		return
+	}
+	if !s.requireAdmin(w, r, locale) {
+		return
+	}
+	teamID, userID := r.PostFormValue("team_id"), cmd.Mentions[0]
+	identity, err := lookupIdentity(s.Identities, teamID, userID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving identity")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+
+	setting, value := strings.ToLower(cmd.Arg(0)), cmd.Arg(1)
+	switch setting {
+	case "":
+		fmt.Fprint(w, identitySummary(locale, identity))
+		return
+	case "remove":
+		err = s.Identities.Remove(teamID, userID)
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("removing identity")
+			renderStoreError(w, locale, "error.config_store", err)
+			return
+		}
+		fmt.Fprint(w, tr(locale, "identity.removed", userID))
+		return
+	case "profile":
+		token, ok := s.teamToken(w, r, locale, teamID)
+		if !ok {
+			return
+		}
+		user, err := slack.New(token.AccessToken).GetUserInfo(userID)
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("retrieving user info")
+			renderError(w, locale, "error.slack")
+			return
+		}
+		if user.Profile.Email == "" {
+			fmt.Fprint(w, tr(locale, "identity.no_email", userID))
+			return
+		}
+		identity.Email, identity.EmailVerified, identity.Source = user.Profile.Email, true, IdentitySourceProfile
+	default:
+		err = setIdentity(identity, setting, value)
+		if err != nil {
+			fmt.Fprint(w, tr(locale, "identity.usage"))
+			return
+		}
+	}
+
+	err = s.Identities.Store(identity)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("storing identity")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	fmt.Fprint(w, tr(locale, "identity.saved")+"\n"+identitySummary(locale, identity))
+}
+
+// openSettings opens the modal workspace admins view and edit the settings
+// of their team in.
+func (s *SlashCommandHandlers) openSettings(w http.ResponseWriter, r *http.Request, locale string) {
+	teamID := r.PostFormValue("team_id")
+	if !s.requireAdmin(w, r, locale) {
+		return
+	}
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+	srv, err := s.MeetingGenerator.ServerConfigReader.Get(teamID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving server config")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	var msgCfg *MessageCfg
+	if s.MessageConfig != nil {
+		cfg := messageConfig(r, s.MessageConfig, teamID)
+		msgCfg = &cfg
+	}
+
+	_, err = slack.New(token.AccessToken).OpenView(r.PostFormValue("trigger_id"), settingsView(locale, &srv, msgCfg))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("opening settings")
+		renderError(w, locale, "error.slack")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// openFeedback opens the modal users submit feedback about the app in.
+func (s *SlashCommandHandlers) openFeedback(w http.ResponseWriter, r *http.Request, locale string) {
+	if s.Feedback == nil {
+		fmt.Fprint(w, tr(locale, "feedback.disabled"))
+		return
+	}
+	token, ok := s.teamToken(w, r, locale, r.PostFormValue("team_id"))
+	if !ok {
+		return
+	}
+	view := feedbackView(locale, r.PostFormValue("channel_id"))
+	_, err := slack.New(token.AccessToken).OpenView(r.PostFormValue("trigger_id"), view)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("opening feedback")
+		renderError(w, locale, "error.slack")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// cancelMeeting retracts the invites of the caller's most recent meeting.
+func (s *SlashCommandHandlers) cancelMeeting(w http.ResponseWriter, r *http.Request, locale string) {
+	if s.Meetings == nil || s.InviteTracker == nil {
+		fmt.Fprint(w, tr(locale, "cancel.disabled"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	callerID := r.PostFormValue("user_id")
+
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+	meeting, err := latestMeeting(s.Meetings, teamID, func(m *MeetingRecord) bool {
+		return m.HostID == callerID && m.live()
+	})
+	if err != nil {
+		switch err.Error() {
+		case errMissingMeeting:
+			fmt.Fprint(w, tr(locale, "cancel.none"))
+		default:
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("finding meeting to cancel")
+			renderStoreError(w, locale, "error.config_store", err)
+		}
+		return
+	}
+
+	retracted, err := s.InviteTracker.Retract(token.AccessToken, meeting.MeetingID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("meeting_id", meeting.MeetingID).
+			Msg("retracting invites")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	err = s.Meetings.SetStatus(teamID, meeting.MeetingID, MeetingCancelled)
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Str("meeting_id", meeting.MeetingID).
+			Msg("marking meeting cancelled")
+	}
+	fmt.Fprint(w, tr(locale, "cancel.done", meeting.URL, retracted))
+}
+
+// endMeeting ends the most recent active meeting of the channel.
+func (s *SlashCommandHandlers) endMeeting(w http.ResponseWriter, r *http.Request, locale string) {
+	if s.Meetings == nil {
+		fmt.Fprint(w, tr(locale, "end.disabled"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+	callerID := r.PostFormValue("user_id")
+	channelID := r.PostFormValue("channel_id")
+
+	meeting, err := latestMeeting(s.Meetings, teamID, func(m *MeetingRecord) bool {
+		return m.ChannelID == channelID && m.live()
+	})
+	if err != nil {
+		switch err.Error() {
+		case errMissingMeeting:
+			fmt.Fprint(w, tr(locale, "end.none"))
+		default:
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("finding meeting to end")
+			renderStoreError(w, locale, "error.config_store", err)
+		}
+		return
+	}
+	err = s.Meetings.SetStatus(teamID, meeting.MeetingID, MeetingEnded)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("meeting_id", meeting.MeetingID).
+			Msg("marking meeting ended")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+
+	msgCfg := messageConfig(r, s.MessageConfig, teamID)
+	ended := endedMsg(locale, callerID, meeting, msgCfg.brandStyle())
+	if meeting.ResponseURL != "" && time.Since(time.Unix(meeting.CreatedAt, 0)) < responseURLLifetime {
+		err = replaceOriginal(meeting.ResponseURL, ended)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("updating meeting message")
+		}
+	}
+	if s.RoomEnder != nil {
+		err = s.RoomEnder.EndRoom(teamID, teamName, meeting)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Str("meeting_id", meeting.MeetingID).
+				Msg("ending room")
+		}
+	}
+	writeMsg(w, ended)
+}
+
+// personalMeeting gives the caller the link to their personal room.
+func (s *SlashCommandHandlers) personalMeeting(w http.ResponseWriter, r *http.Request, locale string) {
+	if s.PersonalRooms == nil {
+		fmt.Fprint(w, tr(locale, "me.disabled"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+	callerID := r.PostFormValue("user_id")
+
+	// the room the caller chose takes the place of the generated one
+	roomName := s.callerPrefs(r).RoomName
+	if roomName == "" {
+		room, err := personalRoom(s.PersonalRooms, teamID, callerID)
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("retrieving personal room")
+			renderStoreError(w, locale, "error.config_store", err)
+			return
+		}
+		roomName = room.RoomName
+	}
+	meeting, err := s.MeetingGenerator.ForRoom(xid.New().String(), teamID, teamName, roomName)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("generating personal meeting")
+		renderStoreError(w, locale, "error.meeting", err)
+		return
+	}
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+	joinURL, err := userMeetingURL(token.AccessToken, callerID, &meeting)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("creating personal meeting url")
+		renderError(w, locale, "error.slack")
+		return
+	}
+	msgCfg := messageConfig(r, s.MessageConfig, teamID)
+	writeMsg(w, personalRoomMsg(locale, &meeting, joinURL, msgCfg.brandStyle()))
+}
+
+// listParticipants shows who is in the most recent active meeting of the
+// channel.
+func (s *SlashCommandHandlers) listParticipants(w http.ResponseWriter, r *http.Request, locale string) {
+	if s.Meetings == nil {
+		fmt.Fprint(w, tr(locale, "who.disabled"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	channelID := r.PostFormValue("channel_id")
+
+	meeting, err := latestMeeting(s.Meetings, teamID, func(m *MeetingRecord) bool {
+		return m.ChannelID == channelID && m.live()
+	})
+	if err != nil {
+		switch err.Error() {
+		case errMissingMeeting:
+			fmt.Fprint(w, tr(locale, "who.none"))
+		default:
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("finding meeting for participants")
+			renderStoreError(w, locale, "error.config_store", err)
+		}
+		return
+	}
+	if len(meeting.Participants) == 0 {
+		fmt.Fprint(w, tr(locale, "who.empty", meeting.URL))
+		return
+	}
+	fmt.Fprint(w, tr(locale, "who.list", meeting.URL, len(meeting.Participants), participantList(locale, meeting.Participants)))
+}
+
+// meetingHistory lists the recent meetings of the channel, or of the caller
+// with /jitsi history me, with links to rejoin them.
+func (s *SlashCommandHandlers) meetingHistory(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	if s.Meetings == nil {
+		fmt.Fprint(w, tr(locale, "history.disabled"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+	callerID := r.PostFormValue("user_id")
+	channelID := r.PostFormValue("channel_id")
+	mine := strings.ToLower(cmd.Arg(0)) == "me"
+	n := historyLength(cmd.Arg(0))
+	if mine {
+		n = historyLength(cmd.Arg(1))
+	}
+
+	recent, err := s.Meetings.Recent(teamID, time.Now().Add(-historyLookback))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving meeting history")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	history := meetingHistory(recent, n, func(m *MeetingRecord) bool {
+		if mine {
+			return m.HostID == callerID
+		}
+		return m.ChannelID == channelID
+	})
+	if len(history) == 0 {
+		fmt.Fprint(w, historySummary(locale, history, nil))
+		return
+	}
+
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+	joinURL, ok := s.rejoinURL(w, r, locale, token.AccessToken, teamID, teamName)
+	if !ok {
+		return
+	}
+	fmt.Fprint(w, historySummary(locale, history, joinURL))
+}
+
+// activeMeetings lists the meetings of the workspace started from public
+// channels that participants are currently in, with links to join them.
+func (s *SlashCommandHandlers) activeMeetings(w http.ResponseWriter, r *http.Request, locale string) {
+	if s.Meetings == nil {
+		fmt.Fprint(w, tr(locale, "active.disabled"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+
+	recent, err := s.Meetings.Recent(teamID, time.Now().Add(-meetingLookback))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving active meetings")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	active := activeMeetings(recent)
+	if len(active) == 0 {
+		fmt.Fprint(w, activeSummary(locale, active, nil))
+		return
+	}
+
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+	active = publicMeetings(token.AccessToken, active)
+	if len(active) == 0 {
+		fmt.Fprint(w, activeSummary(locale, active, nil))
+		return
+	}
+	joinURL, ok := s.rejoinURL(w, r, locale, token.AccessToken, teamID, teamName)
+	if !ok {
+		return
+	}
+	fmt.Fprint(w, activeSummary(locale, active, joinURL))
+}
+
+// rejoinURL provides the links the caller joins earlier meetings with.
+// Meetings on the team's current server are joined with a personal link,
+// others with the link they were started with. The response is written when
+// the caller cannot be retrieved.
+func (s *SlashCommandHandlers) rejoinURL(w http.ResponseWriter, r *http.Request, locale, token, teamID, teamName string) (func(*MeetingRecord) string, bool) {
+	user, err := slack.New(token).GetUserInfo(r.PostFormValue("user_id"))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving user")
+		renderError(w, locale, "error.slack")
+		return nil, false
+	}
+	return func(record *MeetingRecord) string {
+		meeting, err := s.MeetingGenerator.ForRoom(record.MeetingID, teamID, teamName, record.RoomName)
+		if err != nil || meeting.URL != record.URL {
+			return record.URL
+		}
+		meetingURL, err := meeting.AuthenticatedURL(user.ID, user.Name, user.Profile.Image192)
+		if err != nil {
+			return record.URL
+		}
+		return meetingURL
+	}, true
+}
+
+// namedRoom starts a meeting in a room named by the caller, e.g.
+// /jitsi room design-sync @alice or /jitsi room "design sync"
+func (s *SlashCommandHandlers) namedRoom(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	name := cmd.Arg(0)
+	if name == "" {
+		fmt.Fprint(w, tr(locale, "room.usage"))
+		return
+	}
+	s.dispatchInvites(w, r, locale, cmd, func(teamID, teamName string) (Meeting, error) {
+		return s.MeetingGenerator.Named(teamID, teamName, r.PostFormValue("user_id"), name)
+	})
+}
+
+// channelRoom starts a meeting in the standing room of the channel.
+func (s *SlashCommandHandlers) channelRoom(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	if s.ChannelRooms == nil {
+		fmt.Fprint(w, tr(locale, "here.disabled"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	room, err := channelRoom(s.ChannelRooms, teamID, r.PostFormValue("channel_id"), r.PostFormValue("channel_name"))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving channel room")
+		renderStoreError(w, locale, "error.config_store", err)
+		return
+	}
+	s.dispatchInvites(w, r, locale, cmd, func(teamID, teamName string) (Meeting, error) {
+		return s.MeetingGenerator.ForRoom(xid.New().String(), teamID, teamName, room.RoomName)
+	})
+}
+
+// dispatchInvites starts a meeting in the room created by newMeeting and
+// invites the mentioned users or announces it in the channel.
+func (s *SlashCommandHandlers) dispatchInvites(w http.ResponseWriter, r *http.Request, locale string, cmd *Command, newMeeting func(teamID, teamName string) (Meeting, error)) {
+	// Generate the meeting data.
+	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+	callerID := r.PostFormValue("user_id")
+	msgCfg := messageConfig(r, s.MessageConfig, teamID)
+	if cmd.Flag(flagTranscribe) && !s.Transcription {
+		fmt.Fprint(w, tr(locale, "transcript.disabled"))
+		return
+	}
+	// Passcodes are only shared in personal invites, never in the channel.
+	passcode, protect := requestedPasscode(cmd)
+	if protect && len(cmd.Mentions) == 0 {
+		fmt.Fprint(w, tr(locale, "passcode.needs_invitees"))
+		return
+	}
+	if passcode != "" && !passcodeRE.MatchString(passcode) {
+		fmt.Fprint(w, tr(locale, "passcode.invalid"))
+		return
+	}
+	opts, ok := s.permittedOptions(w, r, locale, cmd)
+	if !ok {
+		return
+	}
+	if s.Limits.throttled(w, hlog.FromRequest(r), locale, teamID, callerID, len(cmd.Mentions)) {
+		return
+	}
+	meeting, err := newMeeting(teamID, teamName)
+	if err != nil {
+		switch err.Error() {
+		case errInvalidRoomName:
+			fmt.Fprint(w, tr(locale, "room.invalid"))
+		default:
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("generating meeting")
+			renderStoreError(w, locale, "error.meeting", err)
+		}
+		return
+	}
+	meeting.setOptions(opts)
+	record := newMeetingRecord(locale, teamID, callerID, r.PostFormValue("channel_id"), r.PostFormValue("response_url"), &meeting)
+
+	// If nobody was @-mentioned then just send a generic invite to the channel.
+	if len(cmd.Mentions) == 0 {
+		recordUsage(hlog.FromRequest(r), s.Usage, newMeetingStarted(teamID, record.ChannelID, 0))
+		s.announceMeeting(w, r, locale, &meeting, record, msgCfg.announcementStyle())
+		return
+	}
+
+	// Meetings with personal invites may be protected with a passcode that
+	// is only shared with the invitees.
+	if protect {
+		if s.RoomLocker == nil {
+			fmt.Fprint(w, tr(locale, "passcode.disabled"))
+			return
+		}
+		if passcode == "" {
+			passcode, err = generatePasscode()
+			if err != nil {
+				hlog.FromRequest(r).Error().
+					Err(err).
+					Msg("generating passcode")
+				renderError(w, locale, "error.generic")
+				return
+			}
+		}
+		err = s.RoomLocker.LockRoom(teamID, teamName, &meeting, passcode)
+		if err != nil {
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("locking room")
+			renderError(w, locale, "passcode.failed")
+			return
+		}
+		meeting.Passcode = passcode
+	}
+	recordMeeting(hlog.FromRequest(r), s.Meetings, record)
+
+	// Grab a oauth token for the slack workspace.
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+
+	// Dispatch a personal invite to each user @-mentioned. Tracked invites
+	// can be accepted or declined, which the host's confirmation summarizes.
+	meeting.RSVP = s.InviteTracker != nil && s.Meetings != nil
+	tracked := 0
+	slackClient := slack.New(token.AccessToken)
+	activeOnly := cmd.Flag(flagActiveOnly)
+	presence := make(map[string]string)
+	var invitees, skipped, failed, external []string
+	var notices []slack.Block
+	for _, userID := range cmd.Mentions {
+		invitees = append(invitees, userID)
+
+		// Members of other organizations in shared channels cannot be sent a
+		// direct message, so they see their invite in the channel instead.
+		if user, err := slackClient.GetUserInfo(userID); err == nil && isExternalUser(token, user) {
+			err = sendChannelInvite(token.AccessToken, callerID, user, record.ChannelID, &meeting, msgCfg.inviteStyle())
+			if err != nil {
+				hlog.FromRequest(r).Warn().
+					Err(err).
+					Msg("sending channel invite")
+				failed = append(failed, userID)
+				continue
+			}
+			external = append(external, userID)
+			continue
+		}
+
+		// The host is told which invitees are away so they know a ping may
+		// go unanswered, and may choose to only invite active users.
+		status, err := slackClient.GetUserPresence(userID)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("checking presence")
+		} else {
+			presence[userID] = status.Presence
+			if activeOnly && status.Presence == presenceAway {
+				skipped = append(skipped, userID)
+				continue
+			}
+		}
+
+		// Invites to users in do not disturb are held back and the caller is
+		// offered to have them delivered once do not disturb ends.
+		until, err := dndUntil(slackClient, userID, time.Now())
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("checking dnd")
+		}
+		if !until.IsZero() {
+			invite, err := prepareInvite(token.AccessToken, callerID, userID, &meeting)
+			if err != nil {
+				hlog.FromRequest(r).Error().
+					Err(err).
+					Msg("preparing held back invite")
+				failed = append(failed, userID)
+				continue
+			}
+			notice, err := dndNotice(locale, invite, until)
+			if err != nil {
+				hlog.FromRequest(r).Error().
+					Err(err).
+					Msg("creating dnd notice")
+				failed = append(failed, userID)
+				continue
+			}
+			notices = append(notices, notice...)
+			continue
+		}
+
+		invite, err := sendOrQueueInvite(s.InviteQueue, token.AccessToken, teamID, callerID, userID, &meeting, msgCfg.inviteStyle())
+		if err != nil {
+			switch err.Error() {
+			case errInactiveAccount, errMissingAuthToken:
+				hlog.FromRequest(r).Info().
+					Err(err).
+					Msg(fmt.Sprintf("inactive or missing auth token"))
+				install(w, locale, s.installURL(r))
+				return
+			case errInvalidAuth:
+				// catches the case where a workspace has removed the app but
+				// someone tries to use the command anyways
+				hlog.FromRequest(r).Info().
+					Err(err).
+					Msg("invalid auth")
+				install(w, locale, s.installURL(r))
+				return
+			case errCannotDMBot:
+				hlog.FromRequest(r).Warn().
+					Err(err).
+					Msg("bot cannot DM")
+			default:
+				hlog.FromRequest(r).Error().
+					Err(err).
+					Msg("unexpected sendPersonalizedInvite error")
+			}
+			failed = append(failed, userID)
+			continue
+		}
+		if invite == nil {
+			// queued invites are tracked by the dispatcher once sent
+			if s.InviteTracker != nil {
+				tracked++
+			}
+			continue
+		}
+		if s.InviteTracker != nil {
+			invite.TeamID = teamID
+			err = s.InviteTracker.Track(invite)
+			if err != nil {
+				hlog.FromRequest(r).Warn().
+					Err(err).
+					Msg("tracking invite")
+			} else {
+				tracked++
+			}
+		}
+	}
+
+	recordUsage(hlog.FromRequest(r), s.Usage, newMeetingStarted(teamID, record.ChannelID, len(invitees)-len(skipped)-len(failed)))
+
+	// Create a personalized response for the meeting initiator.
+	resp, err := joinPersonalMeetingMsg(token.AccessToken, locale, callerID, &meeting, msgCfg.brandStyle())
+	if err != nil {
+		switch err.Error() {
+		case errInvalidAuth, errInactiveAccount, errMissingAuthToken:
+			hlog.FromRequest(r).Info().
+				Err(err).
+				Msg("joinPersonalMeetingMsg invalid or missing token")
+			install(w, locale, s.installURL(r))
+			return
+		default:
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("joinPersonalizedMeetingMsg error")
+			renderError(w, locale, "error.slack")
+			return
+		}
+	}
+	if meeting.Passcode != "" {
+		resp.Blocks.BlockSet = append(resp.Blocks.BlockSet, passcodeBlock(locale, meeting.Passcode))
+	}
+	resp.Blocks.BlockSet = append(resp.Blocks.BlockSet, presenceSummary(locale, presence, invitees, skipped)...)
+	resp.Blocks.BlockSet = append(resp.Blocks.BlockSet, notices...)
+	resp.Blocks.BlockSet = append(resp.Blocks.BlockSet, externalNotice(locale, external)...)
+	resp.Blocks.BlockSet = append(resp.Blocks.BlockSet, inviteFailures(locale, failed)...)
+	if meeting.RSVP && tracked > 0 {
+		resp.Blocks.BlockSet = append(resp.Blocks.BlockSet, rsvpBlock(locale, 0, 0, tracked))
+		s.recordHostMessage(hlog.FromRequest(r), record, resp)
+	}
+	writeMsg(w, resp)
+}
+
+// recordHostMessage stores the host's confirmation of the invites of a
+// meeting so it can be updated as invitees respond.
+func (s *SlashCommandHandlers) recordHostMessage(log *zerolog.Logger, record *MeetingRecord, msg *slack.Msg) {
+	b, err := json.Marshal(msg)
+	if err == nil {
+		err = s.Meetings.SetHostMessage(record.TeamID, record.MeetingID, string(b))
+	}
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Msg("recording host message")
+	}
+}
+
+// recordedMeeting starts a meeting the host may record, e.g.
+// /jitsi record @alice, which is the same as /jitsi --record @alice
+func (s *SlashCommandHandlers) recordedMeeting(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	cmd.Flags[flagRecord] = ""
+	s.dispatchInvites(w, r, locale, cmd, func(teamID, teamName string) (Meeting, error) {
+		return s.MeetingGenerator.New(teamID, teamName, r.PostFormValue("user_id"), r.PostFormValue("channel_name"))
+	})
+}
+
+// streamMeeting starts a meeting the host may live stream with their stream
+// key, e.g. /jitsi stream abcd-efgh-ijkl https://youtu.be/xyz. The response
+// is only shown to the host since the channel would see the stream key with
+// the command, and the stream is announced in the channel once it is live.
+func (s *SlashCommandHandlers) streamMeeting(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	if s.RoomStreamer == nil {
+		fmt.Fprint(w, tr(locale, "stream.disabled"))
+		return
+	}
+	streamKey, streamURL := cmd.Arg(0), cmd.Arg(1)
+	if !streamKeyRE.MatchString(streamKey) || (streamURL != "" && !validWebURL(strings.Trim(streamURL, "<>"))) {
+		fmt.Fprint(w, tr(locale, "stream.usage"))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+	callerID := r.PostFormValue("user_id")
+	opts, ok := s.permittedOptions(w, r, locale, cmd)
+	if !ok {
+		return
+	}
+	if s.Limits.throttled(w, hlog.FromRequest(r), locale, teamID, callerID, 0) {
+		return
+	}
+	meeting, err := s.MeetingGenerator.New(teamID, teamName, callerID, r.PostFormValue("channel_name"))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("generating meeting")
+		renderStoreError(w, locale, "error.meeting", err)
+		return
+	}
+	opts.Stream = true
+	meeting.setOptions(opts)
+	err = s.RoomStreamer.StreamRoom(teamID, teamName, &meeting, streamKey)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("preparing live stream")
+		renderError(w, locale, "stream.failed")
+		return
+	}
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+
+	// The command response is ephemeral so it cannot be replaced once the
+	// meeting ended.
+	record := newMeetingRecord(locale, teamID, callerID, r.PostFormValue("channel_id"), "", &meeting)
+	record.StreamURL = strings.Trim(streamURL, "<>")
+	recordMeeting(hlog.FromRequest(r), s.Meetings, record)
+	recordUsage(hlog.FromRequest(r), s.Usage, newMeetingStarted(teamID, record.ChannelID, 0))
+
+	msgCfg := messageConfig(r, s.MessageConfig, teamID)
+	resp, err := joinPersonalMeetingMsg(token.AccessToken, locale, callerID, &meeting, msgCfg.brandStyle())
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("joinPersonalMeetingMsg error")
+		renderError(w, locale, "error.slack")
+		return
+	}
+	resp.Attachments[0].Title = tr(locale, "stream.ready")
+	resp.Attachments[0].Fallback = resp.Attachments[0].Title
+	writeMsg(w, resp)
+}
+
+// breakoutRooms starts a meeting with breakout rooms and sends every
+// mentioned user the link to their breakout room, e.g.
+// /jitsi breakout 3 @alice @bob @carol
+func (s *SlashCommandHandlers) breakoutRooms(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	count := breakoutCount(cmd.Arg(0))
+	if count == 0 {
+		fmt.Fprint(w, tr(locale, "breakout.usage", maxBreakoutRooms))
+		return
+	}
+	assignments := assignBreakoutRooms(cmd.Mentions, count)
+	if len(assignments[count-1]) == 0 {
+		fmt.Fprint(w, tr(locale, "breakout.usage", maxBreakoutRooms))
+		return
+	}
+	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+	callerID := r.PostFormValue("user_id")
+	opts, ok := s.permittedOptions(w, r, locale, cmd)
+	if !ok {
+		return
+	}
+	if s.Limits.throttled(w, hlog.FromRequest(r), locale, teamID, callerID, len(cmd.Mentions)) {
+		return
+	}
+	main, err := s.MeetingGenerator.New(teamID, teamName, callerID, r.PostFormValue("channel_name"))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("generating meeting")
+		renderStoreError(w, locale, "error.meeting", err)
+		return
+	}
+	rooms, err := s.MeetingGenerator.Breakouts(teamID, teamName, callerID, &main, count)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("generating breakout rooms")
+		renderStoreError(w, locale, "error.meeting", err)
+		return
+	}
+	main.setOptions(opts)
+	for i := range rooms {
+		rooms[i].setOptions(opts)
+	}
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+
+	msgCfg := messageConfig(r, s.MessageConfig, teamID)
+	var invited int
+	var failed []string
+	for i, userIDs := range assignments {
+		for _, userID := range userIDs {
+			invited++
+			err = sendBreakoutInvite(token.AccessToken, callerID, userID, &main, &rooms[i], i+1, msgCfg.inviteStyle())
+			if err != nil {
+				hlog.FromRequest(r).Warn().
+					Err(err).
+					Msg("sending breakout invite")
+				failed = append(failed, userID)
+			}
+		}
+	}
+	record := newMeetingRecord(locale, teamID, callerID, r.PostFormValue("channel_id"), r.PostFormValue("response_url"), &main)
+	recordMeeting(hlog.FromRequest(r), s.Meetings, record)
+	recordUsage(hlog.FromRequest(r), s.Usage, newMeetingStarted(teamID, record.ChannelID, invited-len(failed)))
+
+	// The host gets the links to every room so they can visit them.
+	host, err := slack.New(token.AccessToken).GetUserInfo(callerID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving user")
+		renderError(w, locale, "error.slack")
+		return
+	}
+	mainURL, err := main.AuthenticatedURL(host.ID, host.Name, host.Profile.Image192)
+	roomURLs := make([]string, len(rooms))
+	for i := range rooms {
+		if err == nil {
+			roomURLs[i], err = rooms[i].AuthenticatedURL(host.ID, host.Name, host.Profile.Image192)
+		}
+	}
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("creating breakout room urls")
+		renderStoreError(w, locale, "error.meeting", err)
+		return
+	}
+	summary := breakoutSummary(locale, mainURL, roomURLs, assignments)
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, summary, false, false), nil, nil),
+	}
+	writeMsg(w, &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         summary,
+		Blocks:       slack.Blocks{BlockSet: append(blocks, inviteFailures(locale, failed)...)},
+	})
+}
+
+// announceMeeting announces the meeting in the channel. With live
+// announcements the message is posted by the app so it can be updated as
+// participants join, falling back to the command response when the app
+// cannot post to the channel.
+func (s *SlashCommandHandlers) announceMeeting(w http.ResponseWriter, r *http.Request, locale string, meeting *Meeting, record *MeetingRecord, style messageStyle) {
+	if s.LiveAnnouncements && s.Meetings != nil {
+		ts, err := s.postAnnouncement(record, style)
+		if err == nil {
+			record.MessageTS = ts
+			recordMeeting(hlog.FromRequest(r), s.Meetings, record)
+			if s.Expiry != nil {
+				s.Expiry.Schedule(record)
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		hlog.FromRequest(r).Info().
+			Err(err).
+			Msg("posting live announcement")
+	}
+	recordMeeting(hlog.FromRequest(r), s.Meetings, record)
+	writeMsg(w, roomMsg(locale, record.HostID, meeting, style))
+}
+
+func (s *SlashCommandHandlers) postAnnouncement(record *MeetingRecord, style messageStyle) (string, error) {
+	token, err := s.TokenReader.GetTokenForTeam(record.TeamID)
+	if err != nil {
+		return "", err
+	}
+	_, ts, err := slack.New(token.AccessToken).PostMessage(
+		record.ChannelID,
+		liveRoomMsgOptions(record, style)...,
+	)
+	return ts, err
+}
+
+func (s *SlashCommandHandlers) inviteChannel(w http.ResponseWriter, r *http.Request, locale string) {
+	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+	callerID := r.PostFormValue("user_id")
+	channelID := r.PostFormValue("channel_id")
+
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+	members, err := channelMembers(token.AccessToken, channelID, callerID)
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("listing channel members")
+		fmt.Fprint(w, tr(locale, "channel.list_failed"))
 		return
 	}
-	eventsAPIEvent, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
-	if err != nil {
-		hlog.FromRequest(r).Warn().Err(err).Msg("evhandle: parse failed")
-		w.WriteHeader(http.StatusInternalServerError)
+	if len(members) == 0 {
+		fmt.Fprint(w, tr(locale, "channel.empty"))
 		return
 	}
 
-	if eventsAPIEvent.Type == slackevents.URLVerification {
-		var cr *slackevents.ChallengeResponse
-		err := json.Unmarshal([]byte(body), &cr)
+	// Large channels require confirmation before everyone is messaged.
+	if s.ChannelInviteConfirmSize > 0 && len(members) > s.ChannelInviteConfirmSize {
+		view, err := confirmChannelInviteView(locale, channelInviteRequest{
+			ChannelID:   channelID,
+			ChannelName: r.PostFormValue("channel_name"),
+			TeamName:    teamName,
+			HostID:      callerID,
+		}, len(members))
+		if err == nil {
+			_, err = slack.New(token.AccessToken).OpenView(r.PostFormValue("trigger_id"), view)
+		}
 		if err != nil {
-			hlog.FromRequest(r).Warn().Err(err).Msg("evhandle: challenge resp failed")
-			w.WriteHeader(http.StatusInternalServerError)
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("opening channel invite confirmation")
+			renderError(w, locale, "error.slack")
 			return
 		}
 		w.WriteHeader(http.StatusOK)
-		w.Header().Set("Content-Type", "text")
-		w.Write([]byte(cr.Challenge))
+		return
 	}
 
-	if eventsAPIEvent.Type == slackevents.CallbackEvent {
-		innerEvent := eventsAPIEvent.InnerEvent
-		switch innerEvent.Data.(type) {
-		case *slackevents.AppUninstalledEvent:
-			{
-				err := e.TokenWriter.Remove(eventsAPIEvent.TeamID)
-				// do not error out or return 500 since this failing is non-critical
-				if err != nil {
-					hlog.FromRequest(r).Warn().
-						Err(err).
-						Msg(fmt.Sprintf("app_uninstalled failed for: %s", eventsAPIEvent.TeamID))
-				}
+	if s.Limits.throttled(w, hlog.FromRequest(r), locale, teamID, callerID, len(members)) {
+		return
+	}
+	meeting, err := s.MeetingGenerator.New(teamID, teamName, r.PostFormValue("user_id"), r.PostFormValue("channel_name"))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("generating meeting")
+		renderStoreError(w, locale, "error.meeting", err)
+		return
+	}
+	recordMeeting(hlog.FromRequest(r), s.Meetings, newMeetingRecord(locale, teamID, callerID, r.PostFormValue("channel_id"), r.PostFormValue("response_url"), &meeting))
+	msgCfg := messageConfig(r, s.MessageConfig, teamID)
+	invites, invited, err := inviteMembers(s.InviteQueue, token.AccessToken, teamID, callerID, members, &meeting, msgCfg.inviteStyle())
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("inviting channel members")
+	}
+	recordUsage(hlog.FromRequest(r), s.Usage, newMeetingStarted(teamID, channelID, invited))
+	if s.InviteTracker != nil {
+		for _, invite := range invites {
+			invite.TeamID = teamID
+			err = s.InviteTracker.Track(invite)
+			if err != nil {
+				hlog.FromRequest(r).Warn().
+					Err(err).
+					Msg("tracking invite")
 			}
 		}
 	}
 
-	w.WriteHeader(http.StatusOK)
-}
-
-// SlashCommandHandlers provides http handlers for Slack slash commands
-// that integrate with Jitsi Meet.
-type SlashCommandHandlers struct {
-	MeetingGenerator   *MeetingGenerator
-	SlackSigningSecret string
-	TokenReader        TokenReader
-	TokenWriter        TokenWriter
-	SharableURL        string
-	ServerConfigWriter ServerConfigWriter
+	resp, err := joinPersonalMeetingMsg(token.AccessToken, locale, callerID, &meeting, msgCfg.brandStyle())
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("joinPersonalizedMeetingMsg error")
+		renderError(w, locale, "error.slack")
+		return
+	}
+	resp.Blocks.BlockSet = append(resp.Blocks.BlockSet, channelInviteSummary(locale, invited, len(members))...)
+	writeMsg(w, resp)
 }
 
-// Jitsi will create a conference and dispatch an invite message to both users.
-// It is a slash command for Slack.
-func (s *SlashCommandHandlers) Jitsi(w http.ResponseWriter, r *http.Request) {
-	if !handleRequestValidation(w, r, s.SlackSigningSecret) {
+func (s *SlashCommandHandlers) broadcastInvite(w http.ResponseWriter, r *http.Request, locale string) {
+	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+	callerID := r.PostFormValue("user_id")
+	if s.Limits.throttled(w, hlog.FromRequest(r), locale, teamID, callerID, 0) {
 		return
 	}
-	err := r.ParseForm()
+	meeting, err := s.MeetingGenerator.New(teamID, teamName, r.PostFormValue("user_id"), r.PostFormValue("channel_name"))
 	if err != nil {
 		hlog.FromRequest(r).Error().
 			Err(err).
-			Msg("unable to parse form data")
-		w.WriteHeader(http.StatusInternalServerError)
+			Msg("generating meeting")
+		renderStoreError(w, locale, "error.meeting", err)
 		return
 	}
+	recordMeeting(hlog.FromRequest(r), s.Meetings, newMeetingRecord(locale, teamID, callerID, r.PostFormValue("channel_id"), r.PostFormValue("response_url"), &meeting))
+	recordUsage(hlog.FromRequest(r), s.Usage, newMeetingStarted(teamID, r.PostFormValue("channel_id"), 0))
 
-	text := r.PostFormValue("text")
-	if helpCmdRE.MatchString(text) {
-		help(w)
-	} else if serverCmdRE.MatchString(text) {
-		s.configureServer(w, r)
-	} else {
-		s.dispatchInvites(w, r)
+	msgCfg := messageConfig(r, s.MessageConfig, teamID)
+	msg, err := broadcastMsg(locale, callerID, teamName, broadcastKeyword(r.PostFormValue("text")), &meeting, msgCfg.announcementStyle())
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("creating broadcast message")
+		renderError(w, locale, "error.generic")
+		return
 	}
+	writeMsg(w, msg)
 }
 
-func (s *SlashCommandHandlers) configureServer(w http.ResponseWriter, r *http.Request) {
+func (s *SlashCommandHandlers) scheduleCalendarEvent(w http.ResponseWriter, r *http.Request, locale string) {
+	if len(s.Calendars) == 0 {
+		fmt.Fprint(w, tr(locale, "calendar.disabled"))
+		return
+	}
 	teamID := r.PostFormValue("team_id")
+	teamName := r.PostFormValue("team_domain")
+	callerID := r.PostFormValue("user_id")
 	text := r.PostFormValue("text")
 
-	// First check if the default is being requested.
-	configuration := strings.Split(text, " ")
-	if len(configuration) < 2 {
-		fmt.Fprintf(w, "Run '/jitsi server default' or '/jitsi server [url]' with the URL of your team's server")
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
 		return
 	}
 
-	if configuration[1] == "default" {
-		err := s.ServerConfigWriter.Remove(teamID)
-		if err != nil {
-			hlog.FromRequest(r).Error().
-				Err(err).
-				Msg("defaulting server")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprint(w, "Your team's conferences will now be hosted on https://meet.jit.si")
+	// The caller's timezone is used to interpret the requested start time.
+	slackClient := slack.New(token.AccessToken)
+	caller, err := slackClient.GetUserInfo(callerID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving caller info")
+		renderError(w, locale, "error.slack")
 		return
 	}
-
-	if !serverConfigRE.MatchString(text) {
-		w.Header().Set("Content-type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprint(w, "A proper conference host must be provided.")
+	loc := userLocaleInfo{TZ: caller.TZ}.location()
+	start, err := parseStartTime(mentionRE.ReplaceAllString(text, ""), time.Now().In(loc))
+	if err != nil {
+		fmt.Fprint(w, tr(locale, "calendar.usage"))
+		return
+	}
+	if s.Limits.throttled(w, hlog.FromRequest(r), locale, teamID, callerID, 0) {
 		return
 	}
 
-	host := serverConfigRE.FindAllStringSubmatch(text, -1)[0][1]
-	host = strings.Trim(host, "<>")
-	err := s.ServerConfigWriter.Store(&ServerCfgData{
-		TeamID: teamID,
-		Server: host,
-	})
+	var attendees []string
+	for _, match := range atMentionRE.FindAllStringSubmatch(text, -1) {
+		userInfo, err := slackClient.GetUserInfo(match[1])
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("retrieving attendee info")
+			continue
+		}
+		if userInfo.Profile.Email != "" {
+			attendees = append(attendees, userInfo.Profile.Email)
+		}
+	}
+
+	meeting, err := s.MeetingGenerator.New(teamID, teamName, r.PostFormValue("user_id"), r.PostFormValue("channel_name"))
 	if err != nil {
 		hlog.FromRequest(r).Error().
 			Err(err).
-			Msg("configuring server")
-		w.WriteHeader(http.StatusInternalServerError)
+			Msg("generating meeting")
+		renderStoreError(w, locale, "error.meeting", err)
 		return
 	}
-	w.Header().Set("Content-type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Your team's conferences will now be hosted on %s\nRun `/jitsi server default` if you'd like to continue using https://meet.jit.si", host)
+
+	ev := CalendarEvent{
+		Title:     tr(locale, "calendar.title"),
+		Start:     start,
+		End:       start.Add(calendarEventLength),
+		URL:       meeting.URL,
+		Attendees: attendees,
+	}
+	var connectLinks []string
+	for _, calendar := range s.Calendars {
+		link, err := calendar.CreateEvent(teamID, callerID, ev)
+		if err != nil {
+			switch err.Error() {
+			case errMissingCalendarToken:
+				connectLinks = append(connectLinks, fmt.Sprintf("<%s|%s>", calendar.AuthURL(teamID, callerID), calendar.Name()))
+				continue
+			default:
+				hlog.FromRequest(r).Error().
+					Err(err).
+					Str("calendar", calendar.Name()).
+					Msg("creating calendar event")
+				renderError(w, locale, "error.calendar", calendar.Name())
+				return
+			}
+		}
+		fmt.Fprint(w, tr(locale, "calendar.created", link, formatTime(locale, start), meeting.URL))
+		return
+	}
+	fmt.Fprint(w, tr(locale, "calendar.connect", strings.Join(connectLinks, tr(locale, "calendar.or"))))
 }
 
-func (s *SlashCommandHandlers) dispatchInvites(w http.ResponseWriter, r *http.Request) {
-	// Generate the meeting data.
+// scheduleMeeting starts a meeting later, e.g. /jitsi schedule 3pm @alice.
+// The invitees, or the channel when nobody is mentioned, see the start time
+// in their own timezone and the messages say the meeting is starting once
+// it starts. Scheduled meetings are kept in-process and their messages are
+// not updated if the service restarts before they start.
+func (s *SlashCommandHandlers) scheduleMeeting(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	if s.Tasks == nil {
+		fmt.Fprint(w, tr(locale, "schedule.disabled"))
+		return
+	}
 	teamID := r.PostFormValue("team_id")
 	teamName := r.PostFormValue("team_domain")
-	meeting, err := s.MeetingGenerator.New(teamID, teamName)
+	callerID := r.PostFormValue("user_id")
+	channelID := r.PostFormValue("channel_id")
+
+	token, ok := s.teamToken(w, r, locale, teamID)
+	if !ok {
+		return
+	}
+	slackClient := slack.New(token.AccessToken)
+	caller, err := slackClient.GetUserInfo(callerID)
 	if err != nil {
 		hlog.FromRequest(r).Error().
 			Err(err).
-			Msg("generating meeting")
-		w.WriteHeader(http.StatusInternalServerError)
+			Msg("retrieving caller info")
+		renderError(w, locale, "error.slack")
 		return
 	}
-
-	// If nobody was @-mentioned then just send a generic invite to the channel.
-	text := r.PostFormValue("text")
-	matches := atMentionRE.FindAllStringSubmatch(text, -1)
-	if matches == nil {
-		w.Header().Set("Content-type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		resp := fmt.Sprintf(roomTemplate, meeting.Host, meeting.Host, meeting.URL)
-		w.Write([]byte(resp))
+	loc := userLocaleInfo{TZ: caller.TZ}.location()
+	start, err := parseStartTime(strings.Join(cmd.Args, " "), time.Now().In(loc))
+	if err != nil {
+		fmt.Fprint(w, tr(locale, "schedule.usage"))
+		return
+	}
+	opts, ok := s.permittedOptions(w, r, locale, cmd)
+	if !ok {
+		return
+	}
+	if s.Limits.throttled(w, hlog.FromRequest(r), locale, teamID, callerID, len(cmd.Mentions)) {
 		return
 	}
 
-	// Grab a oauth token for the slack workspace.
-	token, err := s.TokenReader.GetTokenForTeam(teamID)
+	meeting, err := s.MeetingGenerator.New(teamID, teamName, callerID, r.PostFormValue("channel_name"))
 	if err != nil {
-		switch err.Error() {
-		case errMissingAuthToken:
-			hlog.FromRequest(r).Info().
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("generating meeting")
+		renderStoreError(w, locale, "error.meeting", err)
+		return
+	}
+	meeting.setOptions(opts)
+	record := newMeetingRecord(locale, teamID, callerID, channelID, "", &meeting)
+	recordMeeting(hlog.FromRequest(r), s.Meetings, record)
+
+	msgCfg := messageConfig(r, s.MessageConfig, teamID)
+	var messages []scheduledMessage
+	var failed []string
+	if len(cmd.Mentions) == 0 {
+		style := msgCfg.announcementStyle()
+		text := tr(locale, "schedule.announcement", callerID, slackDate(locale, start))
+		_, ts, err := slackClient.PostMessage(channelID, scheduledAnnouncementMsgOptions(locale, text, &meeting, style)...)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
 				Err(err).
-				Msg("missing auth token")
-			install(w, s.SharableURL)
-		default:
-			hlog.FromRequest(r).Error().
+				Msg("posting scheduled announcement")
+			fmt.Fprint(w, tr(locale, "schedule.announce_failed"))
+			return
+		}
+		messages = append(messages, scheduledMessage{
+			channel:   channelID,
+			timestamp: ts,
+			locale:    locale,
+			options: func(text string) []slack.MsgOption {
+				return scheduledAnnouncementMsgOptions(locale, text, &meeting, style)
+			},
+		})
+	}
+	for _, userID := range cmd.Mentions {
+		invite, err := prepareInvite(token.AccessToken, callerID, userID, &meeting)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
 				Err(err).
-				Msg("retrieving token")
-			w.WriteHeader(http.StatusInternalServerError)
+				Msg("preparing scheduled invite")
+			failed = append(failed, userID)
+			continue
+		}
+		style := msgCfg.inviteStyle()
+		_, opts := scheduledInviteMsgOptions(invite, slackDateIn(invite.Locale, invite.location(), start), style)
+		_, ts, err := slackClient.PostMessage(invite.Channel, opts...)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("sending scheduled invite")
+			failed = append(failed, userID)
+			continue
 		}
+		messages = append(messages, scheduledMessage{
+			channel:   invite.Channel,
+			timestamp: ts,
+			locale:    invite.Locale,
+			options: func(text string) []slack.MsgOption {
+				return inviteMsgOptions(invite, text, style)
+			},
+		})
+	}
+	recordUsage(hlog.FromRequest(r), s.Usage, newMeetingStarted(teamID, channelID, len(cmd.Mentions)-len(failed)))
+
+	log := hlog.FromRequest(r)
+	accessToken := token.AccessToken
+	s.Tasks.After(time.Until(start), func() {
+		startScheduled(log, accessToken, meeting.ID, messages)
+	})
+
+	resp, err := joinPersonalMeetingMsg(token.AccessToken, locale, callerID, &meeting, msgCfg.brandStyle())
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("joinPersonalMeetingMsg error")
+		renderError(w, locale, "error.slack")
 		return
 	}
+	resp.Attachments[0].Title = tr(locale, "schedule.confirm", slackDate(locale, start))
+	resp.Attachments[0].Fallback = resp.Attachments[0].Title
+	resp.Blocks.BlockSet = append(resp.Blocks.BlockSet, inviteFailures(locale, failed)...)
+	writeMsg(w, resp)
+}
 
-	// Dispatch a personal invite to each user @-mentioned.
-	callerID := r.PostFormValue("user_id")
-	for _, match := range matches {
-		err = sendPersonalizedInvite(token.AccessToken, callerID, match[1], &meeting)
-		if err != nil {
-			switch err.Error() {
-			case errInactiveAccount, errMissingAuthToken:
-				hlog.FromRequest(r).Info().
-					Err(err).
-					Msg(fmt.Sprintf("inactive or missing auth token"))
-				install(w, s.SharableURL)
-				return
-			case errInvalidAuth:
-				// catches the case where a workspace has removed the app but
-				// someone tries to use the command anyways
-				hlog.FromRequest(r).Info().
-					Err(err).
-					Msg("invalid auth")
-				install(w, s.SharableURL)
-				return
-			case errCannotDMBot:
-				hlog.FromRequest(r).Warn().
-					Err(err).
-					Msg("bot cannot DM")
-			default:
-				hlog.FromRequest(r).Error().
-					Err(err).
-					Msg("unexpected sendPersonalizedInvite error")
-			}
-		}
+// CalendarOAuthHandlers is used for handling calendar OAuth callbacks.
+type CalendarOAuthHandlers struct {
+	Calendar CalendarProvider
+}
+
+// Auth completes the connection of a user's calendar.
+func (c *CalendarOAuthHandlers) Auth(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	if params.Get("error") != "" {
+		hlog.FromRequest(r).Info().
+			Err(errors.New(params.Get("error"))).
+			Msg("calendar connect declined")
+		fmt.Fprintf(w, "%s was not connected.", c.Calendar.Name())
+		return
 	}
 
-	// Create a personalized response for the meeting initiator.
-	resp, err := joinPersonalMeetingMsg(token.AccessToken, callerID, &meeting)
+	err := c.Calendar.Connect(r.Context(), params.Get("state"), params.Get("code"))
 	if err != nil {
 		switch err.Error() {
-		case errInvalidAuth, errInactiveAccount, errMissingAuthToken:
-			hlog.FromRequest(r).Info().
+		case errInvalidState:
+			hlog.FromRequest(r).Warn().
 				Err(err).
-				Msg("joinPersonalMeetingMsg invalid or missing token")
-			install(w, s.SharableURL)
-			return
+				Msg("calendar connect state")
+			w.WriteHeader(http.StatusBadRequest)
+		case errTeamDenied:
+			hlog.FromRequest(r).Info().
+				Msg("denying team calendar connect")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "%s was not connected. This workspace can't use the app.", c.Calendar.Name())
 		default:
 			hlog.FromRequest(r).Error().
 				Err(err).
-				Msg("joinPersonalizedMeetingMsg error")
+				Msg("calendar connect")
+			w.WriteHeader(http.StatusInternalServerError)
 		}
+		return
 	}
-	w.Header().Set("Content-type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(resp))
+	fmt.Fprintf(w, "%s connected. You can close this window and return to Slack.", c.Calendar.Name())
 }
 
 // TokenWriter provides an interface to write access token data to the
@@ -342,22 +3222,104 @@ type TokenWriter interface {
 	Remove(teamID string) error
 }
 
+// UserTokenReadWriter provides an interface for reading and writing the
+// user-scoped access tokens of users that authorized the app.
+type UserTokenReadWriter interface {
+	GetTokenForUser(teamID, userID string) (*UserTokenData, error)
+	StoreUserToken(data *UserTokenData) error
+	RemoveUserToken(teamID, userID string) error
+}
+
 // SlackOAuthHandlers is used for handling Slack OAuth validation.
 type SlackOAuthHandlers struct {
 	ClientID     string
-	ClientSecret string
+	ClientSecret *Secret
 	AppID        string
 	TokenWriter  TokenWriter
+	// AuthorizeURL is optional and is the slack authorize url installs are
+	// redirected to with a signed state. Installs must then start from
+	// Install and callbacks without a valid state are rejected.
+	AuthorizeURL string
+	// StateSecret is used to sign the install state.
+	StateSecret string
+	// Apps are optional and are the other slack apps served. Their installs
+	// are told apart by the app query parameter, e.g.
+	// https://[server]/slack/auth?app=A123
+	Apps SlackApps
+	// UserTokens is optional and stores the user token of installers that
+	// granted user scopes.
+	UserTokens UserTokenReadWriter
+	// Audit is optional and records installs.
+	Audit AuditWriter
+	// Gate is optional and denies installs of teams that may not use the
+	// service.
+	Gate *TeamGate
+}
+
+// client returns the app id and oauth client of the app an install is for.
+func (o *SlackOAuthHandlers) client(r *http.Request) (appID, clientID, clientSecret string) {
+	if app, ok := o.Apps.byID(r.URL.Query().Get("app")); ok {
+		return app.AppID, app.ClientID, app.ClientSecret
+	}
+	return o.AppID, o.ClientID, o.ClientSecret.Value()
+}
+
+// Install starts a slack install by redirecting to the authorize url with
+// a state the callback verifies. Installs started from the link of an
+// install prompt carry its channel and command to the callback.
+func (o *SlackOAuthHandlers) Install(w http.ResponseWriter, r *http.Request) {
+	authorizeURL, err := url.Parse(o.AuthorizeURL)
+	if o.AuthorizeURL == "" || err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var resume url.Values
+	if raw := r.URL.Query().Get(keyResume); raw != "" {
+		resume, err = verifyState(o.StateSecret, raw)
+		if err != nil {
+			// the install itself does not depend on the prompt
+			hlog.FromRequest(r).Info().
+				Err(err).
+				Msg("ignoring install resume state")
+		}
+	}
+	state, cookie, err := installState(o.StateSecret, resume)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("creating install state")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// installs resumed for a known team are denied before slack is asked
+	if teamID := resume.Get(keyResumeTeam); teamID != "" && o.Gate != nil && !o.Gate.Allowed(hlog.FromRequest(r), teamID) {
+		hlog.FromRequest(r).Info().
+			Str("team", teamID).
+			Msg("denying team install")
+		o.renderInstallPage(w, r, http.StatusForbidden, PageInstallFailed, "")
+		return
+	}
+	params := authorizeURL.Query()
+	_, clientID, _ := o.client(r)
+	params.Set("client_id", clientID)
+	params.Set("state", state)
+	if teamID := resume.Get(keyResumeTeam); teamID != "" {
+		params.Set("team", teamID)
+	}
+	authorizeURL.RawQuery = params.Encode()
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, authorizeURL.String(), http.StatusFound)
 }
 
-// Auth validates OAuth access tokens.
+// Auth validates OAuth access tokens and shows installers a landing page,
+// see LoadPages.
 func (o *SlackOAuthHandlers) Auth(w http.ResponseWriter, r *http.Request) {
 	params, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
 		hlog.FromRequest(r).Error().
 			Err(err).
 			Msg("parsing query params")
-		w.WriteHeader(http.StatusInternalServerError)
+		o.renderInstallPage(w, r, http.StatusInternalServerError, PageInstallFailed, "")
 		return
 	}
 
@@ -370,15 +3332,28 @@ func (o *SlackOAuthHandlers) Auth(w http.ResponseWriter, r *http.Request) {
 			hlog.FromRequest(r).Info().
 				Err(errors.New(params["error"][0])).
 				Msg("user declined install")
-			w.WriteHeader(http.StatusOK)
+			o.renderInstallPage(w, r, http.StatusOK, PageInstallDeclined, "")
 			return
 		default:
 			hlog.FromRequest(r).Error().
 				Err(errors.New(params["error"][0])).
 				Msg("failed install")
-			w.WriteHeader(http.StatusInternalServerError)
+			o.renderInstallPage(w, r, http.StatusInternalServerError, PageInstallFailed, "")
+			return
+		}
+	}
+
+	var resume url.Values
+	if o.AuthorizeURL != "" {
+		resume, err = verifyInstallState(o.StateSecret, r)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("rejecting install callback")
+			o.renderInstallPage(w, r, http.StatusForbidden, PageInstallFailed, "")
 			return
 		}
+		http.SetCookie(w, &http.Cookie{Name: installStateCookie, Path: "/slack", MaxAge: -1})
 	}
 
 	code := params["code"]
@@ -386,14 +3361,15 @@ func (o *SlackOAuthHandlers) Auth(w http.ResponseWriter, r *http.Request) {
 		hlog.FromRequest(r).Error().
 			Err(err).
 			Msg("code not provided")
-		w.WriteHeader(http.StatusInternalServerError)
+		o.renderInstallPage(w, r, http.StatusInternalServerError, PageInstallFailed, "")
 		return
 	}
 
+	appID, clientID, clientSecret := o.client(r)
 	resp, err := slack.GetOAuthV2Response(
 		http.DefaultClient,
-		o.ClientID,
-		o.ClientSecret,
+		clientID,
+		clientSecret,
 		code[0],
 		"")
 
@@ -401,23 +3377,76 @@ func (o *SlackOAuthHandlers) Auth(w http.ResponseWriter, r *http.Request) {
 		hlog.FromRequest(r).Error().
 			Err(err).
 			Msg("oauth req error")
-		w.WriteHeader(http.StatusInternalServerError)
+		o.renderInstallPage(w, r, http.StatusInternalServerError, PageInstallFailed, "")
 		return
 	}
 
-	err = o.TokenWriter.Store(&TokenData{
-		TeamID:      resp.Team.ID,
-		AccessToken: resp.AccessToken,
-	})
+	if o.Gate != nil && !o.Gate.Allowed(hlog.FromRequest(r), resp.Team.ID) {
+		hlog.FromRequest(r).Info().
+			Str("team", resp.Team.ID).
+			Msg("denying team install")
+		o.renderInstallPage(w, r, http.StatusForbidden, PageInstallFailed, "")
+		return
+	}
+
+	installed := tokenData(resp)
+	err = o.TokenWriter.Store(installed)
 
 	if err != nil {
 		hlog.FromRequest(r).Error().
 			Err(err).
 			Msg("unable to store token")
-		w.WriteHeader(http.StatusInternalServerError)
+		o.renderInstallPage(w, r, http.StatusInternalServerError, PageInstallFailed, "")
 		return
 	}
+	recordAudit(hlog.FromRequest(r), o.Audit, newAuditEvent(resp.Team.ID, resp.AuthedUser.ID, AuditInstall, appID, nil, installAudit(installed)))
+
+	if user := userTokenData(resp); user != nil && o.UserTokens != nil {
+		// the install succeeded even if the user token cannot be stored
+		err = o.UserTokens.StoreUserToken(user)
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("unable to store user token")
+		}
+	}
+
+	// the install succeeded even if the installer cannot be messaged
+	err = sendOnboardingMessage(resp.AccessToken, resp.AuthedUser.ID)
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("sending onboarding message")
+	}
+
+	// installs started from a prompt lead back to the channel it was shown
+	// in, where the command may be run again
+	channelID := resumeChannel(resp.Team.ID, resume)
+	if channelID != "" {
+		err = sendResumeMessage(resp.AccessToken, resp.AuthedUser.ID, channelID, resume.Get(keyResumeCommand))
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("sending resume message")
+		}
+	}
+	o.renderInstallPage(w, r, http.StatusOK, PageInstallSuccess, installRedirect(appID, resp.Team.ID, channelID))
+}
 
-	redirect := fmt.Sprintf("https://slack.com/app_redirect?app=%s", o.AppID)
-	http.Redirect(w, r, redirect, http.StatusFound)
+// renderInstallPage writes the landing page of an install callback. The slack
+// url is optional and defaults to the app in slack.
+func (o *SlackOAuthHandlers) renderInstallPage(w http.ResponseWriter, r *http.Request, status int, name, slackURL string) {
+	appID, _, _ := o.client(r)
+	page := installPage{SlackURL: slackURL}
+	if page.SlackURL == "" {
+		page.SlackURL = installRedirect(appID, "", "")
+	}
+	if o.AuthorizeURL != "" {
+		// relative to the callback at /slack/auth
+		page.RetryURL = "install"
+		if app := r.URL.Query().Get("app"); app != "" {
+			page.RetryURL += "?" + url.Values{"app": {app}}.Encode()
+		}
+	}
+	renderPage(w, r, status, name, &page)
 }
@@ -0,0 +1,230 @@
+package jitsi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// The help topics of the built-in subcommands, e.g. /jitsi help server
+const (
+	topicMeetings  = "meetings"
+	topicSchedule  = "schedule"
+	topicServer    = "server"
+	topicCustomize = "customize"
+	topicAdmin     = "admin"
+)
+
+// maxSectionTextLength is the length slack limits the text of a section
+// block to.
+const maxSectionTextLength = 3000
+
+// helpTopics are the topics of the built-in subcommands in the order they are
+// listed in the help.
+var helpTopics = []string{topicMeetings, topicSchedule, topicServer, topicCustomize, topicAdmin}
+
+// subcommand is a /jitsi subcommand and how it is listed in the help.
+type subcommand struct {
+	name    string
+	handler SubcommandHandler
+	// topic is the help topic the subcommand is listed under. Subcommands
+	// without a topic are not listed.
+	topic string
+	// help describes how to use the subcommand in the locale.
+	help func(locale string) string
+	// async marks subcommands that start meetings and send invites. They
+	// are handled after the command was acknowledged when async commands
+	// are enabled.
+	async bool
+}
+
+// builtinHelp describes a built-in subcommand with the help of its locale
+// key.
+func builtinHelp(key string) func(locale string) string {
+	return func(locale string) string {
+		return tr(locale, key)
+	}
+}
+
+// builtinSubcommands are the subcommands of the app in the order they are
+// listed in the help. The entry without a name lists the invites that are
+// sent without a subcommand.
+func (s *SlashCommandHandlers) builtinSubcommands() []subcommand {
+	withoutCmd := func(h func(http.ResponseWriter, *http.Request, string)) SubcommandHandler {
+		return func(w http.ResponseWriter, r *http.Request, locale string, _ *Command) {
+			h(w, r, locale)
+		}
+	}
+	return []subcommand{
+		{topic: topicMeetings, help: builtinHelp("help.invite")},
+		{name: "room", handler: s.namedRoom, topic: topicMeetings, help: builtinHelp("help.room"), async: true},
+		{name: "me", handler: withoutCmd(s.personalMeeting), topic: topicMeetings, help: builtinHelp("help.me"), async: true},
+		{name: "here", handler: s.channelRoom, topic: topicMeetings, help: builtinHelp("help.here"), async: true},
+		{name: "channel", handler: withoutCmd(s.inviteChannel), topic: topicMeetings, help: builtinHelp("help.channel"), async: true},
+		{name: "end", handler: withoutCmd(s.endMeeting), topic: topicMeetings, help: builtinHelp("help.end")},
+		{name: "who", handler: withoutCmd(s.listParticipants), topic: topicMeetings, help: builtinHelp("help.who")},
+		{name: "active", handler: withoutCmd(s.activeMeetings), topic: topicMeetings, help: builtinHelp("help.active")},
+		{name: "record", handler: s.recordedMeeting, topic: topicMeetings, help: builtinHelp("help.record"), async: true},
+		{name: "stream", handler: s.streamMeeting, topic: topicMeetings, help: builtinHelp("help.stream"), async: true},
+		{name: "breakout", handler: s.breakoutRooms, topic: topicMeetings, help: builtinHelp("help.breakout"), async: true},
+		{name: "history", handler: s.meetingHistory, topic: topicMeetings, help: builtinHelp("help.history")},
+		{name: "cancel", handler: withoutCmd(s.cancelMeeting), topic: topicMeetings, help: builtinHelp("help.cancel")},
+		{name: "feedback", handler: withoutCmd(s.openFeedback), topic: topicMeetings, help: builtinHelp("help.feedback")},
+		{name: "schedule", handler: s.scheduleMeeting, topic: topicSchedule, help: builtinHelp("help.schedule"), async: true},
+		{name: "calendar", handler: withoutCmd(s.scheduleCalendarEvent), topic: topicSchedule, help: builtinHelp("help.calendar"), async: true},
+		{name: "server", handler: s.configureServer, topic: topicServer, help: builtinHelp("help.server")},
+		{name: "prefs", handler: s.configurePrefs, topic: topicCustomize, help: builtinHelp("help.prefs")},
+		{name: "link", handler: s.linkIdentity, topic: topicCustomize, help: builtinHelp("help.link")},
+		{name: "forget-me", handler: s.forgetMe, topic: topicCustomize, help: builtinHelp("help.forget")},
+		{name: "naming", handler: s.configureRoomNaming, topic: topicCustomize, help: builtinHelp("help.naming")},
+		{name: "words", handler: s.configureWords, topic: topicCustomize, help: builtinHelp("help.words")},
+		{name: "template", handler: s.configureTemplate, topic: topicCustomize, help: builtinHelp("help.template")},
+		{name: "brand", handler: s.configureBranding, topic: topicCustomize, help: builtinHelp("help.brand")},
+		{name: "config", handler: s.configureURLConfig, topic: topicCustomize, help: builtinHelp("help.config")},
+		{name: "settings", handler: withoutCmd(s.openSettings), topic: topicAdmin, help: builtinHelp("help.settings")},
+		{name: "permissions", handler: s.configurePermissions, topic: topicAdmin, help: builtinHelp("help.permissions")},
+		{name: "stats", handler: withoutCmd(s.usageStats), topic: topicAdmin, help: builtinHelp("help.stats")},
+		{name: "identity", handler: s.configureIdentity, topic: topicAdmin, help: builtinHelp("help.identity")},
+		{name: "help", handler: s.showHelp},
+	}
+}
+
+// allSubcommands returns the built-in subcommands followed by the registered
+// ones. Registered subcommands replace the built-in ones of the same name and
+// keep their help unless they have their own.
+func (s *SlashCommandHandlers) allSubcommands() []subcommand {
+	var all []subcommand
+	replaced := make(map[string]bool)
+	for _, sub := range s.builtinSubcommands() {
+		if i, ok := s.registered(sub.name); ok && sub.name != "" {
+			reg := s.subcommands[i]
+			if reg.topic == "" {
+				reg.topic, reg.help = sub.topic, sub.help
+			}
+			sub = reg
+			replaced[sub.name] = true
+		}
+		all = append(all, sub)
+	}
+	for _, sub := range s.subcommands {
+		if !replaced[sub.name] {
+			all = append(all, sub)
+		}
+	}
+	return all
+}
+
+// registered looks up a registered subcommand by name.
+func (s *SlashCommandHandlers) registered(name string) (int, bool) {
+	for i, sub := range s.subcommands {
+		if sub.name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// lookupSubcommand returns the subcommand of the name, preferring registered
+// subcommands over the built-in ones.
+func (s *SlashCommandHandlers) lookupSubcommand(name string) (subcommand, bool) {
+	if name == "" {
+		return subcommand{}, false
+	}
+	for _, sub := range s.allSubcommands() {
+		if sub.name == name && sub.handler != nil {
+			return sub, true
+		}
+	}
+	return subcommand{}, false
+}
+
+// showHelp shows the help of all topics, e.g. /jitsi help, or of one topic
+// or subcommand, e.g. /jitsi help server
+func (s *SlashCommandHandlers) showHelp(w http.ResponseWriter, r *http.Request, locale string, cmd *Command) {
+	writeMsg(w, helpMsg(locale, s.allSubcommands(), strings.ToLower(cmd.Arg(0)), cmd.Slash))
+}
+
+// helpMsg creates the help of the subcommands of a topic or of a single
+// subcommand. All topics are listed when topic is empty. The help mentions
+// the slash command that was run.
+func helpMsg(locale string, subcommands []subcommand, topic, slash string) *slack.Msg {
+	topics := append([]string{}, helpTopics...)
+	for _, sub := range subcommands {
+		if sub.topic != "" && !containsString(topics, sub.topic) {
+			topics = append(topics, sub.topic)
+		}
+	}
+
+	match := func(sub subcommand) bool {
+		return topic == "" || sub.topic == topic
+	}
+	if topic != "" && !containsString(topics, topic) {
+		match = func(sub subcommand) bool {
+			return sub.name == topic
+		}
+	}
+
+	title := withSlashCommand(tr(locale, "help.title"), slash)
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, title, false, false)),
+	}
+	for _, t := range topics {
+		var lines []string
+		for _, sub := range subcommands {
+			if sub.topic == t && match(sub) {
+				lines = append(lines, withSlashCommand(sub.help(locale), slash))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		// long topics continue in further sections as slack limits the
+		// text of a section
+		text := "*" + helpTopicTitle(locale, t) + "*"
+		for _, line := range lines {
+			if len(text)+len(line) >= maxSectionTextLength {
+				blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+				text = ""
+			}
+			text = strings.TrimPrefix(text+"\n"+line, "\n")
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+	}
+
+	names := make([]string, 0, len(topics))
+	for _, t := range topics {
+		names = append(names, "`"+t+"`")
+	}
+	footer := tr(locale, "help.topics", strings.Join(names, ", "))
+	if len(blocks) == 1 {
+		footer = tr(locale, "help.unknown_topic", topic) + " " + footer
+	}
+	footer = withSlashCommand(footer, slash)
+	blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, footer, false, false)))
+
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         title,
+		Blocks:       slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// helpTopicTitle returns the title of a help topic. Topics of registered
+// subcommands are titled with their name.
+func helpTopicTitle(locale, topic string) string {
+	if containsString(helpTopics, topic) {
+		return tr(locale, "help.topic."+topic)
+	}
+	return topic
+}
+
+// containsString returns whether the value is in the list.
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package jitsi
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// historyLookback is how far back meetings are listed by the history
+	// subcommand.
+	historyLookback = 30 * 24 * time.Hour
+	// defaultHistoryLength and maxHistoryLength limit the meetings listed by
+	// the history subcommand.
+	defaultHistoryLength = 5
+	maxHistoryLength     = 20
+)
+
+// historyLength parses the number of meetings to list, falling back to the
+// default for missing or invalid numbers.
+func historyLength(arg string) int {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		return defaultHistoryLength
+	}
+	if n > maxHistoryLength {
+		return maxHistoryLength
+	}
+	return n
+}
+
+// meetingHistory selects the n most recent meetings that match from meetings
+// sorted most recent first. Cancelled meetings are left out.
+func meetingHistory(meetings []*MeetingRecord, n int, match func(*MeetingRecord) bool) []*MeetingRecord {
+	var history []*MeetingRecord
+	for _, meeting := range meetings {
+		if len(history) == n {
+			break
+		}
+		if meeting.Status != MeetingCancelled && match(meeting) {
+			history = append(history, meeting)
+		}
+	}
+	return history
+}
+
+// historySummary lists meetings with the links to rejoin them. Expired
+// meetings are listed without a link.
+func historySummary(locale string, meetings []*MeetingRecord, joinURL func(*MeetingRecord) string) string {
+	if len(meetings) == 0 {
+		return tr(locale, "history.none")
+	}
+	now := time.Now()
+	lines := []string{tr(locale, "history.title")}
+	for _, meeting := range meetings {
+		created := time.Unix(meeting.CreatedAt, 0)
+		date := slackDate(locale, created)
+		if meeting.expired(now) {
+			lines = append(lines, tr(locale, "history.expired_item", meeting.RoomName, meeting.ChannelID, meeting.HostID, date))
+			continue
+		}
+		lines = append(lines, tr(
+			locale,
+			"history.item",
+			joinURL(meeting),
+			meeting.RoomName,
+			meeting.ChannelID,
+			meeting.HostID,
+			date,
+		))
+	}
+	return strings.Join(lines, "\n")
+}
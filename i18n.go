@@ -0,0 +1,240 @@
+package jitsi
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const slackUsersInfoURL = "https://slack.com/api/users.info"
+
+// builtinLocales are the message catalogs shipped with the service. The
+// english catalog contains every message key and documents the format
+// expected from additional catalogs.
+//
+//go:embed locales/*.json
+var builtinLocales embed.FS
+
+var translations = newCatalogs()
+
+// catalogs holds the message catalogs keyed by slack locale (e.g. en-US).
+type catalogs struct {
+	mu            sync.RWMutex
+	defaultLocale string
+	messages      map[string]map[string]string
+}
+
+func newCatalogs() *catalogs {
+	c := &catalogs{
+		defaultLocale: "en",
+		messages:      make(map[string]map[string]string),
+	}
+	entries, err := builtinLocales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := builtinLocales.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		err = c.loadJSON(strings.TrimSuffix(entry.Name(), ".json"), data)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return c
+}
+
+func (c *catalogs) loadJSON(locale string, data []byte) error {
+	var messages map[string]string
+	err := json.Unmarshal(data, &messages)
+	if err != nil {
+		return fmt.Errorf("locale %s: %w", locale, err)
+	}
+	c.register(locale, messages)
+	return nil
+}
+
+func (c *catalogs) register(locale string, messages map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	locale = normalizeLocale(locale)
+	if c.messages[locale] == nil {
+		c.messages[locale] = make(map[string]string)
+	}
+	for k, v := range messages {
+		c.messages[locale][k] = v
+	}
+}
+
+// lookup finds a message for the locale, falling back to the language of
+// the locale and then the default locale.
+func (c *catalogs) lookup(locale, key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	locale = normalizeLocale(locale)
+	candidates := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, c.defaultLocale, "en")
+	for _, candidate := range candidates {
+		if msg, ok := c.messages[candidate][key]; ok {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+// RegisterTranslations adds or overrides messages for a locale. Messages
+// use fmt verbs and may use explicit argument indexes (e.g. %[2]s) when a
+// language needs a different argument order.
+func RegisterTranslations(locale string, messages map[string]string) {
+	translations.register(locale, messages)
+}
+
+// LoadTranslations loads every <locale>.json message catalog in the
+// directory, e.g. de-DE.json or fr.json.
+func LoadTranslations(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		locale := strings.TrimSuffix(filepath.Base(file), ".json")
+		err = translations.loadJSON(locale, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDefaultLocale sets the locale used when a user's locale is unknown or
+// has no translation.
+func SetDefaultLocale(locale string) {
+	translations.mu.Lock()
+	defer translations.mu.Unlock()
+	translations.defaultLocale = normalizeLocale(locale)
+}
+
+// DefaultLocale returns the locale used when a user's locale is unknown.
+func DefaultLocale() string {
+	translations.mu.RLock()
+	defer translations.mu.RUnlock()
+	return translations.defaultLocale
+}
+
+// tr translates the message key for the locale and formats it with args.
+func tr(locale, key string, args ...interface{}) string {
+	msg, ok := translations.lookup(locale, key)
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// userLocaleInfo is the locale and timezone of a slack user.
+type userLocaleInfo struct {
+	Locale string `json:"locale"`
+	TZ     string `json:"tz"`
+}
+
+// location returns the timezone of the user or UTC when it is unknown.
+func (u userLocaleInfo) location() *time.Location {
+	loc, err := time.LoadLocation(u.TZ)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// location returns the timezone of the invitee or UTC when it is unknown.
+func (i *Invite) location() *time.Location {
+	return userLocaleInfo{Locale: i.Locale, TZ: i.TZ}.location()
+}
+
+// userLocale retrieves the slack locale and timezone of the user. The slack
+// client does not support requesting the locale so users.info is called
+// directly.
+func userLocale(token, userID string) (userLocaleInfo, error) {
+	req, err := http.NewRequest(
+		http.MethodGet,
+		slackUsersInfoURL+"?"+url.Values{
+			"user":           {userID},
+			"include_locale": {"true"},
+		}.Encode(),
+		nil,
+	)
+	if err != nil {
+		return userLocaleInfo{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return userLocaleInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		OK    bool           `json:"ok"`
+		Error string         `json:"error"`
+		User  userLocaleInfo `json:"user"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return userLocaleInfo{}, err
+	}
+	if !body.OK {
+		return userLocaleInfo{}, errors.New(body.Error)
+	}
+	return body.User, nil
+}
+
+// localeFor returns the slack locale of the user or the default locale when
+// it cannot be retrieved.
+func localeFor(token, userID string) string {
+	info, err := userLocale(token, userID)
+	if err != nil || info.Locale == "" {
+		return DefaultLocale()
+	}
+	return info.Locale
+}
+
+// formatTime formats the time using the layout of the locale. The time
+// should already be in the timezone of the reader.
+func formatTime(locale string, t time.Time) string {
+	return t.Format(tr(locale, "time.format"))
+}
+
+// slackDate formats the time with slack's date tokens so every reader sees it
+// in their own timezone. The fallback is formatted in UTC.
+func slackDate(locale string, t time.Time) string {
+	return slackDateIn(locale, time.UTC, t)
+}
+
+// slackDateIn formats the time like slackDate for a single reader, whose
+// timezone the fallback shown in notifications is formatted in.
+func slackDateIn(locale string, loc *time.Location, t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), formatTime(locale, t.In(loc)))
+}
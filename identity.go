@@ -0,0 +1,433 @@
+package jitsi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// KeyIdentityTeamID is the dynamo key for the team of an identity. This
+	// key is the partition key.
+	KeyIdentityTeamID = "team-id"
+	// KeyIdentityUserID is the dynamo key for the slack user of an
+	// identity. This key is the sort key.
+	KeyIdentityUserID = "user-id"
+
+	errMissingIdentity  = "missing_identity"
+	errIdentityMismatch = "identity_mismatch"
+	errInvalidIdentity  = "invalid_identity"
+
+	slackOIDCAuthorizeURL = "https://slack.com/openid/connect/authorize"
+	slackOIDCTokenURL     = "https://slack.com/api/openid.connect.token"
+	slackOIDCIssuer       = "https://slack.com"
+
+	// IdentitySourceLinked, IdentitySourceProfile and IdentitySourceAdmin
+	// record where the email of an identity came from: signing in with
+	// slack, the slack profile of the user or a workspace admin.
+	IdentitySourceLinked  = "linked"
+	IdentitySourceProfile = "profile"
+	IdentitySourceAdmin   = "admin"
+
+	// identityStateLifetime is how long a user has to complete signing in
+	// with slack after requesting it.
+	identityStateLifetime = 15 * time.Minute
+)
+
+// SlackIdentity maps a slack user to their identity on the conference
+// server. It is populated by the user signing in with slack, from their
+// slack profile or by a workspace admin.
+type SlackIdentity struct {
+	TeamID string `dynamodbav:"team-id"`
+	UserID string `dynamodbav:"user-id"`
+	// Subject is the subject of the user in the id tokens of slack, which
+	// stays the same for as long as the user exists. It is empty until the
+	// user signs in with slack.
+	Subject string `dynamodbav:"subject,omitempty"`
+	Email   string `dynamodbav:"email,omitempty"`
+	// EmailVerified is whether the email may be claimed, i.e. slack
+	// verified the user owns it or it was taken from the slack profile or
+	// set by an admin.
+	EmailVerified bool   `dynamodbav:"email-verified,omitempty"`
+	Source        string `dynamodbav:"source,omitempty"`
+	LinkedAt      int64  `dynamodbav:"linked-at,omitempty"`
+	// Username is optional and is the user name on the conference server,
+	// e.g. of an account on a self-hosted server.
+	Username string `dynamodbav:"username,omitempty"`
+	// Moderator grants the user moderator rights in every meeting of the
+	// team.
+	Moderator bool `dynamodbav:"moderator,omitempty"`
+}
+
+// IdentityReader provides an interface for reading the identities slack
+// users are mapped to.
+type IdentityReader interface {
+	Get(teamID, userID string) (*SlackIdentity, error)
+}
+
+// IdentityReadWriter provides an interface for reading, writing and removing
+// the identities slack users are mapped to.
+type IdentityReadWriter interface {
+	IdentityReader
+	Store(identity *SlackIdentity) error
+	Remove(teamID, userID string) error
+}
+
+// apply sets the identity claims of a meeting token for the user. The user
+// name takes precedence over the subject and only verified emails are
+// claimed.
+func (i *SlackIdentity) apply(in *JWTInput) {
+	switch {
+	case i.Username != "":
+		in.UserID = i.Username
+	case i.Subject != "":
+		in.UserID = i.Subject
+	}
+	if i.EmailVerified {
+		in.Email = i.Email
+	}
+	in.Moderator = in.Moderator || i.Moderator
+}
+
+// mapped returns whether an admin mapped the user to a conference identity
+// that outlives unlinking the slack identity.
+func (i *SlackIdentity) mapped() bool {
+	return i.Username != "" || i.Moderator || (i.Email != "" && i.Source != IdentitySourceLinked)
+}
+
+// lookupIdentity retrieves the identity of a user, providing an empty
+// identity when none is stored.
+func lookupIdentity(identities IdentityReader, teamID, userID string) (*SlackIdentity, error) {
+	identity, err := identities.Get(teamID, userID)
+	if err != nil {
+		if err.Error() == errMissingIdentity {
+			return &SlackIdentity{TeamID: teamID, UserID: userID}, nil
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+// unlinkIdentity removes the slack identity a user linked while keeping
+// what an admin mapped them to.
+func unlinkIdentity(identities IdentityReadWriter, teamID, userID string) error {
+	identity, err := lookupIdentity(identities, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if !identity.mapped() {
+		return identities.Remove(teamID, userID)
+	}
+	identity.Subject, identity.LinkedAt = "", 0
+	if identity.Source == IdentitySourceLinked {
+		identity.Email, identity.EmailVerified, identity.Source = "", false, ""
+	}
+	return identities.Store(identity)
+}
+
+var (
+	// usernameRE matches the user names of conference server accounts.
+	usernameRE = regexp.MustCompile(`^[\w.@+-]{1,64}$`)
+	// mailtoRE matches emails slack formatted as links, e.g.
+	// <mailto:alice@example.com|alice@example.com>
+	mailtoRE = regexp.MustCompile(`^<mailto:([^|>]+)(?:\|[^>]*)?>$`)
+)
+
+// setIdentity changes a setting of the identity a user is mapped to, e.g.
+// username alice or moderator on.
+func setIdentity(identity *SlackIdentity, setting, value string) error {
+	switch {
+	case setting == "username" && value == "default":
+		identity.Username = ""
+	case setting == "username" && usernameRE.MatchString(value):
+		identity.Username = value
+	case setting == "email" && value == "default":
+		identity.Email, identity.EmailVerified, identity.Source = "", false, ""
+	case setting == "email":
+		if m := mailtoRE.FindStringSubmatch(value); m != nil {
+			value = m[1]
+		}
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return errors.New(errInvalidIdentity)
+		}
+		identity.Email, identity.EmailVerified, identity.Source = value, true, IdentitySourceAdmin
+	case setting == "moderator" && (value == "on" || value == "off"):
+		identity.Moderator = value == "on"
+	default:
+		return errors.New(errInvalidIdentity)
+	}
+	return nil
+}
+
+// identitySummary describes the identity a user is mapped to.
+func identitySummary(locale string, i *SlackIdentity) string {
+	value := func(v string) string {
+		if v == "" {
+			return tr(locale, "identity.none")
+		}
+		return v
+	}
+	email := value(i.Email)
+	if i.Email != "" && i.Source != "" {
+		email += " (" + tr(locale, "identity.source."+i.Source) + ")"
+	}
+	moderator := tr(locale, "prefs.off")
+	if i.Moderator {
+		moderator = tr(locale, "prefs.on")
+	}
+	linked := tr(locale, "prefs.off")
+	if i.Subject != "" {
+		linked = tr(locale, "prefs.on")
+	}
+	return tr(locale, "identity.current", i.UserID, value(i.Username), email, moderator, linked)
+}
+
+// idTokenClaims are the claims of the id tokens slack issues when users sign
+// in with slack.
+type idTokenClaims struct {
+	jwt.StandardClaims
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Nonce         string `json:"nonce"`
+	TeamID        string `json:"https://slack.com/team_id"`
+	UserID        string `json:"https://slack.com/user_id"`
+}
+
+// SlackSignIn links the identities of users who sign in with slack, see
+// https://api.slack.com/authentication/sign-in-with-slack
+type SlackSignIn struct {
+	ClientID     string
+	ClientSecret *Secret
+	// RedirectURL is the url of Auth registered as a redirect url of the
+	// slack app.
+	RedirectURL string
+	// StateSecret is used to sign the oauth state so the callback can
+	// trust which slack user is signing in.
+	StateSecret string
+	Identities  IdentityReadWriter
+	// Gate is optional and denies linking identities of teams that may not
+	// use the service.
+	Gate *TeamGate
+}
+
+// AuthURL returns the url a slack user visits to link their identity.
+func (s *SlackSignIn) AuthURL(teamID, userID string) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	state := signState(s.StateSecret, url.Values{
+		"team":        {teamID},
+		"user":        {userID},
+		keyStateNonce: {nonce},
+	}, identityStateLifetime)
+	return slackOIDCAuthorizeURL + "?" + url.Values{
+		"response_type": {"code"},
+		"scope":         {"openid email"},
+		"client_id":     {s.ClientID},
+		"redirect_uri":  {s.RedirectURL},
+		"state":         {state},
+		"nonce":         {nonce},
+		"team":          {teamID},
+	}.Encode(), nil
+}
+
+// Auth completes signing in with slack and links the identity of the user.
+func (s *SlackSignIn) Auth(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	if params.Get("error") != "" {
+		hlog.FromRequest(r).Info().
+			Err(errors.New(params.Get("error"))).
+			Msg("sign in declined")
+		fmt.Fprint(w, "Your Slack identity was not linked.")
+		return
+	}
+
+	err := s.link(r.Context(), params.Get("state"), params.Get("code"))
+	if err != nil {
+		switch err.Error() {
+		case errInvalidState, errIdentityMismatch:
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("sign in state")
+			w.WriteHeader(http.StatusBadRequest)
+		case errTeamDenied:
+			hlog.FromRequest(r).Info().
+				Msg("denying team sign in")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "Your Slack identity was not linked. This workspace can't use the app.")
+		default:
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Msg("sign in")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	fmt.Fprint(w, "Your Slack identity is linked. You can close this window and return to Slack.")
+}
+
+// link exchanges an oauth code for an id token and stores the identity of
+// the slack user encoded in the state. The id token must be for that user.
+func (s *SlackSignIn) link(ctx context.Context, state, code string) error {
+	values, err := verifyState(s.StateSecret, state)
+	if err != nil {
+		return err
+	}
+	if s.Gate != nil && !s.Gate.Allowed(zerolog.Ctx(ctx), values.Get("team")) {
+		return errors.New(errTeamDenied)
+	}
+	claims, err := s.exchange(ctx, code)
+	if err != nil {
+		return err
+	}
+	err = claims.Valid()
+	if err != nil {
+		return err
+	}
+	if !claims.VerifyIssuer(slackOIDCIssuer, true) ||
+		!claims.VerifyAudience(s.ClientID, true) ||
+		claims.Nonce != values.Get(keyStateNonce) ||
+		claims.TeamID != values.Get("team") ||
+		claims.UserID != values.Get("user") {
+		return errors.New(errIdentityMismatch)
+	}
+	// what an admin mapped the user to is kept, but the verified email of
+	// the slack identity replaces other emails
+	identity, err := lookupIdentity(s.Identities, claims.TeamID, claims.UserID)
+	if err != nil {
+		return err
+	}
+	identity.Subject = claims.Subject
+	identity.LinkedAt = time.Now().Unix()
+	if claims.EmailVerified || identity.Email == "" {
+		identity.Email = claims.Email
+		identity.EmailVerified = claims.EmailVerified
+		identity.Source = IdentitySourceLinked
+	}
+	return s.Identities.Store(identity)
+}
+
+// exchange exchanges an oauth code for the claims of the id token of the
+// user. The id token is received from slack over tls rather than through
+// the browser, so its signature is not checked.
+func (s *SlackSignIn) exchange(ctx context.Context, code string) (*idTokenClaims, error) {
+	form := url.Values{
+		"client_id":     {s.ClientID},
+		"client_secret": {s.ClientSecret.Value()},
+		"code":          {code},
+		"redirect_uri":  {s.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slackOIDCTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		OK      bool   `json:"ok"`
+		Error   string `json:"error"`
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+	if !body.OK {
+		return nil, errors.New(body.Error)
+	}
+	var claims idTokenClaims
+	_, _, err = new(jwt.Parser).ParseUnverified(body.IDToken, &claims)
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// IdentityStore stores and retrieves the identities of slack users from aws
+// dynamodb.
+type IdentityStore struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+// Get retrieves the identity a user is mapped to.
+func (i *IdentityStore) Get(teamID, userID string) (*SlackIdentity, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyIdentityTeamID: teamID,
+		KeyIdentityUserID: userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := i.DB.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(i.TableName),
+		Key:       key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, errors.New(errMissingIdentity)
+	}
+
+	var identity SlackIdentity
+	err = attributevalue.UnmarshalMap(result.Item, &identity)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// Store will persist the identity a user is mapped to.
+func (i *IdentityStore) Store(identity *SlackIdentity) error {
+	av, err := attributevalue.MarshalMap(identity)
+	if err != nil {
+		return err
+	}
+	_, err = i.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(i.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// Remove will remove the identity a user is mapped to.
+func (i *IdentityStore) Remove(teamID, userID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyIdentityTeamID: teamID,
+		KeyIdentityUserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = i.DB.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(i.TableName),
+		Key:       key,
+	})
+	return err
+}
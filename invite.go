@@ -0,0 +1,134 @@
+package jitsi
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// InviteReadWriter provides an interface for reading and writing the state
+// of personal invites.
+type InviteReadWriter interface {
+	Store(*Invite) error
+	Get(meetingID, userID string) (*Invite, error)
+	SetJoined(meetingID, userID string) error
+	SetResponse(meetingID, userID, response string) error
+	ForMeeting(meetingID string) ([]*Invite, error)
+	Remove(meetingID, userID string) error
+}
+
+// InviteTracker tracks personal invites and sends a reminder to invitees
+// that have not joined the meeting once the reminder delay has passed.
+type InviteTracker struct {
+	Invites     InviteReadWriter
+	TokenReader TokenReader
+	Tasks       *DelayedTasks
+	// ReminderDelay is how long to wait before reminding an invitee. No
+	// reminders are sent when this is zero.
+	ReminderDelay time.Duration
+	// MessageConfig is optional and applies the team's branding to
+	// reminders.
+	MessageConfig MessageConfigReader
+	Log           zerolog.Logger
+}
+
+// Track records a sent invite and schedules its reminder.
+func (t *InviteTracker) Track(invite *Invite) error {
+	invite.CreatedAt = time.Now().Unix()
+	err := t.Invites.Store(invite)
+	if err != nil {
+		return err
+	}
+	if t.ReminderDelay > 0 {
+		meetingID, userID := invite.MeetingID, invite.UserID
+		t.Tasks.After(t.ReminderDelay, func() {
+			t.remind(meetingID, userID)
+		})
+	}
+	return nil
+}
+
+// Joined records that the user joined the meeting they were invited to.
+func (t *InviteTracker) Joined(meetingID, userID string) error {
+	return t.Invites.SetJoined(meetingID, userID)
+}
+
+// Respond records whether the user accepted or declined the invite and
+// provides the invites of the meeting to summarize the responses.
+func (t *InviteTracker) Respond(meetingID, userID, response string) ([]*Invite, error) {
+	err := t.Invites.SetResponse(meetingID, userID, response)
+	if err != nil {
+		return nil, err
+	}
+	return t.Invites.ForMeeting(meetingID)
+}
+
+// Retract updates the invites sent for a cancelled meeting and stops
+// tracking them. The number of retracted invites is returned.
+func (t *InviteTracker) Retract(token, meetingID string) (int, error) {
+	invites, err := t.Invites.ForMeeting(meetingID)
+	if err != nil {
+		return 0, err
+	}
+	retracted := 0
+	for _, invite := range invites {
+		err = retractInvite(token, invite)
+		if err != nil {
+			t.Log.Warn().
+				Err(err).
+				Str("meeting_id", meetingID).
+				Msg("retracting invite")
+			continue
+		}
+		err = t.Invites.Remove(meetingID, invite.UserID)
+		if err != nil {
+			return retracted, err
+		}
+		retracted++
+	}
+	return retracted, nil
+}
+
+func (t *InviteTracker) remind(meetingID, userID string) {
+	invite, err := t.Invites.Get(meetingID, userID)
+	if err != nil && err.Error() == errMissingInvite {
+		// the invite was retracted
+		return
+	}
+	if err != nil {
+		t.Log.Error().
+			Err(err).
+			Str("meeting_id", meetingID).
+			Msg("retrieving invite for reminder")
+		return
+	}
+	if invite.Joined || invite.Response == rsvpDeclined {
+		return
+	}
+
+	token, err := t.TokenReader.GetTokenForTeam(invite.TeamID)
+	if err != nil {
+		t.Log.Warn().
+			Err(err).
+			Str("team_id", invite.TeamID).
+			Msg("retrieving token for reminder")
+		return
+	}
+	cfg := MessageCfg{TeamID: invite.TeamID}
+	if t.MessageConfig != nil {
+		cfg, err = t.MessageConfig.Get(invite.TeamID)
+		if err != nil {
+			t.Log.Warn().
+				Err(err).
+				Str("team_id", invite.TeamID).
+				Msg("retrieving message config for reminder")
+		}
+	}
+	err = sendInviteReminder(token.AccessToken, invite, cfg.brandStyle())
+	if err != nil {
+		t.Log.Warn().
+			Err(err).
+			Str("meeting_id", meetingID).
+			Msg("sending invite reminder")
+	}
+}
@@ -0,0 +1,518 @@
+package jitsi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// DefaultInviteAttempts is how often an invite is attempted before it is
+	// dead lettered when no number of attempts is configured.
+	DefaultInviteAttempts = 5
+
+	// inviteRetryDelay is the delay before an invite is retried the first
+	// time. The delay doubles with every attempt up to maxInviteRetryDelay.
+	inviteRetryDelay    = 10 * time.Second
+	maxInviteRetryDelay = 15 * time.Minute
+	// inviteDepthInterval is how often the depth of the queue is measured.
+	inviteDepthInterval = 30 * time.Second
+	// inviteReceiveWait is how long a receive waits for invites, which is
+	// the longest wait sqs allows.
+	inviteReceiveWait = 20 * time.Second
+	// inviteReceiveBatch is the number of invites received at once, which is
+	// the most sqs allows.
+	inviteReceiveBatch = 10
+
+	// inviteSent, inviteRetried, inviteDeadLettered and inviteDropped label
+	// what became of a queued invite.
+	inviteSent         = "sent"
+	inviteRetried      = "retried"
+	inviteDeadLettered = "dead_lettered"
+	inviteDropped      = "dropped"
+
+	// inviteQueueMain and inviteQueueDeadLetter label the queue the depth is
+	// measured of.
+	inviteQueueMain       = "invites"
+	inviteQueueDeadLetter = "dead_letter"
+
+	errMalformedInvite = "malformed_invite"
+)
+
+// inviteQueueDepth is a gauge for the approximate number of invites waiting
+// in the queue and in the dead letter queue.
+var inviteQueueDepth = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "invite_queue_depth",
+		Help: "The approximate number of queued invites by queue.",
+	},
+	[]string{"queue"},
+)
+
+// inviteJobCounter is a counter for the attempts to send queued invites with
+// what became of the invite as label.
+var inviteJobCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "invite_queue_jobs_total",
+		Help: "A counter for queued invites by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(inviteQueueDepth, inviteJobCounter)
+}
+
+// InviteJob is a personal invite queued to be sent.
+type InviteJob struct {
+	// Invite is the prepared invite, which knows the team it is sent for and
+	// the direct message channel it is sent to.
+	Invite   *Invite `json:"invite"`
+	QueuedAt int64   `json:"queued_at"`
+}
+
+// QueuedInvite is an invite received from a queue.
+type QueuedInvite struct {
+	// Job is nil when the invite could not be decoded.
+	Job *InviteJob
+	// Attempt is how often the invite was received, counting this time.
+	Attempt int
+	// Receipt identifies the received invite to the queue.
+	Receipt string
+
+	body string
+}
+
+// InviteQueue provides an interface for queueing personal invites so that
+// they are sent even when the process restarts or the slack api fails.
+// Received invites stay queued until they are deleted and are received
+// again once their retry delay passed.
+type InviteQueue interface {
+	Send(job *InviteJob) error
+	// Receive waits for queued invites until the context is done.
+	Receive(ctx context.Context) ([]*QueuedInvite, error)
+	Delete(job *QueuedInvite) error
+	// Retry receives the invite again once the delay passed.
+	Retry(job *QueuedInvite, delay time.Duration) error
+	// DeadLetter moves an invite that cannot be sent out of the queue.
+	DeadLetter(job *QueuedInvite) error
+	// Depth returns the approximate number of invites in the queue and in
+	// the dead letter queue.
+	Depth() (int, int, error)
+}
+
+// sendOrQueueInvite sends the personal invite of the user, or queues it to
+// be sent by an InviteDispatcher when a queue is configured. No invite is
+// returned for queued invites, which are tracked once they were sent.
+func sendOrQueueInvite(queue InviteQueue, token, teamID, hostID, userID string, meeting *Meeting, style messageStyle) (*Invite, error) {
+	if queue == nil {
+		return sendPersonalizedInvite(token, hostID, userID, meeting, style)
+	}
+	invite, err := prepareInvite(token, hostID, userID, meeting)
+	if err != nil {
+		return nil, err
+	}
+	invite.TeamID = teamID
+	return nil, queue.Send(&InviteJob{
+		Invite:   invite,
+		QueuedAt: time.Now().Unix(),
+	})
+}
+
+// InviteDispatcher sends the invites of an invite queue. Invites that fail
+// to send are retried with a growing delay and dead lettered once they ran
+// out of attempts or cannot be sent at all, e.g. when the app was removed
+// from the team. Invites may be sent twice when the process exits right
+// after sending them.
+type InviteDispatcher struct {
+	Queue       InviteQueue
+	TokenReader TokenReader
+	// MessageConfig is optional and applies the team's templates and
+	// branding to invites.
+	MessageConfig MessageConfigReader
+	// InviteTracker is optional and tracks the invites once they were sent.
+	InviteTracker *InviteTracker
+	// Meetings is optional and drops the invites of meetings that ended,
+	// expired or were cancelled before they were sent.
+	Meetings MeetingReadWriter
+	// MaxAttempts is how often an invite is attempted before it is dead
+	// lettered. DefaultInviteAttempts is used when it is zero.
+	MaxAttempts int
+	// Workers is the number of invites sent concurrently. A single worker
+	// is used when it is zero.
+	Workers int
+	Log     zerolog.Logger
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+	stopped bool
+}
+
+// Start sends the queued invites until the dispatcher is stopped.
+func (d *InviteDispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil || d.stopped {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	workers := d.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	d.done.Add(workers + 1)
+	for n := 0; n < workers; n++ {
+		go d.work(ctx)
+	}
+	go d.measure(ctx)
+}
+
+// Stop stops receiving invites and waits for the received invites to be
+// sent.
+func (d *InviteDispatcher) Stop() {
+	d.mu.Lock()
+	cancel := d.cancel
+	d.cancel = nil
+	d.stopped = true
+	d.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		d.done.Wait()
+	}
+}
+
+func (d *InviteDispatcher) work(ctx context.Context) {
+	defer d.done.Done()
+	for ctx.Err() == nil {
+		jobs, err := d.Queue.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			d.Log.Warn().
+				Err(err).
+				Msg("receiving invites")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(inviteRetryDelay):
+			}
+			continue
+		}
+		for _, job := range jobs {
+			d.dispatch(job)
+		}
+	}
+}
+
+// measure updates the depth of the queue every interval.
+func (d *InviteDispatcher) measure(ctx context.Context) {
+	defer d.done.Done()
+	ticker := time.NewTicker(inviteDepthInterval)
+	defer ticker.Stop()
+	for {
+		queued, deadLettered, err := d.Queue.Depth()
+		if err != nil {
+			d.Log.Warn().
+				Err(err).
+				Msg("measuring invite queue depth")
+		} else {
+			inviteQueueDepth.WithLabelValues(inviteQueueMain).Set(float64(queued))
+			inviteQueueDepth.WithLabelValues(inviteQueueDeadLetter).Set(float64(deadLettered))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch sends a received invite and deletes, retries or dead letters it
+// depending on the outcome. Invites of meetings that are over are deleted
+// without sending them.
+func (d *InviteDispatcher) dispatch(job *QueuedInvite) {
+	var err error
+	live := true
+	if job.Job == nil || job.Job.Invite == nil {
+		err = errors.New(errMalformedInvite)
+	} else {
+		live, err = d.live(job.Job.Invite)
+		if err == nil && live {
+			err = d.send(job.Job.Invite)
+		}
+	}
+	if err == nil && !live {
+		inviteJobCounter.WithLabelValues(inviteDropped).Inc()
+		d.logJob(d.Log.Info(), job).
+			Msg("dropping invite of meeting that is over")
+		err = d.Queue.Delete(job)
+		if err != nil {
+			d.Log.Warn().
+				Err(err).
+				Msg("deleting dropped invite")
+		}
+		return
+	}
+	if err == nil {
+		inviteJobCounter.WithLabelValues(inviteSent).Inc()
+		d.track(job.Job.Invite)
+		err = d.Queue.Delete(job)
+		if err != nil {
+			d.Log.Warn().
+				Err(err).
+				Msg("deleting sent invite")
+		}
+		return
+	}
+
+	maxAttempts := d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultInviteAttempts
+	}
+	if !retryableInvite(err) || job.Attempt >= maxAttempts {
+		inviteJobCounter.WithLabelValues(inviteDeadLettered).Inc()
+		d.logJob(d.Log.Error(), job).
+			Err(err).
+			Msg("dead lettering invite")
+		err = d.Queue.DeadLetter(job)
+		if err != nil {
+			d.Log.Error().
+				Err(err).
+				Msg("dead lettering invite")
+		}
+		return
+	}
+
+	inviteJobCounter.WithLabelValues(inviteRetried).Inc()
+	delay := inviteRetryAfter(err, job.Attempt)
+	d.logJob(d.Log.Warn(), job).
+		Err(err).
+		Dur("retry", delay).
+		Msg("retrying invite")
+	err = d.Queue.Retry(job, delay)
+	if err != nil {
+		d.Log.Warn().
+			Err(err).
+			Msg("retrying invite")
+	}
+}
+
+// logJob adds the invite of the job to a log event.
+func (d *InviteDispatcher) logJob(event *zerolog.Event, job *QueuedInvite) *zerolog.Event {
+	event = event.Int("attempt", job.Attempt)
+	if job.Job != nil && job.Job.Invite != nil {
+		event = event.
+			Str("team_id", job.Job.Invite.TeamID).
+			Str("meeting_id", job.Job.Invite.MeetingID)
+	}
+	return event
+}
+
+// live returns whether the meeting of the invite may still be joined. Invites
+// of meetings that are not tracked, e.g. because tracking them failed, are
+// sent.
+func (d *InviteDispatcher) live(invite *Invite) (bool, error) {
+	if d.Meetings == nil {
+		return true, nil
+	}
+	meeting, err := d.Meetings.Get(invite.TeamID, invite.MeetingID)
+	if err != nil && err.Error() == errMissingMeeting {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return meeting.live(), nil
+}
+
+// send posts the invite with the team's message configuration.
+func (d *InviteDispatcher) send(invite *Invite) error {
+	token, err := d.TokenReader.GetTokenForTeam(invite.TeamID)
+	if err != nil {
+		return err
+	}
+	cfg := MessageCfg{TeamID: invite.TeamID}
+	if d.MessageConfig != nil {
+		cfg, err = d.MessageConfig.Get(invite.TeamID)
+		if err != nil {
+			d.Log.Warn().
+				Err(err).
+				Str("team_id", invite.TeamID).
+				Msg("retrieving message config for invite")
+			cfg = MessageCfg{TeamID: invite.TeamID}
+		}
+	}
+	return postInvite(token.AccessToken, invite, cfg.inviteStyle())
+}
+
+// track records a sent invite when invites are tracked.
+func (d *InviteDispatcher) track(invite *Invite) {
+	if d.InviteTracker == nil {
+		return
+	}
+	err := d.InviteTracker.Track(invite)
+	if err != nil {
+		d.Log.Warn().
+			Err(err).
+			Str("meeting_id", invite.MeetingID).
+			Msg("tracking invite")
+	}
+}
+
+// retryableInvite returns whether sending the invite may succeed when it is
+// retried. Invites of teams that removed the app, and to users that cannot
+// be messaged, never do.
+func retryableInvite(err error) bool {
+	switch err.Error() {
+	case errInvalidAuth, errInactiveAccount, errMissingAuthToken, errCannotDMBot, errMalformedInvite:
+		return false
+	}
+	return true
+}
+
+// inviteRetryAfter returns how long to wait before retrying an invite. Rate
+// limited invites are retried once slack allows it.
+func inviteRetryAfter(err error, attempt int) time.Duration {
+	var limited *slack.RateLimitedError
+	if errors.As(err, &limited) && limited.RetryAfter > 0 {
+		return limited.RetryAfter
+	}
+	delay := inviteRetryDelay
+	for n := 1; n < attempt && delay < maxInviteRetryDelay; n++ {
+		delay *= 2
+	}
+	if delay > maxInviteRetryDelay {
+		delay = maxInviteRetryDelay
+	}
+	return delay
+}
+
+// SQSInviteQueue queues invites in aws sqs. The visibility timeout of the
+// queue should leave enough time to send a batch of invites.
+type SQSInviteQueue struct {
+	Client   *sqs.Client
+	QueueURL string
+	// DeadLetterURL is optional and is the queue invites that cannot be sent
+	// are moved to. They are dropped when it is empty.
+	DeadLetterURL string
+}
+
+// Send queues the invite.
+func (s *SQSInviteQueue) Send(job *InviteJob) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.SendMessage(context.TODO(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String(s.QueueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// Receive waits for queued invites using long polling.
+func (s *SQSInviteQueue) Receive(ctx context.Context) ([]*QueuedInvite, error) {
+	resp, err := s.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(s.QueueURL),
+		MaxNumberOfMessages: inviteReceiveBatch,
+		WaitTimeSeconds:     int32(inviteReceiveWait.Seconds()),
+		AttributeNames:      []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*QueuedInvite, 0, len(resp.Messages))
+	for _, msg := range resp.Messages {
+		job := &QueuedInvite{
+			Receipt: aws.ToString(msg.ReceiptHandle),
+			body:    aws.ToString(msg.Body),
+		}
+		job.Attempt, _ = strconv.Atoi(msg.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		var decoded InviteJob
+		if json.Unmarshal([]byte(job.body), &decoded) == nil {
+			job.Job = &decoded
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Delete removes the invite from the queue.
+func (s *SQSInviteQueue) Delete(job *QueuedInvite) error {
+	_, err := s.Client.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(s.QueueURL),
+		ReceiptHandle: aws.String(job.Receipt),
+	})
+	return err
+}
+
+// Retry changes the visibility timeout of the invite to the delay. Sqs
+// delays messages for up to 12 hours.
+func (s *SQSInviteQueue) Retry(job *QueuedInvite, delay time.Duration) error {
+	_, err := s.Client.ChangeMessageVisibility(context.TODO(), &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(s.QueueURL),
+		ReceiptHandle:     aws.String(job.Receipt),
+		VisibilityTimeout: int32(delay.Seconds()),
+	})
+	return err
+}
+
+// DeadLetter moves the invite to the dead letter queue as it was received
+// and deletes it from the queue.
+func (s *SQSInviteQueue) DeadLetter(job *QueuedInvite) error {
+	if s.DeadLetterURL != "" {
+		_, err := s.Client.SendMessage(context.TODO(), &sqs.SendMessageInput{
+			QueueUrl:    aws.String(s.DeadLetterURL),
+			MessageBody: aws.String(job.body),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.Delete(job)
+}
+
+// Depth returns the approximate number of invites in the queue, counting
+// invites that wait for a retry, and in the dead letter queue.
+func (s *SQSInviteQueue) Depth() (int, int, error) {
+	queued, err := s.count(s.QueueURL,
+		types.QueueAttributeNameApproximateNumberOfMessages,
+		types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+		types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+	)
+	if err != nil || s.DeadLetterURL == "" {
+		return queued, 0, err
+	}
+	deadLettered, err := s.count(s.DeadLetterURL, types.QueueAttributeNameApproximateNumberOfMessages)
+	return queued, deadLettered, err
+}
+
+// count sums the counts of messages of the queue.
+func (s *SQSInviteQueue) count(queueURL string, names ...types.QueueAttributeName) (int, error) {
+	resp, err := s.Client.GetQueueAttributes(context.TODO(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: names,
+	})
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, name := range names {
+		n, _ := strconv.Atoi(resp.Attributes[string(name)])
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,203 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// KeyInviteMeetingID is the dynamo key for the meeting an invite
+	// belongs to. This key is the partition key.
+	KeyInviteMeetingID = "meeting-id"
+	// KeyInviteUserID is the dynamo key for the invited user. This key is
+	// the sort key.
+	KeyInviteUserID = "user-id"
+	// KeyInviteJoined is the dynamo key for whether the invitee joined.
+	KeyInviteJoined = "joined"
+	// KeyInviteResponse is the dynamo key for the invitee's response.
+	KeyInviteResponse = "response"
+	// KeyInvitePurgeAt is the dynamo key for when an invite is purged. It is
+	// the ttl attribute of the table.
+	KeyInvitePurgeAt = "purge-at"
+
+	errMissingInvite = "missing_invite"
+)
+
+// Invite is the state of a personal invite sent to a user for a meeting.
+type Invite struct {
+	MeetingID string  `dynamodbav:"meeting-id"`
+	UserID    string  `dynamodbav:"user-id"`
+	TeamID    string  `dynamodbav:"team-id"`
+	HostID    string  `dynamodbav:"host-id"`
+	Host      string  `dynamodbav:"host"`
+	URL       string  `dynamodbav:"url"`
+	RoomName  string  `dynamodbav:"room,omitempty"`
+	DialIn    *DialIn `dynamodbav:"dial-in,omitempty"`
+	Passcode  string  `dynamodbav:"passcode,omitempty"`
+	// E2EE notes in the invite that the meeting is end-to-end encrypted.
+	E2EE bool `dynamodbav:"e2ee,omitempty"`
+	// Channel and Timestamp identify the direct message of the invite.
+	Channel   string `dynamodbav:"channel"`
+	Timestamp string `dynamodbav:"message-ts"`
+	// Locale is the slack locale of the invitee used for reminders.
+	Locale string `dynamodbav:"locale,omitempty"`
+	// TZ is the slack timezone of the invitee, which times in their invites
+	// are shown in.
+	TZ     string `dynamodbav:"tz,omitempty"`
+	Joined bool   `dynamodbav:"joined"`
+	// Response is whether the invitee accepted or declined the invite. It
+	// is empty when the invite was sent without the rsvp buttons.
+	Response  string `dynamodbav:"response,omitempty"`
+	CreatedAt int64  `dynamodbav:"created-at"`
+	// PurgeAt is the ttl attribute the invite is purged by. It is zero when
+	// invites are kept.
+	PurgeAt int64 `dynamodbav:"purge-at,omitempty"`
+}
+
+// InviteStore stores and retrieves invite state from aws dynamodb.
+type InviteStore struct {
+	TableName string
+	// Retention is optional and purges invites that long after they were
+	// sent.
+	Retention time.Duration
+	DB        *dynamodb.Client
+}
+
+// Store will persist the invite.
+func (i *InviteStore) Store(invite *Invite) error {
+	if i.Retention > 0 {
+		invite.PurgeAt = purgeAt(invite.CreatedAt, i.Retention, 0)
+	}
+	av, err := attributevalue.MarshalMap(invite)
+	if err != nil {
+		return err
+	}
+	_, err = i.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(i.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// Get retrieves the invite sent to a user for a meeting.
+func (i *InviteStore) Get(meetingID, userID string) (*Invite, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyInviteMeetingID: meetingID,
+		KeyInviteUserID:    userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := i.DB.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(i.TableName),
+		Key:       key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, errors.New(errMissingInvite)
+	}
+
+	var invite Invite
+	err = attributevalue.UnmarshalMap(result.Item, &invite)
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// SetJoined records that the invitee joined the meeting.
+func (i *InviteStore) SetJoined(meetingID, userID string) error {
+	return i.update(meetingID, userID, expression.Set(expression.Name(KeyInviteJoined), expression.Value(true)))
+}
+
+// SetResponse records whether the invitee accepted or declined the invite.
+func (i *InviteStore) SetResponse(meetingID, userID, response string) error {
+	return i.update(meetingID, userID, expression.Set(expression.Name(KeyInviteResponse), expression.Value(response)))
+}
+
+// update applies the update to an existing invite.
+func (i *InviteStore) update(meetingID, userID string, update expression.UpdateBuilder) error {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyInviteMeetingID: meetingID,
+		KeyInviteUserID:    userID,
+	})
+	if err != nil {
+		return err
+	}
+	cond := expression.AttributeExists(expression.Name(KeyInviteMeetingID))
+	expr, err := expression.NewBuilder().
+		WithUpdate(update).
+		WithCondition(cond).
+		Build()
+	if err != nil {
+		return err
+	}
+	_, err = i.DB.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(i.TableName),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	return err
+}
+
+// ForMeeting retrieves the invites sent for a meeting.
+func (i *InviteStore) ForMeeting(meetingID string) ([]*Invite, error) {
+	keyCond := expression.Key(KeyInviteMeetingID).Equal(expression.Value(meetingID))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var invites []*Invite
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := i.DB.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:                 aws.String(i.TableName),
+			KeyConditionExpression:    expr.KeyCondition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var page []*Invite
+		err = attributevalue.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return invites, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// Remove deletes the invite sent to a user for a meeting.
+func (i *InviteStore) Remove(meetingID, userID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyInviteMeetingID: meetingID,
+		KeyInviteUserID:    userID,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = i.DB.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(i.TableName),
+		Key:       key,
+	})
+	return err
+}
@@ -0,0 +1,93 @@
+package jitsi
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// PageInstallSuccess, PageInstallDeclined and PageInstallFailed are the
+	// names of the pages installers land on after the slack oauth exchange.
+	PageInstallSuccess  = "install_success.html"
+	PageInstallDeclined = "install_declined.html"
+	PageInstallFailed   = "install_failed.html"
+)
+
+// builtinPages are the landing pages shipped with the service. Each page is
+// executed with an installPage.
+//
+//go:embed pages/*.html
+var builtinPages embed.FS
+
+var landingPages = newPages()
+
+// pages holds the parsed landing page templates by file name.
+type pages struct {
+	mu   sync.RWMutex
+	tmpl *template.Template
+}
+
+func newPages() *pages {
+	return &pages{tmpl: template.Must(template.ParseFS(builtinPages, "pages/*.html"))}
+}
+
+// installPage is the data landing pages are executed with.
+type installPage struct {
+	// SlackURL opens slack, in the channel the install started from when it
+	// is known.
+	SlackURL string
+	// RetryURL starts the install again. It is empty when installs do not
+	// start at SlackOAuthHandlers.Install.
+	RetryURL string
+}
+
+// LoadPages overrides the landing pages with the html templates of the same
+// name in the directory, e.g. install_success.html. Pages missing from the
+// directory keep the builtin template.
+func LoadPages(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	landingPages.mu.Lock()
+	defer landingPages.mu.Unlock()
+	tmpl, err := landingPages.tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	tmpl, err = tmpl.ParseFiles(files...)
+	if err != nil {
+		return err
+	}
+	landingPages.tmpl = tmpl
+	return nil
+}
+
+// renderPage writes the landing page with the status code. The page is
+// rendered before anything is written so that a broken template results in
+// an empty internal server error.
+func renderPage(w http.ResponseWriter, r *http.Request, status int, name string, data *installPage) {
+	landingPages.mu.RLock()
+	tmpl := landingPages.tmpl
+	landingPages.mu.RUnlock()
+
+	var buf bytes.Buffer
+	err := tmpl.ExecuteTemplate(&buf, name, data)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("page", name).
+			Msg("rendering page")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
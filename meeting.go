@@ -1,10 +1,18 @@
 package jitsi
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/rs/xid"
 )
 
+// meetingLookback is how far back the meetings of a team are searched when
+// a command refers to an earlier meeting.
+const meetingLookback = 24 * time.Hour
+
 // MeetingTokenGenerator provides an interface for creating video conference
 // authenticated access via JWT.
 type MeetingTokenGenerator interface {
@@ -17,58 +25,267 @@ type ServerConfigReader interface {
 	Get(string) (ServerCfg, error)
 }
 
+// MeetingReadWriter provides an interface for reading and writing the state
+// of meetings.
+type MeetingReadWriter interface {
+	Store(*MeetingRecord) error
+	Get(teamID, meetingID string) (*MeetingRecord, error)
+	Recent(teamID string, since time.Time) ([]*MeetingRecord, error)
+	SetStatus(teamID, meetingID, status string) error
+	ForRoom(roomName string) (*MeetingRecord, error)
+	AddParticipant(teamID, meetingID, connectionID string, p Participant) (*MeetingRecord, error)
+	RemoveParticipant(teamID, meetingID, connectionID string) (*MeetingRecord, error)
+	SetHostMessage(teamID, meetingID, msg string) error
+}
+
+// latestMeeting finds the most recent meeting of the team that matches.
+func latestMeeting(meetings MeetingReadWriter, teamID string, match func(*MeetingRecord) bool) (*MeetingRecord, error) {
+	recent, err := meetings.Recent(teamID, time.Now().Add(-meetingLookback))
+	if err != nil {
+		return nil, err
+	}
+	for _, meeting := range recent {
+		if match(meeting) {
+			return meeting, nil
+		}
+	}
+	return nil, errors.New(errMissingMeeting)
+}
+
 // MeetingGenerator provides an interface for generating meetings configured
 // correctly for the slack team.
 type MeetingGenerator struct {
 	ServerConfigReader    ServerConfigReader
 	MeetingTokenGenerator MeetingTokenGenerator
+	// DialIn is optional and adds dial-in information to meetings.
+	DialIn DialInProvider
+	// UserPrefs is optional and applies the preferences of users to the
+	// meetings they start and join.
+	UserPrefs UserPrefsReader
+	// Identities is optional and claims the identities users linked in
+	// their meeting tokens.
+	Identities IdentityReader
+	// MeetingTTL is optional and limits how long the links of a meeting are
+	// valid after it was created.
+	MeetingTTL time.Duration
 }
 
 // Meeting contains the server specific info for a meeting.
 type Meeting struct {
+	// ID uniquely identifies the meeting and sorts by creation time.
+	ID               string
 	RoomName         string
 	URL              string
 	Host             string
 	AuthenticatedURL func(UserID, UserName, AvatarURL string) (string, error)
+	// DialIn is nil when the meeting cannot be joined by phone.
+	DialIn *DialIn
+	// Passcode is set when the room is protected with a passcode.
+	Passcode string
+	// RSVP offers invitees to accept or decline their personal invite.
+	RSVP bool
+	// Expires is when the links of the meeting stop being valid. It is zero
+	// when meetings do not expire.
+	Expires time.Time
+
+	// prefs retrieves the preferences of a user. It is nil when user
+	// preferences are disabled.
+	prefs func(userID string) UserPrefs
+	// config are the conference config overrides of the team.
+	config []string
+	// options are shared by the copies of the meeting so the links reflect
+	// options set after the meeting was generated.
+	options *MeetingOptions
+}
+
+// e2ee returns whether the meeting is end-to-end encrypted.
+func (m *Meeting) e2ee() bool {
+	return m.options != nil && m.options.E2EE
+}
+
+// setOptions applies the options of the host to the links of the meeting.
+func (m *Meeting) setOptions(opts MeetingOptions) {
+	if m.options == nil {
+		m.options = &MeetingOptions{}
+	}
+	*m.options = opts
+	config := append(append([]string{}, m.config...), opts.config()...)
+	m.URL = strings.SplitN(m.URL, "#", 2)[0] + urlFragment(config)
+}
+
+// userLocale returns the locale messages about the meeting are shown to the
+// user in, preferring the language the user chose over their slack locale,
+// and the timezone of the user.
+func (m *Meeting) userLocale(token, userID string) userLocaleInfo {
+	info, err := userLocale(token, userID)
+	if err != nil || info.Locale == "" {
+		info.Locale = DefaultLocale()
+	}
+	if m.prefs != nil {
+		if prefs := m.prefs(userID); prefs.Locale != "" {
+			info.Locale = prefs.Locale
+		}
+	}
+	return info
 }
 
 // New generates a new meeting for the provided team. Each team may either be
-// using the default service, meet.jit.si, or their own installation.
-func (m *MeetingGenerator) New(teamID, teamName string) (Meeting, error) {
-	var mtg Meeting
-	mtg.RoomName = RandomName()
+// using the default service, meet.jit.si, or their own installation. The
+// room is named as configured for the team, using the name of the channel
+// the meeting is started from when rooms are named after channels.
+func (m *MeetingGenerator) New(teamID, teamName, hostID, channelName string) (Meeting, error) {
+	srv, err := m.hostServer(teamID, hostID)
+	if err != nil {
+		return Meeting{}, err
+	}
+	roomName := filteredRoomName(roomNamerFor(srv.RoomNaming), RoomNameInput{
+		TeamName:    teamName,
+		ChannelName: channelName,
+		Time:        time.Now(),
+		Words:       srv.Words,
+	})
+	if srv.TeamRoomPrefix && !srv.TenantScopedURLs {
+		roomName = teamRoomPrefix(teamID) + "-" + roomName
+	}
+	return m.forServer(srv, xid.New().String(), teamID, teamName, roomName), nil
+}
 
+// Named generates a new meeting for the team in a room chosen by a user.
+// Rooms on servers without tenant scoped urls get a random suffix since the
+// name may already be used by another team.
+func (m *MeetingGenerator) Named(teamID, teamName, hostID, name string) (Meeting, error) {
+	roomName, err := sanitizeRoomName(name)
+	if err != nil {
+		return Meeting{}, err
+	}
+	srv, err := m.hostServer(teamID, hostID)
+	if err != nil {
+		return Meeting{}, err
+	}
+	if !srv.TenantScopedURLs {
+		roomName = uniqueRoomName(roomName)
+	}
+	return m.forServer(srv, xid.New().String(), teamID, teamName, roomName), nil
+}
+
+// ForRoom recreates the meeting with the provided id and room for the team,
+// e.g. to give another user an authenticated url for an existing meeting.
+func (m *MeetingGenerator) ForRoom(meetingID, teamID, teamName, roomName string) (Meeting, error) {
 	srv, err := m.ServerConfigReader.Get(teamID)
 	if err != nil {
 		return Meeting{}, err
 	}
+	return m.forServer(srv, meetingID, teamID, teamName, roomName), nil
+}
+
+// hostServer retrieves the server configuration of the team for a meeting
+// started by the host. Meetings are hosted on the server the host prefers,
+// which is not expected to support tenant scoped or authenticated urls.
+func (m *MeetingGenerator) hostServer(teamID, hostID string) (ServerCfg, error) {
+	srv, err := m.ServerConfigReader.Get(teamID)
+	if err != nil || m.UserPrefs == nil {
+		return srv, err
+	}
+	prefs, err := m.UserPrefs.Get(teamID, hostID)
+	if err != nil {
+		// the team's server is used when preferences are unavailable
+		return srv, nil
+	}
+	if prefs.Server != "" && prefs.Server != srv.Server {
+		srv.Server = prefs.Server
+		srv.TenantScopedURLs = false
+		srv.AuthenticatedURLSupport = false
+	}
+	return srv, nil
+}
+
+func (m *MeetingGenerator) forServer(srv ServerCfg, meetingID, teamID, teamName, roomName string) Meeting {
+	var mtg Meeting
+	opts := &MeetingOptions{}
+	mtg.options = opts
+	mtg.ID = meetingID
+	mtg.RoomName = roomName
 	mtg.Host = srv.Server
+	if m.MeetingTTL > 0 {
+		created := time.Now()
+		if id, err := xid.FromString(meetingID); err == nil {
+			created = id.Time()
+		}
+		mtg.Expires = created.Add(m.MeetingTTL)
+	}
+	if m.DialIn != nil {
+		// the meeting is usable without dial-in so failures are dropped
+		mtg.DialIn, _ = m.DialIn.DialIn(srv.Server, mtg.RoomName)
+	}
 
+	var roomURL string
 	if srv.TenantScopedURLs {
-		mtg.URL = fmt.Sprintf("%s/%s/%s", srv.Server, strings.ToLower(teamName), mtg.RoomName)
+		roomURL = fmt.Sprintf("%s/%s/%s", srv.Server, strings.ToLower(teamName), mtg.RoomName)
 	} else {
-		mtg.URL = fmt.Sprintf("%s/%s", srv.Server, mtg.RoomName)
+		roomURL = fmt.Sprintf("%s/%s", srv.Server, mtg.RoomName)
 	}
+	mtg.config = srv.URLConfig
+	mtg.URL = roomURL + urlFragment(srv.URLConfig)
 
 	if srv.AuthenticatedURLSupport {
 		mtg.AuthenticatedURL = func(userID, userName, avatarURL string) (string, error) {
-			jwt, err := m.MeetingTokenGenerator.CreateJWT(JWTInput{
+			in := JWTInput{
 				TenantID:   teamID,
 				TenantName: teamName,
 				RoomClaim:  mtg.RoomName,
 				UserID:     userID,
 				UserName:   userName,
 				AvatarURL:  avatarURL,
-			})
+				Lifetime:   srv.JWTLifetime,
+				Expires:    mtg.Expires,
+				Moderator:  opts.moderator(userID),
+				Features:   opts.features(userID),
+			}
+			if m.Identities != nil {
+				// users who have not linked their identity get a token
+				// for their slack user id
+				if identity, err := m.Identities.Get(teamID, userID); err == nil {
+					identity.apply(&in)
+				}
+			}
+			jwt, err := m.MeetingTokenGenerator.CreateJWT(in)
 			if err != nil {
 				return "", err
 			}
-			return fmt.Sprintf("%s?jwt=%s", mtg.URL, jwt), nil
+			return fmt.Sprintf("%s?jwt=%s", roomURL, jwt), nil
 		}
 	} else {
 		mtg.AuthenticatedURL = func(userID, userName, avatarURL string) (string, error) {
-			return mtg.URL, nil
+			return roomURL, nil
+		}
+	}
+
+	if m.UserPrefs != nil {
+		mtg.prefs = func(userID string) UserPrefs {
+			prefs, err := m.UserPrefs.Get(teamID, userID)
+			if err != nil {
+				// the meeting is usable without preferences
+				return UserPrefs{}
+			}
+			return prefs
+		}
+	}
+	// the config overrides of the team are followed by the options of the
+	// meeting and the preferences of the user joining it, which take
+	// precedence
+	authenticatedURL := mtg.AuthenticatedURL
+	prefs := mtg.prefs
+	mtg.AuthenticatedURL = func(userID, userName, avatarURL string) (string, error) {
+		meetingURL, err := authenticatedURL(userID, userName, avatarURL)
+		if err != nil {
+			return "", err
+		}
+		config := append(append([]string{}, srv.URLConfig...), opts.config()...)
+		if prefs != nil {
+			userPrefs := prefs(userID)
+			config = append(config, userPrefs.config()...)
 		}
+		return meetingURL + urlFragment(config), nil
 	}
-	return mtg, nil
+	return mtg
 }
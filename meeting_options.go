@@ -0,0 +1,132 @@
+package jitsi
+
+import (
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// The flags hosts shape the room of a meeting with, e.g. /jitsi --muted
+const (
+	flagMuted      = "muted"
+	flagNoVideo    = "no-video"
+	flagLobby      = "lobby"
+	flagE2EE       = "e2ee"
+	flagRecord     = "record"
+	flagTranscribe = "transcribe"
+)
+
+// MeetingOptions shape the room of a meeting for everyone joining through
+// the links of the app.
+type MeetingOptions struct {
+	// StartMuted joins participants with their microphone muted.
+	StartMuted bool
+	// StartWithoutVideo joins participants with their camera off.
+	StartWithoutVideo bool
+	// Lobby makes the host a moderator through their meeting token so they
+	// can enable the lobby and admit guests, who knock once it is enabled.
+	Lobby bool
+	// E2EE turns on end-to-end encryption for participants whose client
+	// supports it.
+	E2EE bool
+	// Record enables the recording of the meeting for the host, who is made
+	// a moderator to start it.
+	Record bool
+	// Transcribe enables the transcription of the meeting for the host, who
+	// is made a moderator to start it.
+	Transcribe bool
+	// Stream enables live streaming the meeting for the host, who is made a
+	// moderator to start it. It is only set by the stream subcommand, which
+	// passes the stream key to the conference server.
+	Stream bool
+	// HostID is the user that started the meeting.
+	HostID string
+}
+
+// meetingOptions reads the options of a meeting from the flags of the
+// command starting it and the flags the host prefers.
+func meetingOptions(cmd *Command, hostID string, preferred []string) MeetingOptions {
+	flag := func(name string) bool {
+		return cmd.Flag(name) || containsString(preferred, name)
+	}
+	return MeetingOptions{
+		StartMuted:        flag(flagMuted),
+		StartWithoutVideo: flag(flagNoVideo),
+		Lobby:             flag(flagLobby),
+		E2EE:              flag(flagE2EE),
+		Record:            flag(flagRecord),
+		Transcribe:        flag(flagTranscribe),
+		HostID:            hostID,
+	}
+}
+
+// config returns the conference config overrides of the options.
+func (o *MeetingOptions) config() []string {
+	var config []string
+	if o.StartMuted {
+		config = append(config, "config.startWithAudioMuted=true")
+	}
+	if o.StartWithoutVideo {
+		config = append(config, "config.startWithVideoMuted=true")
+	}
+	if o.Lobby {
+		config = append(config, "config.lobby.autoKnock=true")
+	}
+	if o.E2EE {
+		config = append(config, "config.e2ee.enabled=true")
+	}
+	if o.Record {
+		config = append(config, "config.recordingService.enabled=true")
+	}
+	if o.Transcribe {
+		config = append(config, "config.transcription.enabled=true")
+	}
+	if o.Stream {
+		config = append(config, "config.liveStreaming.enabled=true")
+	}
+	return config
+}
+
+// e2eeBlock creates the block noting that a meeting is end-to-end encrypted.
+func e2eeBlock(locale string) slack.Block {
+	return slack.NewContextBlock("", slack.NewTextBlockObject(
+		slack.MarkdownType,
+		tr(locale, "e2ee.text"),
+		false,
+		false,
+	))
+}
+
+// moderator returns whether the user moderates the meeting.
+func (o *MeetingOptions) moderator(userID string) bool {
+	return (o.Lobby || o.Record || o.Transcribe || o.Stream) && o.host(userID)
+}
+
+// features returns the meeting token features enabled for the user.
+func (o *MeetingOptions) features(userID string) []string {
+	var features []string
+	if o.Record && o.host(userID) {
+		features = append(features, featureRecording)
+	}
+	if o.Transcribe && o.host(userID) {
+		features = append(features, featureTranscription)
+	}
+	if o.Stream && o.host(userID) {
+		features = append(features, featureLivestreaming)
+	}
+	return features
+}
+
+// host returns whether the user started the meeting.
+func (o *MeetingOptions) host(userID string) bool {
+	return userID != "" && userID == o.HostID
+}
+
+// urlFragment returns the url fragment applying conference config overrides,
+// e.g. #config.startWithAudioMuted=true
+func urlFragment(config []string) string {
+	if len(config) == 0 {
+		return ""
+	}
+	return "#" + strings.Join(config, "&")
+}
@@ -0,0 +1,334 @@
+package jitsi
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/xid"
+)
+
+const (
+	// KeyMeetingTeamID is the dynamo key for the team a meeting belongs to.
+	// This key is the partition key.
+	KeyMeetingTeamID = "team-id"
+	// KeyMeetingID is the dynamo key for the meeting id. This key is the
+	// sort key and sorts meetings by creation time.
+	KeyMeetingID = "meeting-id"
+	// KeyMeetingStatus is the dynamo key for the status of a meeting.
+	KeyMeetingStatus = "status"
+	// KeyMeetingRoomKey is the dynamo key for the lower case room name of a
+	// meeting. This key is the partition key of the room index.
+	KeyMeetingRoomKey = "room-key"
+	// KeyMeetingParticipants is the dynamo key for the participants that are
+	// in a meeting.
+	KeyMeetingParticipants = "participants"
+	// KeyMeetingAttendees is the dynamo key for everyone that was in a
+	// meeting.
+	KeyMeetingAttendees = "attendees"
+	// KeyMeetingHostMessage is the dynamo key for the host's confirmation of
+	// the invites sent for a meeting.
+	KeyMeetingHostMessage = "host-message"
+	// KeyMeetingPurgeAt is the dynamo key for when a meeting is purged. It
+	// is the ttl attribute of the table.
+	KeyMeetingPurgeAt = "purge-at"
+
+	// MeetingStarted is the status of a meeting that was created and that
+	// nobody is in.
+	MeetingStarted = "started"
+	// MeetingActive is the status of a meeting that participants are in.
+	MeetingActive = "active"
+	// MeetingCancelled is the status of a meeting the host called off.
+	MeetingCancelled = "cancelled"
+	// MeetingEnded is the status of a meeting that was ended.
+	MeetingEnded = "ended"
+	// MeetingExpired is the status of a meeting whose links stopped being
+	// valid.
+	MeetingExpired = "expired"
+
+	errMissingMeeting = "missing_meeting"
+)
+
+// MeetingRecord is the state of a meeting created from slack.
+type MeetingRecord struct {
+	TeamID    string `dynamodbav:"team-id"`
+	MeetingID string `dynamodbav:"meeting-id"`
+	HostID    string `dynamodbav:"host-id"`
+	RoomName  string `dynamodbav:"room"`
+	// RoomKey is the lower case room name as used by the conference server.
+	RoomKey string `dynamodbav:"room-key"`
+	URL     string `dynamodbav:"url"`
+	// Server is the conference server hosting the meeting.
+	Server string `dynamodbav:"server,omitempty"`
+	// Locale is the locale of the host that messages about the meeting are
+	// shown in.
+	Locale string `dynamodbav:"locale,omitempty"`
+	// ChannelID is the channel the meeting was started from.
+	ChannelID string `dynamodbav:"channel"`
+	// MessageTS is the timestamp of the message announcing the meeting when
+	// it was posted by the app and can be updated.
+	MessageTS string `dynamodbav:"message-ts,omitempty"`
+	// ResponseURL updates the slash command response announcing the meeting.
+	ResponseURL string `dynamodbav:"response-url,omitempty"`
+	// HostMessage is the json encoded confirmation the host got for the
+	// invites of the meeting, which is replaced through the response url as
+	// invitees respond.
+	HostMessage string `dynamodbav:"host-message,omitempty"`
+	// StreamURL is where the public can watch the live stream of the
+	// meeting as provided by the host.
+	StreamURL string `dynamodbav:"stream-url,omitempty"`
+	Status    string `dynamodbav:"status"`
+	CreatedAt int64  `dynamodbav:"created-at"`
+	// ExpiresAt is when the links of the meeting stop being valid. It is zero
+	// when meetings do not expire.
+	ExpiresAt int64 `dynamodbav:"expires-at,omitempty"`
+	// PurgeAt is the ttl attribute the meeting is purged by, which is never
+	// before it expires. It is zero when meetings are kept.
+	PurgeAt int64 `dynamodbav:"purge-at,omitempty"`
+	// Participants are the participants currently in the meeting keyed by
+	// their connection.
+	Participants map[string]Participant `dynamodbav:"participants"`
+	// Attendees are everyone that joined the meeting, by user id or by
+	// connection for participants without one.
+	Attendees []string `dynamodbav:"attendees,stringset,omitempty"`
+}
+
+// Participant is a participant of a meeting.
+type Participant struct {
+	// ID is the user id of the participant's meeting token which is the
+	// slack user id for participants that joined from an invite.
+	ID     string `dynamodbav:"id,omitempty"`
+	Name   string `dynamodbav:"name,omitempty"`
+	Avatar string `dynamodbav:"avatar,omitempty"`
+}
+
+// MeetingStore stores and retrieves meeting state from aws dynamodb.
+type MeetingStore struct {
+	TableName string
+	// RoomIndex is the name of the global secondary index with the room name
+	// as partition key and the meeting id as sort key.
+	RoomIndex string
+	// Retention is optional and purges meetings that long after they were
+	// created, or once they expire when that is later.
+	Retention time.Duration
+	DB        *dynamodb.Client
+}
+
+// Store will persist the meeting.
+func (m *MeetingStore) Store(meeting *MeetingRecord) error {
+	meeting.PurgeAt = meeting.ExpiresAt
+	if m.Retention > 0 {
+		meeting.PurgeAt = purgeAt(meeting.CreatedAt, m.Retention, meeting.ExpiresAt)
+	}
+	av, err := attributevalue.MarshalMap(meeting)
+	if err != nil {
+		return err
+	}
+	_, err = m.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(m.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// Get retrieves a meeting of the team.
+func (m *MeetingStore) Get(teamID, meetingID string) (*MeetingRecord, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyMeetingTeamID: teamID,
+		KeyMeetingID:     meetingID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.DB.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(m.TableName),
+		Key:       key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, errors.New(errMissingMeeting)
+	}
+
+	var meeting MeetingRecord
+	err = attributevalue.UnmarshalMap(result.Item, &meeting)
+	if err != nil {
+		return nil, err
+	}
+	return &meeting, nil
+}
+
+// Recent retrieves the meetings of the team created since the provided
+// time, most recent first.
+func (m *MeetingStore) Recent(teamID string, since time.Time) ([]*MeetingRecord, error) {
+	keyCond := expression.Key(KeyMeetingTeamID).Equal(expression.Value(teamID)).
+		And(expression.Key(KeyMeetingID).GreaterThanEqual(expression.Value(xid.NewWithTime(since).String())))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var meetings []*MeetingRecord
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := m.DB.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:                 aws.String(m.TableName),
+			KeyConditionExpression:    expr.KeyCondition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ScanIndexForward:          aws.Bool(false),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var page []*MeetingRecord
+		err = attributevalue.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+		meetings = append(meetings, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return meetings, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// ForRoom retrieves the most recent meeting in the room.
+func (m *MeetingStore) ForRoom(roomName string) (*MeetingRecord, error) {
+	keyCond := expression.Key(KeyMeetingRoomKey).Equal(expression.Value(strings.ToLower(roomName)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.DB.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:                 aws.String(m.TableName),
+		IndexName:                 aws.String(m.RoomIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int32(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		return nil, errors.New(errMissingMeeting)
+	}
+
+	var meeting MeetingRecord
+	err = attributevalue.UnmarshalMap(result.Items[0], &meeting)
+	if err != nil {
+		return nil, err
+	}
+	return &meeting, nil
+}
+
+// AddParticipant records that a participant joined the meeting and provides
+// the updated meeting.
+func (m *MeetingStore) AddParticipant(teamID, meetingID, connectionID string, p Participant) (*MeetingRecord, error) {
+	attendee := p.ID
+	if attendee == "" {
+		attendee = participantKey(connectionID)
+	}
+	update := expression.Set(
+		expression.Name(KeyMeetingParticipants+"."+participantKey(connectionID)),
+		expression.Value(p),
+	).Add(
+		expression.Name(KeyMeetingAttendees),
+		expression.Value(types.AttributeValueMemberSS{Value: []string{attendee}}),
+	)
+	return m.updateMeeting(teamID, meetingID, update)
+}
+
+// RemoveParticipant records that a participant left the meeting and provides
+// the updated meeting.
+func (m *MeetingStore) RemoveParticipant(teamID, meetingID, connectionID string) (*MeetingRecord, error) {
+	update := expression.Remove(
+		expression.Name(KeyMeetingParticipants + "." + participantKey(connectionID)),
+	)
+	return m.updateMeeting(teamID, meetingID, update)
+}
+
+// SetStatus updates the status of a meeting.
+func (m *MeetingStore) SetStatus(teamID, meetingID, status string) error {
+	update := expression.Set(expression.Name(KeyMeetingStatus), expression.Value(status))
+	_, err := m.updateMeeting(teamID, meetingID, update)
+	return err
+}
+
+// SetHostMessage records the host's confirmation of the invites sent for a
+// meeting.
+func (m *MeetingStore) SetHostMessage(teamID, meetingID, msg string) error {
+	update := expression.Set(expression.Name(KeyMeetingHostMessage), expression.Value(msg))
+	_, err := m.updateMeeting(teamID, meetingID, update)
+	return err
+}
+
+// updateMeeting applies the update to an existing meeting and provides the
+// updated meeting.
+func (m *MeetingStore) updateMeeting(teamID, meetingID string, update expression.UpdateBuilder) (*MeetingRecord, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyMeetingTeamID: teamID,
+		KeyMeetingID:     meetingID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cond := expression.AttributeExists(expression.Name(KeyMeetingID))
+	expr, err := expression.NewBuilder().
+		WithUpdate(update).
+		WithCondition(cond).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.DB.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(m.TableName),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var meeting MeetingRecord
+	err = attributevalue.UnmarshalMap(result.Attributes, &meeting)
+	if err != nil {
+		return nil, err
+	}
+	return &meeting, nil
+}
+
+// participantKey creates a map key for a participant's connection that is
+// safe to use in a dynamo document path.
+func participantKey(connectionID string) string {
+	sum := sha1.Sum([]byte(connectionID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// purgeAt returns when a record created at the unix time is purged after it
+// was kept for the retention, or at the unix time it is needed until when
+// that is later.
+func purgeAt(created int64, retention time.Duration, needed int64) int64 {
+	purge := time.Unix(created, 0).Add(retention).Unix()
+	if needed > purge {
+		return needed
+	}
+	return purge
+}
@@ -0,0 +1,257 @@
+package jitsi
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoreBackendMemory stores tokens and server configuration in memory. It is
+// meant for local development and tests, as everything stored is lost when
+// the service stops.
+const StoreBackendMemory = "memory"
+
+// MemoryTokenStore stores and retrieves access tokens in memory. The zero
+// value is ready to use.
+type MemoryTokenStore struct {
+	mu         sync.Mutex
+	teams      map[string]TokenData
+	userTokens map[string]UserTokenData
+}
+
+// GetTokenForTeam retrieves the access token stored with the provided team
+// id.
+func (m *MemoryTokenStore) GetTokenForTeam(teamID string) (*TokenData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.teams[teamID]
+	if !ok {
+		return nil, errors.New(errMissingAuthToken)
+	}
+	return &data, nil
+}
+
+// Store will store access token data, replacing the previous token of the
+// team. The user tokens of its users are kept.
+func (m *MemoryTokenStore) Store(data *TokenData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.teams == nil {
+		m.teams = make(map[string]TokenData)
+	}
+	m.teams[data.TeamID] = *data
+	return nil
+}
+
+// Remove will remove access token data for the team, including the user
+// tokens of its users.
+func (m *MemoryTokenStore) Remove(teamID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.teams, teamID)
+	prefix := userTokenID(teamID, "")
+	for id := range m.userTokens {
+		if strings.HasPrefix(id, prefix) {
+			delete(m.userTokens, id)
+		}
+	}
+	return nil
+}
+
+// GetTokenForUser retrieves the user token stored for the user of a team.
+func (m *MemoryTokenStore) GetTokenForUser(teamID, userID string) (*UserTokenData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.userTokens[userTokenID(teamID, userID)]
+	if !ok {
+		return nil, errors.New(errMissingUserToken)
+	}
+	return &data, nil
+}
+
+// StoreUserToken will store the user token of a user. The token of the team
+// must be stored first.
+func (m *MemoryTokenStore) StoreUserToken(data *UserTokenData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.teams[data.TeamID]; !ok {
+		return errors.New(errMissingAuthToken)
+	}
+	if m.userTokens == nil {
+		m.userTokens = make(map[string]UserTokenData)
+	}
+	m.userTokens[userTokenID(data.TeamID, data.UserID)] = *data
+	return nil
+}
+
+// RemoveUserToken will remove the user token of a user.
+func (m *MemoryTokenStore) RemoveUserToken(teamID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.userTokens, userTokenID(teamID, userID))
+	return nil
+}
+
+// RemoveTeam will remove the token of a team along with the user tokens of
+// its users.
+func (m *MemoryTokenStore) RemoveTeam(teamID string) error {
+	return m.Remove(teamID)
+}
+
+// RemoveUser will remove the user token of a user.
+func (m *MemoryTokenStore) RemoveUser(teamID, userID string) error {
+	return m.RemoveUserToken(teamID, userID)
+}
+
+// ExportTeam will export the install of a team. The token is not exported.
+func (m *MemoryTokenStore) ExportTeam(teamID string) (interface{}, error) {
+	data, err := m.GetTokenForTeam(teamID)
+	if err != nil {
+		return nil, err
+	}
+	install := installAudit(data)
+	install["authed_user_id"] = data.AuthedUserID
+	return install, nil
+}
+
+// TeamIDs lists the teams with a stored token.
+func (m *MemoryTokenStore) TeamIDs() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	teamIDs := make([]string, 0, len(m.teams))
+	for teamID := range m.teams {
+		teamIDs = append(teamIDs, teamID)
+	}
+	sort.Strings(teamIDs)
+	return teamIDs, nil
+}
+
+// UserIDs lists the users of a team with a stored user token.
+func (m *MemoryTokenStore) UserIDs(teamID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var userIDs []string
+	for _, data := range m.userTokens {
+		if data.TeamID == teamID {
+			userIDs = append(userIDs, data.UserID)
+		}
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+// MemoryServerCfgStore stores the server configuration of teams in memory.
+type MemoryServerCfgStore struct {
+	ServerDefaults
+
+	mu   sync.Mutex
+	cfgs map[string]ServerCfg
+}
+
+// Store will persist the server of a team.
+func (m *MemoryServerCfgStore) Store(data *ServerCfgData) error {
+	return m.update(data.TeamID, func(cfg *ServerCfg) {
+		cfg.Server = data.Server
+	})
+}
+
+// Remove will remove the configured server for a team. That team will use
+// the default server while keeping its other settings.
+func (m *MemoryServerCfgStore) Remove(teamID string) error {
+	return m.update(teamID, func(cfg *ServerCfg) {
+		cfg.Server = ""
+	})
+}
+
+// SetWordlists will persist the words random room names of a team are
+// generated from.
+func (m *MemoryServerCfgStore) SetWordlists(teamID string, words Wordlists) error {
+	return m.update(teamID, func(cfg *ServerCfg) {
+		cfg.Words = words
+	})
+}
+
+// SetJWTLifetime will persist the lifetime of the team's meeting tokens. A
+// zero lifetime restores the default.
+func (m *MemoryServerCfgStore) SetJWTLifetime(teamID string, lifetime time.Duration) error {
+	return m.update(teamID, func(cfg *ServerCfg) {
+		cfg.JWTLifetime = 0
+		if lifetime > 0 {
+			cfg.JWTLifetime = lifetime.Truncate(time.Second)
+		}
+	})
+}
+
+// SetOpenServerChanges will persist whether everyone may change the server
+// of a team.
+func (m *MemoryServerCfgStore) SetOpenServerChanges(teamID string, open bool) error {
+	return m.update(teamID, func(cfg *ServerCfg) {
+		cfg.OpenServerChanges = open
+	})
+}
+
+// SetPermissions will persist who the subcommands of a team are limited to.
+func (m *MemoryServerCfgStore) SetPermissions(teamID string, permissions map[string]string) error {
+	copied := make(map[string]string, len(permissions))
+	for subcommand, limit := range permissions {
+		copied[subcommand] = limit
+	}
+	return m.update(teamID, func(cfg *ServerCfg) {
+		cfg.Permissions = copied
+	})
+}
+
+// SetURLConfig will persist the conference config overrides of a team's
+// meeting links. No overrides restore the defaults of the server.
+func (m *MemoryServerCfgStore) SetURLConfig(teamID string, overrides []string) error {
+	copied := append([]string(nil), overrides...)
+	return m.update(teamID, func(cfg *ServerCfg) {
+		cfg.URLConfig = copied
+	})
+}
+
+// SetRoomNaming will persist how rooms of a team are named.
+func (m *MemoryServerCfgStore) SetRoomNaming(teamID, naming string) error {
+	return m.update(teamID, func(cfg *ServerCfg) {
+		cfg.RoomNaming = naming
+	})
+}
+
+// update changes the stored configuration of a team and records when it was
+// changed.
+func (m *MemoryServerCfgStore) update(teamID string, change func(*ServerCfg)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cfgs == nil {
+		m.cfgs = make(map[string]ServerCfg)
+	}
+	cfg := m.cfgs[teamID]
+	change(&cfg)
+	cfg.UpdatedAt = time.Now().Truncate(time.Second)
+	m.cfgs[teamID] = cfg
+	return nil
+}
+
+// Get retrieves the server configuration for a team. This will provide
+// the default if no configuration is stored for the team.
+func (m *MemoryServerCfgStore) Get(teamID string) (ServerCfg, error) {
+	m.mu.Lock()
+	cfg := m.cfgs[teamID]
+	m.mu.Unlock()
+	return m.apply(cfg), nil
+}
+
+// RemoveTeam will remove the server configuration of a team.
+func (m *MemoryServerCfgStore) RemoveTeam(teamID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.cfgs, teamID)
+	return nil
+}
+
+// ExportTeam will export the server configuration of a team.
+func (m *MemoryServerCfgStore) ExportTeam(teamID string) (interface{}, error) {
+	return m.Get(teamID)
+}
@@ -0,0 +1,234 @@
+package jitsi
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// KeyTeamIDMsgCfg is the dynamo key for storing the team id.
+	// This key is the primary index.
+	KeyTeamIDMsgCfg = "team-id"
+
+	// maxTemplateTextLength limits the length of custom message text.
+	maxTemplateTextLength = 500
+	// maxUsernameLength limits the length of the custom bot display name.
+	maxUsernameLength = 80
+)
+
+var (
+	emojiRE = regexp.MustCompile(`^:[a-z0-9_+'-]+:$`)
+	colorRE = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// MessageTemplate customizes a message sent by the app. Empty fields use
+// the default of the message.
+type MessageTemplate struct {
+	// Text replaces the message text. The placeholders {host}, {url} and
+	// {room} are substituted with the meeting host, url and room name.
+	Text  string `dynamodbav:"text,omitempty"`
+	Emoji string `dynamodbav:"emoji,omitempty"`
+	Color string `dynamodbav:"color,omitempty"`
+}
+
+// MessageCfg is the message customization of a team.
+type MessageCfg struct {
+	TeamID string `dynamodbav:"team-id"`
+	// Invite is used for personal invites.
+	Invite MessageTemplate `dynamodbav:"invite"`
+	// Announcement is used for meetings announced in a channel.
+	Announcement MessageTemplate `dynamodbav:"announcement"`
+	// Branding is applied to every message.
+	Branding Branding `dynamodbav:"branding"`
+}
+
+// Branding customizes the appearance of every message of a team.
+type Branding struct {
+	// Color is the attachment color used instead of the default.
+	Color string `dynamodbav:"color,omitempty"`
+	// IconEmoji and Username replace the icon and display name of messages
+	// posted by the app. This requires the chat:write.customize scope.
+	IconEmoji string `dynamodbav:"icon-emoji,omitempty"`
+	Username  string `dynamodbav:"username,omitempty"`
+}
+
+// messageStyle is the customization applied to a message.
+type messageStyle struct {
+	MessageTemplate
+	Branding Branding
+}
+
+func (c *MessageCfg) inviteStyle() messageStyle {
+	return messageStyle{MessageTemplate: c.Invite, Branding: c.Branding}
+}
+
+func (c *MessageCfg) announcementStyle() messageStyle {
+	return messageStyle{MessageTemplate: c.Announcement, Branding: c.Branding}
+}
+
+// brandStyle is used for messages that have no template.
+func (c *MessageCfg) brandStyle() messageStyle {
+	return messageStyle{Branding: c.Branding}
+}
+
+// color returns the attachment color of the message. The template color
+// takes precedence over the team's brand color.
+func (s messageStyle) color() string {
+	if s.MessageTemplate.Color != "" {
+		return s.MessageTemplate.Color
+	}
+	if s.Branding.Color != "" {
+		return s.Branding.Color
+	}
+	return defaultColor
+}
+
+// postOptions returns the options applying the team's branding to posted
+// messages.
+func (s messageStyle) postOptions() []slack.MsgOption {
+	var opts []slack.MsgOption
+	if s.Branding.Username != "" {
+		opts = append(opts, slack.MsgOptionUsername(s.Branding.Username))
+	}
+	if s.Branding.IconEmoji != "" {
+		opts = append(opts, slack.MsgOptionIconEmoji(s.Branding.IconEmoji))
+	}
+	return opts
+}
+
+// template returns the template for the kind of message or nil when the
+// kind is unknown.
+func (c *MessageCfg) template(kind string) *MessageTemplate {
+	switch kind {
+	case "invite":
+		return &c.Invite
+	case "announcement":
+		return &c.Announcement
+	}
+	return nil
+}
+
+// render creates the message text from the template, falling back to the
+// default text. Only the known placeholders are substituted so neither the
+// template nor the values are interpreted in any other way.
+func (t MessageTemplate) render(defaultText, host, meetingURL, room string) string {
+	text := defaultText
+	if t.Text != "" {
+		text = strings.NewReplacer(
+			"{host}", host,
+			"{url}", meetingURL,
+			"{room}", room,
+		).Replace(t.Text)
+	}
+	if t.Emoji != "" {
+		text = t.Emoji + " " + text
+	}
+	return text
+}
+
+// MessageCfgStore is used to store message customization for teams.
+type MessageCfgStore struct {
+	// TableName is the name of the dynamo table where configuration is stored.
+	TableName string
+	// DB is the client used to access dynamodb.
+	DB *dynamodb.Client
+}
+
+// Store will persist the message configuration for a team.
+func (m *MessageCfgStore) Store(cfg *MessageCfg) error {
+	av, err := attributevalue.MarshalMap(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = m.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(m.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// Remove will remove the message configuration for a team. That team will
+// use the default messages.
+func (m *MessageCfgStore) Remove(teamID string) error {
+	av, err := attributevalue.MarshalMap(map[string]string{KeyTeamIDMsgCfg: teamID})
+	if err != nil {
+		return err
+	}
+	_, err = m.DB.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(m.TableName),
+		Key:       av,
+	})
+	return err
+}
+
+// Get retrieves the message configuration for a team. An empty
+// configuration is provided if none is stored for the team.
+func (m *MessageCfgStore) Get(teamID string) (MessageCfg, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{KeyTeamIDMsgCfg: teamID})
+	if err != nil {
+		return MessageCfg{}, err
+	}
+	result, err := m.DB.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(m.TableName),
+		Key:       key,
+	})
+	if err != nil {
+		return MessageCfg{}, err
+	}
+	if len(result.Item) == 0 {
+		return MessageCfg{TeamID: teamID}, nil
+	}
+
+	var cfg MessageCfg
+	err = attributevalue.UnmarshalMap(result.Item, &cfg)
+	if err != nil {
+		return MessageCfg{}, err
+	}
+	return cfg, nil
+}
+
+// templateSummary describes the message templates of a team.
+func templateSummary(locale string, cfg *MessageCfg) string {
+	value := func(v string) string {
+		if v == "" {
+			return tr(locale, "template.default")
+		}
+		return v
+	}
+	lines := []string{tr(locale, "template.usage")}
+	for _, kind := range []string{"invite", "announcement"} {
+		tmpl := cfg.template(kind)
+		lines = append(lines, tr(
+			locale,
+			"template.current",
+			kind,
+			value(tmpl.Text),
+			value(tmpl.Emoji),
+			value(tmpl.Color),
+		))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// brandSummary describes the branding of a team.
+func brandSummary(locale string, b *Branding) string {
+	value := func(v string) string {
+		if v == "" {
+			return tr(locale, "template.default")
+		}
+		return v
+	}
+	return tr(locale, "brand.usage") + "\n" + tr(
+		locale,
+		"brand.current",
+		value(b.Color),
+		value(b.IconEmoji),
+		value(b.Username),
+	)
+}
@@ -0,0 +1,474 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// tableWaitInterval is how often a changed table is described until it
+	// and its indexes are active again.
+	tableWaitInterval = 5 * time.Second
+
+	errTableKeyMismatch  = "table_key_mismatch"
+	errStreamMismatch    = "stream_view_type_mismatch"
+	errReplicaNotCreated = "replica_not_created"
+)
+
+// TableSchema is the schema of a dynamodb table of the service. Every key is
+// a string.
+type TableSchema struct {
+	Name         string
+	PartitionKey string
+	// SortKey is optional and is the sort key of the table.
+	SortKey string
+	// Indexes are the global secondary indexes of the table.
+	Indexes []IndexSchema
+	// TTLAttribute is optional and is the attribute items expire by.
+	TTLAttribute string
+	// Stream is optional and is what the stream of the table records.
+	Stream types.StreamViewType
+	// Replicas is optional and are the other regions the table is replicated
+	// to as a global table, which requires a stream of new and old images.
+	Replicas []string
+}
+
+// IndexSchema is the schema of a global secondary index, which projects
+// every attribute.
+type IndexSchema struct {
+	Name         string
+	PartitionKey string
+	SortKey      string
+}
+
+// TableNames are the dynamodb tables of a deployment. Tables that are not
+// named are not used and have no schema.
+type TableNames struct {
+	Token            string
+	ServerCfg        string
+	CalendarToken    string
+	Invite           string
+	Meeting          string
+	MeetingRoomIndex string
+	PersonalRoom     string
+	ChannelRoom      string
+	UserPrefs        string
+	Identity         string
+	Audit            string
+	TeamAccess       string
+	Usage            string
+	Feedback         string
+	MessageCfg       string
+	Delivery         string
+	RateLimit        string
+	ConfigHistory    string
+	// ServerCfgStream is optional and records the keys of changed server
+	// configuration in a stream, which invalidates cached configuration.
+	ServerCfgStream bool
+	// ReplicaRegions is optional and are the other regions every table is
+	// replicated to.
+	ReplicaRegions []string
+}
+
+// Schemas returns the schemas of the named tables.
+func (t TableNames) Schemas() []TableSchema {
+	serverCfg := TableSchema{Name: t.ServerCfg, PartitionKey: KeyTeamIDSrvCfg}
+	if t.ServerCfgStream {
+		serverCfg.Stream = types.StreamViewTypeKeysOnly
+	}
+	meeting := TableSchema{
+		Name:         t.Meeting,
+		PartitionKey: KeyMeetingTeamID,
+		SortKey:      KeyMeetingID,
+		TTLAttribute: KeyMeetingPurgeAt,
+	}
+	if t.MeetingRoomIndex != "" {
+		meeting.Indexes = []IndexSchema{{
+			Name:         t.MeetingRoomIndex,
+			PartitionKey: KeyMeetingRoomKey,
+			SortKey:      KeyMeetingID,
+		}}
+	}
+	all := []TableSchema{
+		{Name: t.Token, PartitionKey: KeyTeamID},
+		serverCfg,
+		{Name: t.CalendarToken, PartitionKey: KeyCalendarTokenID},
+		{Name: t.Invite, PartitionKey: KeyInviteMeetingID, SortKey: KeyInviteUserID, TTLAttribute: KeyInvitePurgeAt},
+		meeting,
+		{Name: t.PersonalRoom, PartitionKey: KeyPersonalRoomTeamID, SortKey: KeyPersonalRoomUserID},
+		{Name: t.ChannelRoom, PartitionKey: KeyChannelRoomTeamID, SortKey: KeyChannelRoomChannelID},
+		{Name: t.UserPrefs, PartitionKey: KeyUserPrefsTeamID, SortKey: KeyUserPrefsUserID},
+		{Name: t.Identity, PartitionKey: KeyIdentityTeamID, SortKey: KeyIdentityUserID},
+		{Name: t.Audit, PartitionKey: KeyAuditTeamID, SortKey: KeyAuditEventID},
+		{Name: t.TeamAccess, PartitionKey: KeyTeamAccessTeamID},
+		{Name: t.Usage, PartitionKey: KeyUsageTeamID, SortKey: KeyUsageEventID},
+		{Name: t.Feedback, PartitionKey: KeyFeedbackTeamID, SortKey: KeyFeedbackID},
+		{Name: t.MessageCfg, PartitionKey: KeyTeamIDMsgCfg},
+		{Name: t.Delivery, PartitionKey: KeyDeliveryID, TTLAttribute: KeyDeliveryExpiresAt},
+		{Name: t.RateLimit, PartitionKey: KeyRateLimitID, TTLAttribute: KeyRateLimitExpiresAt},
+		{Name: t.ConfigHistory, PartitionKey: KeyConfigChangeTeamID, SortKey: KeyConfigChangeID, TTLAttribute: KeyConfigChangePurgeAt},
+	}
+	var schemas []TableSchema
+	for _, schema := range all {
+		if schema.Name == "" {
+			continue
+		}
+		if len(t.ReplicaRegions) > 0 {
+			// the stream of new and old images still records the keys the
+			// server config stream is read for
+			schema.Stream = types.StreamViewTypeNewAndOldImages
+			schema.Replicas = t.ReplicaRegions
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas
+}
+
+// TableMigrator creates the tables of the service and brings existing tables
+// up to date with their schema. Missing indexes and replicas are added and
+// streams and time to live are enabled, while nothing is ever removed. New
+// tables are billed per request.
+type TableMigrator struct {
+	DB *dynamodb.Client
+	// DryRun is optional and only logs the changes instead of making them.
+	DryRun bool
+	Log    zerolog.Logger
+}
+
+// Migrate migrates every table, stopping at the first table that fails.
+func (m *TableMigrator) Migrate(ctx context.Context, schemas []TableSchema) error {
+	for _, schema := range schemas {
+		err := m.migrate(ctx, schema)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *TableMigrator) migrate(ctx context.Context, schema TableSchema) error {
+	log := m.Log.With().Str("table", schema.Name).Logger()
+	result, err := m.DB.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(schema.Name),
+	})
+	var missing *types.ResourceNotFoundException
+	if errors.As(err, &missing) {
+		log.Info().Msg("creating table")
+		if m.DryRun {
+			return nil
+		}
+		err = m.create(ctx, schema)
+		if err != nil {
+			return err
+		}
+		result, err = m.wait(ctx, schema.Name)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	table := result.Table
+
+	if !keysMatch(table.KeySchema, schema.PartitionKey, schema.SortKey) {
+		log.Error().
+			Str("partition_key", schema.PartitionKey).
+			Str("sort_key", schema.SortKey).
+			Msg("table has a different key schema")
+		return errors.New(errTableKeyMismatch)
+	}
+
+	for _, index := range schema.Indexes {
+		if hasIndex(table.GlobalSecondaryIndexes, index.Name) {
+			continue
+		}
+		log.Info().Str("index", index.Name).Msg("creating index")
+		if m.DryRun {
+			continue
+		}
+		// dynamodb creates one index of a table at a time
+		_, err = m.DB.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:            aws.String(schema.Name),
+			AttributeDefinitions: attributeDefinitions(index.PartitionKey, index.SortKey),
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:  aws.String(index.Name),
+					KeySchema:  keySchema(index.PartitionKey, index.SortKey),
+					Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+				},
+			}},
+		})
+		if err != nil {
+			return err
+		}
+		result, err = m.wait(ctx, schema.Name)
+		if err != nil {
+			return err
+		}
+		table = result.Table
+	}
+
+	if schema.Stream != "" {
+		enabled := table.StreamSpecification != nil && aws.ToBool(table.StreamSpecification.StreamEnabled)
+		switch {
+		case !enabled:
+			log.Info().Str("view_type", string(schema.Stream)).Msg("enabling stream")
+			if m.DryRun {
+				break
+			}
+			_, err = m.DB.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+				TableName: aws.String(schema.Name),
+				StreamSpecification: &types.StreamSpecification{
+					StreamEnabled:  aws.Bool(true),
+					StreamViewType: schema.Stream,
+				},
+			})
+			if err != nil {
+				return err
+			}
+			result, err = m.wait(ctx, schema.Name)
+			if err != nil {
+				return err
+			}
+			table = result.Table
+		case table.StreamSpecification.StreamViewType != schema.Stream && len(schema.Replicas) > 0:
+			// the view type of a stream only changes by disabling it
+			log.Error().
+				Str("view_type", string(table.StreamSpecification.StreamViewType)).
+				Str("expected_view_type", string(schema.Stream)).
+				Msg("replicas require a stream with a different view type")
+			return errors.New(errStreamMismatch)
+		case table.StreamSpecification.StreamViewType != schema.Stream:
+			// every view type includes the keys the service reads
+			log.Info().
+				Str("view_type", string(table.StreamSpecification.StreamViewType)).
+				Msg("keeping stream with a different view type")
+		}
+		if table.LatestStreamArn != nil {
+			log.Info().Str("stream_arn", *table.LatestStreamArn).Msg("table has stream")
+		}
+	}
+
+	for _, region := range schema.Replicas {
+		if findReplica(table.Replicas, region) != nil {
+			continue
+		}
+		log.Info().Str("region", region).Msg("creating replica")
+		if m.DryRun {
+			continue
+		}
+		// replicas are added one at a time, like indexes
+		_, err = m.DB.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName: aws.String(schema.Name),
+			ReplicaUpdates: []types.ReplicationGroupUpdate{{
+				Create: &types.CreateReplicationGroupMemberAction{
+					RegionName: aws.String(region),
+				},
+			}},
+		})
+		if err != nil {
+			return err
+		}
+		result, err = m.wait(ctx, schema.Name)
+		if err != nil {
+			return err
+		}
+		table = result.Table
+		replica := findReplica(table.Replicas, region)
+		if replica == nil || replica.ReplicaStatus != types.ReplicaStatusActive {
+			log.Error().Str("region", region).Msg("replica was not created")
+			return errors.New(errReplicaNotCreated)
+		}
+	}
+
+	if schema.TTLAttribute != "" {
+		err = m.enableTTL(ctx, log, schema)
+		if err != nil {
+			return err
+		}
+	}
+	log.Info().Msg("table is up to date")
+	return nil
+}
+
+func (m *TableMigrator) create(ctx context.Context, schema TableSchema) error {
+	attributes := attributeDefinitions(schema.PartitionKey, schema.SortKey)
+	var indexes []types.GlobalSecondaryIndex
+	for _, index := range schema.Indexes {
+		attributes = append(attributes, attributeDefinitions(index.PartitionKey, index.SortKey)...)
+		indexes = append(indexes, types.GlobalSecondaryIndex{
+			IndexName:  aws.String(index.Name),
+			KeySchema:  keySchema(index.PartitionKey, index.SortKey),
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		})
+	}
+	input := &dynamodb.CreateTableInput{
+		TableName:              aws.String(schema.Name),
+		AttributeDefinitions:   uniqueAttributes(attributes),
+		KeySchema:              keySchema(schema.PartitionKey, schema.SortKey),
+		GlobalSecondaryIndexes: indexes,
+		BillingMode:            types.BillingModePayPerRequest,
+	}
+	if schema.Stream != "" {
+		input.StreamSpecification = &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: schema.Stream,
+		}
+	}
+	_, err := m.DB.CreateTable(ctx, input)
+	return err
+}
+
+// enableTTL enables time to live on the attribute of the schema. Time to
+// live enabled on another attribute is kept, since it can only be changed
+// once it was disabled for an hour.
+func (m *TableMigrator) enableTTL(ctx context.Context, log zerolog.Logger, schema TableSchema) error {
+	result, err := m.DB.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(schema.Name),
+	})
+	if err != nil {
+		return err
+	}
+	ttl := result.TimeToLiveDescription
+	if ttl != nil && ttl.TimeToLiveStatus != types.TimeToLiveStatusDisabled {
+		if aws.ToString(ttl.AttributeName) != schema.TTLAttribute {
+			log.Warn().
+				Str("attribute", aws.ToString(ttl.AttributeName)).
+				Str("expected_attribute", schema.TTLAttribute).
+				Msg("time to live is enabled on a different attribute")
+		}
+		return nil
+	}
+	log.Info().Str("attribute", schema.TTLAttribute).Msg("enabling time to live")
+	if m.DryRun {
+		return nil
+	}
+	_, err = m.DB.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(schema.Name),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(schema.TTLAttribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return err
+}
+
+// wait describes the table until it, its indexes and its replicas are
+// active.
+func (m *TableMigrator) wait(ctx context.Context, name string) (*dynamodb.DescribeTableOutput, error) {
+	for {
+		result, err := m.DB.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(name),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if active(result.Table) {
+			return result, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(tableWaitInterval):
+		}
+	}
+}
+
+func active(table *types.TableDescription) bool {
+	if table.TableStatus != types.TableStatusActive {
+		return false
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if index.IndexStatus != types.IndexStatusActive {
+			return false
+		}
+	}
+	for _, replica := range table.Replicas {
+		if replica.ReplicaStatus == types.ReplicaStatusCreating || replica.ReplicaStatus == types.ReplicaStatusUpdating {
+			return false
+		}
+	}
+	return true
+}
+
+func keysMatch(keys []types.KeySchemaElement, partitionKey, sortKey string) bool {
+	var hash, sort string
+	for _, key := range keys {
+		switch key.KeyType {
+		case types.KeyTypeHash:
+			hash = aws.ToString(key.AttributeName)
+		case types.KeyTypeRange:
+			sort = aws.ToString(key.AttributeName)
+		}
+	}
+	return hash == partitionKey && sort == sortKey
+}
+
+func hasIndex(indexes []types.GlobalSecondaryIndexDescription, name string) bool {
+	for _, index := range indexes {
+		if aws.ToString(index.IndexName) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findReplica returns the replica of the table in the region, or nil when
+// the table is not replicated to the region.
+func findReplica(replicas []types.ReplicaDescription, region string) *types.ReplicaDescription {
+	for i := range replicas {
+		if aws.ToString(replicas[i].RegionName) == region {
+			return &replicas[i]
+		}
+	}
+	return nil
+}
+
+func keySchema(partitionKey, sortKey string) []types.KeySchemaElement {
+	keys := []types.KeySchemaElement{{
+		AttributeName: aws.String(partitionKey),
+		KeyType:       types.KeyTypeHash,
+	}}
+	if sortKey != "" {
+		keys = append(keys, types.KeySchemaElement{
+			AttributeName: aws.String(sortKey),
+			KeyType:       types.KeyTypeRange,
+		})
+	}
+	return keys
+}
+
+func attributeDefinitions(partitionKey, sortKey string) []types.AttributeDefinition {
+	attributes := []types.AttributeDefinition{{
+		AttributeName: aws.String(partitionKey),
+		AttributeType: types.ScalarAttributeTypeS,
+	}}
+	if sortKey != "" {
+		attributes = append(attributes, types.AttributeDefinition{
+			AttributeName: aws.String(sortKey),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+	}
+	return attributes
+}
+
+// uniqueAttributes removes the attributes that are defined twice because
+// they are keys of the table and of an index.
+func uniqueAttributes(attributes []types.AttributeDefinition) []types.AttributeDefinition {
+	seen := make(map[string]bool)
+	var unique []types.AttributeDefinition
+	for _, attribute := range attributes {
+		name := aws.ToString(attribute.AttributeName)
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, attribute)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,59 @@
+package jitsi
+
+import (
+	"net/url"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// mobileAppScheme is the url scheme registered by the Jitsi Meet apps.
+	mobileAppScheme = "org.jitsi.meet"
+	// mobileAppPackage is the android package of the Jitsi Meet app.
+	mobileAppPackage = "org.jitsi.meet"
+
+	// actionOpenApp and actionOpenAndroidApp are the action ids of the
+	// buttons opening a meeting in the mobile app. Clicks need no handling.
+	actionOpenApp        = "open_app"
+	actionOpenAndroidApp = "open_android_app"
+)
+
+// appLinks creates the links opening a meeting in the Jitsi Meet mobile app.
+// The deep link is handled by the app on iOS and android, the intent link
+// is needed for browsers on android that do not follow custom schemes. The
+// links are empty when the meeting url cannot be parsed.
+func appLinks(meetingURL string) (deepLink, intentLink string) {
+	u, err := url.Parse(meetingURL)
+	if err != nil || u.Host == "" {
+		return "", ""
+	}
+	location := u.Host + u.EscapedPath()
+	if u.RawQuery != "" {
+		location += "?" + u.RawQuery
+	}
+	deepLink = mobileAppScheme + "://" + location
+	intentLink = "intent://" + location + "#Intent;scheme=" + mobileAppScheme + ";package=" + mobileAppPackage + ";end"
+	return deepLink, intentLink
+}
+
+// appButtons creates the secondary buttons opening a meeting in the mobile
+// app.
+func appButtons(locale, meetingURL string) []slack.BlockElement {
+	deepLink, intentLink := appLinks(meetingURL)
+	if deepLink == "" {
+		return nil
+	}
+	openApp := slack.NewButtonBlockElement(
+		actionOpenApp,
+		"",
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "button.open_app"), false, false),
+	)
+	openApp.URL = deepLink
+	openAndroidApp := slack.NewButtonBlockElement(
+		actionOpenAndroidApp,
+		"",
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "button.open_android_app"), false, false),
+	)
+	openAndroidApp.URL = intentLink
+	return []slack.BlockElement{openApp, openAndroidApp}
+}
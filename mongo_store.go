@@ -0,0 +1,525 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// StoreBackendMongoDB stores tokens and server configuration in mongodb,
+	// e.g. mongodb atlas.
+	StoreBackendMongoDB = "mongodb"
+
+	// DefaultMongoDatabase is the database of the mongodb stores when no
+	// database is configured.
+	DefaultMongoDatabase = "jitsi-slack"
+
+	// mongoTokens holds the token of each team by team id and the user
+	// tokens of its users by team/user, like the dynamodb token table.
+	mongoTokens = "tokens"
+	// mongoServerCfg holds the server configuration of each team by team id.
+	mongoServerCfg = "server-cfg"
+	// mongoDeliveries and mongoRateLimits hold expirable records, which are
+	// removed by ttl indexes on their expires-at dates.
+	mongoDeliveries = "deliveries"
+	mongoRateLimits = "rate-limits"
+
+	mongoConnectTimeout = 10 * time.Second
+	// mongoDuplicateKey is the code of writes that conflict with a unique
+	// index.
+	mongoDuplicateKey = 11000
+)
+
+// mongoIndexes are the indexes of the collections, created by
+// ConnectMongoDB. Expirable records are removed by the ttl monitor, which
+// runs every minute, once their expires-at date passed.
+var mongoIndexes = map[string][]mongo.IndexModel{
+	mongoTokens: {{
+		Keys: bson.D{{Key: "team-id", Value: 1}},
+	}},
+	mongoDeliveries: {{
+		Keys:    bson.D{{Key: "expires-at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}},
+	mongoRateLimits: {{
+		Keys:    bson.D{{Key: "expires-at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}},
+}
+
+// ConnectMongoDB connects to the mongodb deployment of the connection string
+// and creates the indexes of the stores in the database. DefaultMongoDatabase
+// is used when the database is empty.
+func ConnectMongoDB(uri, database string) (*mongo.Database, error) {
+	if database == "" {
+		database = DefaultMongoDatabase
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mongoConnectTimeout)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	db := client.Database(database)
+	for collection, models := range mongoIndexes {
+		_, err = db.Collection(collection).Indexes().CreateMany(ctx, models)
+		if err != nil {
+			client.Disconnect(ctx)
+			return nil, fmt.Errorf("creating indexes of %s: %w", collection, err)
+		}
+	}
+	return db, nil
+}
+
+// mongoDuplicate reports whether a write failed because it conflicts with a
+// unique index, e.g. an upsert of an existing _id.
+func mongoDuplicate(err error) bool {
+	var we mongo.WriteException
+	if errors.As(err, &we) {
+		for _, e := range we.WriteErrors {
+			if e.Code == mongoDuplicateKey {
+				return true
+			}
+		}
+	}
+	var ce mongo.CommandError
+	return errors.As(err, &ce) && ce.Code == mongoDuplicateKey
+}
+
+// mongoToken is a token as it is stored in a document. The access token is
+// replaced by its ciphertext when tokens are encrypted.
+type mongoToken struct {
+	ID          string `bson:"_id"`
+	TeamID      string `bson:"team-id"`
+	UserID      string `bson:"user-id,omitempty"`
+	AccessToken string `bson:"access-token,omitempty"`
+	Scope       string `bson:"scope,omitempty"`
+	// BotUserID, AppID, AuthedUserID and EnterpriseID are only stored for
+	// the tokens of teams.
+	BotUserID    string `bson:"bot-user-id,omitempty"`
+	AppID        string `bson:"app-id,omitempty"`
+	AuthedUserID string `bson:"authed-user-id,omitempty"`
+	EnterpriseID string `bson:"enterprise-id,omitempty"`
+	KeyID        string `bson:"key-id,omitempty"`
+	DataKey      []byte `bson:"data-key,omitempty"`
+	Ciphertext   []byte `bson:"ciphertext,omitempty"`
+}
+
+// MongoTokenStore stores and retrieves access tokens from mongodb. The user
+// tokens of a team are found by the index on its team id.
+type MongoTokenStore struct {
+	DB *mongo.Database
+	// Cipher is optional and encrypts the access tokens that are stored.
+	// Tokens stored before they were encrypted are still read.
+	Cipher TokenCipher
+}
+
+func (m *MongoTokenStore) tokens() *mongo.Collection {
+	return m.DB.Collection(mongoTokens)
+}
+
+// encrypt replaces the access token with its ciphertext when tokens are
+// encrypted.
+func (m *MongoTokenStore) encrypt(token *mongoToken) error {
+	if m.Cipher == nil {
+		return nil
+	}
+	enc, err := m.Cipher.Encrypt(token.ID, token.AccessToken)
+	if err != nil {
+		return err
+	}
+	token.AccessToken = ""
+	token.KeyID, token.DataKey, token.Ciphertext = enc.KeyID, enc.DataKey, enc.Ciphertext
+	return nil
+}
+
+// decrypt returns the access token. Tokens without a key id were stored in
+// plaintext.
+func (m *MongoTokenStore) decrypt(token *mongoToken) (string, error) {
+	if token.KeyID == "" {
+		return token.AccessToken, nil
+	}
+	if m.Cipher == nil {
+		return "", errors.New(errMissingTokenCipher)
+	}
+	return m.Cipher.Decrypt(token.ID, &EncryptedToken{
+		KeyID:      token.KeyID,
+		DataKey:    token.DataKey,
+		Ciphertext: token.Ciphertext,
+	})
+}
+
+// get retrieves the token with the id. It reports whether it exists.
+func (m *MongoTokenStore) get(id string) (*mongoToken, bool, error) {
+	var token mongoToken
+	err := m.tokens().FindOne(context.TODO(), bson.M{"_id": id}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &token, true, nil
+}
+
+// put replaces the token with its id.
+func (m *MongoTokenStore) put(token *mongoToken) error {
+	err := m.encrypt(token)
+	if err != nil {
+		return err
+	}
+	_, err = m.tokens().ReplaceOne(
+		context.TODO(),
+		bson.M{"_id": token.ID},
+		token,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// GetTokenForTeam retrieves the access token stored with the provided team
+// id.
+func (m *MongoTokenStore) GetTokenForTeam(teamID string) (*TokenData, error) {
+	token, found, err := m.get(teamID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New(errMissingAuthToken)
+	}
+	accessToken, err := m.decrypt(token)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenData{
+		TeamID:       teamID,
+		AccessToken:  accessToken,
+		Scope:        token.Scope,
+		BotUserID:    token.BotUserID,
+		AppID:        token.AppID,
+		AuthedUserID: token.AuthedUserID,
+		EnterpriseID: token.EnterpriseID,
+	}, nil
+}
+
+// Store will store access token data, replacing the previous token of the
+// team. The user tokens of its users are kept.
+func (m *MongoTokenStore) Store(data *TokenData) error {
+	return m.put(&mongoToken{
+		ID:           data.TeamID,
+		TeamID:       data.TeamID,
+		AccessToken:  data.AccessToken,
+		Scope:        data.Scope,
+		BotUserID:    data.BotUserID,
+		AppID:        data.AppID,
+		AuthedUserID: data.AuthedUserID,
+		EnterpriseID: data.EnterpriseID,
+	})
+}
+
+// Remove will remove access token data for the team, including the user
+// tokens of its users.
+func (m *MongoTokenStore) Remove(teamID string) error {
+	_, err := m.tokens().DeleteMany(context.TODO(), bson.M{"team-id": teamID})
+	return err
+}
+
+// GetTokenForUser retrieves the user token stored for the user of a team.
+func (m *MongoTokenStore) GetTokenForUser(teamID, userID string) (*UserTokenData, error) {
+	token, found, err := m.get(userTokenID(teamID, userID))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New(errMissingUserToken)
+	}
+	accessToken, err := m.decrypt(token)
+	if err != nil {
+		return nil, err
+	}
+	return &UserTokenData{
+		TeamID:      teamID,
+		UserID:      userID,
+		AccessToken: accessToken,
+		Scope:       token.Scope,
+	}, nil
+}
+
+// StoreUserToken will store the user token of a user. The token of the team
+// must be stored first.
+func (m *MongoTokenStore) StoreUserToken(data *UserTokenData) error {
+	_, found, err := m.get(data.TeamID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New(errMissingAuthToken)
+	}
+	return m.put(&mongoToken{
+		ID:          userTokenID(data.TeamID, data.UserID),
+		TeamID:      data.TeamID,
+		UserID:      data.UserID,
+		AccessToken: data.AccessToken,
+		Scope:       data.Scope,
+	})
+}
+
+// RemoveUserToken will remove the user token of a user.
+func (m *MongoTokenStore) RemoveUserToken(teamID, userID string) error {
+	_, err := m.tokens().DeleteOne(context.TODO(), bson.M{"_id": userTokenID(teamID, userID)})
+	return err
+}
+
+// RemoveTeam will remove the token of a team along with the user tokens of
+// its users.
+func (m *MongoTokenStore) RemoveTeam(teamID string) error {
+	return m.Remove(teamID)
+}
+
+// RemoveUser will remove the user token of a user.
+func (m *MongoTokenStore) RemoveUser(teamID, userID string) error {
+	return m.RemoveUserToken(teamID, userID)
+}
+
+// ExportTeam will export the install of a team. The token is not exported.
+func (m *MongoTokenStore) ExportTeam(teamID string) (interface{}, error) {
+	data, err := m.GetTokenForTeam(teamID)
+	if err != nil {
+		return nil, err
+	}
+	install := installAudit(data)
+	install["authed_user_id"] = data.AuthedUserID
+	return install, nil
+}
+
+// TeamIDs lists the teams with a stored token.
+func (m *MongoTokenStore) TeamIDs() ([]string, error) {
+	return m.distinct("team-id", bson.M{"user-id": bson.M{"$exists": false}})
+}
+
+// UserIDs lists the users of a team with a stored user token.
+func (m *MongoTokenStore) UserIDs(teamID string) ([]string, error) {
+	return m.distinct("user-id", bson.M{"team-id": teamID, "user-id": bson.M{"$exists": true}})
+}
+
+// distinct returns the distinct values of the field of the tokens matching
+// the filter.
+func (m *MongoTokenStore) distinct(field string, filter bson.M) ([]string, error) {
+	values, err := m.tokens().Distinct(context.TODO(), field, filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// mongoServerCfgData is the server configuration of a team as it is stored
+// in a document with the team id as its _id.
+type mongoServerCfgData struct {
+	Server            string            `bson:"server-url,omitempty"`
+	RoomNaming        string            `bson:"room-naming,omitempty"`
+	Words             Wordlists         `bson:"wordlists"`
+	JWTLifetime       int64             `bson:"jwt-lifetime,omitempty"`
+	OpenServerChanges bool              `bson:"open-server-changes,omitempty"`
+	Permissions       map[string]string `bson:"permissions,omitempty"`
+	URLConfig         []string          `bson:"url-config,omitempty"`
+	UpdatedAt         time.Time         `bson:"updated-at,omitempty"`
+}
+
+// MongoServerCfgStore stores the server configuration of teams in mongodb.
+type MongoServerCfgStore struct {
+	DB *mongo.Database
+	ServerDefaults
+}
+
+// Store will persist the server of a team.
+func (m *MongoServerCfgStore) Store(data *ServerCfgData) error {
+	return m.update(data.TeamID, bson.M{"$set": bson.M{"server-url": data.Server}})
+}
+
+// Remove will remove the configured server for a team. That team will use
+// the default server while keeping its other settings.
+func (m *MongoServerCfgStore) Remove(teamID string) error {
+	return m.update(teamID, bson.M{"$unset": bson.M{"server-url": ""}})
+}
+
+// SetWordlists will persist the words random room names of a team are
+// generated from.
+func (m *MongoServerCfgStore) SetWordlists(teamID string, words Wordlists) error {
+	return m.update(teamID, bson.M{"$set": bson.M{"wordlists": words}})
+}
+
+// SetJWTLifetime will persist the lifetime of the team's meeting tokens. A
+// zero lifetime restores the default.
+func (m *MongoServerCfgStore) SetJWTLifetime(teamID string, lifetime time.Duration) error {
+	if lifetime <= 0 {
+		return m.update(teamID, bson.M{"$unset": bson.M{"jwt-lifetime": ""}})
+	}
+	return m.update(teamID, bson.M{"$set": bson.M{"jwt-lifetime": int64(lifetime.Seconds())}})
+}
+
+// SetOpenServerChanges will persist whether everyone may change the server
+// of a team.
+func (m *MongoServerCfgStore) SetOpenServerChanges(teamID string, open bool) error {
+	return m.update(teamID, bson.M{"$set": bson.M{"open-server-changes": open}})
+}
+
+// SetPermissions will persist who the subcommands of a team are limited to.
+func (m *MongoServerCfgStore) SetPermissions(teamID string, permissions map[string]string) error {
+	if len(permissions) == 0 {
+		return m.update(teamID, bson.M{"$unset": bson.M{"permissions": ""}})
+	}
+	return m.update(teamID, bson.M{"$set": bson.M{"permissions": permissions}})
+}
+
+// SetURLConfig will persist the conference config overrides of a team's
+// meeting links. No overrides restore the defaults of the server.
+func (m *MongoServerCfgStore) SetURLConfig(teamID string, overrides []string) error {
+	if len(overrides) == 0 {
+		return m.update(teamID, bson.M{"$unset": bson.M{"url-config": ""}})
+	}
+	return m.update(teamID, bson.M{"$set": bson.M{"url-config": overrides}})
+}
+
+// SetRoomNaming will persist how rooms of a team are named.
+func (m *MongoServerCfgStore) SetRoomNaming(teamID, naming string) error {
+	return m.update(teamID, bson.M{"$set": bson.M{"room-naming": naming}})
+}
+
+// update applies the update operators to the configuration of a team and
+// records when it was changed.
+func (m *MongoServerCfgStore) update(teamID string, update bson.M) error {
+	update["$currentDate"] = bson.M{"updated-at": true}
+	_, err := m.DB.Collection(mongoServerCfg).UpdateOne(
+		context.TODO(),
+		bson.M{"_id": teamID},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Get retrieves the server configuration for a team. This will provide
+// the default if no configuration is stored for the team.
+func (m *MongoServerCfgStore) Get(teamID string) (ServerCfg, error) {
+	var data mongoServerCfgData
+	err := m.DB.Collection(mongoServerCfg).FindOne(context.TODO(), bson.M{"_id": teamID}).Decode(&data)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return ServerCfg{}, err
+	}
+	return m.apply(ServerCfg{
+		Server:            data.Server,
+		RoomNaming:        data.RoomNaming,
+		Words:             data.Words,
+		JWTLifetime:       time.Duration(data.JWTLifetime) * time.Second,
+		OpenServerChanges: data.OpenServerChanges,
+		Permissions:       data.Permissions,
+		URLConfig:         data.URLConfig,
+		UpdatedAt:         data.UpdatedAt,
+	}), nil
+}
+
+// RemoveTeam will remove the server configuration of a team.
+func (m *MongoServerCfgStore) RemoveTeam(teamID string) error {
+	_, err := m.DB.Collection(mongoServerCfg).DeleteOne(context.TODO(), bson.M{"_id": teamID})
+	return err
+}
+
+// ExportTeam will export the server configuration of a team.
+func (m *MongoServerCfgStore) ExportTeam(teamID string) (interface{}, error) {
+	return m.Get(teamID)
+}
+
+// MongoDeliveryCache remembers deliveries in mongodb, so that retries are
+// recognized by every instance of the service. Deliveries expire through the
+// ttl index of the collection.
+type MongoDeliveryCache struct {
+	DB *mongo.Database
+}
+
+// Seen records the delivery and returns whether it was recorded before. The
+// delivery is only recorded when it is missing or expired, so concurrent
+// deliveries are recorded once.
+func (m *MongoDeliveryCache) Seen(key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	// documents are only removed by the ttl monitor some time after they
+	// expired, and upserting an unexpired delivery conflicts with its _id
+	_, err := m.DB.Collection(mongoDeliveries).UpdateOne(
+		context.TODO(),
+		bson.M{"_id": key, "expires-at": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"expires-at": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongoDuplicate(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// MongoRateLimiter is a rate limiter that counts units in mongodb, so that
+// the limits hold across the instances of the service. Every window of a key
+// is counted in its own document, which expires through the ttl index of the
+// collection once the window ended.
+type MongoRateLimiter struct {
+	DB *mongo.Database
+}
+
+// Take takes n units of the limit of the key. The units are only added when
+// the count stays within the limit, so concurrent takes never exceed it.
+func (m *MongoRateLimiter) Take(key string, n int, limit RateLimit) (time.Duration, error) {
+	if limit.unlimited() {
+		return 0, nil
+	}
+	now := time.Now()
+	start := windowStart(now, limit.Window)
+	end := start.Add(limit.Window)
+	if n > limit.Count {
+		return 0, errors.New(errExceedsRateLimit)
+	}
+	// upserting a window that has too few units left conflicts with its _id
+	_, err := m.DB.Collection(mongoRateLimits).UpdateOne(
+		context.TODO(),
+		bson.M{
+			"_id":   fmt.Sprintf("%s/%d", key, start.Unix()),
+			"taken": bson.M{"$lte": limit.Count - n},
+		},
+		bson.M{
+			"$inc": bson.M{"taken": n},
+			"$set": bson.M{"expires-at": end},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if mongoDuplicate(err) {
+		return end.Sub(now), nil
+	}
+	return 0, err
+}
+
+// Return gives back n units taken from the limit of the key. The count never
+// goes below zero, e.g. when the window ended since the units were taken.
+func (m *MongoRateLimiter) Return(key string, n int, limit RateLimit) error {
+	if limit.unlimited() {
+		return nil
+	}
+	start := windowStart(time.Now(), limit.Window)
+	_, err := m.DB.Collection(mongoRateLimits).UpdateOne(
+		context.TODO(),
+		bson.M{
+			"_id":   fmt.Sprintf("%s/%d", key, start.Unix()),
+			"taken": bson.M{"$gte": n},
+		},
+		bson.M{"$inc": bson.M{"taken": -n}},
+	)
+	return err
+}
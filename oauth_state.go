@@ -0,0 +1,165 @@
+package jitsi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keyStateExpiry  = "exp"
+	keyStateNonce   = "nonce"
+	errInvalidState = "invalid_state"
+
+	// keyResume is the install link parameter and the keys of the state
+	// resuming the slash command an install prompt was shown for.
+	keyResume        = "resume"
+	keyResumeTeam    = "team"
+	keyResumeChannel = "channel"
+	keyResumeCommand = "command"
+	// installResumeLifetime is how long the install link of a prompt leads
+	// back to its channel, since it may be passed on to an admin.
+	installResumeLifetime = 24 * time.Hour
+	// maxResumeCommandLength limits the commands carried by install links.
+	// Longer commands are not repeated after the install.
+	maxResumeCommandLength = 200
+
+	// installStateCookie binds the state of a slack install to the browser
+	// that started it.
+	installStateCookie = "jitsi_slack_install"
+	// installStateLifetime is how long a user has to complete a slack
+	// install.
+	installStateLifetime = 10 * time.Minute
+)
+
+// signState encodes the provided values into an oauth state parameter that
+// expires after the provided lifetime. The state is signed so that a
+// callback can trust the values it carries.
+func signState(secret string, values url.Values, lifetime time.Duration) string {
+	v := url.Values{}
+	for k, vals := range values {
+		v[k] = vals
+	}
+	v.Set(keyStateExpiry, strconv.FormatInt(time.Now().Add(lifetime).Unix(), 10))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(v.Encode()))
+	return payload + "." + stateSignature(secret, payload)
+}
+
+// verifyState checks the signature and expiry of a state parameter created
+// with signState and returns the values it carries.
+func verifyState(secret, state string) (url.Values, error) {
+	parts := strings.SplitN(state, ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New(errInvalidState)
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(stateSignature(secret, parts[0]))) {
+		return nil, errors.New(errInvalidState)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New(errInvalidState)
+	}
+	values, err := url.ParseQuery(string(raw))
+	if err != nil {
+		return nil, errors.New(errInvalidState)
+	}
+	exp, err := strconv.ParseInt(values.Get(keyStateExpiry), 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return nil, errors.New(errInvalidState)
+	}
+	values.Del(keyStateExpiry)
+	return values, nil
+}
+
+// resumeState creates the signed state of an install prompt shown for a
+// slash command run in a channel.
+func resumeState(secret, teamID, channelID, command string) string {
+	if len(command) > maxResumeCommandLength {
+		command = ""
+	}
+	return signState(secret, url.Values{
+		keyResumeTeam:    {teamID},
+		keyResumeChannel: {channelID},
+		keyResumeCommand: {command},
+	}, installResumeLifetime)
+}
+
+// installState creates the state of a slack install together with the
+// cookie holding its nonce. The resume values are optional and carried to
+// the callback.
+func installState(secret string, resume url.Values) (string, *http.Cookie, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	values := url.Values{keyStateNonce: {nonce}}
+	for _, k := range []string{keyResumeTeam, keyResumeChannel, keyResumeCommand} {
+		if v := resume.Get(k); v != "" {
+			values.Set(k, v)
+		}
+	}
+	state := signState(secret, values, installStateLifetime)
+	return state, &http.Cookie{
+		Name:     installStateCookie,
+		Value:    nonce,
+		Path:     "/slack",
+		MaxAge:   int(installStateLifetime.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}, nil
+}
+
+// verifyInstallState checks that the state of a slack install callback was
+// issued by installState to the same browser and returns the resume values
+// it carries.
+func verifyInstallState(secret string, r *http.Request) (url.Values, error) {
+	values, err := verifyState(secret, r.URL.Query().Get("state"))
+	if err != nil {
+		return nil, err
+	}
+	cookie, err := r.Cookie(installStateCookie)
+	if err != nil || values.Get(keyStateNonce) == "" {
+		return nil, errors.New(errInvalidState)
+	}
+	if !hmac.Equal([]byte(cookie.Value), []byte(values.Get(keyStateNonce))) {
+		return nil, errors.New(errInvalidState)
+	}
+	values.Del(keyStateNonce)
+	return values, nil
+}
+
+// resumeChannel returns the channel an install prompt was shown in when it
+// belongs to the installed team.
+func resumeChannel(teamID string, resume url.Values) string {
+	if teamID == "" || resume.Get(keyResumeTeam) != teamID {
+		return ""
+	}
+	return resume.Get(keyResumeChannel)
+}
+
+// installRedirect returns where an installer is sent once the install
+// succeeded. The channel is optional and opened in the installed team.
+func installRedirect(appID, teamID, channelID string) string {
+	params := url.Values{"app": {appID}}
+	if channelID != "" {
+		params.Set("team", teamID)
+		params.Set("channel", channelID)
+	}
+	return "https://slack.com/app_redirect?" + params.Encode()
+}
+
+func stateSignature(secret, payload string) string {
+	hasher := hmac.New(sha256.New, []byte(secret))
+	hasher.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,171 @@
+package jitsi
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testStateSecret = "state-secret"
+
+func TestVerifyState(t *testing.T) {
+	values := url.Values{"team": {"T123"}, "user": {"U123"}}
+	state := signState(testStateSecret, values, time.Minute)
+	payload := strings.SplitN(state, ".", 2)[0]
+	signature := strings.SplitN(state, ".", 2)[1]
+	forged := base64.RawURLEncoding.EncodeToString([]byte(url.Values{
+		"team":         {"T999"},
+		"user":         {"U123"},
+		keyStateExpiry: {"9999999999"},
+	}.Encode()))
+
+	tests := []struct {
+		name  string
+		state string
+		ok    bool
+	}{
+		{name: "signed state", state: state, ok: true},
+		{name: "tampered payload", state: forged + "." + signature},
+		{name: "bad signature", state: payload + "." + stateSignature(testStateSecret, forged)},
+		{name: "signed with another secret", state: signState("other-secret", values, time.Minute)},
+		{name: "truncated signature", state: payload + "." + signature[:len(signature)-1]},
+		{name: "missing signature", state: payload},
+		{name: "payload that is not base64", state: "!!!." + stateSignature(testStateSecret, "!!!")},
+		{name: "expired", state: signState(testStateSecret, values, -time.Second)},
+		{name: "empty", state: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := verifyState(testStateSecret, test.state)
+			if !test.ok {
+				if err == nil || err.Error() != errInvalidState {
+					t.Fatalf("verifyState = %v, %v, want %s", got, err, errInvalidState)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Get("team") != "T123" || got.Get("user") != "U123" || got.Get(keyStateExpiry) != "" {
+				t.Errorf("values = %v, want the signed values without the expiry", got)
+			}
+		})
+	}
+}
+
+func TestSignStateKeepsItsExpiry(t *testing.T) {
+	state := signState(testStateSecret, url.Values{keyStateExpiry: {"9999999999"}}, -time.Second)
+	if _, err := verifyState(testStateSecret, state); err == nil {
+		t.Fatal("state with an expiry among its values outlived its lifetime")
+	}
+}
+
+// installCallback creates the install callback request of the state, sent
+// with the nonce cookie when it is not empty.
+func installCallback(state, nonce string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/slack/auth?"+url.Values{"state": {state}, "code": {"c"}}.Encode(), nil)
+	if nonce != "" {
+		r.AddCookie(&http.Cookie{Name: installStateCookie, Value: nonce})
+	}
+	return r
+}
+
+func TestVerifyInstallState(t *testing.T) {
+	resume := url.Values{
+		keyResumeTeam:    {"T123"},
+		keyResumeChannel: {"C123"},
+		keyResumeCommand: {"/jitsi @alice"},
+	}
+	state, cookie, err := installState(testStateSecret, resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cookie.Secure || !cookie.HttpOnly || cookie.Name != installStateCookie || cookie.Value == "" {
+		t.Fatalf("cookie = %+v, want a secure http only nonce cookie", cookie)
+	}
+	other, otherCookie, err := installState(testStateSecret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		ok      bool
+	}{
+		{name: "nonce cookie", request: installCallback(state, cookie.Value), ok: true},
+		{name: "missing nonce cookie", request: installCallback(state, "")},
+		{name: "mismatched nonce cookie", request: installCallback(state, otherCookie.Value)},
+		{name: "cookie of the state", request: installCallback(other, otherCookie.Value), ok: true},
+		{name: "state without a nonce", request: func() *http.Request {
+			// a resume state is signed with the same secret but has no nonce
+			r := installCallback(resumeState(testStateSecret, "T123", "C123", ""), "")
+			r.Header.Set("Cookie", installStateCookie+"=")
+			return r
+		}()},
+		{name: "signed with another secret", request: func() *http.Request {
+			state, cookie, _ := installState("other-secret", resume)
+			return installCallback(state, cookie.Value)
+		}()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := verifyInstallState(testStateSecret, test.request)
+			if !test.ok {
+				if err == nil || err.Error() != errInvalidState {
+					t.Fatalf("verifyInstallState = %v, %v, want %s", values, err, errInvalidState)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if values.Get(keyStateNonce) != "" {
+				t.Errorf("values = %v, want the nonce removed", values)
+			}
+		})
+	}
+
+	values, err := verifyInstallState(testStateSecret, installCallback(state, cookie.Value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range resume {
+		if values.Get(k) != resume.Get(k) {
+			t.Errorf("%s = %q, want %q", k, values.Get(k), resume.Get(k))
+		}
+	}
+}
+
+func TestResumeChannel(t *testing.T) {
+	resume, err := verifyState(testStateSecret, resumeState(testStateSecret, "T123", "C123", "/jitsi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resumeChannel("T123", resume); got != "C123" {
+		t.Errorf("resumeChannel of the team = %q, want C123", got)
+	}
+	if got := resumeChannel("T456", resume); got != "" {
+		t.Errorf("resumeChannel of another team = %q, want none", got)
+	}
+	if got := resumeChannel("", resume); got != "" {
+		t.Errorf("resumeChannel without a team = %q, want none", got)
+	}
+	if got := resumeChannel("T123", nil); got != "" {
+		t.Errorf("resumeChannel without a state = %q, want none", got)
+	}
+}
+
+func TestResumeStateDropsLongCommands(t *testing.T) {
+	resume, err := verifyState(testStateSecret, resumeState(testStateSecret, "T123", "C123", strings.Repeat("a", maxResumeCommandLength+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resume.Get(keyResumeCommand) != "" || resume.Get(keyResumeChannel) != "C123" {
+		t.Errorf("resume = %v, want the channel without the command", resume)
+	}
+}
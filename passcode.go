@@ -0,0 +1,123 @@
+package jitsi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/slack-go/slack"
+)
+
+// passcodeLength is the number of digits of a generated meeting passcode.
+const passcodeLength = 6
+
+// The flags used to protect a meeting with a passcode, e.g. --passcode for a
+// generated passcode or --password=secret for a chosen one.
+const (
+	flagPasscode = "passcode"
+	flagPassword = "password"
+)
+
+// passcodeRE matches the passcodes hosts may choose.
+var passcodeRE = regexp.MustCompile(`^[!-_a-~]{4,32}$`)
+
+// requestedPasscode returns the passcode chosen with the flags of the
+// command. It is empty when the passcode is to be generated and ok is false
+// when no passcode was requested.
+func requestedPasscode(cmd *Command) (passcode string, ok bool) {
+	for _, flag := range []string{flagPasscode, flagPassword} {
+		if value, set := cmd.Flags[flag]; set {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// generatePasscode creates a random numeric passcode.
+func generatePasscode() (string, error) {
+	max := big.NewInt(10)
+	digits := make([]byte, passcodeLength)
+	for i := range digits {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		digits[i] = byte('0' + n.Int64())
+	}
+	return string(digits), nil
+}
+
+// RoomLocker protects a meeting with a passcode on the conference server.
+type RoomLocker interface {
+	LockRoom(teamID, teamName string, meeting *Meeting, passcode string) error
+}
+
+// RoomPasswordAPI sets room passwords through an endpoint of a prosody
+// module. Since rooms are only created once the first participant joins,
+// the module is expected to apply the password when the room is created.
+// Requests are authorized with a meeting token for the room.
+type RoomPasswordAPI struct {
+	// Server is the conference server providing the endpoint. Meetings on
+	// other servers cannot be protected.
+	Server string
+	// Endpoint is the url of the room password endpoint.
+	// (e.g. https://meet.example.com/room-password)
+	Endpoint string
+	// MUCDomain is the domain of the conference rooms.
+	MUCDomain             string
+	MeetingTokenGenerator MeetingTokenGenerator
+}
+
+// LockRoom sets the passcode of the meeting's room.
+func (p *RoomPasswordAPI) LockRoom(teamID, teamName string, meeting *Meeting, passcode string) error {
+	conference, ok := roomJID(p.Server, p.MUCDomain, meeting.URL, meeting.RoomName)
+	if !ok {
+		return fmt.Errorf("room password: %s is not hosted on %s", meeting.URL, p.Server)
+	}
+	jwt, err := p.MeetingTokenGenerator.CreateJWT(JWTInput{
+		TenantID:   teamID,
+		TenantName: teamName,
+		RoomClaim:  meeting.RoomName,
+	})
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"password": passcode})
+	if err != nil {
+		return err
+	}
+
+	endpoint := p.Endpoint + "?" + url.Values{
+		"conference": {conference},
+	}.Encode()
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("room password: %s", resp.Status)
+	}
+	return nil
+}
+
+// passcodeBlock creates the block showing the passcode of a meeting.
+func passcodeBlock(locale, passcode string) slack.Block {
+	return slack.NewContextBlock("", slack.NewTextBlockObject(
+		slack.MarkdownType,
+		tr(locale, "passcode.text", passcode),
+		false,
+		false,
+	))
+}
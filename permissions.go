@@ -0,0 +1,88 @@
+package jitsi
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// isWorkspaceAdmin returns whether the user is an admin or owner of the
+// slack workspace.
+func isWorkspaceAdmin(token, userID string) (bool, error) {
+	userInfo, err := slack.New(token).GetUserInfo(userID)
+	if err != nil {
+		return false, err
+	}
+	return userInfo.IsAdmin || userInfo.IsOwner, nil
+}
+
+const (
+	// roleAdmins limits a subcommand to workspace admins and owners.
+	roleAdmins = "admins"
+	// roleEveryone lifts the limit of a subcommand.
+	roleEveryone = "everyone"
+)
+
+// userGroupRE matches a mentioned slack user group and captures its id.
+var userGroupRE = regexp.MustCompile(`^<!subteam\^([A-Z0-9]+)(\|[^>]*)?>$`)
+
+// parseRole parses who a subcommand is limited to, which is admins,
+// everyone or a mentioned user group. An empty role is returned when the
+// value is not a role.
+func parseRole(value string) string {
+	switch strings.ToLower(value) {
+	case roleAdmins, roleEveryone:
+		return strings.ToLower(value)
+	}
+	if m := userGroupRE.FindStringSubmatch(value); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// permitted returns whether the user may run a subcommand limited to the
+// role. Workspace admins and owners may run every subcommand so they cannot
+// lock themselves out.
+func permitted(token, userID, role string) (bool, error) {
+	if role == "" || role == roleEveryone {
+		return true, nil
+	}
+	admin, err := isWorkspaceAdmin(token, userID)
+	if err != nil || admin || role == roleAdmins {
+		return admin, err
+	}
+	members, err := slack.New(token).GetUserGroupMembers(role)
+	if err != nil {
+		return false, err
+	}
+	for _, member := range members {
+		if member == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// permissionsSummary describes who the subcommands of a team are limited
+// to.
+func permissionsSummary(locale string, permissions map[string]string) string {
+	lines := []string{tr(locale, "permissions.usage")}
+	names := make([]string, 0, len(permissions))
+	for name := range permissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		role := permissions[name]
+		if role != roleAdmins {
+			role = "<!subteam^" + role + ">"
+		}
+		lines = append(lines, tr(locale, "permissions.current", name, role))
+	}
+	if len(names) == 0 {
+		lines = append(lines, tr(locale, "permissions.none"))
+	}
+	return strings.Join(lines, "\n")
+}
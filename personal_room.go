@@ -0,0 +1,138 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// KeyPersonalRoomTeamID is the dynamo key for the team of a personal
+	// room. This key is the partition key.
+	KeyPersonalRoomTeamID = "team-id"
+	// KeyPersonalRoomUserID is the dynamo key for the owner of a personal
+	// room. This key is the sort key.
+	KeyPersonalRoomUserID = "user-id"
+
+	errMissingPersonalRoom = "missing_personal_room"
+	errPersonalRoomExists  = "personal_room_exists"
+)
+
+// PersonalRoom is the stable room of a user.
+type PersonalRoom struct {
+	TeamID    string `dynamodbav:"team-id"`
+	UserID    string `dynamodbav:"user-id"`
+	RoomName  string `dynamodbav:"room"`
+	CreatedAt int64  `dynamodbav:"created-at"`
+}
+
+// PersonalRoomReadWriter provides an interface for reading and creating the
+// personal rooms of users.
+type PersonalRoomReadWriter interface {
+	Get(teamID, userID string) (*PersonalRoom, error)
+	Create(room *PersonalRoom) error
+}
+
+// newPersonalRoom creates the personal room of a user. The room is named
+// after the user id with a random suffix so the name cannot be guessed.
+func newPersonalRoom(teamID, userID string) *PersonalRoom {
+	return &PersonalRoom{
+		TeamID:    teamID,
+		UserID:    userID,
+		RoomName:  uniqueRoomName(strings.ToLower(userID)),
+		CreatedAt: time.Now().Unix(),
+	}
+}
+
+// personalRoom retrieves the personal room of a user, creating it on first
+// use.
+func personalRoom(rooms PersonalRoomReadWriter, teamID, userID string) (*PersonalRoom, error) {
+	room, err := rooms.Get(teamID, userID)
+	if err == nil || err.Error() != errMissingPersonalRoom {
+		return room, err
+	}
+	room = newPersonalRoom(teamID, userID)
+	err = rooms.Create(room)
+	if err != nil && err.Error() == errPersonalRoomExists {
+		// another request created the room first
+		return rooms.Get(teamID, userID)
+	}
+	return room, err
+}
+
+// personalRoomMsg gives a user the link to their personal room.
+func personalRoomMsg(locale string, meeting *Meeting, joinURL string, style messageStyle) *slack.Msg {
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Attachments: []slack.Attachment{
+			joinAttachment(locale, tr(locale, "me.text", meeting.URL), style.color(), joinURL),
+		},
+	}
+}
+
+// PersonalRoomStore stores and retrieves personal rooms from aws dynamodb.
+type PersonalRoomStore struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+// Get retrieves the personal room of a user.
+func (p *PersonalRoomStore) Get(teamID, userID string) (*PersonalRoom, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyPersonalRoomTeamID: teamID,
+		KeyPersonalRoomUserID: userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := p.DB.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(p.TableName),
+		Key:       key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, errors.New(errMissingPersonalRoom)
+	}
+
+	var room PersonalRoom
+	err = attributevalue.UnmarshalMap(result.Item, &room)
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// Create persists a new personal room. The room of a user is never
+// replaced so links to it keep working.
+func (p *PersonalRoomStore) Create(room *PersonalRoom) error {
+	av, err := attributevalue.MarshalMap(room)
+	if err != nil {
+		return err
+	}
+	cond := expression.AttributeNotExists(expression.Name(KeyPersonalRoomUserID))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+	_, err = p.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:                aws.String(p.TableName),
+		Item:                     av,
+		ConditionExpression:      expr.Condition(),
+		ExpressionAttributeNames: expr.Names(),
+	})
+	var exists *types.ConditionalCheckFailedException
+	if errors.As(err, &exists) {
+		return errors.New(errPersonalRoomExists)
+	}
+	return err
+}
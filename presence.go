@@ -0,0 +1,44 @@
+package jitsi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+const presenceAway = "away"
+
+// flagActiveOnly is the flag used to skip invites to away users.
+const flagActiveOnly = "active-only"
+
+// presenceSummary creates the blocks telling a host whether the invitees
+// are active and which away invitees were not sent an invite.
+func presenceSummary(locale string, presence map[string]string, order []string, skipped []string) []slack.Block {
+	var blocks []slack.Block
+	var statuses []string
+	for _, userID := range order {
+		if p, ok := presence[userID]; ok {
+			statuses = append(statuses, tr(locale, "presence.status", userID, tr(locale, "presence."+p)))
+		}
+	}
+	if len(statuses) > 0 {
+		blocks = append(blocks, slack.NewContextBlock(
+			"",
+			slack.NewTextBlockObject(slack.MarkdownType, strings.Join(statuses, " • "), false, false),
+		))
+	}
+	if len(skipped) > 0 {
+		var mentions []string
+		for _, userID := range skipped {
+			mentions = append(mentions, fmt.Sprintf("<@%s>", userID))
+		}
+		msg := tr(locale, "presence.skipped", strings.Join(mentions, ", "))
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, msg, false, false),
+			nil,
+			nil,
+		))
+	}
+	return blocks
+}
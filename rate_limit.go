@@ -0,0 +1,355 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// KeyRateLimitID is the dynamo key for the window of a rate limit. This
+	// key is the partition key.
+	KeyRateLimitID = "limit-id"
+	// KeyRateLimitExpiresAt is the dynamo key for when the window of a rate
+	// limit ends. It is meant to be the time to live attribute of the table.
+	KeyRateLimitExpiresAt = "expires-at"
+
+	keyRateLimitTaken = "taken"
+
+	// errExceedsRateLimit is returned when more units are taken than a
+	// limit allows in a window, so taking them can never succeed.
+	errExceedsRateLimit = "exceeds_rate_limit"
+)
+
+// RateLimit allows Count units per Window, e.g. 20 invites per minute. A
+// limit with a Count of zero is unlimited.
+type RateLimit struct {
+	Count  int
+	Window time.Duration
+}
+
+// unlimited returns whether the limit allows any number of units.
+func (l RateLimit) unlimited() bool {
+	return l.Count <= 0 || l.Window <= 0
+}
+
+// RateLimiter provides an interface for taking units from rate limits that
+// reset every window.
+type RateLimiter interface {
+	// Take takes n units of the limit of the key. It returns zero when the
+	// units were taken and how long until the limit resets otherwise. An
+	// errExceedsRateLimit error is returned when n is more than the limit
+	// allows in a window.
+	Take(key string, n int, limit RateLimit) (time.Duration, error)
+	// Return gives back n units taken from the limit of the key in the
+	// current window, e.g. when another limit rejected what they were taken
+	// for.
+	Return(key string, n int, limit RateLimit) error
+}
+
+// windowStart returns the start of the fixed window of the limit the time
+// falls in.
+func windowStart(t time.Time, window time.Duration) time.Time {
+	return t.Truncate(window)
+}
+
+// MemoryRateLimiter is a rate limiter that counts units in memory. The
+// limits are per instance of the service, see DynamoRateLimiter for limits
+// shared by every instance.
+type MemoryRateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+	swept   time.Time
+}
+
+// rateWindow is the units taken in a window.
+type rateWindow struct {
+	start time.Time
+	end   time.Time
+	taken int
+}
+
+// Take takes n units of the limit of the key.
+func (m *MemoryRateLimiter) Take(key string, n int, limit RateLimit) (time.Duration, error) {
+	if limit.unlimited() {
+		return 0, nil
+	}
+	if n > limit.Count {
+		return 0, errors.New(errExceedsRateLimit)
+	}
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+	if m.windows == nil {
+		m.windows = make(map[string]*rateWindow)
+	}
+	start := windowStart(now, limit.Window)
+	window, ok := m.windows[key]
+	if !ok || !window.start.Equal(start) {
+		window = &rateWindow{start: start, end: start.Add(limit.Window)}
+		m.windows[key] = window
+	}
+	if window.taken+n > limit.Count {
+		return window.end.Sub(now), nil
+	}
+	window.taken += n
+	return 0, nil
+}
+
+// Return gives back n units taken from the limit of the key.
+func (m *MemoryRateLimiter) Return(key string, n int, limit RateLimit) error {
+	if limit.unlimited() {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	window, ok := m.windows[key]
+	if !ok || !window.start.Equal(windowStart(time.Now(), limit.Window)) {
+		return nil
+	}
+	window.taken -= n
+	if window.taken < 0 {
+		window.taken = 0
+	}
+	return nil
+}
+
+// sweep forgets the windows that ended, at most once a minute.
+func (m *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for key, window := range m.windows {
+		if !now.Before(window.end) {
+			delete(m.windows, key)
+		}
+	}
+}
+
+// MeetingLimits limits how many meetings teams and users start and how many
+// invites they send, so that a single command cannot message large numbers
+// of users and get the app rate limited or flagged by slack.
+type MeetingLimits struct {
+	Limiter RateLimiter
+	// TeamMeetings and UserMeetings limit the meetings started by a team
+	// and by a user of a team.
+	TeamMeetings RateLimit
+	UserMeetings RateLimit
+	// TeamInvites and UserInvites limit the personal invites sent by a team
+	// and by a user of a team.
+	TeamInvites RateLimit
+	UserInvites RateLimit
+}
+
+// rateTake is the units a request takes from a limit.
+type rateTake struct {
+	key   string
+	n     int
+	limit RateLimit
+}
+
+// allow takes a meeting with the invites from the limits of the team and the
+// user. When the meeting may not be started, it returns how long until the
+// limit that was exceeded resets, or the count of the limit when the invites
+// exceed it, so they can never be sent at once. The limits of the user are
+// taken first, and the units taken before a limit is exceeded are given
+// back, so a throttled user retrying does not use up the limits of their
+// team. Limits that cannot be checked are not enforced.
+func (m *MeetingLimits) allow(log *zerolog.Logger, teamID, userID string, invites int) (retry time.Duration, most int, ok bool) {
+	if m == nil {
+		return 0, 0, true
+	}
+	takes := []rateTake{
+		{"meetings/" + teamID + "/" + userID, 1, m.UserMeetings},
+		{"invites/" + teamID + "/" + userID, invites, m.UserInvites},
+		{"meetings/" + teamID, 1, m.TeamMeetings},
+		{"invites/" + teamID, invites, m.TeamInvites},
+	}
+	var taken []rateTake
+	for _, take := range takes {
+		if take.n == 0 || take.limit.unlimited() {
+			continue
+		}
+		retry, err := m.Limiter.Take(take.key, take.n, take.limit)
+		if err != nil && err.Error() == errExceedsRateLimit {
+			log.Info().
+				Str("limit", take.key).
+				Int("units", take.n).
+				Int("count", take.limit.Count).
+				Msg("rate limit exceeded")
+			m.giveBack(log, taken)
+			return 0, take.limit.Count, false
+		}
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("limit", take.key).
+				Msg("checking rate limit")
+			continue
+		}
+		if retry > 0 {
+			log.Info().
+				Str("limit", take.key).
+				Int("units", take.n).
+				Dur("retry", retry).
+				Msg("rate limited")
+			m.giveBack(log, taken)
+			return retry, 0, false
+		}
+		taken = append(taken, take)
+	}
+	return 0, 0, true
+}
+
+// giveBack returns the units taken from the limits.
+func (m *MeetingLimits) giveBack(log *zerolog.Logger, taken []rateTake) {
+	for _, take := range taken {
+		err := m.Limiter.Return(take.key, take.n, take.limit)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("limit", take.key).
+				Msg("returning rate limit units")
+		}
+	}
+}
+
+// throttled responds to a slash command with a message asking the caller to
+// try again later when the meeting may not be started.
+func (m *MeetingLimits) throttled(w http.ResponseWriter, log *zerolog.Logger, locale, teamID, userID string, invites int) bool {
+	retry, most, ok := m.allow(log, teamID, userID, invites)
+	if ok {
+		return false
+	}
+	writeMsg(w, &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         limitedText(locale, retry, most),
+	})
+	return true
+}
+
+// limitedText explains why a meeting may not be started, see allow. Callers
+// inviting more users than a limit allows are told how many they may invite
+// rather than to try again.
+func limitedText(locale string, retry time.Duration, most int) string {
+	if most > 0 {
+		return tr(locale, "ratelimit.too_many", most)
+	}
+	return throttledText(locale, retry)
+}
+
+// throttledText asks the caller to try again once the limit resets.
+func throttledText(locale string, retry time.Duration) string {
+	if retry < time.Second {
+		retry = time.Second
+	}
+	return tr(locale, "ratelimit.throttled", retry.Round(time.Second).String())
+}
+
+// DynamoRateLimiter is a rate limiter that counts units in aws dynamodb, so
+// that the limits hold across the instances of the service. Every window of
+// a key is counted in its own item, which expires through the time to live
+// of the table once the window ended.
+type DynamoRateLimiter struct {
+	TableName string
+	DB        DynamoItemAPI
+	// Region is optional and counts the units taken in the region in items
+	// of their own. Concurrent takes in the regions of a global table would
+	// otherwise overwrite each other, as the last write of an item wins, so
+	// the limits hold for every region on its own.
+	Region string
+}
+
+// Take takes n units of the limit of the key. The units are only added when
+// the count stays within the limit, so concurrent takes never exceed it.
+func (d *DynamoRateLimiter) Take(key string, n int, limit RateLimit) (time.Duration, error) {
+	if limit.unlimited() {
+		return 0, nil
+	}
+	now := time.Now()
+	start := windowStart(now, limit.Window)
+	end := start.Add(limit.Window)
+	if n > limit.Count {
+		return 0, errors.New(errExceedsRateLimit)
+	}
+	if d.Region != "" {
+		key = d.Region + "/" + key
+	}
+	id, err := attributevalue.MarshalMap(map[string]string{
+		KeyRateLimitID: fmt.Sprintf("%s/%d", key, start.Unix()),
+	})
+	if err != nil {
+		return 0, err
+	}
+	cond := expression.AttributeNotExists(expression.Name(keyRateLimitTaken)).
+		Or(expression.Name(keyRateLimitTaken).LessThanEqual(expression.Value(limit.Count - n)))
+	update := expression.Add(expression.Name(keyRateLimitTaken), expression.Value(n)).
+		Set(expression.Name(KeyRateLimitExpiresAt), expression.Value(end.Unix()))
+	expr, err := expression.NewBuilder().WithCondition(cond).WithUpdate(update).Build()
+	if err != nil {
+		return 0, err
+	}
+	_, err = d.DB.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(d.TableName),
+		Key:                       id,
+		ConditionExpression:       expr.Condition(),
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	var exceeded *types.ConditionalCheckFailedException
+	if errors.As(err, &exceeded) {
+		return end.Sub(now), nil
+	}
+	return 0, err
+}
+
+// Return gives back n units taken from the limit of the key. The count never
+// goes below zero, e.g. when the window ended since the units were taken.
+func (d *DynamoRateLimiter) Return(key string, n int, limit RateLimit) error {
+	if limit.unlimited() {
+		return nil
+	}
+	start := windowStart(time.Now(), limit.Window)
+	if d.Region != "" {
+		key = d.Region + "/" + key
+	}
+	id, err := attributevalue.MarshalMap(map[string]string{
+		KeyRateLimitID: fmt.Sprintf("%s/%d", key, start.Unix()),
+	})
+	if err != nil {
+		return err
+	}
+	cond := expression.Name(keyRateLimitTaken).GreaterThanEqual(expression.Value(n))
+	update := expression.Add(expression.Name(keyRateLimitTaken), expression.Value(-n))
+	expr, err := expression.NewBuilder().WithCondition(cond).WithUpdate(update).Build()
+	if err != nil {
+		return err
+	}
+	_, err = d.DB.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(d.TableName),
+		Key:                       id,
+		ConditionExpression:       expr.Condition(),
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	var missing *types.ConditionalCheckFailedException
+	if errors.As(err, &missing) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,398 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog"
+)
+
+func TestMemoryRateLimiterTake(t *testing.T) {
+	limiter := &MemoryRateLimiter{}
+	limit := RateLimit{Count: 3, Window: time.Hour}
+	for n := 0; n < 3; n++ {
+		retry, err := limiter.Take("invites/T123", 1, limit)
+		if err != nil || retry != 0 {
+			t.Fatalf("take %d = %v, %v, want it taken", n, retry, err)
+		}
+	}
+	retry, err := limiter.Take("invites/T123", 1, limit)
+	if err != nil || retry <= 0 || retry > time.Hour {
+		t.Fatalf("take over the limit = %v, %v, want a retry within the window", retry, err)
+	}
+	if retry, _ := limiter.Take("invites/T456", 3, limit); retry != 0 {
+		t.Errorf("other key retry = %v, want it taken", retry)
+	}
+}
+
+func TestMemoryRateLimiterTakeMany(t *testing.T) {
+	limiter := &MemoryRateLimiter{}
+	limit := RateLimit{Count: 5, Window: time.Hour}
+	retry, err := limiter.Take("invites/T123", 6, limit)
+	if err == nil || err.Error() != errExceedsRateLimit || retry != 0 {
+		t.Fatalf("take over the count = %v, %v, want %s", retry, err, errExceedsRateLimit)
+	}
+	// a rejected take does not count
+	if retry, _ := limiter.Take("invites/T123", 5, limit); retry != 0 {
+		t.Fatalf("retry = %v, want the whole limit taken", retry)
+	}
+	if retry, _ := limiter.Take("invites/T123", 1, limit); retry == 0 {
+		t.Fatal("took a unit of an exhausted limit")
+	}
+}
+
+func TestMemoryRateLimiterUnlimited(t *testing.T) {
+	limiter := &MemoryRateLimiter{}
+	for _, limit := range []RateLimit{{}, {Count: 1}, {Window: time.Minute}} {
+		for n := 0; n < 10; n++ {
+			if retry, _ := limiter.Take("meetings/T123", 100, limit); retry != 0 {
+				t.Fatalf("limit %+v retry = %v, want unlimited", limit, retry)
+			}
+		}
+	}
+}
+
+func TestMemoryRateLimiterWindowResets(t *testing.T) {
+	limiter := &MemoryRateLimiter{}
+	limit := RateLimit{Count: 1, Window: 50 * time.Millisecond}
+	// start at the beginning of a window so both takes fall in it
+	time.Sleep(time.Until(windowStart(time.Now(), limit.Window).Add(limit.Window)))
+	if retry, _ := limiter.Take("meetings/T123", 1, limit); retry != 0 {
+		t.Fatalf("retry = %v, want it taken", retry)
+	}
+	retry, _ := limiter.Take("meetings/T123", 1, limit)
+	if retry == 0 {
+		t.Fatal("took a unit of an exhausted limit")
+	}
+	time.Sleep(retry)
+	if retry, _ := limiter.Take("meetings/T123", 1, limit); retry != 0 {
+		t.Errorf("retry after the window = %v, want it taken", retry)
+	}
+}
+
+func TestMemoryRateLimiterReturn(t *testing.T) {
+	limiter := &MemoryRateLimiter{}
+	limit := RateLimit{Count: 2, Window: time.Hour}
+	limiter.Take("meetings/T123", 2, limit)
+	if err := limiter.Return("meetings/T123", 1, limit); err != nil {
+		t.Fatal(err)
+	}
+	if retry, _ := limiter.Take("meetings/T123", 1, limit); retry != 0 {
+		t.Fatalf("retry = %v, want the returned unit taken", retry)
+	}
+	if retry, _ := limiter.Take("meetings/T123", 1, limit); retry == 0 {
+		t.Fatal("took a unit of an exhausted limit")
+	}
+	// returning more than was taken, or to a key never taken from, does not
+	// add units
+	limiter.Return("meetings/T123", 5, limit)
+	limiter.Return("meetings/T456", 1, limit)
+	if retry, _ := limiter.Take("meetings/T123", 2, limit); retry != 0 {
+		t.Fatalf("retry = %v, want the whole limit taken", retry)
+	}
+	if retry, _ := limiter.Take("meetings/T123", 1, limit); retry == 0 {
+		t.Fatal("took more units than the limit allows")
+	}
+}
+
+func TestMemoryRateLimiterConcurrent(t *testing.T) {
+	limiter := &MemoryRateLimiter{}
+	limit := RateLimit{Count: 50, Window: time.Hour}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for n := 0; n < 200; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if retry, _ := limiter.Take("invites/T123", 1, limit); retry == 0 {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != limit.Count {
+		t.Errorf("took %d units, want %d", taken, limit.Count)
+	}
+}
+
+// failingRateLimiter fails every take.
+type failingRateLimiter struct{}
+
+func (failingRateLimiter) Take(key string, n int, limit RateLimit) (time.Duration, error) {
+	return 0, errors.New("unavailable")
+}
+
+func (failingRateLimiter) Return(key string, n int, limit RateLimit) error {
+	return errors.New("unavailable")
+}
+
+func TestMeetingLimitsAllow(t *testing.T) {
+	log := zerolog.Nop()
+	limits := &MeetingLimits{
+		Limiter:      &MemoryRateLimiter{},
+		TeamMeetings: RateLimit{Count: 3, Window: time.Hour},
+		UserMeetings: RateLimit{Count: 2, Window: time.Hour},
+		TeamInvites:  RateLimit{Count: 10, Window: time.Hour},
+		UserInvites:  RateLimit{Count: 6, Window: time.Hour},
+	}
+	if _, _, ok := limits.allow(&log, "T123", "U1", 4); !ok {
+		t.Fatal("first meeting was limited")
+	}
+	// the user has 2 invites left
+	if retry, _, ok := limits.allow(&log, "T123", "U1", 3); ok || retry <= 0 {
+		t.Fatalf("allow = %v, %v, want the user invite limit exceeded", retry, ok)
+	}
+	if _, _, ok := limits.allow(&log, "T123", "U1", 2); !ok {
+		t.Fatal("meeting within the limits was limited")
+	}
+	if _, _, ok := limits.allow(&log, "T123", "U1", 0); ok {
+		t.Fatal("meeting over the user meeting limit was allowed")
+	}
+	// the team has 1 meeting and 4 invites left, which another user may use
+	if _, _, ok := limits.allow(&log, "T123", "U2", 5); ok {
+		t.Fatal("meeting over the team invite limit was allowed")
+	}
+	if _, _, ok := limits.allow(&log, "T123", "U2", 4); !ok {
+		t.Fatal("meeting within the team limits was limited")
+	}
+	if _, _, ok := limits.allow(&log, "T123", "U3", 0); ok {
+		t.Fatal("meeting over the team meeting limit was allowed")
+	}
+	if _, _, ok := limits.allow(&log, "T456", "U1", 6); !ok {
+		t.Fatal("meeting of another team was limited")
+	}
+}
+
+func TestMeetingLimitsThrottledUserKeepsTeamLimits(t *testing.T) {
+	log := zerolog.Nop()
+	limits := &MeetingLimits{
+		Limiter:      &MemoryRateLimiter{},
+		TeamMeetings: RateLimit{Count: 5, Window: time.Hour},
+		UserMeetings: RateLimit{Count: 1, Window: time.Hour},
+		TeamInvites:  RateLimit{Count: 5, Window: time.Hour},
+		UserInvites:  RateLimit{Count: 100, Window: time.Hour},
+	}
+	if _, _, ok := limits.allow(&log, "T123", "U1", 1); !ok {
+		t.Fatal("first meeting was limited")
+	}
+	for n := 0; n < 20; n++ {
+		if _, _, ok := limits.allow(&log, "T123", "U1", 1); ok {
+			t.Fatal("throttled user was allowed")
+		}
+		// the team invite limit rejects after the user limits were taken
+		if _, _, ok := limits.allow(&log, "T123", "U2", 5); ok {
+			t.Fatal("meeting over the team invite limit was allowed")
+		}
+	}
+	for _, userID := range []string{"U2", "U3", "U4", "U5"} {
+		if _, _, ok := limits.allow(&log, "T123", userID, 1); !ok {
+			t.Fatalf("%s was limited by the retries of others", userID)
+		}
+	}
+}
+
+func TestMeetingLimitsTooManyInvitees(t *testing.T) {
+	log := zerolog.Nop()
+	limits := &MeetingLimits{
+		Limiter:      &MemoryRateLimiter{},
+		UserMeetings: RateLimit{Count: 5, Window: time.Hour},
+		TeamInvites:  RateLimit{Count: 8, Window: time.Hour},
+		UserInvites:  RateLimit{Count: 10, Window: time.Hour},
+	}
+	for n := 0; n < 3; n++ {
+		retry, most, ok := limits.allow(&log, "T123", "U1", 9)
+		if ok || retry != 0 || most != 8 {
+			t.Fatalf("allow = %v, %d, %v, want the team invite count of 8", retry, most, ok)
+		}
+	}
+	// the rejected meetings gave back what they took from the user limits
+	if _, _, ok := limits.allow(&log, "T123", "U1", 8); !ok {
+		t.Fatal("meeting within the limits was limited")
+	}
+	if got := limitedText(DefaultLocale(), 0, 8); !strings.Contains(got, "max 8") {
+		t.Errorf("limitedText = %q, want it to mention max 8", got)
+	}
+	if got := limitedText(DefaultLocale(), time.Minute, 0); got != throttledText(DefaultLocale(), time.Minute) {
+		t.Errorf("limitedText = %q, want the throttled text", got)
+	}
+}
+
+func TestMeetingLimitsUnavailable(t *testing.T) {
+	log := zerolog.Nop()
+	limits := &MeetingLimits{
+		Limiter:      failingRateLimiter{},
+		TeamMeetings: RateLimit{Count: 1, Window: time.Hour},
+		UserInvites:  RateLimit{Count: 1, Window: time.Hour},
+	}
+	for n := 0; n < 3; n++ {
+		if _, _, ok := limits.allow(&log, "T123", "U1", 5); !ok {
+			t.Fatal("limits that cannot be checked were enforced")
+		}
+	}
+	var unset *MeetingLimits
+	if _, _, ok := unset.allow(&log, "T123", "U1", 5); !ok {
+		t.Fatal("meeting without limits was limited")
+	}
+}
+
+func TestThrottledText(t *testing.T) {
+	for retry, want := range map[time.Duration]string{
+		0:                       "1s",
+		400 * time.Millisecond:  "1s",
+		1600 * time.Millisecond: "2s",
+		90 * time.Second:        "1m30s",
+	} {
+		if got := throttledText(DefaultLocale(), retry); !strings.Contains(got, want) {
+			t.Errorf("throttledText(%v) = %q, want it to mention %s", retry, got, want)
+		}
+	}
+}
+
+var (
+	// counterAddRE and counterCondRE match the update and condition of the
+	// counted units in the requests of DynamoRateLimiter.
+	counterAddRE  = regexp.MustCompile(`ADD (#\w+) (:\w+)`)
+	counterCondRE = regexp.MustCompile(`(#\w+) (<=|>=) (:\w+)`)
+)
+
+// counterTable applies the conditional updates of DynamoRateLimiter to
+// counters in memory like dynamodb does, in place of a table.
+type counterTable struct {
+	DynamoItemAPI
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *counterTable) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	id := params.Key[KeyRateLimitID].(*types.AttributeValueMemberS).Value
+	number := func(placeholder string) int {
+		n, _ := strconv.Atoi(params.ExpressionAttributeValues[placeholder].(*types.AttributeValueMemberN).Value)
+		return n
+	}
+	count, exists := c.counts[id]
+	cond := aws.ToString(params.ConditionExpression)
+	m := counterCondRE.FindStringSubmatch(cond)
+	ok := m != nil && (m[2] == "<=" && count <= number(m[3]) || m[2] == ">=" && count >= number(m[3]))
+	if !ok && !(strings.Contains(cond, "attribute_not_exists") && !exists) {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	add := counterAddRE.FindStringSubmatch(aws.ToString(params.UpdateExpression))
+	c.counts[id] = count + number(add[2])
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// count returns the units counted for the key in the current window.
+func (c *counterTable) count(key string, window time.Duration) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[key+"/"+strconv.FormatInt(windowStart(time.Now(), window).Unix(), 10)]
+}
+
+func TestDynamoRateLimiterTake(t *testing.T) {
+	table := &counterTable{}
+	limiter := &DynamoRateLimiter{TableName: "rate-limits", DB: table}
+	limit := RateLimit{Count: 5, Window: time.Hour}
+	if retry, err := limiter.Take("invites/T123", 3, limit); err != nil || retry != 0 {
+		t.Fatalf("take = %v, %v, want it taken", retry, err)
+	}
+	retry, err := limiter.Take("invites/T123", 3, limit)
+	if err != nil || retry <= 0 || retry > time.Hour {
+		t.Fatalf("take over the limit = %v, %v, want a retry within the window", retry, err)
+	}
+	if retry, err := limiter.Take("invites/T123", 2, limit); err != nil || retry != 0 {
+		t.Fatalf("take of the rest = %v, %v, want it taken", retry, err)
+	}
+	if got := table.count("invites/T123", limit.Window); got != 5 {
+		t.Errorf("counted %d units, want 5", got)
+	}
+	retry, err = limiter.Take("invites/T456", 6, limit)
+	if err == nil || err.Error() != errExceedsRateLimit || retry != 0 {
+		t.Errorf("take over the count = %v, %v, want %s", retry, err, errExceedsRateLimit)
+	}
+	if got := table.count("invites/T456", limit.Window); got != 0 {
+		t.Errorf("counted %d units over the count, want 0", got)
+	}
+}
+
+func TestDynamoRateLimiterReturn(t *testing.T) {
+	table := &counterTable{}
+	limiter := &DynamoRateLimiter{TableName: "rate-limits", DB: table}
+	limit := RateLimit{Count: 2, Window: time.Hour}
+	limiter.Take("meetings/T123", 2, limit)
+	if err := limiter.Return("meetings/T123", 1, limit); err != nil {
+		t.Fatal(err)
+	}
+	if got := table.count("meetings/T123", limit.Window); got != 1 {
+		t.Fatalf("counted %d units, want 1", got)
+	}
+	// the count never goes below zero
+	if err := limiter.Return("meetings/T123", 5, limit); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Return("meetings/T456", 1, limit); err != nil {
+		t.Fatal(err)
+	}
+	if got := table.count("meetings/T123", limit.Window); got != 1 {
+		t.Errorf("counted %d units, want 1", got)
+	}
+}
+
+func TestDynamoRateLimiterRegion(t *testing.T) {
+	table := &counterTable{}
+	limit := RateLimit{Count: 1, Window: time.Hour}
+	east := &DynamoRateLimiter{TableName: "rate-limits", DB: table, Region: "us-east-1"}
+	west := &DynamoRateLimiter{TableName: "rate-limits", DB: table, Region: "us-west-2"}
+	if retry, _ := east.Take("meetings/T123", 1, limit); retry != 0 {
+		t.Fatalf("retry = %v, want it taken", retry)
+	}
+	if retry, _ := west.Take("meetings/T123", 1, limit); retry != 0 {
+		t.Fatalf("retry in another region = %v, want it taken", retry)
+	}
+	if retry, _ := east.Take("meetings/T123", 1, limit); retry == 0 {
+		t.Fatal("took a unit of an exhausted limit")
+	}
+	if got := table.count("us-east-1/meetings/T123", limit.Window); got != 1 {
+		t.Errorf("counted %d units in us-east-1, want 1", got)
+	}
+}
+
+func TestDynamoRateLimiterConcurrent(t *testing.T) {
+	limiter := &DynamoRateLimiter{TableName: "rate-limits", DB: &counterTable{}}
+	limit := RateLimit{Count: 20, Window: time.Hour}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for n := 0; n < 100; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if retry, err := limiter.Take("invites/T123", 1, limit); err == nil && retry == 0 {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != limit.Count {
+		t.Errorf("took %d units, want %d", taken, limit.Count)
+	}
+}
@@ -0,0 +1,111 @@
+package jitsi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/slack-go/slack"
+)
+
+// featureRecording is the meeting token feature allowing a participant to
+// record the meeting.
+const featureRecording = "recording"
+
+// RecordingEvent is sent once the recording of a room is available, e.g. by
+// the finalize script of jibri.
+type RecordingEvent struct {
+	RoomName string `json:"room_name"`
+	// URL is where the recording can be watched or downloaded.
+	URL string `json:"url"`
+}
+
+// RecordingHandler is used to post the links to finished recordings to the
+// channels their meetings were started from.
+type RecordingHandler struct {
+	// Secret is the bearer token recording events are authorized with.
+	Secret      string
+	Meetings    MeetingReadWriter
+	TokenReader TokenReader
+}
+
+// Handle handles recording events posted by the recorder.
+func (h *RecordingHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if !authorizedEvent(r, h.Secret) {
+		hlog.FromRequest(r).Warn().Msg("recording event unauthorized")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var event RecordingEvent
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		hlog.FromRequest(r).Warn().Err(err).Msg("malformed recording event")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if !validWebURL(event.URL) {
+		hlog.FromRequest(r).Warn().Msg("recording event without url")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	meeting, ok := meetingForEvent(w, r, h.Meetings, event.RoomName)
+	if !ok {
+		return
+	}
+	err = postToMeetingChannel(h.TokenReader, meeting, tr(meeting.Locale, "recording.ready", event.URL, meeting.URL, meeting.RoomName))
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("meeting_id", meeting.MeetingID).
+			Msg("posting recording")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// validWebURL returns whether the url is a web url users can open.
+func validWebURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// meetingForEvent finds the meeting of the room an event was sent for. The
+// response is written when there is none.
+func meetingForEvent(w http.ResponseWriter, r *http.Request, meetings MeetingReadWriter, roomName string) (*MeetingRecord, bool) {
+	meeting, err := meetings.ForRoom(roomWithoutTenant(roomName))
+	if err != nil {
+		switch err.Error() {
+		case errMissingMeeting:
+			// rooms that were not started from slack are not tracked
+			w.WriteHeader(http.StatusOK)
+		default:
+			hlog.FromRequest(r).Error().
+				Err(err).
+				Str("room", roomName).
+				Msg("finding meeting for room")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return meeting, true
+}
+
+// postToMeetingChannel posts a message about a meeting to the channel it was
+// started from, in the thread of its announcement when the app posted it.
+func postToMeetingChannel(tokens TokenReader, meeting *MeetingRecord, text string) error {
+	token, err := tokens.GetTokenForTeam(meeting.TeamID)
+	if err != nil {
+		return err
+	}
+	opts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if meeting.MessageTS != "" {
+		opts = append(opts, slack.MsgOptionTS(meeting.MessageTS))
+	}
+	_, _, err = slack.New(token.AccessToken).PostMessage(meeting.ChannelID, opts...)
+	return err
+}
@@ -0,0 +1,717 @@
+package jitsi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// StoreBackendRedis stores tokens and server configuration in redis.
+	StoreBackendRedis = "redis"
+
+	// DefaultRedisPrefix prefixes the keys of the redis stores when no prefix
+	// is configured, so the stores can share a redis database.
+	DefaultRedisPrefix = "jitsi-slack:"
+	// DefaultRedisCacheTTL is how long the stores are cached in redis when
+	// redis caches dynamodb and no time to live is configured.
+	DefaultRedisCacheTTL = 10 * time.Minute
+)
+
+// redisKeys builds the keys of the redis stores, e.g.
+// jitsi-slack:token:T123 for the token of a team, jitsi-slack:token:T123/U123
+// for the user token of a user, jitsi-slack:token-users:T123 for the users of
+// a team with a user token and jitsi-slack:server-cfg:T123 for the server
+// configuration of a team.
+type redisKeys string
+
+func (p redisKeys) prefix() string {
+	if p == "" {
+		return DefaultRedisPrefix
+	}
+	return string(p)
+}
+
+func (p redisKeys) token(id string) string {
+	return p.prefix() + "token:" + id
+}
+
+func (p redisKeys) tokenUsers(teamID string) string {
+	return p.prefix() + "token-users:" + teamID
+}
+
+func (p redisKeys) serverCfg(teamID string) string {
+	return p.prefix() + "server-cfg:" + teamID
+}
+
+// expire sets the time to live of the keys in a transaction when one is
+// configured.
+func expire(ctx context.Context, pipe redis.Pipeliner, ttl time.Duration, keys ...string) {
+	if ttl <= 0 {
+		return
+	}
+	for _, key := range keys {
+		pipe.Expire(ctx, key, ttl)
+	}
+}
+
+// RedisTokenStore stores and retrieves access tokens from redis. Tokens are
+// stored in hashes with the fields of the dynamodb token table.
+type RedisTokenStore struct {
+	Client redis.UniversalClient
+	// Prefix prefixes the keys of the store. DefaultRedisPrefix is used when
+	// it is empty.
+	Prefix string
+	// TTL is optional and expires tokens once they were not written for the
+	// duration, e.g. when redis caches another store.
+	TTL time.Duration
+	// Cipher is optional and encrypts the access tokens that are stored.
+	// Tokens stored before they were encrypted are still read.
+	Cipher TokenCipher
+}
+
+// encrypt replaces the access token of the fields with its ciphertext when
+// tokens are encrypted.
+func (r *RedisTokenStore) encrypt(id string, fields map[string]interface{}) error {
+	if r.Cipher == nil {
+		return nil
+	}
+	enc, err := r.Cipher.Encrypt(id, fields[KeyAccessToken].(string))
+	if err != nil {
+		return err
+	}
+	fields[KeyAccessToken] = enc.Ciphertext
+	fields[KeyTokenKeyID] = enc.KeyID
+	if len(enc.DataKey) > 0 {
+		fields[KeyTokenDataKey] = enc.DataKey
+	}
+	return nil
+}
+
+// decrypt returns the access token of the fields. Fields without a key id
+// were stored in plaintext.
+func (r *RedisTokenStore) decrypt(id string, fields map[string]string) (string, error) {
+	keyID, ok := fields[KeyTokenKeyID]
+	if !ok {
+		return fields[KeyAccessToken], nil
+	}
+	if r.Cipher == nil {
+		return "", errors.New(errMissingTokenCipher)
+	}
+	return r.Cipher.Decrypt(id, &EncryptedToken{
+		KeyID:      keyID,
+		DataKey:    []byte(fields[KeyTokenDataKey]),
+		Ciphertext: []byte(fields[KeyAccessToken]),
+	})
+}
+
+// GetTokenForTeam retrieves the access token stored with the provided team
+// id.
+func (r *RedisTokenStore) GetTokenForTeam(teamID string) (*TokenData, error) {
+	fields, err := r.Client.HGetAll(context.TODO(), redisKeys(r.Prefix).token(teamID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errors.New(errMissingAuthToken)
+	}
+	token, err := r.decrypt(teamID, fields)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenData{
+		TeamID:       teamID,
+		AccessToken:  token,
+		Scope:        fields["scope"],
+		BotUserID:    fields["bot-user-id"],
+		AppID:        fields["app-id"],
+		AuthedUserID: fields["authed-user-id"],
+		EnterpriseID: fields["enterprise-id"],
+	}, nil
+}
+
+// Store will store access token data, replacing the previous token of the
+// team. The users of the team with a user token stay known.
+func (r *RedisTokenStore) Store(data *TokenData) error {
+	fields := map[string]interface{}{KeyAccessToken: data.AccessToken}
+	for name, value := range map[string]string{
+		"scope":          data.Scope,
+		"bot-user-id":    data.BotUserID,
+		"app-id":         data.AppID,
+		"authed-user-id": data.AuthedUserID,
+		"enterprise-id":  data.EnterpriseID,
+	} {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	err := r.encrypt(data.TeamID, fields)
+	if err != nil {
+		return err
+	}
+	keys := redisKeys(r.Prefix)
+	ctx := context.TODO()
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys.token(data.TeamID))
+		pipe.HSet(ctx, keys.token(data.TeamID), fields)
+		expire(ctx, pipe, r.TTL, keys.token(data.TeamID), keys.tokenUsers(data.TeamID))
+		return nil
+	})
+	return err
+}
+
+// Remove will remove access token data for the team, including the user
+// tokens of its users.
+func (r *RedisTokenStore) Remove(teamID string) error {
+	keys := redisKeys(r.Prefix)
+	ctx := context.TODO()
+	userIDs, err := r.Client.SMembers(ctx, keys.tokenUsers(teamID)).Result()
+	if err != nil {
+		return err
+	}
+	remove := []string{keys.token(teamID), keys.tokenUsers(teamID)}
+	for _, userID := range userIDs {
+		remove = append(remove, keys.token(userTokenID(teamID, userID)))
+	}
+	return r.Client.Del(ctx, remove...).Err()
+}
+
+// GetTokenForUser retrieves the user token stored for the user of a team.
+func (r *RedisTokenStore) GetTokenForUser(teamID, userID string) (*UserTokenData, error) {
+	id := userTokenID(teamID, userID)
+	fields, err := r.Client.HGetAll(context.TODO(), redisKeys(r.Prefix).token(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errors.New(errMissingUserToken)
+	}
+	token, err := r.decrypt(id, fields)
+	if err != nil {
+		return nil, err
+	}
+	return &UserTokenData{
+		TeamID:      teamID,
+		UserID:      userID,
+		AccessToken: token,
+		Scope:       fields["scope"],
+	}, nil
+}
+
+// StoreUserToken will store the user token of a user. The token of the team
+// must be stored first.
+func (r *RedisTokenStore) StoreUserToken(data *UserTokenData) error {
+	keys := redisKeys(r.Prefix)
+	ctx := context.TODO()
+	installed, err := r.Client.Exists(ctx, keys.token(data.TeamID)).Result()
+	if err != nil {
+		return err
+	}
+	if installed == 0 {
+		return errors.New(errMissingAuthToken)
+	}
+
+	id := userTokenID(data.TeamID, data.UserID)
+	fields := map[string]interface{}{KeyAccessToken: data.AccessToken}
+	if data.Scope != "" {
+		fields["scope"] = data.Scope
+	}
+	err = r.encrypt(id, fields)
+	if err != nil {
+		return err
+	}
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, keys.tokenUsers(data.TeamID), data.UserID)
+		pipe.Del(ctx, keys.token(id))
+		pipe.HSet(ctx, keys.token(id), fields)
+		expire(ctx, pipe, r.TTL, keys.tokenUsers(data.TeamID), keys.token(id))
+		return nil
+	})
+	return err
+}
+
+// RemoveUserToken will remove the user token of a user.
+func (r *RedisTokenStore) RemoveUserToken(teamID, userID string) error {
+	keys := redisKeys(r.Prefix)
+	ctx := context.TODO()
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys.token(userTokenID(teamID, userID)))
+		pipe.SRem(ctx, keys.tokenUsers(teamID), userID)
+		return nil
+	})
+	return err
+}
+
+// RemoveTeam will remove the token of a team along with the user tokens of
+// its users.
+func (r *RedisTokenStore) RemoveTeam(teamID string) error {
+	return r.Remove(teamID)
+}
+
+// RemoveUser will remove the user token of a user.
+func (r *RedisTokenStore) RemoveUser(teamID, userID string) error {
+	return r.RemoveUserToken(teamID, userID)
+}
+
+// ExportTeam will export the install of a team. The token is not exported.
+func (r *RedisTokenStore) ExportTeam(teamID string) (interface{}, error) {
+	data, err := r.GetTokenForTeam(teamID)
+	if err != nil {
+		return nil, err
+	}
+	install := installAudit(data)
+	install["authed_user_id"] = data.AuthedUserID
+	return install, nil
+}
+
+// TeamIDs lists the teams with a stored token. The keys are scanned, so it
+// is only used by the admin api.
+func (r *RedisTokenStore) TeamIDs() ([]string, error) {
+	prefix := redisKeys(r.Prefix).token("")
+	keys, err := redisScan(context.TODO(), r.Client, prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	var teamIDs []string
+	for _, key := range keys {
+		// user tokens are keyed by team/user
+		if id := strings.TrimPrefix(key, prefix); !strings.Contains(id, "/") {
+			teamIDs = append(teamIDs, id)
+		}
+	}
+	return teamIDs, nil
+}
+
+// UserIDs lists the users of a team with a stored user token.
+func (r *RedisTokenStore) UserIDs(teamID string) ([]string, error) {
+	return r.Client.SMembers(context.TODO(), redisKeys(r.Prefix).tokenUsers(teamID)).Result()
+}
+
+// redisScan returns the keys matching the pattern, scanning every master of
+// a cluster.
+func redisScan(ctx context.Context, client redis.UniversalClient, match string) ([]string, error) {
+	scan := func(ctx context.Context, client redis.Cmdable, keys *[]string) error {
+		iter := client.Scan(ctx, 0, match, 0).Iterator()
+		for iter.Next(ctx) {
+			*keys = append(*keys, iter.Val())
+		}
+		return iter.Err()
+	}
+	var keys []string
+	cluster, ok := client.(*redis.ClusterClient)
+	if !ok {
+		err := scan(ctx, client, &keys)
+		return keys, err
+	}
+	var mu sync.Mutex
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		var masterKeys []string
+		err := scan(ctx, master, &masterKeys)
+		mu.Lock()
+		keys = append(keys, masterKeys...)
+		mu.Unlock()
+		return err
+	})
+	return keys, err
+}
+
+// RedisServerCfgStore stores the server configuration of teams in redis.
+// The configuration of a team is stored in a hash with the fields of the
+// dynamodb server configuration table, with lists and maps encoded as json.
+type RedisServerCfgStore struct {
+	Client redis.UniversalClient
+	// Prefix prefixes the keys of the store. DefaultRedisPrefix is used when
+	// it is empty.
+	Prefix string
+	// TTL is optional and expires the configuration of a team once it was
+	// not written for the duration, e.g. when redis caches another store.
+	TTL time.Duration
+	ServerDefaults
+}
+
+// Store will persist the server of a team.
+func (r *RedisServerCfgStore) Store(data *ServerCfgData) error {
+	return r.set(data.TeamID, map[string]interface{}{KeyServer: data.Server})
+}
+
+// Remove will remove the configured server for a team. That team will use
+// the default server while keeping its other settings.
+func (r *RedisServerCfgStore) Remove(teamID string) error {
+	return r.set(teamID, nil, KeyServer)
+}
+
+// SetWordlists will persist the words random room names of a team are
+// generated from.
+func (r *RedisServerCfgStore) SetWordlists(teamID string, words Wordlists) error {
+	b, err := json.Marshal(words)
+	if err != nil {
+		return err
+	}
+	return r.set(teamID, map[string]interface{}{KeyWordlists: b})
+}
+
+// SetJWTLifetime will persist the lifetime of the team's meeting tokens. A
+// zero lifetime restores the default.
+func (r *RedisServerCfgStore) SetJWTLifetime(teamID string, lifetime time.Duration) error {
+	if lifetime <= 0 {
+		return r.set(teamID, nil, KeyJWTLifetime)
+	}
+	return r.set(teamID, map[string]interface{}{KeyJWTLifetime: int64(lifetime.Seconds())})
+}
+
+// SetOpenServerChanges will persist whether everyone may change the server
+// of a team.
+func (r *RedisServerCfgStore) SetOpenServerChanges(teamID string, open bool) error {
+	return r.set(teamID, map[string]interface{}{KeyOpenServerChanges: strconv.FormatBool(open)})
+}
+
+// SetPermissions will persist who the subcommands of a team are limited to.
+func (r *RedisServerCfgStore) SetPermissions(teamID string, permissions map[string]string) error {
+	b, err := json.Marshal(permissions)
+	if err != nil {
+		return err
+	}
+	return r.set(teamID, map[string]interface{}{KeyPermissions: b})
+}
+
+// SetURLConfig will persist the conference config overrides of a team's
+// meeting links. No overrides restore the defaults of the server.
+func (r *RedisServerCfgStore) SetURLConfig(teamID string, overrides []string) error {
+	if len(overrides) == 0 {
+		return r.set(teamID, nil, KeyURLConfig)
+	}
+	b, err := json.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+	return r.set(teamID, map[string]interface{}{KeyURLConfig: b})
+}
+
+// SetRoomNaming will persist how rooms of a team are named.
+func (r *RedisServerCfgStore) SetRoomNaming(teamID, naming string) error {
+	return r.set(teamID, map[string]interface{}{KeyRoomNaming: naming})
+}
+
+// set changes and removes fields of the configuration of a team and records
+// when it was changed.
+func (r *RedisServerCfgStore) set(teamID string, fields map[string]interface{}, remove ...string) error {
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	fields[KeyServerCfgUpdatedAt] = time.Now().Unix()
+	key := redisKeys(r.Prefix).serverCfg(teamID)
+	ctx := context.TODO()
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(remove) > 0 {
+			pipe.HDel(ctx, key, remove...)
+		}
+		pipe.HSet(ctx, key, fields)
+		expire(ctx, pipe, r.TTL, key)
+		return nil
+	})
+	return err
+}
+
+// Get retrieves the server configuration for a team. This will provide
+// the default if no configuration is stored for the team.
+func (r *RedisServerCfgStore) Get(teamID string) (ServerCfg, error) {
+	cfg, _, err := r.lookup(teamID)
+	if err != nil {
+		return ServerCfg{}, err
+	}
+	return r.apply(cfg), nil
+}
+
+// lookup retrieves the stored configuration of a team and whether any is
+// stored.
+func (r *RedisServerCfgStore) lookup(teamID string) (ServerCfg, bool, error) {
+	fields, err := r.Client.HGetAll(context.TODO(), redisKeys(r.Prefix).serverCfg(teamID)).Result()
+	if err != nil || len(fields) == 0 {
+		return ServerCfg{}, false, err
+	}
+
+	cfg := ServerCfg{
+		Server:     fields[KeyServer],
+		RoomNaming: fields[KeyRoomNaming],
+	}
+	cfg.OpenServerChanges, _ = strconv.ParseBool(fields[KeyOpenServerChanges])
+	if lifetime, err := strconv.ParseInt(fields[KeyJWTLifetime], 10, 64); err == nil {
+		cfg.JWTLifetime = time.Duration(lifetime) * time.Second
+	}
+	if updatedAt, err := strconv.ParseInt(fields[KeyServerCfgUpdatedAt], 10, 64); err == nil && updatedAt > 0 {
+		cfg.UpdatedAt = time.Unix(updatedAt, 0)
+	}
+	for name, v := range map[string]interface{}{
+		KeyWordlists:   &cfg.Words,
+		KeyPermissions: &cfg.Permissions,
+		KeyURLConfig:   &cfg.URLConfig,
+	} {
+		if fields[name] == "" {
+			continue
+		}
+		err = json.Unmarshal([]byte(fields[name]), v)
+		if err != nil {
+			return ServerCfg{}, false, err
+		}
+	}
+	return cfg, true, nil
+}
+
+// put replaces the stored configuration of a team, e.g. with the
+// configuration of the store redis caches.
+func (r *RedisServerCfgStore) put(teamID string, cfg ServerCfg) error {
+	fields := map[string]interface{}{
+		KeyServer:            cfg.Server,
+		KeyOpenServerChanges: strconv.FormatBool(cfg.OpenServerChanges),
+	}
+	if cfg.RoomNaming != "" {
+		fields[KeyRoomNaming] = cfg.RoomNaming
+	}
+	if cfg.JWTLifetime > 0 {
+		fields[KeyJWTLifetime] = int64(cfg.JWTLifetime.Seconds())
+	}
+	if !cfg.UpdatedAt.IsZero() {
+		fields[KeyServerCfgUpdatedAt] = cfg.UpdatedAt.Unix()
+	}
+	for name, v := range map[string]interface{}{
+		KeyWordlists:   cfg.Words,
+		KeyPermissions: cfg.Permissions,
+		KeyURLConfig:   cfg.URLConfig,
+	} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fields[name] = b
+	}
+	key := redisKeys(r.Prefix).serverCfg(teamID)
+	ctx := context.TODO()
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, fields)
+		expire(ctx, pipe, r.TTL, key)
+		return nil
+	})
+	return err
+}
+
+// RemoveTeam will remove the server configuration of a team.
+func (r *RedisServerCfgStore) RemoveTeam(teamID string) error {
+	return r.Client.Del(context.TODO(), redisKeys(r.Prefix).serverCfg(teamID)).Err()
+}
+
+// ExportTeam will export the server configuration of a team.
+func (r *RedisServerCfgStore) ExportTeam(teamID string) (interface{}, error) {
+	return r.Get(teamID)
+}
+
+// RedisTokenCache caches the tokens of another store in redis, e.g. in
+// front of dynamodb. Tokens are read from redis first and written to the
+// store, which removes them from redis. Tokens are read from the store when
+// redis fails.
+type RedisTokenCache struct {
+	Cache  *RedisTokenStore
+	Tokens TokenReadWriter
+}
+
+// GetTokenForTeam retrieves the token of the team from the cache, or from
+// the store when it is not cached.
+func (c *RedisTokenCache) GetTokenForTeam(teamID string) (*TokenData, error) {
+	data, err := c.Cache.GetTokenForTeam(teamID)
+	if err == nil {
+		return data, nil
+	}
+	data, err = c.Tokens.GetTokenForTeam(teamID)
+	if err != nil {
+		return nil, err
+	}
+	c.Cache.Store(data)
+	return data, nil
+}
+
+// Store will store the token data in the store.
+func (c *RedisTokenCache) Store(data *TokenData) error {
+	err := c.Tokens.Store(data)
+	if err != nil {
+		return err
+	}
+	return c.Cache.Remove(data.TeamID)
+}
+
+// Remove will remove the token data of the team, including the user tokens
+// of its users.
+func (c *RedisTokenCache) Remove(teamID string) error {
+	err := c.Tokens.Remove(teamID)
+	if err != nil {
+		return err
+	}
+	return c.Cache.Remove(teamID)
+}
+
+// GetTokenForUser retrieves the user token of the user from the cache, or
+// from the store when it is not cached.
+func (c *RedisTokenCache) GetTokenForUser(teamID, userID string) (*UserTokenData, error) {
+	data, err := c.Cache.GetTokenForUser(teamID, userID)
+	if err == nil {
+		return data, nil
+	}
+	data, err = c.Tokens.GetTokenForUser(teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+	// user tokens are only cached along with the token of their team
+	c.Cache.StoreUserToken(data)
+	return data, nil
+}
+
+// StoreUserToken will store the user token of a user in the store.
+func (c *RedisTokenCache) StoreUserToken(data *UserTokenData) error {
+	err := c.Tokens.StoreUserToken(data)
+	if err != nil {
+		return err
+	}
+	return c.Cache.RemoveUserToken(data.TeamID, data.UserID)
+}
+
+// RemoveUserToken will remove the user token of a user.
+func (c *RedisTokenCache) RemoveUserToken(teamID, userID string) error {
+	err := c.Tokens.RemoveUserToken(teamID, userID)
+	if err != nil {
+		return err
+	}
+	return c.Cache.RemoveUserToken(teamID, userID)
+}
+
+// RemoveTeam will remove the token of a team along with the user tokens of
+// its users.
+func (c *RedisTokenCache) RemoveTeam(teamID string) error {
+	return c.Remove(teamID)
+}
+
+// RemoveUser will remove the user token of a user.
+func (c *RedisTokenCache) RemoveUser(teamID, userID string) error {
+	return c.RemoveUserToken(teamID, userID)
+}
+
+// ExportTeam will export the install of a team from the store.
+func (c *RedisTokenCache) ExportTeam(teamID string) (interface{}, error) {
+	if exporter, ok := c.Tokens.(TeamDataExporter); ok {
+		return exporter.ExportTeam(teamID)
+	}
+	return c.Cache.ExportTeam(teamID)
+}
+
+// TeamIDs lists the teams with a token in the store.
+func (c *RedisTokenCache) TeamIDs() ([]string, error) {
+	lister, ok := c.Tokens.(TokenLister)
+	if !ok {
+		return nil, errors.New(errUnlistableTokens)
+	}
+	return lister.TeamIDs()
+}
+
+// UserIDs lists the users of a team with a user token in the store.
+func (c *RedisTokenCache) UserIDs(teamID string) ([]string, error) {
+	lister, ok := c.Tokens.(TokenLister)
+	if !ok {
+		return nil, errors.New(errUnlistableTokens)
+	}
+	return lister.UserIDs(teamID)
+}
+
+// RedisServerCfgCache caches the server configuration of another store in
+// redis, e.g. in front of dynamodb. Changes are written to the store, which
+// removes the configuration from redis.
+type RedisServerCfgCache struct {
+	Cache        *RedisServerCfgStore
+	ServerConfig ServerConfigReadWriter
+}
+
+// Get retrieves the server configuration of the team from the cache, or from
+// the store when it is not cached.
+func (c *RedisServerCfgCache) Get(teamID string) (ServerCfg, error) {
+	cfg, ok, err := c.Cache.lookup(teamID)
+	if err == nil && ok {
+		return c.Cache.apply(cfg), nil
+	}
+	cfg, err = c.ServerConfig.Get(teamID)
+	if err != nil {
+		return ServerCfg{}, err
+	}
+	c.Cache.put(teamID, cfg)
+	return cfg, nil
+}
+
+// change applies a change to the store and removes the configuration of the
+// team from the cache.
+func (c *RedisServerCfgCache) change(teamID string, err error) error {
+	if err != nil {
+		return err
+	}
+	return c.Cache.RemoveTeam(teamID)
+}
+
+// Store will persist the server of a team.
+func (c *RedisServerCfgCache) Store(data *ServerCfgData) error {
+	return c.change(data.TeamID, c.ServerConfig.Store(data))
+}
+
+// Remove will remove the configured server for a team.
+func (c *RedisServerCfgCache) Remove(teamID string) error {
+	return c.change(teamID, c.ServerConfig.Remove(teamID))
+}
+
+// SetWordlists will persist the words random room names of a team are
+// generated from.
+func (c *RedisServerCfgCache) SetWordlists(teamID string, words Wordlists) error {
+	return c.change(teamID, c.ServerConfig.SetWordlists(teamID, words))
+}
+
+// SetJWTLifetime will persist the lifetime of the team's meeting tokens.
+func (c *RedisServerCfgCache) SetJWTLifetime(teamID string, lifetime time.Duration) error {
+	return c.change(teamID, c.ServerConfig.SetJWTLifetime(teamID, lifetime))
+}
+
+// SetOpenServerChanges will persist whether everyone may change the server
+// of a team.
+func (c *RedisServerCfgCache) SetOpenServerChanges(teamID string, open bool) error {
+	return c.change(teamID, c.ServerConfig.SetOpenServerChanges(teamID, open))
+}
+
+// SetPermissions will persist who the subcommands of a team are limited to.
+func (c *RedisServerCfgCache) SetPermissions(teamID string, permissions map[string]string) error {
+	return c.change(teamID, c.ServerConfig.SetPermissions(teamID, permissions))
+}
+
+// SetURLConfig will persist the conference config overrides of a team's
+// meeting links.
+func (c *RedisServerCfgCache) SetURLConfig(teamID string, overrides []string) error {
+	return c.change(teamID, c.ServerConfig.SetURLConfig(teamID, overrides))
+}
+
+// SetRoomNaming will persist how rooms of a team are named.
+func (c *RedisServerCfgCache) SetRoomNaming(teamID, naming string) error {
+	return c.change(teamID, c.ServerConfig.SetRoomNaming(teamID, naming))
+}
+
+// RemoveTeam will remove the server configuration of a team.
+func (c *RedisServerCfgCache) RemoveTeam(teamID string) error {
+	if remover, ok := c.ServerConfig.(TeamDataRemover); ok {
+		err := remover.RemoveTeam(teamID)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Cache.RemoveTeam(teamID)
+}
+
+// ExportTeam will export the server configuration of a team from the store.
+func (c *RedisServerCfgCache) ExportTeam(teamID string) (interface{}, error) {
+	return c.ServerConfig.Get(teamID)
+}
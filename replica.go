@@ -0,0 +1,114 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// replicaCheckInterval is how long the result of checking the replicas
+	// of the region is reused, so that frequent health checks do not
+	// describe the tables every time.
+	replicaCheckInterval = 30 * time.Second
+	// replicaCheckTimeout is how long describing the tables may take before
+	// the health check fails.
+	replicaCheckTimeout = 3 * time.Second
+
+	errReplicaUnavailable = "replica_unavailable"
+)
+
+// TableDescriber provides an interface for describing dynamodb tables.
+type TableDescriber interface {
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+}
+
+// ReplicaHealthCheck is a health check that verifies the replicas of the
+// tables in the region of the instance, so that a load balancer routing
+// between regions stops sending requests to a region whose replica is
+// unavailable. The tables are described in the region of the client.
+type ReplicaHealthCheck struct {
+	DB     TableDescriber
+	Region string
+	Tables []string
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// Handle responds with the result of the latest check of the replicas.
+func (c *ReplicaHealthCheck) Handle(w http.ResponseWriter, r *http.Request) {
+	err := c.Check()
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("region", c.Region).
+			Msg("replica health check failed")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "health check failed")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "health check passed")
+}
+
+// Check returns why a table is unavailable in the region, checking the
+// tables again once the latest check is older than the check interval.
+// Concurrent checks wait for the one describing the tables. The tables are
+// described apart from the health check request, so a load balancer giving
+// up on a request does not fail the checks of the request after it.
+func (c *ReplicaHealthCheck) Check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checked.IsZero() && time.Since(c.checked) < replicaCheckInterval {
+		return c.err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+	defer cancel()
+	err := c.check(ctx)
+	if errors.Is(err, context.Canceled) {
+		// a cancelled check says nothing about the replicas
+		return err
+	}
+	c.err = err
+	c.checked = time.Now()
+	return c.err
+}
+
+func (c *ReplicaHealthCheck) check(ctx context.Context) error {
+	for _, table := range c.Tables {
+		result, err := c.DB.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(table),
+		})
+		if err != nil {
+			return fmt.Errorf("describing %s: %w", table, err)
+		}
+		if !c.available(result.Table) {
+			return fmt.Errorf("%s: %s", errReplicaUnavailable, table)
+		}
+	}
+	return nil
+}
+
+// available returns whether the table serves requests in the region. Tables
+// being updated, e.g. while a replica is added in another region, still
+// serve requests.
+func (c *ReplicaHealthCheck) available(table *types.TableDescription) bool {
+	if table.TableStatus != types.TableStatusActive && table.TableStatus != types.TableStatusUpdating {
+		return false
+	}
+	replica := findReplica(table.Replicas, c.Region)
+	if replica == nil {
+		return true
+	}
+	return replica.ReplicaStatus == types.ReplicaStatusActive || replica.ReplicaStatus == types.ReplicaStatusUpdating
+}
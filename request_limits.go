@@ -0,0 +1,62 @@
+package jitsi
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// ContentTypeForm is the content type of slash commands and
+	// interactions.
+	ContentTypeForm = "application/x-www-form-urlencoded"
+	// ContentTypeJSON is the content type of event callbacks.
+	ContentTypeJSON = "application/json"
+)
+
+// LimitRequest is middleware that rejects bodies larger than maxBody and
+// bodies that are not one of the content types before a handler reads
+// them. A maxBody of zero rejects any body, e.g. for oauth callbacks.
+// Requests without a body, e.g. GET requests of the admin api, need no
+// content type.
+func LimitRequest(maxBody int64, contentTypes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBody {
+				hlog.FromRequest(r).Warn().
+					Int64("length", r.ContentLength).
+					Int64("limit", maxBody).
+					Msg("request body too large")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			if len(contentTypes) > 0 && r.ContentLength != 0 && !allowedContentType(r.Header.Get("Content-Type"), contentTypes) {
+				hlog.FromRequest(r).Warn().
+					Str("content_type", r.Header.Get("Content-Type")).
+					Msg("unexpected content type")
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			// bodies of unknown length are cut off at the limit
+			r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowedContentType returns whether the media type of a content type
+// header is one of the allowed types. Parameters such as the charset are
+// ignored.
+func allowedContentType(header string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+	for _, t := range allowed {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
@@ -1,13 +1,22 @@
 package jitsi
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
+	"net/http"
 	"strconv"
+	"sync"
 	"time"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -17,8 +26,37 @@ const (
 	RequestSignatureHeader = "X-Slack-Signature"
 	// SignatureVersion is the version of signature validation that is preformed.
 	SignatureVersion = "v0"
+
+	// secretPrimary, secretSecondary, secretApp and secretAppSecondary label
+	// the signing secret a request was signed with.
+	secretPrimary      = "primary"
+	secretSecondary    = "secondary"
+	secretApp          = "app"
+	secretAppSecondary = "app_secondary"
+
+	// DefaultMaxBodySize limits the size of slack request bodies when no
+	// limit is configured.
+	DefaultMaxBodySize = 1 << 20
+	// maxRequestAge is how far the timestamp of a signed request may be
+	// off, which is also how long requests are remembered to reject replays.
+	maxRequestAge = 5 * time.Minute
 )
 
+// signingSecretCounter is a counter for verified slack requests with the
+// signing secret that matched as label, so a rotation can be completed once
+// the old secret is no longer used.
+var signingSecretCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "slack_signing_secret_matches_total",
+		Help: "A counter for verified slack requests by signing secret.",
+	},
+	[]string{"secret"},
+)
+
+func init() {
+	prometheus.MustRegister(signingSecretCounter)
+}
+
 // ValidRequest returns a boolean indicating that a request is validated as originating
 // from Slack.
 func ValidRequest(slackSigningSecret, requestBody, timestamp, slackSignature string) bool {
@@ -28,7 +66,7 @@ func ValidRequest(slackSigningSecret, requestBody, timestamp, slackSignature str
 		return false
 	}
 	now := time.Now().Unix()
-	if math.Abs(float64(now)-float64(ts)) > 60*5 {
+	if math.Abs(float64(now)-float64(ts)) > maxRequestAge.Seconds() {
 		return false
 	}
 
@@ -46,5 +84,123 @@ func ValidRequest(slackSigningSecret, requestBody, timestamp, slackSignature str
 	)
 
 	// Compare our signature with Slack's.
-	return mySignature == slackSignature
+	return hmac.Equal([]byte(mySignature), []byte(slackSignature))
+}
+
+// RequestVerifier is middleware that verifies requests were signed by
+// slack before they reach a handler. Oversized bodies and replays of
+// requests that were already verified are rejected. Replays are remembered
+// in-process, so each instance of the service rejects them separately.
+type RequestVerifier struct {
+	// SigningSecret is read for every request so that a rotated secret takes
+	// effect right away.
+	SigningSecret *Secret
+	// SecondarySigningSecret is optional and is accepted next to the
+	// signing secret while it is rotated.
+	SecondarySigningSecret string
+	// Apps are optional and are the other slack apps served, whose requests
+	// are signed with their own signing secret.
+	Apps SlackApps
+	// MaxBodySize limits the size of request bodies. DefaultMaxBodySize is
+	// used when it is zero.
+	MaxBodySize int64
+
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+// Verify wraps a handler so it only serves verified requests. The body is
+// restored for the handler to read.
+func (v *RequestVerifier) Verify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts := r.Header.Get(RequestTimestampHeader)
+		sig := r.Header.Get(RequestSignatureHeader)
+		if ts == "" || sig == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		limit := v.MaxBodySize
+		if limit <= 0 {
+			limit = DefaultMaxBodySize
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+		r.Body.Close()
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("reading request body")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > limit {
+			hlog.FromRequest(r).Warn().
+				Int64("limit", limit).
+				Msg("request body too large")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if !v.signed(ts, sig, body) {
+			hlog.FromRequest(r).Warn().
+				Msg("request signature failed")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if v.replayed(ts, sig, time.Now()) {
+			hlog.FromRequest(r).Warn().
+				Msg("rejecting replayed request")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// signed returns whether the body was signed with a signing secret of the
+// primary app or of one of the apps. The secret that matched is counted.
+func (v *RequestVerifier) signed(ts, sig string, body []byte) bool {
+	valid := func(label, secret string) bool {
+		if secret == "" || !ValidRequest(secret, string(body), ts, sig) {
+			return false
+		}
+		signingSecretCounter.WithLabelValues(label).Inc()
+		return true
+	}
+	if valid(secretPrimary, v.SigningSecret.Value()) || valid(secretSecondary, v.SecondarySigningSecret) {
+		return true
+	}
+	for _, app := range v.Apps {
+		if valid(secretApp, app.SigningSecret) || valid(secretAppSecondary, app.SecondarySigningSecret) {
+			return true
+		}
+	}
+	return false
+}
+
+// replayed records a verified request and returns whether it was seen
+// before. Requests are forgotten once their timestamp is too old to verify.
+func (v *RequestVerifier) replayed(ts, sig string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen == nil {
+		v.seen = make(map[string]time.Time)
+	}
+	if now.Sub(v.pruned) > time.Minute {
+		for key, seen := range v.seen {
+			if now.Sub(seen) > 2*maxRequestAge {
+				delete(v.seen, key)
+			}
+		}
+		v.pruned = now
+	}
+	key := ts + ":" + sig
+	if _, ok := v.seen[key]; ok {
+		return true
+	}
+	v.seen[key] = now
+	return false
 }
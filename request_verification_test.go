@@ -0,0 +1,203 @@
+package jitsi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// signRequest creates a request signed with the secret at the time.
+func signRequest(secret, body string, at time.Time) *http.Request {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(SignatureVersion + ":" + ts + ":" + body))
+	r := httptest.NewRequest(http.MethodPost, "/slash/jitsi", strings.NewReader(body))
+	r.Header.Set(RequestTimestampHeader, ts)
+	r.Header.Set(RequestSignatureHeader, SignatureVersion+"="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+// verify serves the request through the verifier and returns the status and
+// the body the handler read, if it was reached.
+func verify(v *RequestVerifier, r *http.Request) (int, string) {
+	var served string
+	handler := v.Verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		served = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w.Code, served
+}
+
+func TestRequestVerifier(t *testing.T) {
+	body := "team_id=T123&user_id=U123&text=%40alice"
+	now := time.Now()
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		status  int
+	}{
+		{
+			name:    "signed request",
+			request: func() *http.Request { return signRequest(testSigningSecret, body, now) },
+			status:  http.StatusOK,
+		},
+		{
+			name:    "secondary secret",
+			request: func() *http.Request { return signRequest("rotated-secret", body, now) },
+			status:  http.StatusOK,
+		},
+		{
+			name:    "secret of another app",
+			request: func() *http.Request { return signRequest("app-secret", body, now) },
+			status:  http.StatusOK,
+		},
+		{
+			name:    "wrong secret",
+			request: func() *http.Request { return signRequest("wrong-secret", body, now) },
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name: "tampered body",
+			request: func() *http.Request {
+				r := signRequest(testSigningSecret, body, now)
+				r.Body = ioutil.NopCloser(strings.NewReader(body + "&is_admin=true"))
+				return r
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "missing signature",
+			request: func() *http.Request {
+				r := signRequest(testSigningSecret, body, now)
+				r.Header.Del(RequestSignatureHeader)
+				return r
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "missing timestamp",
+			request: func() *http.Request {
+				r := signRequest(testSigningSecret, body, now)
+				r.Header.Del(RequestTimestampHeader)
+				return r
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "malformed timestamp",
+			request: func() *http.Request {
+				r := signRequest(testSigningSecret, body, now)
+				r.Header.Set(RequestTimestampHeader, "yesterday")
+				return r
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:    "timestamp within the replay window",
+			request: func() *http.Request { return signRequest(testSigningSecret, body, now.Add(-maxRequestAge+time.Minute)) },
+			status:  http.StatusOK,
+		},
+		{
+			name:    "timestamp too old",
+			request: func() *http.Request { return signRequest(testSigningSecret, body, now.Add(-maxRequestAge-time.Minute)) },
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "timestamp in the future",
+			request: func() *http.Request { return signRequest(testSigningSecret, body, now.Add(maxRequestAge+time.Minute)) },
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "body at the limit",
+			request: func() *http.Request { return signRequest(testSigningSecret, strings.Repeat("a", 64), now) },
+			status:  http.StatusOK,
+		},
+		{
+			name:    "body over the limit",
+			request: func() *http.Request { return signRequest(testSigningSecret, strings.Repeat("a", 65), now) },
+			status:  http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := &RequestVerifier{
+				SigningSecret:          NewSecret(testSigningSecret),
+				SecondarySigningSecret: "rotated-secret",
+				Apps:                   SlackApps{{AppID: "A123", SigningSecret: "app-secret"}},
+				MaxBodySize:            64,
+			}
+			r := test.request()
+			want, _ := ioutil.ReadAll(r.Body)
+			r.Body = ioutil.NopCloser(strings.NewReader(string(want)))
+			status, served := verify(v, r)
+			if status != test.status {
+				t.Fatalf("status = %d, want %d", status, test.status)
+			}
+			if status == http.StatusOK && served != string(want) {
+				t.Errorf("handler read %q, want %q", served, want)
+			}
+		})
+	}
+}
+
+func TestRequestVerifierReplay(t *testing.T) {
+	v := &RequestVerifier{SigningSecret: NewSecret(testSigningSecret)}
+	at := time.Now()
+	if status, _ := verify(v, signRequest(testSigningSecret, "text=a", at)); status != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", status, http.StatusOK)
+	}
+	if status, _ := verify(v, signRequest(testSigningSecret, "text=a", at)); status != http.StatusUnauthorized {
+		t.Fatalf("replayed request status = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := verify(v, signRequest(testSigningSecret, "text=b", at)); status != http.StatusOK {
+		t.Fatalf("other request status = %d, want %d", status, http.StatusOK)
+	}
+	// a request that failed verification is not remembered
+	bad := signRequest(testSigningSecret, "text=c", at)
+	bad.Body = ioutil.NopCloser(strings.NewReader("text=d"))
+	verify(v, bad)
+	if status, _ := verify(v, signRequest(testSigningSecret, "text=c", at)); status != http.StatusOK {
+		t.Fatalf("request after failed verification status = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestRequestVerifierForgetsOldRequests(t *testing.T) {
+	v := &RequestVerifier{}
+	start := time.Now()
+	if v.replayed("1", "v0=a", start) {
+		t.Fatal("first request replayed")
+	}
+	if !v.replayed("1", "v0=a", start.Add(maxRequestAge)) {
+		t.Fatal("request within the window not replayed")
+	}
+	if v.replayed("1", "v0=a", start.Add(2*maxRequestAge+2*time.Minute)) {
+		t.Fatal("request was not forgotten after the window")
+	}
+	if len(v.seen) != 1 {
+		t.Errorf("remembered %d requests, want 1", len(v.seen))
+	}
+}
+
+func TestRequestVerifierRotatedSecret(t *testing.T) {
+	secret := NewSecret("old-secret")
+	v := &RequestVerifier{SigningSecret: secret}
+	secret.set("new-secret")
+	if status, _ := verify(v, signRequest("new-secret", "text=a", time.Now())); status != http.StatusOK {
+		t.Errorf("rotated secret status = %d, want %d", status, http.StatusOK)
+	}
+	if status, _ := verify(v, signRequest("old-secret", "text=b", time.Now())); status != http.StatusUnauthorized {
+		t.Errorf("old secret status = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,128 @@
+package jitsi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// responseURLLifetime is how long slack accepts updates through the
+// response url of a slash command.
+const responseURLLifetime = 30 * time.Minute
+
+// RoomEnder ends a meeting for all of its participants on the conference
+// server.
+type RoomEnder interface {
+	EndRoom(teamID, teamName string, meeting *MeetingRecord) error
+}
+
+// EndMeetingAPI ends meetings through the end meeting endpoint of a prosody
+// module such as mod_muc_end_meeting. Requests are authorized with a
+// meeting token for the room.
+type EndMeetingAPI struct {
+	// Server is the conference server providing the endpoint. Meetings on
+	// other servers end once their participants leave.
+	Server string
+	// Endpoint is the url of the end meeting endpoint.
+	// (e.g. https://meet.example.com/end-meeting)
+	Endpoint string
+	// MUCDomain is the domain of the conference rooms.
+	// (e.g. conference.meet.example.com)
+	MUCDomain             string
+	MeetingTokenGenerator MeetingTokenGenerator
+}
+
+// EndRoom ends the meeting if it is hosted on the server of the api.
+func (e *EndMeetingAPI) EndRoom(teamID, teamName string, meeting *MeetingRecord) error {
+	conference, ok := roomJID(e.Server, e.MUCDomain, meeting.URL, meeting.RoomName)
+	if !ok {
+		return nil
+	}
+	jwt, err := e.MeetingTokenGenerator.CreateJWT(JWTInput{
+		TenantID:   teamID,
+		TenantName: teamName,
+		RoomClaim:  meeting.RoomName,
+		UserID:     meeting.HostID,
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := e.Endpoint + "?" + url.Values{
+		"conference": {conference},
+	}.Encode()
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("end meeting: %s", resp.Status)
+	}
+	return nil
+}
+
+// roomJID returns the jid of the room of a meeting in the muc domain of the
+// server, and false when the meeting url is not on the server. Urls match
+// when their scheme and host are the same and the meeting is below the path
+// of the server. Rooms of tenant scoped urls, e.g.
+// https://meet.example.com/tenant/room, are prefixed with their tenant as in
+// [tenant]room@conference.meet.example.com.
+func roomJID(server, mucDomain, meetingURL, roomName string) (string, bool) {
+	srv, err := url.Parse(server)
+	if err != nil || srv.Host == "" {
+		return "", false
+	}
+	mtg, err := url.Parse(meetingURL)
+	if err != nil || mtg.User != nil ||
+		!strings.EqualFold(mtg.Scheme, srv.Scheme) ||
+		!strings.EqualFold(mtg.Host, srv.Host) {
+		return "", false
+	}
+	base := strings.TrimSuffix(srv.Path, "/") + "/"
+	if !strings.HasPrefix(mtg.Path, base) {
+		return "", false
+	}
+	room := strings.ToLower(roomName)
+	if i := strings.Index(mtg.Path[len(base):], "/"); i > 0 {
+		room = "[" + strings.ToLower(mtg.Path[len(base):len(base)+i]) + "]" + room
+	}
+	return room + "@" + mucDomain, true
+}
+
+// replaceOriginal replaces the response to a slash command with the message.
+// The message itself is left as it is.
+func replaceOriginal(responseURL string, msg *slack.Msg) error {
+	replaced := *msg
+	replaced.ReplaceOriginal = true
+	return postResponse(responseURL, &replaced)
+}
+
+// postResponse responds to a slash command or an interaction with the
+// message through its response url.
+func postResponse(responseURL string, msg *slack.Msg) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("post response: %s", resp.Status)
+	}
+	return nil
+}
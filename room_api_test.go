@@ -0,0 +1,106 @@
+package jitsi
+
+import "testing"
+
+func TestRoomJID(t *testing.T) {
+	const muc = "conference.meet.example.com"
+	tests := []struct {
+		name    string
+		server  string
+		url     string
+		room    string
+		want    string
+		matches bool
+	}{
+		{
+			name:    "room on the server",
+			server:  "https://meet.example.com",
+			url:     "https://meet.example.com/DesignSync",
+			room:    "DesignSync",
+			want:    "designsync@" + muc,
+			matches: true,
+		},
+		{
+			name:    "url config fragment",
+			server:  "https://meet.example.com",
+			url:     "https://meet.example.com/design#config.startWithAudioMuted=true",
+			room:    "design",
+			want:    "design@" + muc,
+			matches: true,
+		},
+		{
+			name:    "tenant scoped url",
+			server:  "https://meet.example.com",
+			url:     "https://meet.example.com/Acme/DesignSync",
+			room:    "DesignSync",
+			want:    "[acme]designsync@" + muc,
+			matches: true,
+		},
+		{
+			name:    "server with a path",
+			server:  "https://example.com/meet/",
+			url:     "https://example.com/meet/design",
+			room:    "design",
+			want:    "design@" + muc,
+			matches: true,
+		},
+		{
+			name:    "host case",
+			server:  "https://meet.example.com",
+			url:     "https://Meet.Example.com/design",
+			room:    "design",
+			want:    "design@" + muc,
+			matches: true,
+		},
+		{
+			name:   "other server",
+			server: "https://meet.example.com",
+			url:    "https://meet.jit.si/design",
+			room:   "design",
+		},
+		{
+			name:   "host with a suffix",
+			server: "https://meet.example.com",
+			url:    "https://meet.example.com.evil/design",
+			room:   "design",
+		},
+		{
+			name:   "server as user info",
+			server: "https://meet.example.com",
+			url:    "https://meet.example.com@attacker/design",
+			room:   "design",
+		},
+		{
+			name:   "other port",
+			server: "https://meet.example.com",
+			url:    "https://meet.example.com:8443/design",
+			room:   "design",
+		},
+		{
+			name:   "other scheme",
+			server: "https://meet.example.com",
+			url:    "http://meet.example.com/design",
+			room:   "design",
+		},
+		{
+			name:   "outside the path of the server",
+			server: "https://example.com/meet",
+			url:    "https://example.com/meeting/design",
+			room:   "design",
+		},
+		{
+			name:   "server without a host",
+			server: "meet.example.com",
+			url:    "https://meet.example.com/design",
+			room:   "design",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := roomJID(test.server, muc, test.url, test.room)
+			if ok != test.matches || got != test.want {
+				t.Errorf("roomJID = %q, %v, want %q, %v", got, ok, test.want, test.matches)
+			}
+		})
+	}
+}
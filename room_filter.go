@@ -0,0 +1,71 @@
+package jitsi
+
+import (
+	"strings"
+	"sync"
+)
+
+// maxRoomNameAttempts limits how often a blocked room name is regenerated.
+const maxRoomNameAttempts = 10
+
+// defaultRoomNameBlocklist are the built-in terms generated room names must
+// not contain. Terms are matched against the lower cased name so they may
+// span words, e.g. bridesbite.
+var defaultRoomNameBlocklist = []string{
+	"bitch", "cunt", "dick", "fuck", "naked", "nazi", "nude", "porn", "rape",
+	"sex", "shit",
+	"bridesbite", "bridesdevour", "priestsbite", "priestsdevour",
+	"peopleburn", "peopledevour", "siblingsburn", "studentsburn",
+	"teachersburn",
+}
+
+var roomNameBlocklist = struct {
+	mu    sync.RWMutex
+	terms []string
+}{terms: defaultRoomNameBlocklist}
+
+// ExtendRoomNameBlocklist adds terms that generated room names of every team
+// must not contain.
+func ExtendRoomNameBlocklist(terms []string) {
+	roomNameBlocklist.mu.Lock()
+	defer roomNameBlocklist.mu.Unlock()
+	for _, term := range terms {
+		term = strings.ToLower(strings.TrimSpace(term))
+		if term != "" {
+			roomNameBlocklist.terms = append(roomNameBlocklist.terms, term)
+		}
+	}
+}
+
+// blockedRoomName returns whether the room name contains a term of the
+// blocklist or of the team's blocked terms.
+func blockedRoomName(name string, teamTerms []string) bool {
+	name = strings.ToLower(name)
+	for _, term := range teamTerms {
+		if strings.Contains(name, strings.ToLower(term)) {
+			return true
+		}
+	}
+	roomNameBlocklist.mu.RLock()
+	defer roomNameBlocklist.mu.RUnlock()
+	for _, term := range roomNameBlocklist.terms {
+		if strings.Contains(name, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// filteredRoomName names a room with the namer, naming it again while the
+// name is blocked. The last name is used if every attempt is blocked, e.g.
+// for names derived from a channel that do not change.
+func filteredRoomName(namer RoomNamer, in RoomNameInput) string {
+	var name string
+	for i := 0; i < maxRoomNameAttempts; i++ {
+		name = namer.RoomName(in)
+		if !blockedRoomName(name, in.Words.Blocked) {
+			break
+		}
+	}
+	return name
+}
@@ -1,8 +1,35 @@
 package jitsi
 
 import (
+	"errors"
 	"math/rand"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
+)
+
+const (
+	// maxRoomNameLength limits the length of room names chosen by users.
+	maxRoomNameLength = 64
+	// roomSuffixLength is the length of the random suffix that keeps rooms
+	// chosen by users apart from rooms of other teams on shared servers.
+	roomSuffixLength = 6
+	roomSuffixChars  = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+	// maxWordlistLength and maxWordLength limit the custom words of a team.
+	maxWordlistLength = 500
+	maxWordLength     = 24
+
+	errInvalidRoomName = "invalid_room_name"
+	errInvalidWords    = "invalid_words"
+)
+
+var (
+	// roomNameInvalidRE matches the runs of characters that are replaced in
+	// room names chosen by users.
+	roomNameInvalidRE = regexp.MustCompile(`[^a-z0-9_]+`)
+	wordRE            = regexp.MustCompile(`^[\p{L}\p{N}]+$`)
 )
 
 func init() {
@@ -127,3 +154,117 @@ func RandomName() string {
 	)
 	return adj + noun + verb + adv
 }
+
+// Wordlists are the words of a team that random room names are generated
+// from. Empty lists use the built-in english words.
+type Wordlists struct {
+	Adjectives []string `dynamodbav:"adjectives,omitempty"`
+	Nouns      []string `dynamodbav:"nouns,omitempty"`
+	Verbs      []string `dynamodbav:"verbs,omitempty"`
+	Adverbs    []string `dynamodbav:"adverbs,omitempty"`
+	// Blocked are terms generated room names must not contain in addition
+	// to the blocklist of the deployment.
+	Blocked []string `dynamodbav:"blocked,omitempty"`
+}
+
+// list returns the list of a kind of words or nil when the kind is unknown.
+func (wl *Wordlists) list(kind string) *[]string {
+	switch kind {
+	case "adjectives":
+		return &wl.Adjectives
+	case "nouns":
+		return &wl.Nouns
+	case "verbs":
+		return &wl.Verbs
+	case "adverbs":
+		return &wl.Adverbs
+	case "blocked":
+		return &wl.Blocked
+	}
+	return nil
+}
+
+// RandomName generates a room name from the wordlists.
+func (wl Wordlists) RandomName() string {
+	pick := func(custom, builtin []string) string {
+		if len(custom) == 0 {
+			custom = builtin
+		}
+		return custom[rand.Intn(len(custom))]
+	}
+	return pick(wl.Adjectives, adjectives) +
+		pick(wl.Nouns, nouns) +
+		pick(wl.Verbs, verbs) +
+		pick(wl.Adverbs, adverbs)
+}
+
+// parseWords validates a comma or space separated list of words provided by
+// a team. Words are limited to letters and digits of any language so they
+// are safe to use in meeting urls.
+func parseWords(text string) ([]string, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(fields) == 0 || len(fields) > maxWordlistLength {
+		return nil, errors.New(errInvalidWords)
+	}
+	words := make([]string, 0, len(fields))
+	for _, word := range fields {
+		if len(word) > maxWordLength || !wordRE.MatchString(word) {
+			return nil, errors.New(errInvalidWords)
+		}
+		words = append(words, word)
+	}
+	return words, nil
+}
+
+// sanitizeRoomName turns a name chosen by a user into a room name that is
+// safe to use in a meeting url. Letters are lower cased since conference
+// servers do not distinguish case in room names.
+func sanitizeRoomName(name string) (string, error) {
+	name = roomNameInvalidRE.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.Trim(name, "-")
+	if len(name) > maxRoomNameLength {
+		name = strings.TrimRight(name[:maxRoomNameLength], "-")
+	}
+	if name == "" {
+		return "", errors.New(errInvalidRoomName)
+	}
+	return name, nil
+}
+
+// uniqueRoomName appends a random suffix to a room name so that teams on a
+// server without tenant scoped urls do not end up in each other's rooms.
+func uniqueRoomName(name string) string {
+	suffix := make([]byte, roomSuffixLength)
+	for i := range suffix {
+		suffix[i] = roomSuffixChars[rand.Intn(len(roomSuffixChars))]
+	}
+	return name + "-" + string(suffix)
+}
+
+// channelRoomName names a room after the channel and the date, e.g.
+// marketing-2024-05-02. Random words are used for channels without a usable
+// name.
+func channelRoomName(channelName string, t time.Time) string {
+	name, err := sanitizeRoomName(channelName)
+	if err != nil {
+		return RandomName()
+	}
+	return name + "-" + t.Format("2006-01-02")
+}
+
+// wordsSummary describes the words a team's random room names are generated
+// from.
+func wordsSummary(locale string, wl *Wordlists) string {
+	lines := []string{tr(locale, "words.usage")}
+	for _, kind := range []string{"adjectives", "nouns", "verbs", "adverbs", "blocked"} {
+		list := *wl.list(kind)
+		if len(list) == 0 {
+			lines = append(lines, tr(locale, "words.current", kind, tr(locale, "template.default")))
+			continue
+		}
+		lines = append(lines, tr(locale, "words.current", kind, strings.Join(list, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
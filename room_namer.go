@@ -0,0 +1,113 @@
+package jitsi
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	// RoomNamingUUID names rooms with random uuids.
+	RoomNamingUUID = "uuid"
+	// RoomNamingCode names rooms with short random codes. (e.g. abc-defg-hij)
+	RoomNamingCode = "code"
+	// RoomNamingTeam names rooms with random words prefixed by the team.
+	RoomNamingTeam = "team"
+)
+
+// RoomNameInput is the context a room of a new meeting is named in.
+type RoomNameInput struct {
+	TeamName    string
+	ChannelName string
+	Time        time.Time
+	// Words are the team's words for random names.
+	Words Wordlists
+}
+
+// RoomNamer names the rooms of new meetings.
+type RoomNamer interface {
+	RoomName(in RoomNameInput) string
+}
+
+// RoomNamerFunc adapts a function to a RoomNamer.
+type RoomNamerFunc func(in RoomNameInput) string
+
+// RoomName names a room with the function.
+func (f RoomNamerFunc) RoomName(in RoomNameInput) string {
+	return f(in)
+}
+
+// roomNamers are the built-in room naming strategies teams may choose from.
+var roomNamers = map[string]RoomNamer{
+	RoomNamingRandom: RoomNamerFunc(func(in RoomNameInput) string {
+		return in.Words.RandomName()
+	}),
+	RoomNamingChannel: RoomNamerFunc(func(in RoomNameInput) string {
+		return channelRoomName(in.ChannelName, in.Time)
+	}),
+	RoomNamingUUID: RoomNamerFunc(func(RoomNameInput) string {
+		return randomUUID()
+	}),
+	RoomNamingCode: RoomNamerFunc(func(RoomNameInput) string {
+		return randomCode(3, 4, 3)
+	}),
+	RoomNamingTeam: RoomNamerFunc(func(in RoomNameInput) string {
+		team, err := sanitizeRoomName(in.TeamName)
+		if err != nil {
+			return in.Words.RandomName()
+		}
+		return team + "-" + in.Words.RandomName()
+	}),
+}
+
+// roomNamerFor returns the room naming strategy of a team. Random words are
+// used when the team has not chosen a known strategy.
+func roomNamerFor(naming string) RoomNamer {
+	if namer, ok := roomNamers[naming]; ok {
+		return namer
+	}
+	return roomNamers[RoomNamingRandom]
+}
+
+// teamRoomPrefix derives a short prefix from the team id that keeps the
+// generated rooms of teams sharing a server apart without revealing the team.
+func teamRoomPrefix(teamID string) string {
+	sum := sha256.Sum256([]byte(teamID))
+	return hex.EncodeToString(sum[:4])
+}
+
+// randomUUID creates a random version 4 uuid.
+func randomUUID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		// fall back to random words rather than a predictable name
+		return RandomName()
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// randomCode creates groups of random lower case letters joined by dashes.
+func randomCode(groups ...int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	max := big.NewInt(int64(len(letters)))
+	parts := make([]string, 0, len(groups))
+	for _, size := range groups {
+		part := make([]byte, size)
+		for i := range part {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return RandomName()
+			}
+			part[i] = letters[n.Int64()]
+		}
+		parts = append(parts, string(part))
+	}
+	return strings.Join(parts, "-")
+}
@@ -0,0 +1,98 @@
+package jitsi
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// actionAcceptInvite and actionDeclineInvite are the action ids of the
+	// buttons invitees answer their invite with. The value of the buttons is
+	// the id of the meeting.
+	actionAcceptInvite  = "accept_invite"
+	actionDeclineInvite = "decline_invite"
+
+	// The responses of invitees offered to accept or decline their invite.
+	rsvpPending  = "pending"
+	rsvpAccepted = "accepted"
+	rsvpDeclined = "declined"
+
+	// blockRSVP is the block id of the summary of responses in the host's
+	// confirmation.
+	blockRSVP = "rsvp"
+
+	errMissingHostMessage = "missing_host_message"
+)
+
+// rsvpButtons creates the buttons invitees answer their invite with.
+func rsvpButtons(locale, meetingID string) []slack.BlockElement {
+	accept := slack.NewButtonBlockElement(
+		actionAcceptInvite,
+		meetingID,
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "rsvp.accept"), false, false),
+	)
+	decline := slack.NewButtonBlockElement(
+		actionDeclineInvite,
+		meetingID,
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "rsvp.decline"), false, false),
+	)
+	return []slack.BlockElement{accept, decline}
+}
+
+// rsvpCounts counts the responses to the invites of a meeting. Invites that
+// were sent without the rsvp buttons are not counted.
+func rsvpCounts(invites []*Invite) (accepted, declined, pending int) {
+	for _, invite := range invites {
+		switch invite.Response {
+		case rsvpAccepted:
+			accepted++
+		case rsvpDeclined:
+			declined++
+		case rsvpPending:
+			pending++
+		}
+	}
+	return accepted, declined, pending
+}
+
+// rsvpBlock summarizes the responses of the invitees for the host.
+func rsvpBlock(locale string, accepted, declined, pending int) slack.Block {
+	return slack.NewContextBlock(blockRSVP, slack.NewTextBlockObject(
+		slack.MarkdownType,
+		tr(locale, "rsvp.summary", accepted, declined, pending),
+		false,
+		false,
+	))
+}
+
+// withRSVPSummary replaces the summary of responses in the host's
+// confirmation, or adds it when there is none yet.
+func withRSVPSummary(msg *slack.Msg, summary slack.Block) {
+	for i, block := range msg.Blocks.BlockSet {
+		if b, ok := block.(*slack.ContextBlock); ok && b.BlockID == blockRSVP {
+			msg.Blocks.BlockSet[i] = summary
+			return
+		}
+	}
+	msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, summary)
+}
+
+// updateRSVPSummary replaces the host's confirmation of a meeting with one
+// showing the current responses of the invitees. The confirmation can only
+// be replaced while the response url of the command is valid.
+func updateRSVPSummary(meeting *MeetingRecord, invites []*Invite) error {
+	if meeting.HostMessage == "" || meeting.ResponseURL == "" || time.Since(time.Unix(meeting.CreatedAt, 0)) > responseURLLifetime {
+		return errors.New(errMissingHostMessage)
+	}
+	var msg slack.Msg
+	err := json.Unmarshal([]byte(meeting.HostMessage), &msg)
+	if err != nil {
+		return err
+	}
+	accepted, declined, pending := rsvpCounts(invites)
+	withRSVPSummary(&msg, rsvpBlock(meeting.Locale, accepted, declined, pending))
+	return replaceOriginal(meeting.ResponseURL, &msg)
+}
@@ -0,0 +1,52 @@
+package jitsi
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+)
+
+// scheduledMessage is a message about a scheduled meeting that is updated
+// once the meeting starts. The options create the message with its text.
+type scheduledMessage struct {
+	channel   string
+	timestamp string
+	locale    string
+	options   func(text string) []slack.MsgOption
+}
+
+// scheduledInviteMsgOptions creates the content of a personal invite to a
+// meeting that starts later. The start time is shown in the timezone of the
+// invitee.
+func scheduledInviteMsgOptions(invite *Invite, start string, style messageStyle) (string, []slack.MsgOption) {
+	msg := tr(invite.Locale, "schedule.invite", invite.HostID, start)
+	return msg, inviteMsgOptions(invite, msg, style)
+}
+
+// scheduledAnnouncementMsgOptions creates the content of the channel
+// announcement of a meeting that starts later.
+func scheduledAnnouncementMsgOptions(locale, text string, meeting *Meeting, style messageStyle) []slack.MsgOption {
+	return append(
+		style.postOptions(),
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionAttachments(slack.Attachment{
+			Color:    style.color(),
+			Fallback: text,
+			Blocks:   slack.Blocks{BlockSet: inviteBlocks(locale, text, meeting.ID, meeting.URL)},
+		}),
+	)
+}
+
+// startScheduled updates the messages of a scheduled meeting to say that it
+// is starting once it starts.
+func startScheduled(log *zerolog.Logger, token, meetingID string, messages []scheduledMessage) {
+	api := slack.New(token)
+	for _, msg := range messages {
+		_, _, _, err := api.UpdateMessage(msg.channel, msg.timestamp, msg.options(tr(msg.locale, "schedule.starting"))...)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("meeting_id", meetingID).
+				Msg("updating scheduled meeting message")
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package jitsi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// SchemeSecretsManager and SchemeSSM prefix references to secrets in aws
+	// secrets manager and ssm parameter store, e.g.
+	// secretsmanager:arn:aws:secretsmanager:[region]:[account]:secret:[name]
+	// or ssm:/jitsi-slack/signing-secret
+	SchemeSecretsManager = "secretsmanager"
+	SchemeSSM            = "ssm"
+
+	errEmptySecret       = "empty_secret"
+	errMissingSecretKey  = "missing_secret_key"
+	errUnsupportedSecret = "unsupported_secret"
+
+	// secretTimeout limits the time a secret is looked up for.
+	secretTimeout = 10 * time.Second
+)
+
+// Secret is a secret value that may change while the service runs, e.g.
+// when it is rotated in a secret source.
+type Secret struct {
+	mu    sync.RWMutex
+	value string
+}
+
+// NewSecret creates a secret with a fixed value.
+func NewSecret(value string) *Secret {
+	return &Secret{value: value}
+}
+
+// Value returns the current value of the secret. The value of a nil secret
+// is empty.
+func (s *Secret) Value() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value
+}
+
+// set replaces the value of the secret and returns whether it changed.
+func (s *Secret) set(value string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.value != value
+	s.value = value
+	return changed
+}
+
+// SecretSource provides an interface for looking up secrets by name, e.g.
+// the arn of a secret in aws secrets manager.
+type SecretSource interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// SecretsManagerSource looks up secrets in aws secrets manager by their
+// name or arn. Secrets named by arn are looked up in the region of the arn.
+// A key of a json secret is selected with a suffix, e.g.
+// [arn]#signing-secret
+type SecretsManagerSource struct {
+	Client *secretsmanager.Client
+}
+
+// GetSecret retrieves the current version of the secret.
+func (s *SecretsManagerSource) GetSecret(ctx context.Context, name string) (string, error) {
+	id, key := splitSecretKey(name)
+	resp, err := s.Client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	}, func(o *secretsmanager.Options) {
+		o.Region = secretRegion(id, o.Region)
+	})
+	if err != nil {
+		return "", err
+	}
+	value := string(resp.SecretBinary)
+	if resp.SecretString != nil {
+		value = *resp.SecretString
+	}
+	if key == "" {
+		return value, nil
+	}
+	return secretKey(value, key)
+}
+
+// SSMSource looks up parameters in aws ssm parameter store by their name or
+// arn. Parameters named by arn are looked up in the region of the arn and
+// secure strings are decrypted.
+type SSMSource struct {
+	Client *ssm.Client
+}
+
+// GetSecret retrieves the current value of the parameter.
+func (s *SSMSource) GetSecret(ctx context.Context, name string) (string, error) {
+	resp, err := s.Client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: true,
+	}, func(o *ssm.Options) {
+		o.Region = secretRegion(name, o.Region)
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Parameter == nil {
+		return "", errors.New(errEmptySecret)
+	}
+	return aws.ToString(resp.Parameter.Value), nil
+}
+
+// secretRegion returns the region of a secret named by arn, falling back to
+// the region of the client.
+func secretRegion(name, region string) string {
+	if a, err := arn.Parse(name); err == nil && a.Region != "" {
+		return a.Region
+	}
+	return region
+}
+
+// splitSecretKey splits the key of a json secret off the name of a secret.
+func splitSecretKey(name string) (string, string) {
+	if i := strings.LastIndex(name, "#"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// secretKey returns the value of the key of a json secret.
+func secretKey(secret, key string) (string, error) {
+	var values map[string]interface{}
+	err := json.Unmarshal([]byte(secret), &values)
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[key].(string)
+	if !ok {
+		return "", errors.New(errMissingSecretKey)
+	}
+	return value, nil
+}
+
+// SecretLoader resolves references to secrets in the configuration of the
+// service and refreshes the secrets so that rotated secrets take effect
+// without a restart.
+type SecretLoader struct {
+	// Sources are the secret sources by the scheme of the references they
+	// resolve, e.g. SchemeSSM for ssm:/jitsi-slack/signing-secret
+	Sources map[string]SecretSource
+	// Interval is how often secrets are refreshed. Secrets are only loaded
+	// once when it is zero.
+	Interval time.Duration
+	Log      zerolog.Logger
+
+	mu      sync.Mutex
+	loaded  map[string]*Secret
+	stop    chan struct{}
+	stopped bool
+}
+
+// Load resolves a configured value. References to secrets in a source are
+// looked up and refreshed once the loader is started, other values are
+// returned as fixed secrets.
+func (l *SecretLoader) Load(value string) (*Secret, error) {
+	if !l.reference(value) {
+		return NewSecret(value), nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if secret, ok := l.loaded[value]; ok {
+		return secret, nil
+	}
+	current, err := l.lookup(value)
+	if err != nil {
+		return nil, err
+	}
+	if l.loaded == nil {
+		l.loaded = make(map[string]*Secret)
+	}
+	secret := NewSecret(current)
+	l.loaded[value] = secret
+	return secret, nil
+}
+
+// Start refreshes the loaded secrets every interval until the loader is
+// stopped.
+func (l *SecretLoader) Start() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Interval <= 0 || l.stop != nil || l.stopped {
+		return
+	}
+	l.stop = make(chan struct{})
+	go l.run(l.stop)
+}
+
+// Stop stops refreshing secrets. Secrets keep their last value.
+func (l *SecretLoader) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	l.stopped = true
+}
+
+func (l *SecretLoader) run(stop chan struct{}) {
+	ticker := time.NewTicker(l.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			l.refresh()
+		}
+	}
+}
+
+// refresh looks up the loaded secrets again. Secrets that cannot be looked
+// up keep their value until the next refresh.
+func (l *SecretLoader) refresh() {
+	l.mu.Lock()
+	loaded := make(map[string]*Secret, len(l.loaded))
+	for ref, secret := range l.loaded {
+		loaded[ref] = secret
+	}
+	l.mu.Unlock()
+
+	for ref, secret := range loaded {
+		current, err := l.lookup(ref)
+		if err != nil {
+			l.Log.Warn().
+				Err(err).
+				Str("secret", ref).
+				Msg("refreshing secret")
+			continue
+		}
+		if secret.set(current) {
+			l.Log.Info().
+				Str("secret", ref).
+				Msg("secret rotated")
+		}
+	}
+}
+
+// reference returns whether the value refers to a secret in one of the
+// sources. Values are only references when their scheme is a source.
+func (l *SecretLoader) reference(value string) bool {
+	i := strings.Index(value, ":")
+	if i <= 0 {
+		return false
+	}
+	_, ok := l.Sources[value[:i]]
+	return ok
+}
+
+// lookup retrieves the current value of the referenced secret.
+func (l *SecretLoader) lookup(ref string) (string, error) {
+	i := strings.Index(ref, ":")
+	source, ok := l.Sources[ref[:i]]
+	if !ok {
+		return "", errors.New(errUnsupportedSecret)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	value, err := source.GetSecret(ctx, ref[i+1:])
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", errors.New(errEmptySecret)
+	}
+	return value, nil
+}
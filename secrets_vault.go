@@ -0,0 +1,302 @@
+package jitsi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// SchemeVault prefixes references to secrets in hashicorp vault, e.g.
+	// vault:secret/data/jitsi-slack#signing-secret
+	SchemeVault = "vault"
+
+	errExpiredVaultToken = "expired_vault_token"
+
+	// vaultRetryDelay is how long a failed token renewal waits before it is
+	// tried again.
+	vaultRetryDelay = 30 * time.Second
+	// minLeaseRemaining is the lifetime a secret lease must have left to be
+	// renewed instead of reading the secret again.
+	minLeaseRemaining = 10 * time.Second
+)
+
+// VaultSource looks up secrets in hashicorp vault by their api path. The
+// key of the secret is selected with a suffix, e.g. secret/data/app#key for
+// a kv version 2 engine mounted at secret. Secrets with a renewable lease
+// have their lease renewed rather than being read again.
+type VaultSource struct {
+	// Address is the url of the vault server, e.g. https://vault:8200
+	Address string
+	// Token is the vault token secrets are read with. It is renewed before
+	// it expires when it is renewable.
+	Token string
+	// Namespace is optional and is the vault enterprise namespace of the
+	// secrets.
+	Namespace string
+	// Client is optional and is the http client requests are sent with.
+	Client *http.Client
+	Log    zerolog.Logger
+
+	mu     sync.Mutex
+	leases map[string]*vaultLease
+	stop   chan struct{}
+}
+
+// vaultLease is a secret read from vault along with its lease.
+type vaultLease struct {
+	id        string
+	renewable bool
+	expires   time.Time
+	data      map[string]interface{}
+}
+
+// vaultSecret is the response to reading a secret or renewing a lease.
+type vaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	Renewable     bool                   `json:"renewable"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *vaultAuth             `json:"auth"`
+}
+
+// vaultAuth is the token lease of a renewed token.
+type vaultAuth struct {
+	Renewable     bool `json:"renewable"`
+	LeaseDuration int  `json:"lease_duration"`
+}
+
+// vaultToken is the response to looking up the token.
+type vaultToken struct {
+	Data struct {
+		TTL       int  `json:"ttl"`
+		Renewable bool `json:"renewable"`
+	} `json:"data"`
+}
+
+// Validate checks that vault is reachable and the token is valid. It
+// returns the remaining lifetime of the token, which is zero for tokens
+// that do not expire.
+func (v *VaultSource) Validate(ctx context.Context) (time.Duration, error) {
+	var tok vaultToken
+	err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", nil, &tok)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(tok.Data.TTL) * time.Second, nil
+}
+
+// Start renews the token before it expires until the source is stopped.
+// Tokens that do not expire or cannot be renewed are left alone.
+func (v *VaultSource) Start() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.stop != nil {
+		return
+	}
+	v.stop = make(chan struct{})
+	go v.renewToken(v.stop)
+}
+
+// Stop stops renewing the token.
+func (v *VaultSource) Stop() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.stop != nil {
+		close(v.stop)
+		v.stop = nil
+	}
+}
+
+// renewToken renews the token once half of its lifetime has passed.
+func (v *VaultSource) renewToken(stop chan struct{}) {
+	var tok vaultToken
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", nil, &tok)
+	cancel()
+	if err != nil {
+		v.Log.Warn().
+			Err(err).
+			Msg("looking up vault token")
+		return
+	}
+	if !tok.Data.Renewable || tok.Data.TTL <= 0 {
+		return
+	}
+	ttl := time.Duration(tok.Data.TTL) * time.Second
+	expires := time.Now().Add(ttl)
+	wait := ttl / 2
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+
+		var renewed vaultSecret
+		ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+		err := v.do(ctx, http.MethodPost, "auth/token/renew-self", nil, &renewed)
+		cancel()
+		if err != nil || renewed.Auth == nil {
+			remaining := time.Until(expires)
+			v.Log.Warn().
+				Err(err).
+				Dur("remaining", remaining).
+				Msg("renewing vault token")
+			if remaining <= 0 {
+				v.Log.Error().
+					Err(errors.New(errExpiredVaultToken)).
+					Msg("renewing vault token")
+				return
+			}
+			wait = vaultRetryDelay
+			if remaining/2 < wait {
+				wait = remaining / 2
+			}
+			continue
+		}
+		if !renewed.Auth.Renewable || renewed.Auth.LeaseDuration <= 0 {
+			return
+		}
+		ttl = time.Duration(renewed.Auth.LeaseDuration) * time.Second
+		expires = time.Now().Add(ttl)
+		wait = ttl / 2
+	}
+}
+
+// GetSecret retrieves the value of the key of the secret at the path.
+func (v *VaultSource) GetSecret(ctx context.Context, name string) (string, error) {
+	path, key := splitSecretKey(name)
+	if key == "" {
+		return "", errors.New(errMissingSecretKey)
+	}
+	lease, err := v.lease(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	data := lease.data
+	// kv version 2 engines nest the secret in the data of the response
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+	value, ok := data[key].(string)
+	if !ok {
+		return "", errors.New(errMissingSecretKey)
+	}
+	return value, nil
+}
+
+// lease returns the secret at the path, renewing its lease when it has one
+// and reading it again otherwise.
+func (v *VaultSource) lease(ctx context.Context, path string) (*vaultLease, error) {
+	v.mu.Lock()
+	lease := v.leases[path]
+	v.mu.Unlock()
+
+	if lease != nil && lease.renewable && time.Until(lease.expires) > minLeaseRemaining {
+		var renewed vaultSecret
+		err := v.do(ctx, http.MethodPut, "sys/leases/renew", map[string]string{
+			"lease_id": lease.id,
+		}, &renewed)
+		if err == nil {
+			renewedLease := &vaultLease{
+				id:        lease.id,
+				renewable: renewed.Renewable,
+				expires:   time.Now().Add(time.Duration(renewed.LeaseDuration) * time.Second),
+				data:      lease.data,
+			}
+			v.storeLease(path, renewedLease)
+			return renewedLease, nil
+		}
+		v.Log.Warn().
+			Err(err).
+			Str("path", path).
+			Msg("renewing vault lease")
+	}
+
+	var secret vaultSecret
+	err := v.do(ctx, http.MethodGet, path, nil, &secret)
+	if err != nil {
+		return nil, err
+	}
+	if secret.Data == nil {
+		return nil, errors.New(errEmptySecret)
+	}
+	lease = &vaultLease{
+		id:        secret.LeaseID,
+		renewable: secret.Renewable && secret.LeaseID != "",
+		expires:   time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second),
+		data:      secret.Data,
+	}
+	v.storeLease(path, lease)
+	return lease, nil
+}
+
+func (v *VaultSource) storeLease(path string, lease *vaultLease) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.leases == nil {
+		v.leases = make(map[string]*vaultLease)
+	}
+	v.leases[path] = lease
+}
+
+// do sends a request to the vault api and decodes the response into out.
+func (v *VaultSource) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		err := json.NewEncoder(&body).Encode(in)
+		if err != nil {
+			return err
+		}
+	}
+	endpoint := strings.TrimSuffix(v.Address, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	req.Header.Set("X-Vault-Request", "true")
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(respBody, &failure)
+		if len(failure.Errors) == 0 {
+			return fmt.Errorf("vault %s %s: %s", method, path, resp.Status)
+		}
+		return fmt.Errorf("vault %s %s: %s: %s", method, path, resp.Status, strings.Join(failure.Errors, "; "))
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -2,6 +2,8 @@ package jitsi
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -15,6 +17,31 @@ const (
 	KeyTeamIDSrvCfg = "team-id"
 	// KeyServer is the dynamo key for storing the configured server.
 	KeyServer = "server-url"
+	// KeyRoomNaming is the dynamo key for storing how rooms are named.
+	KeyRoomNaming = "room-naming"
+	// KeyWordlists is the dynamo key for storing the team's words for room
+	// names.
+	KeyWordlists = "wordlists"
+	// KeyJWTLifetime is the dynamo key for storing the lifetime of meeting
+	// tokens in seconds.
+	KeyJWTLifetime = "jwt-lifetime"
+	// KeyServerCfgUpdatedAt is the dynamo key for storing when the server
+	// configuration of a team was last changed.
+	KeyServerCfgUpdatedAt = "updated-at"
+	// KeyOpenServerChanges is the dynamo key for storing whether everyone
+	// may change the server of a team.
+	KeyOpenServerChanges = "open-server-changes"
+	// KeyPermissions is the dynamo key for storing who the subcommands of a
+	// team are limited to.
+	KeyPermissions = "permissions"
+	// KeyURLConfig is the dynamo key for storing the conference config
+	// overrides of a team's meeting links.
+	KeyURLConfig = "url-config"
+
+	// RoomNamingRandom names rooms with random words. It is the default.
+	RoomNamingRandom = "random"
+	// RoomNamingChannel names rooms after the channel and the date.
+	RoomNamingChannel = "channel"
 )
 
 // ServerCfg is the server configuration for a team.
@@ -28,6 +55,29 @@ type ServerCfg struct {
 	// AuthenticatedURLSupport indicates whether or not authenticated urls
 	// are supported.
 	AuthenticatedURLSupport bool
+	// TeamRoomPrefix indicates whether generated rooms on servers without
+	// tenant scoped urls are prefixed with a hash of the team id.
+	TeamRoomPrefix bool
+	// RoomNaming is the strategy rooms are named with.
+	// (e.g. random, channel, uuid, code or team)
+	RoomNaming string
+	// Words are the team's words for random room names.
+	Words Wordlists
+	// JWTLifetime is the lifetime of the team's meeting tokens. The lifetime
+	// of the token generator is used when it is zero.
+	JWTLifetime time.Duration
+	// OpenServerChanges indicates whether everyone may change the server of
+	// the team instead of only workspace admins.
+	OpenServerChanges bool
+	// Permissions are who subcommands are limited to by subcommand, either
+	// admins or the id of a slack user group.
+	Permissions map[string]string
+	// URLConfig are the conference config overrides added to the url
+	// fragment of the team's meeting links, e.g. config.p2p.enabled=false
+	URLConfig []string
+	// UpdatedAt is when the configuration was last changed. It is zero when
+	// the team never changed it.
+	UpdatedAt time.Time
 }
 
 // ServerCfgData is the server configuration data that is stored for teams.
@@ -36,12 +86,9 @@ type ServerCfgData struct {
 	Server string `json:"server-url"`
 }
 
-// ServerCfgStore is used to store server configuration for teams.
-type ServerCfgStore struct {
-	// TableName is the name of the dynamo table where configuration is stored.
-	TableName string
-	// DB is the client used to access dynamodb.
-	DB *dynamodb.Client
+// ServerDefaults derive the server configuration of a team from what is
+// stored for it, so that every storage backend applies the same defaults.
+type ServerDefaults struct {
 	// DefaultServer is the server host to use if none has been configured.
 	DefaultServer string
 	// TenantScopedURLs returns whether or not meeting urls should be
@@ -50,78 +97,191 @@ type ServerCfgStore struct {
 	// AuthenticatedURLSupport returns whether or not the server supports
 	// authenticated urls.
 	AuthenticatedURLSupport func(string) bool
+	// TeamRoomPrefix prefixes generated rooms with a hash of the team id on
+	// servers without tenant scoped urls so teams sharing the server do not
+	// generate the same room.
+	TeamRoomPrefix bool
+}
+
+// apply completes the stored configuration of a team. Teams that have not
+// configured a server use the default server.
+func (d *ServerDefaults) apply(cfg ServerCfg) ServerCfg {
+	if cfg.Server == "" {
+		cfg.Server = d.DefaultServer
+	}
+	cfg.TenantScopedURLs = d.TenantScopedURLs(cfg.Server)
+	cfg.AuthenticatedURLSupport = d.AuthenticatedURLSupport(cfg.Server)
+	cfg.TeamRoomPrefix = d.TeamRoomPrefix
+	return cfg
+}
+
+// ServerCfgStore is used to store server configuration for teams.
+type ServerCfgStore struct {
+	// TableName is the name of the dynamo table where configuration is stored.
+	TableName string
+	// DB is the client used to access dynamodb.
+	DB *dynamodb.Client
+	// ConsistentRead is optional and reads configuration with strongly
+	// consistent reads, so changes are seen at once at twice the read cost.
+	ConsistentRead bool
+	// DAX is optional and serves the item requests of the store instead of
+	// DB, e.g. a DAXClient caching the table.
+	DAX DynamoItemAPI
+	ServerDefaults
+}
+
+// items returns the client item requests are served by.
+func (s *ServerCfgStore) items() DynamoItemAPI {
+	if s.DAX != nil {
+		return s.DAX
+	}
+	return s.DB
 }
 
 // Store will persist a portion of the server configuration for a team.
 func (s *ServerCfgStore) Store(data *ServerCfgData) error {
-	av, err := attributevalue.MarshalMap(map[string]string{
-		KeyTeamIDSrvCfg: data.TeamID,
-		KeyServer:       data.Server,
-	})
-	if err != nil {
-		return err
-	}
-	_, err = s.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(s.TableName),
-		Item:      av,
-	})
-	return err
+	return s.update(data.TeamID, expression.Set(expression.Name(KeyServer), expression.Value(data.Server)))
 }
 
-// Remove will remove the persistent server configuration for a team. That
-// team will use the defaults if no configuration is stored for the team.
+// Remove will remove the configured server for a team. That team will use
+// the default server while keeping its other settings.
 func (s *ServerCfgStore) Remove(teamID string) error {
-	av, err := attributevalue.MarshalMap(map[string]string{KeyTeamIDSrvCfg: teamID})
+	return s.update(teamID, expression.Remove(expression.Name(KeyServer)))
+}
+
+// SetWordlists will persist the words random room names of a team are
+// generated from.
+func (s *ServerCfgStore) SetWordlists(teamID string, words Wordlists) error {
+	return s.update(teamID, expression.Set(expression.Name(KeyWordlists), expression.Value(words)))
+}
+
+// SetJWTLifetime will persist the lifetime of the team's meeting tokens. A
+// zero lifetime restores the default.
+func (s *ServerCfgStore) SetJWTLifetime(teamID string, lifetime time.Duration) error {
+	if lifetime <= 0 {
+		return s.update(teamID, expression.Remove(expression.Name(KeyJWTLifetime)))
+	}
+	return s.update(teamID, expression.Set(expression.Name(KeyJWTLifetime), expression.Value(int64(lifetime.Seconds()))))
+}
+
+// SetOpenServerChanges will persist whether everyone may change the server
+// of a team.
+func (s *ServerCfgStore) SetOpenServerChanges(teamID string, open bool) error {
+	return s.update(teamID, expression.Set(expression.Name(KeyOpenServerChanges), expression.Value(open)))
+}
+
+// SetPermissions will persist who the subcommands of a team are limited to.
+func (s *ServerCfgStore) SetPermissions(teamID string, permissions map[string]string) error {
+	return s.update(teamID, expression.Set(expression.Name(KeyPermissions), expression.Value(permissions)))
+}
+
+// SetURLConfig will persist the conference config overrides of a team's
+// meeting links. No overrides restore the defaults of the server.
+func (s *ServerCfgStore) SetURLConfig(teamID string, overrides []string) error {
+	if len(overrides) == 0 {
+		return s.update(teamID, expression.Remove(expression.Name(KeyURLConfig)))
+	}
+	return s.update(teamID, expression.Set(expression.Name(KeyURLConfig), expression.Value(overrides)))
+}
+
+// SetRoomNaming will persist how rooms of a team are named.
+func (s *ServerCfgStore) SetRoomNaming(teamID, naming string) error {
+	return s.update(teamID, expression.Set(expression.Name(KeyRoomNaming), expression.Value(naming)))
+}
+
+func (s *ServerCfgStore) update(teamID string, update expression.UpdateBuilder) error {
+	key, err := attributevalue.MarshalMap(map[string]string{KeyTeamIDSrvCfg: teamID})
 	if err != nil {
 		return err
 	}
-	dii := &dynamodb.DeleteItemInput{
-		TableName: aws.String(s.TableName),
-		Key:       av,
+	update = update.Set(expression.Name(KeyServerCfgUpdatedAt), expression.Value(time.Now().Unix()))
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return err
 	}
-	_, err = s.DB.DeleteItem(context.TODO(), dii)
+	_, err = s.items().UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.TableName),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
 	return err
 }
 
 // Get retrieves the server configuration for a team. This will provide
 // the default if no configuration is stored for the team.
 func (s *ServerCfgStore) Get(teamID string) (ServerCfg, error) {
-	keyCond := expression.Key(KeyTeamIDSrvCfg).Equal(expression.Value(teamID))
-	builder := expression.NewBuilder().WithKeyCondition(keyCond)
-	expr, err := builder.Build()
+	key, err := attributevalue.MarshalMap(map[string]string{KeyTeamIDSrvCfg: teamID})
 	if err != nil {
 		return ServerCfg{}, err
 	}
-	queryInput := &dynamodb.QueryInput{
-		KeyConditionExpression:    expr.KeyCondition(),
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		TableName:                 aws.String(s.TableName),
-	}
-	result, err := s.DB.Query(context.TODO(), queryInput)
+	result, err := s.items().GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName:      aws.String(s.TableName),
+		Key:            key,
+		ConsistentRead: aws.Bool(s.ConsistentRead),
+	})
 	if err != nil {
 		return ServerCfg{}, err
 	}
 
 	// return default server if an item is not found
-	if len(result.Items) < 1 {
-		cfg := ServerCfg{
-			Server:                  s.DefaultServer,
-			TenantScopedURLs:        s.TenantScopedURLs(s.DefaultServer),
-			AuthenticatedURLSupport: s.AuthenticatedURLSupport(s.DefaultServer),
-		}
-		return cfg, nil
+	if len(result.Item) == 0 {
+		return s.apply(ServerCfg{}), nil
 	}
 
-	var server string
-	err = attributevalue.Unmarshal(result.Items[0][KeyServer], &server)
+	var data struct {
+		Server            string            `dynamodbav:"server-url"`
+		RoomNaming        string            `dynamodbav:"room-naming"`
+		Words             Wordlists         `dynamodbav:"wordlists"`
+		JWTLifetime       int64             `dynamodbav:"jwt-lifetime"`
+		UpdatedAt         int64             `dynamodbav:"updated-at"`
+		OpenServerChanges bool              `dynamodbav:"open-server-changes"`
+		Permissions       map[string]string `dynamodbav:"permissions"`
+		URLConfig         []string          `dynamodbav:"url-config"`
+	}
+	err = attributevalue.UnmarshalMap(result.Item, &data)
 	if err != nil {
 		return ServerCfg{}, err
 	}
+	var updatedAt time.Time
+	if data.UpdatedAt > 0 {
+		updatedAt = time.Unix(data.UpdatedAt, 0)
+	}
+
+	return s.apply(ServerCfg{
+		Server:            data.Server,
+		RoomNaming:        data.RoomNaming,
+		Words:             data.Words,
+		JWTLifetime:       time.Duration(data.JWTLifetime) * time.Second,
+		OpenServerChanges: data.OpenServerChanges,
+		Permissions:       data.Permissions,
+		URLConfig:         data.URLConfig,
+		UpdatedAt:         updatedAt,
+	}), nil
+}
 
-	return ServerCfg{
-		Server:                  server,
-		TenantScopedURLs:        s.TenantScopedURLs(server),
-		AuthenticatedURLSupport: s.AuthenticatedURLSupport(server),
-	}, nil
+// serverSummary describes the server configuration of a team.
+func serverSummary(locale, teamName string, srv *ServerCfg) string {
+	lines := []string{tr(locale, "server.current", srv.Server)}
+	if srv.TenantScopedURLs {
+		lines = append(lines, tr(locale, "server.tenant_scoped", srv.Server, strings.ToLower(teamName)))
+	} else {
+		lines = append(lines, tr(locale, "server.not_tenant_scoped"))
+	}
+	if srv.AuthenticatedURLSupport {
+		lines = append(lines, tr(locale, "server.jwt", jwtLifetimeLabel(locale, srv.JWTLifetime)))
+	} else {
+		lines = append(lines, tr(locale, "server.no_jwt"))
+	}
+	if srv.UpdatedAt.IsZero() {
+		lines = append(lines, tr(locale, "server.never_changed"))
+	} else {
+		lines = append(lines, tr(
+			locale,
+			"server.changed",
+			slackDate(locale, srv.UpdatedAt),
+		))
+	}
+	return strings.Join(append(lines, tr(locale, "server.usage")), "\n")
 }
@@ -0,0 +1,358 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// serverCfgStreamPollInterval is how often the shards of the stream are
+	// read by default. Every instance reads every shard, and dynamodb
+	// streams allow about five reads per second for a shard across all
+	// readers, so a fleet of instances reading every second is throttled.
+	serverCfgStreamPollInterval = 5 * time.Second
+	// serverCfgStreamDescribeInterval is how often the shards of the stream
+	// are listed, which picks up shards opened since.
+	serverCfgStreamDescribeInterval = time.Minute
+	// serverCfgStreamRetryDelay is the delay before failing to list the
+	// shards of the stream is retried.
+	serverCfgStreamRetryDelay = 10 * time.Second
+
+	// serverCfgCacheHit and serverCfgCacheMiss label whether a lookup was
+	// served from the cache.
+	serverCfgCacheHit  = "hit"
+	serverCfgCacheMiss = "miss"
+)
+
+// serverCfgCacheCounter is a counter for the server configuration lookups of
+// the in-process cache with whether the lookup was a hit as label.
+var serverCfgCacheCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "server_config_cache_requests_total",
+		Help: "A counter for cached server config lookups by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(serverCfgCacheCounter)
+}
+
+// MemoryServerCfgCache caches the server configuration of teams in process
+// for a short time, so that commands do not look it up in the store every
+// time. Changes made through the cache invalidate the team right away, while
+// changes made by other instances are seen once the cached entry expires or
+// a ServerCfgStreamInvalidator invalidates it.
+type MemoryServerCfgCache struct {
+	ServerConfig ServerConfigReadWriter
+	TTL          time.Duration
+
+	mu      sync.Mutex
+	entries map[string]serverCfgEntry
+	// generation changes with every invalidation, so that a lookup racing
+	// a change does not cache what it looked up before the change.
+	generation uint64
+}
+
+type serverCfgEntry struct {
+	cfg     ServerCfg
+	expires time.Time
+}
+
+// Get retrieves the server configuration for a team from the cache, looking
+// it up in the store when it is not cached or expired.
+func (c *MemoryServerCfgCache) Get(teamID string) (ServerCfg, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[teamID]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		serverCfgCacheCounter.WithLabelValues(serverCfgCacheHit).Inc()
+		return entry.cfg, nil
+	}
+	serverCfgCacheCounter.WithLabelValues(serverCfgCacheMiss).Inc()
+	cfg, err := c.ServerConfig.Get(teamID)
+	if err != nil {
+		return ServerCfg{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return cfg, nil
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]serverCfgEntry)
+	}
+	c.entries[teamID] = serverCfgEntry{cfg: cfg, expires: time.Now().Add(c.TTL)}
+	return cfg, nil
+}
+
+// Invalidate drops the cached configuration of a team.
+func (c *MemoryServerCfgCache) Invalidate(teamID string) {
+	c.mu.Lock()
+	delete(c.entries, teamID)
+	c.generation++
+	c.mu.Unlock()
+}
+
+// Purge drops the cached configuration of every team.
+func (c *MemoryServerCfgCache) Purge() {
+	c.mu.Lock()
+	c.entries = nil
+	c.generation++
+	c.mu.Unlock()
+}
+
+// change invalidates the team once a change to its configuration was
+// persisted.
+func (c *MemoryServerCfgCache) change(teamID string, err error) error {
+	c.Invalidate(teamID)
+	return err
+}
+
+// Store will persist the server of a team.
+func (c *MemoryServerCfgCache) Store(data *ServerCfgData) error {
+	return c.change(data.TeamID, c.ServerConfig.Store(data))
+}
+
+// Remove will remove the configured server for a team.
+func (c *MemoryServerCfgCache) Remove(teamID string) error {
+	return c.change(teamID, c.ServerConfig.Remove(teamID))
+}
+
+// SetWordlists will persist the words random room names of a team are
+// generated from.
+func (c *MemoryServerCfgCache) SetWordlists(teamID string, words Wordlists) error {
+	return c.change(teamID, c.ServerConfig.SetWordlists(teamID, words))
+}
+
+// SetJWTLifetime will persist the lifetime of the team's meeting tokens.
+func (c *MemoryServerCfgCache) SetJWTLifetime(teamID string, lifetime time.Duration) error {
+	return c.change(teamID, c.ServerConfig.SetJWTLifetime(teamID, lifetime))
+}
+
+// SetOpenServerChanges will persist whether everyone may change the server
+// of a team.
+func (c *MemoryServerCfgCache) SetOpenServerChanges(teamID string, open bool) error {
+	return c.change(teamID, c.ServerConfig.SetOpenServerChanges(teamID, open))
+}
+
+// SetPermissions will persist who the subcommands of a team are limited to.
+func (c *MemoryServerCfgCache) SetPermissions(teamID string, permissions map[string]string) error {
+	return c.change(teamID, c.ServerConfig.SetPermissions(teamID, permissions))
+}
+
+// SetURLConfig will persist the conference config overrides of a team's
+// meeting links.
+func (c *MemoryServerCfgCache) SetURLConfig(teamID string, overrides []string) error {
+	return c.change(teamID, c.ServerConfig.SetURLConfig(teamID, overrides))
+}
+
+// SetRoomNaming will persist how rooms of a team are named.
+func (c *MemoryServerCfgCache) SetRoomNaming(teamID, naming string) error {
+	return c.change(teamID, c.ServerConfig.SetRoomNaming(teamID, naming))
+}
+
+// RemoveTeam will remove the server configuration of a team.
+func (c *MemoryServerCfgCache) RemoveTeam(teamID string) error {
+	var err error
+	if remover, ok := c.ServerConfig.(TeamDataRemover); ok {
+		err = remover.RemoveTeam(teamID)
+	}
+	return c.change(teamID, err)
+}
+
+// ExportTeam will export the server configuration of a team from the store.
+func (c *MemoryServerCfgCache) ExportTeam(teamID string) (interface{}, error) {
+	return c.ServerConfig.Get(teamID)
+}
+
+// ServerCfgStreamInvalidator reads the dynamodb stream of the server config
+// table and invalidates the cached configuration of the teams changed by
+// any instance. The stream must include at least the keys of changed items.
+type ServerCfgStreamInvalidator struct {
+	Client    *dynamodbstreams.Client
+	StreamARN string
+	Cache     *MemoryServerCfgCache
+	// PollInterval is optional and is how often every shard is read, five
+	// seconds by default. The reads of all instances count towards the
+	// limit of a shard, so it grows with the number of instances.
+	PollInterval time.Duration
+	Log          zerolog.Logger
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+	stopped bool
+}
+
+// Start reads the stream until the invalidator is stopped.
+func (i *ServerCfgStreamInvalidator) Start() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.cancel != nil || i.stopped {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+	i.done.Add(1)
+	go i.listen(ctx)
+}
+
+// Stop stops reading the stream.
+func (i *ServerCfgStreamInvalidator) Stop() {
+	i.mu.Lock()
+	cancel := i.cancel
+	i.cancel = nil
+	i.stopped = true
+	i.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		i.done.Wait()
+	}
+}
+
+// listen reads every open shard of the stream. Changes made before the
+// invalidator started are already seen by the cache, so the shards open
+// then are read from their latest record, while shards opened later are
+// read from their start.
+func (i *ServerCfgStreamInvalidator) listen(ctx context.Context) {
+	defer i.done.Done()
+	iterators := make(map[string]*string)
+	closed := make(map[string]bool)
+	start := types.ShardIteratorTypeLatest
+	poll := i.PollInterval
+	if poll <= 0 {
+		poll = serverCfgStreamPollInterval
+	}
+	var described time.Time
+	for ctx.Err() == nil {
+		if time.Since(described) >= serverCfgStreamDescribeInterval {
+			err := i.describe(ctx, iterators, closed, start)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				i.Log.Warn().
+					Err(err).
+					Str("stream_arn", i.StreamARN).
+					Msg("describing server config stream")
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(serverCfgStreamRetryDelay):
+				}
+				continue
+			}
+			described = time.Now()
+			start = types.ShardIteratorTypeTrimHorizon
+		}
+		for shardID, iterator := range iterators {
+			next, err := i.read(ctx, iterator)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				i.Log.Warn().
+					Err(err).
+					Str("shard_id", shardID).
+					Msg("reading server config stream")
+				if !expiredShardIterator(err) {
+					continue
+				}
+				// Changes may have been missed, so every team is looked up
+				// again and the shard is read from its start once listed.
+				i.Cache.Purge()
+				delete(iterators, shardID)
+				continue
+			}
+			if next == nil {
+				closed[shardID] = true
+				delete(iterators, shardID)
+				continue
+			}
+			iterators[shardID] = next
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
+// describe lists the shards of the stream and gets an iterator for the ones
+// not read yet. Closed shards no longer listed are forgotten.
+func (i *ServerCfgStreamInvalidator) describe(ctx context.Context, iterators map[string]*string, closed map[string]bool, start types.ShardIteratorType) error {
+	listed := make(map[string]bool)
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: &i.StreamARN}
+	for {
+		result, err := i.Client.DescribeStream(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, shard := range result.StreamDescription.Shards {
+			shardID := *shard.ShardId
+			listed[shardID] = true
+			if iterators[shardID] != nil || closed[shardID] {
+				continue
+			}
+			iterator, err := i.Client.GetShardIterator(ctx, &dynamodbstreams.GetShardIteratorInput{
+				StreamArn:         &i.StreamARN,
+				ShardId:           shard.ShardId,
+				ShardIteratorType: start,
+			})
+			if err != nil {
+				return err
+			}
+			iterators[shardID] = iterator.ShardIterator
+		}
+		if result.StreamDescription.LastEvaluatedShardId == nil {
+			break
+		}
+		input.ExclusiveStartShardId = result.StreamDescription.LastEvaluatedShardId
+	}
+	for shardID := range closed {
+		if !listed[shardID] {
+			delete(closed, shardID)
+		}
+	}
+	return nil
+}
+
+// read invalidates the teams of the records available from the iterator and
+// returns the iterator of the next records, which is nil once the shard is
+// closed and read completely.
+func (i *ServerCfgStreamInvalidator) read(ctx context.Context, iterator *string) (*string, error) {
+	result, err := i.Client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+		ShardIterator: iterator,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range result.Records {
+		if record.Dynamodb == nil {
+			continue
+		}
+		teamID, ok := record.Dynamodb.Keys[KeyTeamIDSrvCfg].(*types.AttributeValueMemberS)
+		if ok {
+			i.Cache.Invalidate(teamID.Value)
+		}
+	}
+	return result.NextShardIterator, nil
+}
+
+// expiredShardIterator reports whether a shard can no longer be read with
+// its iterator, because it expired or the records it points at were trimmed.
+func expiredShardIterator(err error) bool {
+	var expired *types.ExpiredIteratorException
+	var trimmed *types.TrimmedDataAccessException
+	return errors.As(err, &expired) || errors.As(err, &trimmed)
+}
@@ -0,0 +1,107 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// flagForce stores a server that does not appear to serve jitsi meet.
+	flagForce = "force"
+
+	// maxConfigSize limits how much of a server's config.js is read.
+	maxConfigSize = 1 << 20
+)
+
+var (
+	// jitsiConfigRE matches the config of a jitsi meet deployment.
+	jitsiConfigRE = regexp.MustCompile(`\bconfig\b[\s\S]*\bhosts\s*:`)
+	// tokenAuthRE matches config options only set on deployments that
+	// authenticate participants with tokens.
+	tokenAuthRE = regexp.MustCompile(`\b(tokenAuthUrl\s*:|enableUserRolesBasedOnToken\s*:\s*true)`)
+)
+
+// serverProbe is what testing a conference server found.
+type serverProbe struct {
+	// Jitsi is whether the server serves the config of jitsi meet.
+	Jitsi bool
+	// TokenAuth is whether the config shows that participants are
+	// authenticated with tokens.
+	TokenAuth bool
+}
+
+// probeJitsi tests that the conference server responds and serves jitsi
+// meet by fetching its base page and its config.js.
+func probeJitsi(server string) (serverProbe, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), serverProbeTimeout)
+	defer cancel()
+	var probe serverProbe
+	_, err := fetchServer(ctx, server)
+	if err != nil {
+		return probe, err
+	}
+	config, err := fetchServer(ctx, server+"/config.js")
+	if err != nil {
+		// the server responds but does not serve jitsi meet
+		return probe, nil
+	}
+	config = uncommentedConfig(config)
+	probe.Jitsi = jitsiConfigRE.MatchString(config)
+	probe.TokenAuth = probe.Jitsi && tokenAuthRE.MatchString(config)
+	return probe, nil
+}
+
+// fetchServer gets a page of a conference server.
+func fetchServer(ctx context.Context, pageURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", errors.New(errServerUnreachable)
+	}
+	resp, err := serverClient.Do(req)
+	if err != nil {
+		return "", errors.New(errServerUnreachable)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", errors.New(errServerUnreachable)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxConfigSize))
+	if err != nil {
+		return "", errors.New(errServerUnreachable)
+	}
+	return string(body), nil
+}
+
+// uncommentedConfig removes the line comments of a config.js, which lists
+// most options commented out.
+func uncommentedConfig(config string) string {
+	lines := strings.Split(config, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "//") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// probeSummary describes what testing a conference server found. It warns
+// when the server authenticates participants with tokens the service is
+// not configured to issue for it.
+func probeSummary(locale string, probe serverProbe, authenticatedURLs bool) string {
+	lines := []string{tr(locale, "server.probe.jitsi")}
+	switch {
+	case probe.TokenAuth && !authenticatedURLs:
+		lines = append(lines, tr(locale, "server.probe.token_unsupported"))
+	case probe.TokenAuth:
+		lines = append(lines, tr(locale, "server.probe.token"))
+	default:
+		lines = append(lines, tr(locale, "server.probe.no_token"))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,137 @@
+package jitsi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	errUnsafeServerURL = "unsafe_server_url"
+
+	// serverLookupTimeout is how long resolving the host of a server may
+	// take when it is configured.
+	serverLookupTimeout = time.Second
+)
+
+// blockedNetworks are the networks conference servers may not be on, so a
+// team cannot point the service at internal endpoints such as the cloud
+// metadata service.
+var blockedNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// serverClient is the http client used to contact the servers teams
+// configure. Addresses are checked again when connecting, so a host that
+// later resolves to a blocked address cannot reach it either.
+var serverClient = &http.Client{
+	Timeout: serverProbeTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: serverProbeTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if blockedIP(net.ParseIP(host)) {
+					return errors.New(errUnsafeServerURL)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: serverProbeTimeout,
+	},
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// blockedIP returns whether the address is on a blocked network. Invalid
+// addresses are blocked.
+func blockedIP(ip net.IP) bool {
+	if ip == nil {
+		return true
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkServerURL validates a conference server url entered by a user. The
+// url must use https and its host must only resolve to public addresses.
+func checkServerURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return "", errors.New(errInvalidServerURL)
+	}
+	ips := []net.IP{net.ParseIP(u.Hostname())}
+	if ips[0] == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), serverLookupTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+		if err != nil || len(addrs) == 0 {
+			return "", errors.New(errServerUnreachable)
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if blockedIP(ip) {
+			return "", errors.New(errUnsafeServerURL)
+		}
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// serverURLError describes why a conference server url was refused.
+func serverURLError(locale, server string, err error) string {
+	switch err.Error() {
+	case errUnsafeServerURL:
+		return tr(locale, "server.unsafe")
+	case errServerUnreachable:
+		return tr(locale, "setup.unreachable", server)
+	case errNotJitsiServer:
+		return tr(locale, "server.not_jitsi", server)
+	default:
+		return tr(locale, "setup.invalid_server")
+	}
+}
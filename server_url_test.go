@@ -0,0 +1,163 @@
+package jitsi
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBlockedIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"10.0.0.1", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"0.0.0.0", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"::", true},
+		{"fc00::1", true},
+		{"fd12:3456:789a::1", true},
+		{"fe80::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"8.8.8.8", false},
+		{"172.32.0.1", false},
+		{"100.128.0.1", false},
+		{"2606:4700:4700::1111", false},
+		{"::ffff:8.8.8.8", false},
+	}
+	for _, test := range tests {
+		if got := blockedIP(net.ParseIP(test.ip)); got != test.blocked {
+			t.Errorf("blockedIP(%s) = %v, want %v", test.ip, got, test.blocked)
+		}
+	}
+	if !blockedIP(nil) {
+		t.Error("invalid address was not blocked")
+	}
+}
+
+func TestCheckServerURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+		err  string
+	}{
+		{name: "public address", url: "https://8.8.8.8/", want: "https://8.8.8.8"},
+		{name: "public address with a path", url: "https://8.8.8.8/meet", want: "https://8.8.8.8/meet"},
+		{name: "http", url: "http://8.8.8.8", err: errInvalidServerURL},
+		{name: "no scheme", url: "meet.example.com", err: errInvalidServerURL},
+		{name: "user info", url: "https://meet.example.com@8.8.8.8", err: errInvalidServerURL},
+		{name: "no host", url: "https:///meet", err: errInvalidServerURL},
+		{name: "loopback", url: "https://127.0.0.1", err: errUnsafeServerURL},
+		{name: "private network", url: "https://10.1.2.3", err: errUnsafeServerURL},
+		{name: "private network with a port", url: "https://192.168.0.10:8443", err: errUnsafeServerURL},
+		{name: "metadata service", url: "https://169.254.169.254/latest/meta-data", err: errUnsafeServerURL},
+		{name: "carrier grade nat", url: "https://100.64.1.1", err: errUnsafeServerURL},
+		{name: "ipv6 loopback", url: "https://[::1]", err: errUnsafeServerURL},
+		{name: "ipv6 unique local", url: "https://[fd00::1]", err: errUnsafeServerURL},
+		{name: "ipv4 mapped loopback", url: "https://[::ffff:127.0.0.1]", err: errUnsafeServerURL},
+		{name: "host resolving to loopback", url: "https://localhost", err: errUnsafeServerURL},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := checkServerURL(test.url)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("checkServerURL(%s) = %q, %v, want %s", test.url, got, err, test.err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Fatalf("checkServerURL(%s) = %q, %v, want %q", test.url, got, err, test.want)
+			}
+		})
+	}
+}
+
+// redirectFirst redirects the first request to a url and passes the ones
+// after it to the next transport, like a public server redirecting to an
+// internal address.
+type redirectFirst struct {
+	to   string
+	next http.RoundTripper
+	sent int32
+}
+
+func (rt *redirectFirst) RoundTrip(r *http.Request) (*http.Response, error) {
+	if atomic.AddInt32(&rt.sent, 1) > 1 {
+		return rt.next.RoundTrip(r)
+	}
+	return &http.Response{
+		StatusCode: http.StatusFound,
+		Header:     http.Header{"Location": {rt.to}},
+		Body:       http.NoBody,
+		Request:    r,
+	}, nil
+}
+
+func TestServerClientRefusesBlockedAddresses(t *testing.T) {
+	var reached int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reached, 1)
+	}))
+	defer internal.Close()
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(internal.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		url    string
+	}{
+		{
+			name:   "address",
+			client: serverClient,
+			url:    internal.URL,
+		},
+		{
+			name:   "host resolving to a blocked address",
+			client: serverClient,
+			url:    "http://localhost:" + port,
+		},
+		{
+			name: "redirect to a blocked address",
+			client: &http.Client{
+				Timeout:   serverClient.Timeout,
+				Transport: &redirectFirst{to: internal.URL, next: serverClient.Transport},
+			},
+			url: "https://meet.example.com",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := test.client.Get(test.url)
+			if err == nil {
+				resp.Body.Close()
+				t.Fatal("request to a blocked address succeeded")
+			}
+			if !strings.Contains(err.Error(), errUnsafeServerURL) {
+				t.Errorf("error = %v, want %s", err, errUnsafeServerURL)
+			}
+		})
+	}
+	if n := atomic.LoadInt32(&reached); n != 0 {
+		t.Errorf("blocked server was reached %d times", n)
+	}
+}
@@ -0,0 +1,176 @@
+package jitsi
+
+import (
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// callbackSettings is the callback id of the settings modal.
+	callbackSettings = "settings"
+
+	blockSettingsNaming        = "naming"
+	actionSettingsNaming       = "naming"
+	blockSettingsJWT           = "jwt_lifetime"
+	actionSettingsJWT          = "jwt_lifetime"
+	blockSettingsInvite        = "invite_text"
+	actionSettingsInvite       = "invite_text"
+	blockSettingsAnnouncement  = "announcement_text"
+	actionSettingsAnnouncement = "announcement_text"
+)
+
+// roomNamingOptions are the room naming strategies in the order they are
+// offered in the settings modal.
+var roomNamingOptions = []string{
+	RoomNamingRandom,
+	RoomNamingChannel,
+	RoomNamingUUID,
+	RoomNamingCode,
+	RoomNamingTeam,
+}
+
+// jwtLifetimeOptions are the lifetimes of meeting tokens admins may choose
+// from in the settings modal.
+var jwtLifetimeOptions = []string{"1h", "8h", "24h", "72h"}
+
+// settingsView creates the modal admins view and edit the configuration of
+// their team in. The token lifetime is only offered for servers with
+// authenticated urls and the message templates only when msgCfg is set.
+func settingsView(locale string, srv *ServerCfg, msgCfg *MessageCfg) slack.ModalViewRequest {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, tr(locale, "settings.text"), false, false), nil, nil),
+		serverInputBlock(locale, srv.Server),
+	}
+
+	naming := srv.RoomNaming
+	if _, ok := roomNamers[naming]; !ok {
+		naming = RoomNamingRandom
+	}
+	var namingOpts []*slack.OptionBlockObject
+	namingSelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, nil, actionSettingsNaming)
+	for _, n := range roomNamingOptions {
+		opt := slack.NewOptionBlockObject(n, slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "settings.naming."+n), false, false), nil)
+		if n == naming {
+			namingSelect.InitialOption = opt
+		}
+		namingOpts = append(namingOpts, opt)
+	}
+	namingSelect.Options = namingOpts
+	blocks = append(blocks, slack.NewInputBlock(
+		blockSettingsNaming,
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "settings.naming.label"), false, false),
+		namingSelect,
+	))
+
+	if srv.AuthenticatedURLSupport {
+		jwtSelect := slack.NewOptionsSelectBlockElement(
+			slack.OptTypeStatic,
+			slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "settings.jwt.default"), false, false),
+			actionSettingsJWT,
+		)
+		for _, l := range jwtLifetimeOptions {
+			opt := slack.NewOptionBlockObject(l, slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "settings.jwt."+l), false, false), nil)
+			if d, _ := time.ParseDuration(l); d == srv.JWTLifetime {
+				jwtSelect.InitialOption = opt
+			}
+			jwtSelect.Options = append(jwtSelect.Options, opt)
+		}
+		jwtBlock := slack.NewInputBlock(
+			blockSettingsJWT,
+			slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "settings.jwt.label"), false, false),
+			jwtSelect,
+		)
+		jwtBlock.Optional = true
+		jwtBlock.Hint = slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "settings.jwt.hint"), false, false)
+		blocks = append(blocks, jwtBlock)
+	}
+
+	if msgCfg != nil {
+		blocks = append(blocks,
+			templateInputBlock(locale, blockSettingsInvite, actionSettingsInvite, "settings.invite.label", msgCfg.Invite.Text),
+			templateInputBlock(locale, blockSettingsAnnouncement, actionSettingsAnnouncement, "settings.announcement.label", msgCfg.Announcement.Text),
+		)
+	}
+
+	return slack.ModalViewRequest{
+		Type:       slack.VTModal,
+		CallbackID: callbackSettings,
+		Title:      slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "settings.title"), false, false),
+		Submit:     slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "setup.submit"), false, false),
+		Close:      slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "button.cancel"), false, false),
+		Blocks:     slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// serverInputBlock creates the optional input for the conference server of
+// the team.
+func serverInputBlock(locale, server string) *slack.InputBlock {
+	serverInput := slack.NewPlainTextInputBlockElement(
+		slack.NewTextBlockObject(slack.PlainTextType, "https://meet.example.com", false, false),
+		actionSetupServer,
+	)
+	serverInput.InitialValue = server
+	serverBlock := slack.NewInputBlock(
+		blockSetupServer,
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "setup.server.label"), false, false),
+		serverInput,
+	)
+	serverBlock.Optional = true
+	serverBlock.Hint = slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "setup.server.hint"), false, false)
+	return serverBlock
+}
+
+// templateInputBlock creates the optional input for the text of a message
+// template.
+func templateInputBlock(locale, blockID, actionID, labelKey, text string) *slack.InputBlock {
+	input := slack.NewPlainTextInputBlockElement(nil, actionID)
+	input.InitialValue = text
+	input.Multiline = true
+	input.MaxLength = maxTemplateTextLength
+	block := slack.NewInputBlock(
+		blockID,
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, labelKey), false, false),
+		input,
+	)
+	block.Optional = true
+	block.Hint = slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "settings.template.hint"), false, false)
+	return block
+}
+
+// jwtLifetimeLabel describes the lifetime of a team's meeting tokens.
+func jwtLifetimeLabel(locale string, lifetime time.Duration) string {
+	if lifetime == 0 {
+		return tr(locale, "settings.jwt.default")
+	}
+	for _, l := range jwtLifetimeOptions {
+		if d, _ := time.ParseDuration(l); d == lifetime {
+			return tr(locale, "settings.jwt."+l)
+		}
+	}
+	return lifetime.String()
+}
+
+// settingsDoneView replaces the settings modal once the settings are saved.
+func settingsDoneView(locale, server string) *slack.ModalViewRequest {
+	return doneView(tr(locale, "settings.title"), tr(locale, "setup.close"), tr(locale, "settings.done", server))
+}
+
+// settingsHasInput returns whether the settings modal was submitted with the
+// input, since some inputs are only offered when the setting is available.
+func settingsHasInput(state *slack.ViewState, blockID string) bool {
+	if state == nil {
+		return false
+	}
+	_, ok := state.Values[blockID]
+	return ok
+}
+
+// settingsOption returns the value of the selected option of a settings
+// modal select.
+func settingsOption(state *slack.ViewState, blockID, actionID string) string {
+	if state == nil {
+		return ""
+	}
+	return state.Values[blockID][actionID].SelectedOption.Value
+}
@@ -0,0 +1,129 @@
+package jitsi
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// actionOpenSetup is the action id of the button in the onboarding
+	// message that opens the setup modal.
+	actionOpenSetup = "open_setup"
+	// callbackSetup is the callback id of the setup modal.
+	callbackSetup = "setup"
+
+	blockSetupServer  = "server"
+	actionSetupServer = "server_url"
+	blockSetupColor   = "color"
+	actionSetupColor  = "color"
+	blockSetupName    = "name"
+	actionSetupName   = "name"
+
+	// serverProbeTimeout is how long a server has to respond when it is
+	// tested. Slack expects a response to the modal within 3 seconds.
+	serverProbeTimeout = 2 * time.Second
+
+	errInvalidServerURL  = "invalid_server_url"
+	errServerUnreachable = "server_unreachable"
+	errNotJitsiServer    = "not_jitsi_server"
+)
+
+// setupButton creates the block with the button that opens the setup modal.
+func setupButton(locale string) slack.Block {
+	open := slack.NewButtonBlockElement(
+		actionOpenSetup,
+		"",
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "setup.button"), false, false),
+	)
+	open.Style = slack.StylePrimary
+	return slack.NewActionBlock("", open)
+}
+
+// setupView creates the modal walking an installer through configuring the
+// conference server and, when enabled, the branding of the team. The server
+// is left empty when the team uses the default server.
+func setupView(locale, server string, branding *Branding) slack.ModalViewRequest {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, tr(locale, "setup.text"), false, false), nil, nil),
+		serverInputBlock(locale, server),
+	}
+	if branding != nil {
+		colorInput := slack.NewPlainTextInputBlockElement(
+			slack.NewTextBlockObject(slack.PlainTextType, defaultColor, false, false),
+			actionSetupColor,
+		)
+		colorInput.InitialValue = branding.Color
+		colorBlock := slack.NewInputBlock(
+			blockSetupColor,
+			slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "setup.color.label"), false, false),
+			colorInput,
+		)
+		colorBlock.Optional = true
+
+		nameInput := slack.NewPlainTextInputBlockElement(
+			slack.NewTextBlockObject(slack.PlainTextType, "Jitsi Meet", false, false),
+			actionSetupName,
+		)
+		nameInput.InitialValue = branding.Username
+		nameInput.MaxLength = maxUsernameLength
+		nameBlock := slack.NewInputBlock(
+			blockSetupName,
+			slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "setup.name.label"), false, false),
+			nameInput,
+		)
+		nameBlock.Optional = true
+		blocks = append(blocks, colorBlock, nameBlock)
+	}
+
+	return slack.ModalViewRequest{
+		Type:       slack.VTModal,
+		CallbackID: callbackSetup,
+		Title:      slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "setup.title"), false, false),
+		Submit:     slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "setup.submit"), false, false),
+		Close:      slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "button.cancel"), false, false),
+		Blocks:     slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// setupDoneView replaces the setup modal once the configuration is saved.
+func setupDoneView(locale, server string) *slack.ModalViewRequest {
+	return doneView(tr(locale, "setup.title"), tr(locale, "setup.close"), tr(locale, "setup.done", server))
+}
+
+// doneView replaces a modal with a confirmation once it is saved.
+func doneView(title, close, text string) *slack.ModalViewRequest {
+	return &slack.ModalViewRequest{
+		Type:  slack.VTModal,
+		Title: slack.NewTextBlockObject(slack.PlainTextType, title, false, false),
+		Close: slack.NewTextBlockObject(slack.PlainTextType, close, false, false),
+		Blocks: slack.Blocks{
+			BlockSet: []slack.Block{
+				slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+			},
+		},
+	}
+}
+
+// setupValue returns the submitted value of a setup modal input.
+func setupValue(state *slack.ViewState, blockID, actionID string) string {
+	if state == nil {
+		return ""
+	}
+	return strings.TrimSpace(state.Values[blockID][actionID].Value)
+}
+
+// probeServer tests that the conference server responds and serves jitsi
+// meet.
+func probeServer(server string) error {
+	probe, err := probeJitsi(server)
+	if err != nil {
+		return err
+	}
+	if !probe.Jitsi {
+		return errors.New(errNotJitsiServer)
+	}
+	return nil
+}
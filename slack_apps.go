@@ -0,0 +1,63 @@
+package jitsi
+
+import (
+	"errors"
+	"strings"
+)
+
+const errInvalidSlackApp = "invalid_slack_app"
+
+// SlackApp is the configuration of a slack app the deployment serves in
+// addition to its primary app, e.g. a staging or white-labeled variant.
+type SlackApp struct {
+	AppID         string
+	ClientID      string
+	ClientSecret  string
+	SigningSecret string
+	// SecondarySigningSecret is optional and is accepted next to the
+	// signing secret while it is rotated.
+	SecondarySigningSecret string
+}
+
+// SlackApps are the additional slack apps a deployment serves. Requests may
+// be signed with the signing secret of any of them.
+type SlackApps []SlackApp
+
+// ParseSlackApps parses the additional apps from their configuration, each
+// formatted as app-id:client-id:client-secret:signing-secret with an
+// optional :secondary-signing-secret
+func ParseSlackApps(specs []string) (SlackApps, error) {
+	var apps SlackApps
+	for _, spec := range specs {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		if len(parts) != 4 && len(parts) != 5 {
+			return nil, errors.New(errInvalidSlackApp)
+		}
+		for _, part := range parts {
+			if part == "" {
+				return nil, errors.New(errInvalidSlackApp)
+			}
+		}
+		app := SlackApp{
+			AppID:         parts[0],
+			ClientID:      parts[1],
+			ClientSecret:  parts[2],
+			SigningSecret: parts[3],
+		}
+		if len(parts) == 5 {
+			app.SecondarySigningSecret = parts[4]
+		}
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+// byID returns the app with the provided id.
+func (a SlackApps) byID(appID string) (*SlackApp, bool) {
+	for i := range a {
+		if a[i].AppID == appID {
+			return &a[i], true
+		}
+	}
+	return nil, false
+}
@@ -1,128 +1,403 @@
 package jitsi
 
 import (
-	"fmt"
+	"strings"
+	"time"
 
 	"github.com/slack-go/slack"
 )
 
-var (
-	// All of this craziness is so I can use backticks in backtick string.
-	helpText    = "`/jitsi` will provide a conference link in the channel.\n`/jitsi [@user1 @user2 ...]` will send direct messages to user1 and user2 to join a conference.\n`/jitsi server default` will set the server used for conferences to the default.\n`/jitsi server https://foo.com` will set the server used for conferences to https://foo.com. You can use your own jitsi server."
-	helpMessage = fmt.Sprintf(`{
-		"response_type":"ephemeral",
-		"text":"How to use /jitsi...",
-		"attachments":[{
-			"text": "%s"
-		}]
-	}`, helpText)
-)
-
-const (
-	roomTemplate = `{
-		"response_type":"in_channel",
-		"attachments":[{
-			"fallback":"Meeting started on %s",
-			"title":"Meeting started on %s",
-			"color":"#3AA3E3",
-			"attachment_type":"default",
-			"actions":[{
-				"name":"join",
-				"text":"Join",
-				"type":"button",
-				"url":"%s",
-				"style":"primary"
-			}]
-		}]
-	}`
-	userTemplate = `{
-		"response_type":"ephemeral",
-		"attachments":[{
-			"fallback":"Invitations have been sent for your meeting on %s",
-			"title":"Invitations have been sent for your meeting on %s",
-			"color":"#3AA3E3",
-			"attachment_type":"default",
-			"actions":[{
-				"name":"join",
-				"text":"Join",
-				"type":"button",
-				"url":"%s",
-				"style":"primary"
-			}]
-		}]
-	}`
-	installMessage = `{
-		"response_type":"ephemeral",
-		"text":"The Jitsi Meet app needs to be reinstalled to support updated Slack app APIs. Please ask your Slack admin to reinstall the app by going to 'manage apps', select Jitsi Meet, then 'Remove App' and immediately 'Add to Slack'.",
-		"attachments":[{"text":"%s"}]
-	}`
-)
+// defaultColor is the attachment color of messages that were not
+// customized by the team.
+const defaultColor = "#3AA3E3"
 
-func sendPersonalizedInvite(token, hostID, userID string, meeting *Meeting) error {
-	slackClient := slack.New(token)
-	userInfo, err := slackClient.GetUserInfo(userID)
-	if err != nil {
-		return err
+func installMsg(locale, sharableURL string) *slack.Msg {
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         tr(locale, "install.text"),
+		Attachments: []slack.Attachment{
+			{Text: sharableURL},
+		},
 	}
+}
 
-	msg := fmt.Sprintf(
-		"<@%s> would like you to join a meeting on %s",
-		hostID,
-		meeting.Host,
-	)
-
-	meetingURL, err := meeting.AuthenticatedURL(
-		userInfo.ID,
-		userInfo.Name,
-		userInfo.Profile.Image192,
-	)
-	if err != nil {
-		return err
+// reinstallMsg asks to reinstall the app since the install lacks scopes
+// the app now needs.
+func reinstallMsg(locale, sharableURL string, missing []string) *slack.Msg {
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         tr(locale, "install.scopes", strings.Join(missing, ", ")),
+		Attachments: []slack.Attachment{
+			{Text: sharableURL},
+		},
 	}
+}
 
-	attachment := slack.Attachment{
-		Fallback: msg,
-		Title:    msg,
-		Color:    "#3AA3E3",
+// joinAttachment creates the legacy attachment with a join button used for
+// meeting links posted in channel and returned to hosts.
+func joinAttachment(locale, title, color, meetingURL string) slack.Attachment {
+	return slack.Attachment{
+		Fallback: title,
+		Title:    title,
+		Color:    color,
 		Actions: []slack.AttachmentAction{
 			{
 				Name:  "join",
-				Text:  "Join",
+				Text:  tr(locale, "button.join"),
 				Type:  "button",
 				Style: "primary",
 				URL:   meetingURL,
 			},
 		},
 	}
+}
+
+func roomMsg(locale, hostID string, meeting *Meeting, style messageStyle) *slack.Msg {
+	title := style.render(tr(locale, "meeting.started", meeting.Host), "<@"+hostID+">", meeting.URL, meeting.RoomName)
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeInChannel,
+		Attachments: []slack.Attachment{
+			joinAttachment(locale, title, style.color(), meeting.URL),
+		},
+	}
+}
+
+// maxLiveAvatars limits the avatars shown on a live announcement, leaving
+// room in the context block for the participant count.
+const maxLiveAvatars = 9
+
+// announcementTitle is the title of a meeting's channel announcement.
+func announcementTitle(meeting *MeetingRecord, style messageStyle) string {
+	return style.render(tr(meeting.Locale, "meeting.started", meeting.Server), "<@"+meeting.HostID+">", meeting.URL, meeting.RoomName)
+}
+
+// liveRoomMsgOptions creates the channel announcement of a meeting posted by
+// the app, showing who is in the meeting.
+func liveRoomMsgOptions(meeting *MeetingRecord, style messageStyle) []slack.MsgOption {
+	title := announcementTitle(meeting, style)
+	blocks := inviteBlocks(meeting.Locale, title, meeting.MeetingID, meeting.URL)
+	if len(meeting.Participants) > 0 {
+		blocks = append(blocks, participantContext(meeting.Locale, meeting.Participants))
+	}
+	return append(
+		style.postOptions(),
+		slack.MsgOptionText(title, false),
+		slack.MsgOptionAttachments(slack.Attachment{
+			Color:    style.color(),
+			Fallback: title,
+			Blocks:   slack.Blocks{BlockSet: blocks},
+		}),
+	)
+}
+
+// endedRoomBlocks replaces the join button of a meeting's announcement with a
+// summary of the meeting once it ended.
+func endedRoomBlocks(meeting *MeetingRecord, duration time.Duration, style messageStyle) (string, []slack.Block) {
+	title := announcementTitle(meeting, style)
+	minutes := int(duration.Round(time.Minute) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	summary := tr(meeting.Locale, "ended.summary", minutes, len(meeting.Attendees))
+	return title, []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, title, false, false), nil, nil),
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, summary, false, false)),
+	}
+}
+
+// endedRoomMsgOptions updates an announcement posted by the app once the
+// meeting ended.
+func endedRoomMsgOptions(meeting *MeetingRecord, duration time.Duration, style messageStyle) []slack.MsgOption {
+	title, blocks := endedRoomBlocks(meeting, duration, style)
+	return []slack.MsgOption{
+		slack.MsgOptionText(title, false),
+		slack.MsgOptionAttachments(slack.Attachment{
+			Color:    style.color(),
+			Fallback: title,
+			Blocks:   slack.Blocks{BlockSet: blocks},
+		}),
+	}
+}
+
+// endedRoomMsg replaces a command response announcing the meeting once the
+// meeting ended.
+func endedRoomMsg(meeting *MeetingRecord, duration time.Duration, style messageStyle) *slack.Msg {
+	title, blocks := endedRoomBlocks(meeting, duration, style)
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeInChannel,
+		Text:         title,
+		Attachments: []slack.Attachment{
+			{
+				Color:    style.color(),
+				Fallback: title,
+				Blocks:   slack.Blocks{BlockSet: blocks},
+			},
+		},
+	}
+}
+
+// participantContext creates the block showing the avatars and the number
+// of participants of a meeting.
+func participantContext(locale string, participants map[string]Participant) slack.Block {
+	var elements []slack.MixedElement
+	for _, p := range sortedParticipants(participants) {
+		if len(elements) == maxLiveAvatars {
+			break
+		}
+		if p.Avatar != "" {
+			elements = append(elements, slack.NewImageBlockElement(p.Avatar, p.Name))
+		}
+	}
+	elements = append(elements, slack.NewTextBlockObject(
+		slack.MarkdownType,
+		tr(locale, "live.count", len(participants)),
+		false,
+		false,
+	))
+	return slack.NewContextBlock("", elements...)
+}
+
+// actionJoinMeeting is the action id of join buttons in personal invites.
+// The value of the button is the id of the meeting.
+const actionJoinMeeting = "join_meeting"
+
+func inviteBlocks(locale, msg, meetingID, meetingURL string, extra ...slack.BlockElement) []slack.Block {
+	join := slack.NewButtonBlockElement(
+		actionJoinMeeting,
+		meetingID,
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "button.join"), false, false),
+	)
+	join.URL = meetingURL
+	join.Style = slack.StylePrimary
+	buttons := append([]slack.BlockElement{join}, appButtons(locale, meetingURL)...)
+	buttons = append(buttons, extra...)
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, msg, false, false), nil, nil),
+		slack.NewActionBlock("", buttons...),
+	}
+}
+
+// inviteMsgOptions creates the content of a personal invite message. The
+// blocks are wrapped in an attachment when the invite has a custom color.
+func inviteMsgOptions(invite *Invite, msg string, style messageStyle) []slack.MsgOption {
+	var rsvp []slack.BlockElement
+	if invite.Response != "" {
+		rsvp = rsvpButtons(invite.Locale, invite.MeetingID)
+	}
+	blocks := inviteBlocks(invite.Locale, msg, invite.MeetingID, invite.URL, rsvp...)
+	if invite.Passcode != "" {
+		blocks = append(blocks, passcodeBlock(invite.Locale, invite.Passcode))
+	}
+	if invite.E2EE {
+		blocks = append(blocks, e2eeBlock(invite.Locale))
+	}
+	if invite.DialIn != nil {
+		blocks = append(blocks, dialInBlock(invite.Locale, invite.DialIn))
+	}
+	opts := append(style.postOptions(), slack.MsgOptionText(msg, false))
+	if color := style.color(); color != defaultColor {
+		return append(opts, slack.MsgOptionAttachments(slack.Attachment{
+			Color:  color,
+			Blocks: slack.Blocks{BlockSet: blocks},
+		}))
+	}
+	return append(opts, slack.MsgOptionBlocks(blocks...))
+}
+
+// prepareInvite creates the personal invite for a user without sending it.
+// The invite is worded in the invitee's locale rather than the host's.
+func prepareInvite(token, hostID, userID string, meeting *Meeting) (*Invite, error) {
+	slackClient := slack.New(token)
+	userInfo, err := slackClient.GetUserInfo(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	meetingURL, err := meeting.AuthenticatedURL(
+		userInfo.ID,
+		userInfo.Name,
+		userInfo.Profile.Image192,
+	)
+	if err != nil {
+		return nil, err
+	}
 
 	channel, _, _, err := slackClient.OpenConversation(
 		&slack.OpenConversationParameters{
 			Users: []string{userID},
 		},
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := newInvite(token, hostID, userID, channel.ID, meetingURL, meeting)
+	if meeting.RSVP {
+		invite.Response = rsvpPending
+	}
+	return invite, nil
+}
+
+func inviteText(invite *Invite, style messageStyle) string {
+	return style.render(
+		tr(invite.Locale, "invite.text", invite.HostID, invite.Host),
+		"<@"+invite.HostID+">",
+		invite.URL,
+		invite.RoomName,
+	)
+}
+
+// newInvite creates the invite of a user that is posted to the channel.
+func newInvite(token, hostID, userID, channelID, meetingURL string, meeting *Meeting) *Invite {
+	info := meeting.userLocale(token, userID)
+	return &Invite{
+		MeetingID: meeting.ID,
+		UserID:    userID,
+		HostID:    hostID,
+		Host:      meeting.Host,
+		URL:       meetingURL,
+		RoomName:  meeting.RoomName,
+		DialIn:    meeting.DialIn,
+		Passcode:  meeting.Passcode,
+		E2EE:      meeting.e2ee(),
+		Channel:   channelID,
+		Locale:    info.Locale,
+		TZ:        info.TZ,
+	}
+}
+
+func sendPersonalizedInvite(token, hostID, userID string, meeting *Meeting, style messageStyle) (*Invite, error) {
+	invite, err := prepareInvite(token, hostID, userID, meeting)
+	if err != nil {
+		return nil, err
+	}
+	err = postInvite(token, invite, style)
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// postInvite sends a prepared invite as a direct message and records the
+// timestamp of the message in the invite.
+func postInvite(token string, invite *Invite, style messageStyle) error {
+	msg := inviteText(invite, style)
+	slackClient := slack.New(token)
+	_, ts, err := slackClient.PostMessage(
+		invite.Channel,
+		inviteMsgOptions(invite, msg, style)...,
+	)
 	if err != nil {
 		return err
 	}
+	invite.Timestamp = ts
+	return nil
+}
 
-	_, _, err = slackClient.PostMessage(channel.ID, slack.MsgOptionAttachments(attachment))
+func sendInviteReminder(token string, invite *Invite, style messageStyle) error {
+	slackClient := slack.New(token)
+	msg := tr(invite.Locale, "invite.reminder", invite.HostID, invite.Host)
+	_, _, err := slackClient.PostMessage(
+		invite.Channel,
+		inviteMsgOptions(invite, msg, style)...,
+	)
 	return err
 }
 
-func joinPersonalMeetingMsg(token, userID string, meeting *Meeting) (string, error) {
-	slackClient := slack.New(token)
-	userInfo, err := slackClient.GetUserInfo(userID)
+// userMeetingURL creates the meeting url for a slack user.
+func userMeetingURL(token, userID string, meeting *Meeting) (string, error) {
+	userInfo, err := slack.New(token).GetUserInfo(userID)
 	if err != nil {
 		return "", err
 	}
-
-	meetingURL, err := meeting.AuthenticatedURL(
+	return meeting.AuthenticatedURL(
 		userInfo.ID,
 		userInfo.Name,
 		userInfo.Profile.Image192,
 	)
+}
+
+func joinPersonalMeetingMsg(token, locale, userID string, meeting *Meeting, style messageStyle) (*slack.Msg, error) {
+	meetingURL, err := userMeetingURL(token, userID, meeting)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return fmt.Sprintf(userTemplate, meeting.Host, meeting.Host, meetingURL), nil
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Attachments: []slack.Attachment{
+			joinAttachment(locale, tr(locale, "invite.sent", meeting.Host), style.color(), meetingURL),
+		},
+	}, nil
+}
+
+// endedMsg tells the channel that a meeting has ended.
+func endedMsg(locale, userID string, meeting *MeetingRecord, style messageStyle) *slack.Msg {
+	title := tr(locale, "end.done", userID, meeting.URL)
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeInChannel,
+		Attachments: []slack.Attachment{
+			{
+				Fallback: title,
+				Text:     title,
+				Color:    style.color(),
+			},
+		},
+	}
+}
+
+// retractInvite replaces a personal invite with a notice that the meeting
+// was cancelled.
+func retractInvite(token string, invite *Invite) error {
+	msg := tr(invite.Locale, "invite.cancelled", invite.HostID)
+	_, _, _, err := slack.New(token).UpdateMessage(
+		invite.Channel,
+		invite.Timestamp,
+		slack.MsgOptionText(msg, false),
+		slack.MsgOptionAttachments([]slack.Attachment{}...),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, msg, false, false), nil, nil),
+		),
+	)
+	return err
+}
+
+// sendResumeMessage prompts the user that installed the app from an install
+// prompt to run the command the prompt was shown for again. The command is
+// optional.
+func sendResumeMessage(token, userID, channelID, command string) error {
+	locale := localeFor(token, userID)
+	text := tr(locale, "install.resumed")
+	if command != "" {
+		text = tr(locale, "install.resume", command)
+	}
+	_, err := slack.New(token).PostEphemeral(channelID, userID, slack.MsgOptionText(text, false))
+	return err
+}
+
+// sendOnboardingMessage sends a getting started direct message to the user
+// that installed the app.
+func sendOnboardingMessage(token, userID string) error {
+	locale := localeFor(token, userID)
+	slackClient := slack.New(token)
+	channel, _, _, err := slackClient.OpenConversation(
+		&slack.OpenConversationParameters{
+			Users: []string{userID},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	msg := tr(locale, "onboarding.text")
+	_, _, err = slackClient.PostMessage(
+		channel.ID,
+		slack.MsgOptionText(tr(locale, "onboarding.title"), false),
+		slack.MsgOptionBlocks(
+			slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "onboarding.title"), true, false)),
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, msg, false, false), nil, nil),
+			setupButton(locale),
+		),
+	)
+	return err
 }
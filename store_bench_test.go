@@ -0,0 +1,99 @@
+package jitsi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// itemTable serves the item requests of a store from items in memory, keyed
+// by their partition key, in place of dynamodb.
+type itemTable struct {
+	partitionKey string
+	items        map[string]map[string]types.AttributeValue
+}
+
+func (t *itemTable) key(key map[string]types.AttributeValue) string {
+	if s, ok := key[t.partitionKey].(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	return ""
+}
+
+func (t *itemTable) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: t.items[t.key(params.Key)]}, nil
+}
+
+func (t *itemTable) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	t.items[t.key(params.Item)] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (t *itemTable) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (t *itemTable) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(t.items, t.key(params.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func newItemTable(b *testing.B, partitionKey string, items ...interface{}) *itemTable {
+	t := &itemTable{partitionKey: partitionKey, items: make(map[string]map[string]types.AttributeValue)}
+	for _, item := range items {
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			b.Fatal(err)
+		}
+		t.items[t.key(av)] = av
+	}
+	return t
+}
+
+func BenchmarkGetTokenForTeam(b *testing.B) {
+	store := &TokenStore{
+		TableName: "tokens",
+		DAX: newItemTable(b, KeyTeamID, &TokenData{
+			TeamID:      "T123",
+			AccessToken: "xoxb-123",
+			Scope:       "commands,chat:write",
+			BotUserID:   "U123",
+		}),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		token, err := store.GetTokenForTeam("T123")
+		if err != nil || token.AccessToken != "xoxb-123" {
+			b.Fatal(token, err)
+		}
+	}
+}
+
+func BenchmarkServerCfgStoreGet(b *testing.B) {
+	store := &ServerCfgStore{
+		TableName: "server-config",
+		DAX: newItemTable(b, KeyTeamIDSrvCfg, map[string]interface{}{
+			KeyTeamIDSrvCfg: "T123",
+			"server-url":    "https://meet.example.com",
+			"room-naming":   "words",
+			"permissions":   map[string]string{"record": "admins"},
+		}),
+		ServerDefaults: ServerDefaults{
+			DefaultServer:           "https://meet.jit.si",
+			TenantScopedURLs:        func(string) bool { return false },
+			AuthenticatedURLSupport: func(string) bool { return false },
+		},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		cfg, err := store.Get("T123")
+		if err != nil || cfg.Server != "https://meet.example.com" {
+			b.Fatal(cfg, err)
+		}
+	}
+}
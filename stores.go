@@ -0,0 +1,226 @@
+package jitsi
+
+import (
+	"errors"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/go-redis/redis/v8"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// StoreBackendDynamoDB stores tokens and server configuration in aws
+	// dynamodb. It is the default backend.
+	StoreBackendDynamoDB = "dynamodb"
+
+	errUnsupportedBackend = "unsupported_store_backend"
+	errMissingStoreTable  = "missing_store_table"
+	errMissingRedis       = "missing_redis"
+	errMissingBolt        = "missing_bolt"
+	errMissingFirestore   = "missing_firestore"
+	errMissingMongo       = "missing_mongo"
+)
+
+// TokenReadWriter provides an interface for storing the bot tokens of the
+// teams that installed the app and the user tokens of the users that
+// authorized it.
+type TokenReadWriter interface {
+	TokenReader
+	TokenWriter
+	UserTokenReadWriter
+}
+
+// ServerConfigReadWriter provides an interface for storing the server
+// configuration of teams.
+type ServerConfigReadWriter interface {
+	ServerConfigReader
+	ServerConfigWriter
+}
+
+// Stores are the stores every deployment needs, provided by a storage
+// backend. Stores may also implement TeamDataRemover, UserDataRemover and
+// TeamDataExporter to take part in uninstalls, data deletion and export.
+// The stores of optional features, e.g. meetings, invites or the audit log,
+// are not provided by a backend and are dynamodb tables with every backend.
+type Stores struct {
+	Tokens       TokenReadWriter
+	ServerConfig ServerConfigReadWriter
+}
+
+// StoreConfig configures the storage backend of the service.
+type StoreConfig struct {
+	// Backend is the storage backend, StoreBackendDynamoDB when empty.
+	Backend string
+	// DB, TokenTable and ServerCfgTable configure the dynamodb backend.
+	// ConsistentReads is optional and reads its tables with strongly
+	// consistent reads. DAX is optional and serves the item requests of the
+	// tables from a DAX cluster.
+	DB              *dynamodb.Client
+	TokenTable      string
+	ServerCfgTable  string
+	ConsistentReads bool
+	DAX             DynamoItemAPI
+	// Redis, RedisPrefix and RedisTTL configure the redis backend, or the
+	// redis cache in front of the dynamodb backend when RedisCache is set.
+	Redis       redis.UniversalClient
+	RedisPrefix string
+	RedisTTL    time.Duration
+	RedisCache  bool
+	// Bolt is the data file of the bolt backend opened with OpenBoltDB.
+	Bolt *bolt.DB
+	// Firestore is the client of the firestore backend.
+	Firestore *firestore.Client
+	// Mongo is the database of the mongodb backend connected with
+	// ConnectMongoDB.
+	Mongo *mongo.Database
+	// ServerCfgCacheTTL is optional and caches the server configuration of
+	// teams in process for that long.
+	ServerCfgCacheTTL time.Duration
+	// Cipher is optional and encrypts the access tokens that are stored.
+	Cipher         TokenCipher
+	ServerDefaults ServerDefaults
+}
+
+// NewStores creates the stores of the configured backend.
+func NewStores(cfg StoreConfig) (*Stores, error) {
+	stores, err := backendStores(cfg)
+	if err != nil || cfg.ServerCfgCacheTTL <= 0 {
+		return stores, err
+	}
+	stores.ServerConfig = &MemoryServerCfgCache{
+		ServerConfig: stores.ServerConfig,
+		TTL:          cfg.ServerCfgCacheTTL,
+	}
+	return stores, nil
+}
+
+func backendStores(cfg StoreConfig) (*Stores, error) {
+	switch cfg.Backend {
+	case "", StoreBackendDynamoDB:
+		stores, err := dynamoStores(cfg)
+		if err != nil || !cfg.RedisCache {
+			return stores, err
+		}
+		return redisCache(cfg, stores)
+	case StoreBackendRedis:
+		return redisStores(cfg, cfg.RedisTTL)
+	case StoreBackendBolt:
+		if cfg.Bolt == nil {
+			return nil, errors.New(errMissingBolt)
+		}
+		return &Stores{
+			Tokens: &BoltTokenStore{
+				DB:     cfg.Bolt,
+				Cipher: cfg.Cipher,
+			},
+			ServerConfig: &BoltServerCfgStore{
+				DB:             cfg.Bolt,
+				ServerDefaults: cfg.ServerDefaults,
+			},
+		}, nil
+	case StoreBackendFirestore:
+		if cfg.Firestore == nil {
+			return nil, errors.New(errMissingFirestore)
+		}
+		return &Stores{
+			Tokens: &FirestoreTokenStore{
+				Client: cfg.Firestore,
+				Cipher: cfg.Cipher,
+			},
+			ServerConfig: &FirestoreServerCfgStore{
+				Client:         cfg.Firestore,
+				ServerDefaults: cfg.ServerDefaults,
+			},
+		}, nil
+	case StoreBackendMongoDB:
+		if cfg.Mongo == nil {
+			return nil, errors.New(errMissingMongo)
+		}
+		return &Stores{
+			Tokens: &MongoTokenStore{
+				DB:     cfg.Mongo,
+				Cipher: cfg.Cipher,
+			},
+			ServerConfig: &MongoServerCfgStore{
+				DB:             cfg.Mongo,
+				ServerDefaults: cfg.ServerDefaults,
+			},
+		}, nil
+	case StoreBackendMemory:
+		return &Stores{
+			Tokens: &MemoryTokenStore{},
+			ServerConfig: &MemoryServerCfgStore{
+				ServerDefaults: cfg.ServerDefaults,
+			},
+		}, nil
+	}
+	return nil, errors.New(errUnsupportedBackend)
+}
+
+func dynamoStores(cfg StoreConfig) (*Stores, error) {
+	if cfg.TokenTable == "" || cfg.ServerCfgTable == "" {
+		return nil, errors.New(errMissingStoreTable)
+	}
+	return &Stores{
+		Tokens: &TokenStore{
+			TableName:      cfg.TokenTable,
+			DB:             cfg.DB,
+			Cipher:         cfg.Cipher,
+			ConsistentRead: cfg.ConsistentReads,
+			DAX:            cfg.DAX,
+		},
+		ServerConfig: &ServerCfgStore{
+			TableName:      cfg.ServerCfgTable,
+			DB:             cfg.DB,
+			ConsistentRead: cfg.ConsistentReads,
+			DAX:            cfg.DAX,
+			ServerDefaults: cfg.ServerDefaults,
+		},
+	}, nil
+}
+
+func redisStores(cfg StoreConfig, ttl time.Duration) (*Stores, error) {
+	if cfg.Redis == nil {
+		return nil, errors.New(errMissingRedis)
+	}
+	return &Stores{
+		Tokens: &RedisTokenStore{
+			Client: cfg.Redis,
+			Prefix: cfg.RedisPrefix,
+			TTL:    ttl,
+			Cipher: cfg.Cipher,
+		},
+		ServerConfig: &RedisServerCfgStore{
+			Client:         cfg.Redis,
+			Prefix:         cfg.RedisPrefix,
+			TTL:            ttl,
+			ServerDefaults: cfg.ServerDefaults,
+		},
+	}, nil
+}
+
+// redisCache caches the stores in redis. Cached entries expire after
+// DefaultRedisCacheTTL unless a time to live is configured.
+func redisCache(cfg StoreConfig, stores *Stores) (*Stores, error) {
+	ttl := cfg.RedisTTL
+	if ttl <= 0 {
+		ttl = DefaultRedisCacheTTL
+	}
+	cache, err := redisStores(cfg, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &Stores{
+		Tokens: &RedisTokenCache{
+			Cache:  cache.Tokens.(*RedisTokenStore),
+			Tokens: stores.Tokens,
+		},
+		ServerConfig: &RedisServerCfgCache{
+			Cache:        cache.ServerConfig.(*RedisServerCfgStore),
+			ServerConfig: stores.ServerConfig,
+		},
+	}, nil
+}
@@ -0,0 +1,138 @@
+package jitsi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// featureLivestreaming is the meeting token feature allowing a participant
+// to live stream the meeting.
+const featureLivestreaming = "livestreaming"
+
+// streamKeyRE matches the stream keys of streaming services such as youtube,
+// e.g. abcd-efgh-ijkl-mnop-qrst
+var streamKeyRE = regexp.MustCompile(`^[A-Za-z0-9_-]{4,64}$`)
+
+// RoomStreamer prepares the live stream of a meeting on the conference
+// server.
+type RoomStreamer interface {
+	StreamRoom(teamID, teamName string, meeting *Meeting, streamKey string) error
+}
+
+// LiveStreamAPI passes stream keys to an endpoint of a prosody module. The
+// module is expected to provide the key to the recorder once the host starts
+// the live stream. Requests are authorized with a meeting token for the room.
+type LiveStreamAPI struct {
+	// Server is the conference server providing the endpoint. Meetings on
+	// other servers cannot be streamed.
+	Server string
+	// Endpoint is the url of the live stream endpoint.
+	// (e.g. https://meet.example.com/live-stream)
+	Endpoint string
+	// MUCDomain is the domain of the conference rooms.
+	MUCDomain             string
+	MeetingTokenGenerator MeetingTokenGenerator
+}
+
+// StreamRoom sets the stream key of the meeting's room.
+func (l *LiveStreamAPI) StreamRoom(teamID, teamName string, meeting *Meeting, streamKey string) error {
+	conference, ok := roomJID(l.Server, l.MUCDomain, meeting.URL, meeting.RoomName)
+	if !ok {
+		return fmt.Errorf("live stream: %s is not hosted on %s", meeting.URL, l.Server)
+	}
+	jwt, err := l.MeetingTokenGenerator.CreateJWT(JWTInput{
+		TenantID:   teamID,
+		TenantName: teamName,
+		RoomClaim:  meeting.RoomName,
+	})
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"stream_key": streamKey})
+	if err != nil {
+		return err
+	}
+
+	endpoint := l.Endpoint + "?" + url.Values{
+		"conference": {conference},
+	}.Encode()
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("live stream: %s", resp.Status)
+	}
+	return nil
+}
+
+// StreamEvent is sent once the live stream of a room started.
+type StreamEvent struct {
+	RoomName string `json:"room_name"`
+	// URL is where the public can watch the stream. The url provided by the
+	// host is used when it is empty.
+	URL string `json:"url"`
+}
+
+// StreamHandler is used to announce live streams in the channels their
+// meetings were started from once they are live.
+type StreamHandler struct {
+	// Secret is the bearer token stream events are authorized with.
+	Secret      string
+	Meetings    MeetingReadWriter
+	TokenReader TokenReader
+}
+
+// Handle handles stream events posted by the conference server.
+func (h *StreamHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if !authorizedEvent(r, h.Secret) {
+		hlog.FromRequest(r).Warn().Msg("stream event unauthorized")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var event StreamEvent
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		hlog.FromRequest(r).Warn().Err(err).Msg("malformed stream event")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	meeting, ok := meetingForEvent(w, r, h.Meetings, event.RoomName)
+	if !ok {
+		return
+	}
+	streamURL := event.URL
+	if streamURL == "" {
+		streamURL = meeting.StreamURL
+	}
+	msg := tr(meeting.Locale, "stream.live", meeting.HostID, meeting.URL)
+	if validWebURL(streamURL) {
+		msg = tr(meeting.Locale, "stream.live_url", meeting.HostID, streamURL, meeting.URL)
+	}
+	err = postToMeetingChannel(h.TokenReader, meeting, msg)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("meeting_id", meeting.MeetingID).
+			Msg("announcing live stream")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,47 @@
+package jitsi
+
+import (
+	"sync"
+	"time"
+)
+
+// DelayedTasks runs tasks after a delay within the process. Pending tasks
+// are lost when the process exits.
+type DelayedTasks struct {
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]*time.Timer
+	stopped bool
+}
+
+// After schedules the task to run once the delay has passed.
+func (d *DelayedTasks) After(delay time.Duration, task func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	if d.pending == nil {
+		d.pending = make(map[int]*time.Timer)
+	}
+	id := d.nextID
+	d.nextID++
+	d.pending[id] = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+		task()
+	})
+}
+
+// Stop cancels all pending tasks and prevents new ones from being
+// scheduled.
+func (d *DelayedTasks) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	for id, timer := range d.pending {
+		timer.Stop()
+		delete(d.pending, id)
+	}
+}
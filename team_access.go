@@ -0,0 +1,377 @@
+package jitsi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// KeyTeamAccessTeamID is the dynamo key for the team an access entry
+	// applies to. This key is the partition key.
+	KeyTeamAccessTeamID = "team-id"
+
+	// TeamAccessBlocked and TeamAccessAllowed are the access a team is
+	// listed with. Blocked teams are always denied and allowed teams are the
+	// only teams served in allowlist mode.
+	TeamAccessBlocked = "blocked"
+	TeamAccessAllowed = "allowed"
+
+	// AuditTeamAccess is recorded when the access of a team is listed or
+	// unlisted through the admin api. The target is the access.
+	AuditTeamAccess = "team_access"
+
+	errMissingTeamAccess = "missing_team_access"
+	errInvalidTeamAccess = "invalid_team_access"
+	errTeamDenied        = "team_denied"
+
+	// teamAccessCacheTTL is how long the access of a team is cached. Changes
+	// made through another instance take effect once it expired.
+	teamAccessCacheTTL = time.Minute
+)
+
+// TeamAccess lists a team as blocked or allowed.
+type TeamAccess struct {
+	TeamID string `json:"team_id" dynamodbav:"team-id"`
+	Access string `json:"access" dynamodbav:"access"`
+	// Reason is optional and notes why the team was listed, e.g. the
+	// ticket of an abuse report.
+	Reason    string `json:"reason,omitempty" dynamodbav:"reason,omitempty"`
+	UpdatedAt int64  `json:"updated_at" dynamodbav:"updated-at"`
+}
+
+// TeamAccessReadWriter provides an interface for reading and changing the
+// teams that are blocked or allowed.
+type TeamAccessReadWriter interface {
+	Get(teamID string) (*TeamAccess, error)
+	List() ([]*TeamAccess, error)
+	Store(access *TeamAccess) error
+	Remove(teamID string) error
+}
+
+// validTeamAccess returns whether teams may be listed with the access.
+func validTeamAccess(access string) bool {
+	return access == TeamAccessBlocked || access == TeamAccessAllowed
+}
+
+// TeamGate denies blocked teams, or every team that is not allowed in
+// allowlist mode, before their requests reach the handlers.
+type TeamGate struct {
+	Access TeamAccessReadWriter
+	// Allowlist restricts the service to the allowed teams, e.g. for
+	// private deployments.
+	Allowlist bool
+
+	mu    sync.Mutex
+	cache map[string]cachedTeamAccess
+}
+
+// cachedTeamAccess is the access of a team along with when it was looked
+// up. The access is empty for teams that are not listed.
+type cachedTeamAccess struct {
+	access  string
+	fetched time.Time
+}
+
+// Allowed returns whether the team may use the service. Teams are allowed
+// when their access cannot be looked up unless the gate is in allowlist
+// mode.
+func (g *TeamGate) Allowed(log *zerolog.Logger, teamID string) bool {
+	access, err := g.access(teamID)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("team", teamID).
+			Msg("retrieving team access")
+		return !g.Allowlist
+	}
+	if access == TeamAccessBlocked {
+		return false
+	}
+	return !g.Allowlist || access == TeamAccessAllowed
+}
+
+// access returns the cached access of the team, looking it up when it is
+// not cached or expired.
+func (g *TeamGate) access(teamID string) (string, error) {
+	g.mu.Lock()
+	cached, ok := g.cache[teamID]
+	g.mu.Unlock()
+	if ok && time.Since(cached.fetched) < teamAccessCacheTTL {
+		return cached.access, nil
+	}
+
+	var access string
+	entry, err := g.Access.Get(teamID)
+	switch {
+	case err == nil:
+		access = entry.Access
+	case err.Error() != errMissingTeamAccess:
+		return "", err
+	}
+	g.remember(teamID, access)
+	return access, nil
+}
+
+// remember caches the access of the team.
+func (g *TeamGate) remember(teamID, access string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cache == nil {
+		g.cache = make(map[string]cachedTeamAccess)
+	}
+	g.cache[teamID] = cachedTeamAccess{access: access, fetched: time.Now()}
+}
+
+// Check is middleware that denies the requests of teams that may not use
+// the service. Requests must be verified by a RequestVerifier first. Slash
+// commands are answered with an ephemeral message, while events and
+// interactions are acknowledged and dropped so that slack does not retry
+// them. Requests without a team, e.g. url verifications, are let through.
+func (g *TeamGate) Check(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Err(err).
+				Msg("reading request body")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		teamID, command := requestTeam(r.Header.Get("Content-Type"), body)
+		if teamID == "" || g.Allowed(hlog.FromRequest(r), teamID) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		hlog.FromRequest(r).Info().
+			Str("team", teamID).
+			Msg("denying team request")
+		if command {
+			renderError(w, DefaultLocale(), "error.team_denied")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// requestTeam returns the team of a slack request body and whether it is
+// a slash command. Slash commands and interactions are form encoded, with
+// interactions carrying a json payload, and events are json.
+func requestTeam(contentType string, body []byte) (string, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != ContentTypeForm {
+		var event struct {
+			TeamID string `json:"team_id"`
+		}
+		json.Unmarshal(body, &event)
+		return event.TeamID, false
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", false
+	}
+	if payload := form.Get("payload"); payload != "" {
+		var interaction struct {
+			Team struct {
+				ID string `json:"id"`
+			} `json:"team"`
+		}
+		json.Unmarshal([]byte(payload), &interaction)
+		return interaction.Team.ID, false
+	}
+	return form.Get("team_id"), form.Get("command") != ""
+}
+
+// TeamAccessStore stores and retrieves the access of teams from aws
+// dynamodb.
+type TeamAccessStore struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+// Get retrieves the access the team is listed with.
+func (t *TeamAccessStore) Get(teamID string) (*TeamAccess, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyTeamAccessTeamID: teamID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := t.DB.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(t.TableName),
+		Key:       key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, errors.New(errMissingTeamAccess)
+	}
+
+	var access TeamAccess
+	err = attributevalue.UnmarshalMap(result.Item, &access)
+	if err != nil {
+		return nil, err
+	}
+	return &access, nil
+}
+
+// List retrieves every listed team. The table is scanned, so it is only
+// used by the admin api.
+func (t *TeamAccessStore) List() ([]*TeamAccess, error) {
+	entries := []*TeamAccess{}
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := t.DB.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:         aws.String(t.TableName),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var page []*TeamAccess
+		err = attributevalue.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return entries, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// Store will persist the access of a team, replacing its previous access.
+func (t *TeamAccessStore) Store(access *TeamAccess) error {
+	av, err := attributevalue.MarshalMap(access)
+	if err != nil {
+		return err
+	}
+	_, err = t.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(t.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// Remove will unlist a team.
+func (t *TeamAccessStore) Remove(teamID string) error {
+	return deleteTeamItem(t.DB, t.TableName, KeyTeamAccessTeamID, teamID)
+}
+
+// TeamAccessHandler manages the blocked and allowed teams through the
+// admin api, e.g. PUT /admin/teams?team=T123&access=blocked&reason=abuse
+// GET lists the listed teams as json and DELETE unlists a team.
+type TeamAccessHandler struct {
+	// Secret is the bearer token changes are authorized with.
+	Secret string
+	Gate   *TeamGate
+	// Audit is optional and records the changes.
+	Audit AuditWriter
+}
+
+// Handle returns the listed teams, or blocks, allows or unlists a team,
+// depending on the method.
+func (t *TeamAccessHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if !authorizedEvent(r, t.Secret) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodGet {
+		t.list(w, r)
+		return
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	teamID := r.URL.Query().Get("team")
+	if teamID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the previous access is kept for the audit log
+	var before, after interface{}
+	var previous string
+	if entry, err := t.Gate.Access.Get(teamID); err == nil {
+		before, previous = entry, entry.Access
+	}
+	var access string
+	var err error
+	if r.Method == http.MethodDelete {
+		err = t.Gate.Access.Remove(teamID)
+	} else {
+		entry := &TeamAccess{
+			TeamID:    teamID,
+			Access:    r.URL.Query().Get("access"),
+			Reason:    r.URL.Query().Get("reason"),
+			UpdatedAt: time.Now().Unix(),
+		}
+		if !validTeamAccess(entry.Access) {
+			hlog.FromRequest(r).Warn().
+				Err(errors.New(errInvalidTeamAccess)).
+				Str("access", entry.Access).
+				Msg("changing team access")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		err = t.Gate.Access.Store(entry)
+		after, access = entry, entry.Access
+	}
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("team", teamID).
+			Msg("changing team access")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// the change takes effect on this instance right away
+	t.Gate.remember(teamID, access)
+	target := access
+	if target == "" {
+		target = previous
+	}
+	recordAudit(hlog.FromRequest(r), t.Audit, newAuditEvent(teamID, "", AuditTeamAccess, target, before, after))
+	hlog.FromRequest(r).Info().
+		Str("team", teamID).
+		Str("access", access).
+		Msg("changed team access")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list writes the listed teams as json.
+func (t *TeamAccessHandler) list(w http.ResponseWriter, r *http.Request) {
+	entries, err := t.Gate.Access.List()
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("listing team access")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
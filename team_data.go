@@ -0,0 +1,331 @@
+package jitsi
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog"
+)
+
+// TeamDataRemover provides an interface for removing the data stored for a
+// team once it uninstalls the app.
+type TeamDataRemover interface {
+	RemoveTeam(teamID string) error
+}
+
+// UserDataRemover provides an interface for removing the data stored for a
+// user of a team once they ask for it to be deleted.
+type UserDataRemover interface {
+	RemoveUser(teamID, userID string) error
+}
+
+// removeTeamData removes the data of a team from every store. A store
+// failing to remove the data does not keep the others from removing it.
+func removeTeamData(log *zerolog.Logger, teamID string, stores []TeamDataRemover) {
+	for _, store := range stores {
+		err := store.RemoveTeam(teamID)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("team", teamID).
+				Msg("removing team data")
+		}
+	}
+}
+
+// deleteTeamItem deletes the item of a team from a table keyed by the team.
+func deleteTeamItem(db DynamoItemAPI, table, teamKey, teamID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{teamKey: teamID})
+	if err != nil {
+		return err
+	}
+	_, err = db.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key:       key,
+	})
+	return err
+}
+
+// deleteUserItem deletes the item of a user from a table partitioned by the
+// team and sorted by the user.
+func deleteUserItem(db *dynamodb.Client, table, teamKey, userKey, teamID, userID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{teamKey: teamID, userKey: userID})
+	if err != nil {
+		return err
+	}
+	_, err = db.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key:       key,
+	})
+	return err
+}
+
+// deleteTeamItems deletes the items of a team from a table partitioned by
+// the team and sorted by sortKey.
+func deleteTeamItems(db *dynamodb.Client, table, teamKey, sortKey, teamID string) error {
+	return deleteTeamItemsWhere(db, table, teamKey, sortKey, teamID, nil)
+}
+
+// deleteTeamItemsWhere deletes the items of a team that match the filter
+// from a table partitioned by the team and sorted by sortKey. All items of
+// the team are deleted when the filter is nil.
+func deleteTeamItemsWhere(db *dynamodb.Client, table, teamKey, sortKey, teamID string, filter *expression.ConditionBuilder) error {
+	keyCond := expression.Key(teamKey).Equal(expression.Value(teamID))
+	proj := expression.NamesList(expression.Name(teamKey), expression.Name(sortKey))
+	builder := expression.NewBuilder().WithKeyCondition(keyCond).WithProjection(proj)
+	if filter != nil {
+		builder = builder.WithFilter(*filter)
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return err
+	}
+
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := db.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:                 aws.String(table),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ProjectionExpression:      expr.Projection(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return err
+		}
+		err = deleteItems(db, table, result.Items)
+		if err != nil {
+			return err
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// deleteScannedItems deletes the items that match the filter from a table
+// that is not partitioned by the team. The table is scanned, so it is only
+// used for data deletion requests.
+func deleteScannedItems(db *dynamodb.Client, table string, filter expression.ConditionBuilder, keys ...string) error {
+	names := make([]expression.NameBuilder, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, expression.Name(key))
+	}
+	proj := expression.NamesList(names[0], names[1:]...)
+	expr, err := expression.NewBuilder().WithFilter(filter).WithProjection(proj).Build()
+	if err != nil {
+		return err
+	}
+
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := db.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:                 aws.String(table),
+			FilterExpression:          expr.Filter(),
+			ProjectionExpression:      expr.Projection(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return err
+		}
+		err = deleteItems(db, table, result.Items)
+		if err != nil {
+			return err
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// deleteItems deletes the items by their keys.
+func deleteItems(db *dynamodb.Client, table string, keys []map[string]types.AttributeValue) error {
+	for _, key := range keys {
+		_, err := db.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+			TableName: aws.String(table),
+			Key:       key,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveTeam will remove the server configuration of a team.
+func (s *ServerCfgStore) RemoveTeam(teamID string) error {
+	return deleteTeamItem(s.items(), s.TableName, KeyTeamIDSrvCfg, teamID)
+}
+
+// RemoveTeam will remove the message configuration of a team.
+func (m *MessageCfgStore) RemoveTeam(teamID string) error {
+	return m.Remove(teamID)
+}
+
+// RemoveTeam will remove the preferences of the users of a team.
+func (u *UserPrefsStore) RemoveTeam(teamID string) error {
+	return deleteTeamItems(u.DB, u.TableName, KeyUserPrefsTeamID, KeyUserPrefsUserID, teamID)
+}
+
+// RemoveTeam will remove the personal rooms of the users of a team.
+func (p *PersonalRoomStore) RemoveTeam(teamID string) error {
+	return deleteTeamItems(p.DB, p.TableName, KeyPersonalRoomTeamID, KeyPersonalRoomUserID, teamID)
+}
+
+// RemoveTeam will remove the identities the users of a team linked.
+func (i *IdentityStore) RemoveTeam(teamID string) error {
+	return deleteTeamItems(i.DB, i.TableName, KeyIdentityTeamID, KeyIdentityUserID, teamID)
+}
+
+// RemoveTeam will remove the standing rooms of the channels of a team.
+func (c *ChannelRoomStore) RemoveTeam(teamID string) error {
+	return deleteTeamItems(c.DB, c.TableName, KeyChannelRoomTeamID, KeyChannelRoomChannelID, teamID)
+}
+
+// RemoveTeam will remove the config changes of a team.
+func (c *ConfigHistoryStore) RemoveTeam(teamID string) error {
+	return deleteTeamItems(c.DB, c.TableName, KeyConfigChangeTeamID, KeyConfigChangeID, teamID)
+}
+
+// RemoveUser will remove the preferences of a user.
+func (u *UserPrefsStore) RemoveUser(teamID, userID string) error {
+	return deleteUserItem(u.DB, u.TableName, KeyUserPrefsTeamID, KeyUserPrefsUserID, teamID, userID)
+}
+
+// RemoveUser will remove the personal room of a user.
+func (p *PersonalRoomStore) RemoveUser(teamID, userID string) error {
+	return deleteUserItem(p.DB, p.TableName, KeyPersonalRoomTeamID, KeyPersonalRoomUserID, teamID, userID)
+}
+
+// RemoveUser will remove the identity a user linked.
+func (i *IdentityStore) RemoveUser(teamID, userID string) error {
+	return i.Remove(teamID, userID)
+}
+
+// RemoveTeam will remove the token of a team along with the user tokens of
+// its users.
+func (t *TokenStore) RemoveTeam(teamID string) error {
+	return t.Remove(teamID)
+}
+
+// RemoveUser will remove the user token of a user.
+func (t *TokenStore) RemoveUser(teamID, userID string) error {
+	return t.RemoveUserToken(teamID, userID)
+}
+
+// RemoveTeam will remove the calendar tokens of the users of a team. The
+// table is scanned since it is keyed by token.
+func (c *CalendarTokenStore) RemoveTeam(teamID string) error {
+	filter := expression.Name(KeyCalendarTokenID).BeginsWith(teamID + "/")
+	return deleteScannedItems(c.DB, c.TableName, filter, KeyCalendarTokenID)
+}
+
+// RemoveUser will remove the calendar tokens of a user.
+func (c *CalendarTokenStore) RemoveUser(teamID, userID string) error {
+	for _, provider := range []string{CalendarProviderGoogle, CalendarProviderMicrosoft} {
+		err := c.Remove(teamID, userID, provider)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveTeam will remove the meeting history of a team.
+func (m *MeetingStore) RemoveTeam(teamID string) error {
+	return deleteTeamItems(m.DB, m.TableName, KeyMeetingTeamID, KeyMeetingID, teamID)
+}
+
+// RemoveUser will remove the meetings a user hosted and remove them from the
+// attendees of the other meetings of the team.
+func (m *MeetingStore) RemoveUser(teamID, userID string) error {
+	hosted := expression.Name("host-id").Equal(expression.Value(userID))
+	err := deleteTeamItemsWhere(m.DB, m.TableName, KeyMeetingTeamID, KeyMeetingID, teamID, &hosted)
+	if err != nil {
+		return err
+	}
+
+	keyCond := expression.Key(KeyMeetingTeamID).Equal(expression.Value(teamID))
+	attended := expression.Name(KeyMeetingAttendees).Contains(userID)
+	proj := expression.NamesList(expression.Name(KeyMeetingTeamID), expression.Name(KeyMeetingID))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(attended).WithProjection(proj).Build()
+	if err != nil {
+		return err
+	}
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := m.DB.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:                 aws.String(m.TableName),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ProjectionExpression:      expr.Projection(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range result.Items {
+			_, err = m.DB.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+				TableName:        aws.String(m.TableName),
+				Key:              key,
+				UpdateExpression: aws.String("DELETE #a :u"),
+				ExpressionAttributeNames: map[string]string{
+					"#a": KeyMeetingAttendees,
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":u": &types.AttributeValueMemberSS{Value: []string{userID}},
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// RemoveTeam will remove the invites sent in a team. The table is scanned
+// since it is keyed by meeting.
+func (i *InviteStore) RemoveTeam(teamID string) error {
+	filter := expression.Name("team-id").Equal(expression.Value(teamID))
+	return deleteScannedItems(i.DB, i.TableName, filter, KeyInviteMeetingID, KeyInviteUserID)
+}
+
+// RemoveUser will remove the invites a user sent or received.
+func (i *InviteStore) RemoveUser(teamID, userID string) error {
+	filter := expression.Name("team-id").Equal(expression.Value(teamID)).
+		And(expression.Name(KeyInviteUserID).Equal(expression.Value(userID)).
+			Or(expression.Name("host-id").Equal(expression.Value(userID))))
+	return deleteScannedItems(i.DB, i.TableName, filter, KeyInviteMeetingID, KeyInviteUserID)
+}
+
+// RemoveTeam will remove the usage events of a team.
+func (u *UsageStore) RemoveTeam(teamID string) error {
+	return deleteTeamItems(u.DB, u.TableName, KeyUsageTeamID, KeyUsageEventID, teamID)
+}
+
+// RemoveTeam will remove the feedback the users of a team submitted.
+func (f *FeedbackStore) RemoveTeam(teamID string) error {
+	return deleteTeamItems(f.DB, f.TableName, KeyFeedbackTeamID, KeyFeedbackID, teamID)
+}
+
+// RemoveUser will remove the feedback a user submitted.
+func (f *FeedbackStore) RemoveUser(teamID, userID string) error {
+	filter := expression.Name("user-id").Equal(expression.Value(userID))
+	return deleteTeamItemsWhere(f.DB, f.TableName, KeyFeedbackTeamID, KeyFeedbackID, teamID, &filter)
+}
@@ -12,7 +12,7 @@ import (
 // TokenGenerator generates conference tokens for auth'ed users.
 type TokenGenerator struct {
 	Lifetime   time.Duration
-	PrivateKey string
+	PrivateKey *Secret
 	Issuer     string
 	Audience   string
 	Kid        string
@@ -26,12 +26,31 @@ type JWTInput struct {
 	UserID     string
 	UserName   string
 	AvatarURL  string
+	// Email is optional and is the verified email of the user.
+	Email string
+	// Lifetime is the time the token is valid for. The lifetime of the
+	// generator is used when it is zero.
+	Lifetime time.Duration
+	// Expires is optional and caps the expiry of the token, e.g. at the
+	// expiry of the meeting.
+	Expires time.Time
+	// Moderator grants the user moderator rights in the room.
+	Moderator bool
+	// Features are the features enabled for the user, e.g. recording.
+	Features []string
 }
 
 // CreateJWT generates conference tokens for auth'ed users.
 func (g TokenGenerator) CreateJWT(in JWTInput) (string, error) {
 	now := time.Now()
-	exp := now.Add(g.Lifetime)
+	lifetime := g.Lifetime
+	if in.Lifetime > 0 {
+		lifetime = in.Lifetime
+	}
+	exp := now.Add(lifetime)
+	if !in.Expires.IsZero() && in.Expires.Before(exp) {
+		exp = in.Expires
+	}
 	claims := jwt.MapClaims{
 		"iss":  g.Issuer,
 		"nbf":  now.Unix(),
@@ -44,14 +63,17 @@ func (g TokenGenerator) CreateJWT(in JWTInput) (string, error) {
 				DisplayName: in.UserName,
 				ID:          in.UserID,
 				AvatarURL:   in.AvatarURL,
+				Email:       in.Email,
+				Moderator:   in.Moderator,
 			},
-			Group: in.TenantName,
+			Group:    in.TenantName,
+			Features: featureClaim(in.Features),
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
 	token.Header["kid"] = g.Kid
 
-	data, err := dataurl.DecodeString(g.PrivateKey)
+	data, err := dataurl.DecodeString(g.PrivateKey.Value())
 	if err != nil {
 		return "", err
 	}
@@ -81,9 +103,25 @@ type userClaim struct {
 	ID          string `json:"id"`
 	DisplayName string `json:"name"`
 	AvatarURL   string `json:"avatar"`
+	Email       string `json:"email,omitempty"`
+	Moderator   bool   `json:"moderator,omitempty"`
 }
 
 type contextClaim struct {
-	User  userClaim `json:"user"`
-	Group string    `json:"group"`
+	User     userClaim         `json:"user"`
+	Group    string            `json:"group"`
+	Features map[string]string `json:"features,omitempty"`
+}
+
+// featureClaim enables the features in the format of the features claim,
+// e.g. {"recording": "true"}
+func featureClaim(features []string) map[string]string {
+	if len(features) == 0 {
+		return nil
+	}
+	claim := make(map[string]string, len(features))
+	for _, f := range features {
+		claim[f] = "true"
+	}
+	return claim
 }
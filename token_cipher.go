@@ -0,0 +1,160 @@
+package jitsi
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+const (
+	KeyTokenKeyID   = "key-id"   // key the access token is encrypted with
+	KeyTokenDataKey = "data-key" // encrypted data key of the access token
+
+	errInvalidCiphertext = "invalid_ciphertext"
+
+	// maxCachedDataKeys limits the decrypted data keys kept in memory.
+	maxCachedDataKeys = 1000
+)
+
+// EncryptedToken is an access token encrypted at rest.
+type EncryptedToken struct {
+	// KeyID identifies the key the token is encrypted with so that tokens
+	// stay readable when the key is rotated.
+	KeyID string `dynamodbav:"key-id"`
+	// DataKey is the encrypted data key of envelope encryption. It is empty
+	// for ciphers encrypting tokens directly.
+	DataKey    []byte `dynamodbav:"data-key,omitempty"`
+	Ciphertext []byte `dynamodbav:"access-token"`
+}
+
+// TokenCipher provides an interface for encrypting the access tokens stored
+// in the token table. The id is the key of the item the token is stored in
+// and binds the ciphertext to it.
+type TokenCipher interface {
+	Encrypt(id, token string) (*EncryptedToken, error)
+	Decrypt(id string, enc *EncryptedToken) (string, error)
+}
+
+// KMSDataKeyAPI provides an interface for generating and decrypting the data
+// keys of envelope encryption with aws kms.
+type KMSDataKeyAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMSTokenCipher encrypts access tokens with envelope encryption. Each token
+// is encrypted with its own data key, which is encrypted with the aws kms key.
+type KMSTokenCipher struct {
+	Client KMSDataKeyAPI
+	// KeyID is the id, arn or alias of the kms key new tokens are encrypted
+	// with.
+	KeyID string
+
+	mu sync.Mutex
+	// dataKeys are decrypted data keys by their ciphertext, since tokens
+	// are read far more often than they are written.
+	dataKeys map[string][]byte
+}
+
+// Encrypt encrypts the token with a new data key.
+func (k *KMSTokenCipher) Encrypt(id, token string) (*EncryptedToken, error) {
+	resp, err := k.Client.GenerateDataKey(context.TODO(), &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(k.KeyID),
+		KeySpec:           kmstypes.DataKeySpecAes256,
+		EncryptionContext: map[string]string{KeyTeamID: id},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := sealToken(resp.Plaintext, id, token)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedToken{
+		KeyID:      aws.ToString(resp.KeyId),
+		DataKey:    resp.CiphertextBlob,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// Decrypt decrypts the data key of the token with kms and the token with
+// the data key. Older keys decrypt as long as kms permits using them.
+func (k *KMSTokenCipher) Decrypt(id string, enc *EncryptedToken) (string, error) {
+	dataKey, err := k.dataKey(id, enc.DataKey)
+	if err != nil {
+		return "", err
+	}
+	return openToken(dataKey, id, enc.Ciphertext)
+}
+
+func (k *KMSTokenCipher) dataKey(id string, encrypted []byte) ([]byte, error) {
+	k.mu.Lock()
+	dataKey, ok := k.dataKeys[string(encrypted)]
+	k.mu.Unlock()
+	if ok {
+		return dataKey, nil
+	}
+
+	resp, err := k.Client.Decrypt(context.TODO(), &kms.DecryptInput{
+		CiphertextBlob:    encrypted,
+		EncryptionContext: map[string]string{KeyTeamID: id},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.dataKeys == nil || len(k.dataKeys) >= maxCachedDataKeys {
+		k.dataKeys = make(map[string][]byte)
+	}
+	k.dataKeys[string(encrypted)] = resp.Plaintext
+	return resp.Plaintext, nil
+}
+
+// sealToken encrypts the token with aes-gcm, authenticating the id of its
+// item. The nonce is prepended to the ciphertext.
+func sealToken(key []byte, id, token string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, []byte(token), []byte(id)), nil
+}
+
+// openToken decrypts a token encrypted with sealToken.
+func openToken(key []byte, id string, ciphertext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", errors.New(errInvalidCiphertext)
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	token, err := gcm.Open(nil, nonce, sealed, []byte(id))
+	if err != nil {
+		return "", errors.New(errInvalidCiphertext)
+	}
+	return string(token), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
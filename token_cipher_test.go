@@ -0,0 +1,188 @@
+package jitsi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+func testDataKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSealToken(t *testing.T) {
+	key := testDataKey(t)
+	sealed, err := sealToken(key, "T123", "xoxb-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("xoxb-123")) {
+		t.Fatal("sealed token contains the token")
+	}
+	again, err := sealToken(key, "T123", "xoxb-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing the token twice gave the same ciphertext")
+	}
+	if token, err := openToken(key, "T123", sealed); err != nil || token != "xoxb-123" {
+		t.Fatalf("openToken = %q, %v, want the token", token, err)
+	}
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 1
+	tests := []struct {
+		name       string
+		key        []byte
+		id         string
+		ciphertext []byte
+	}{
+		{name: "other item id", key: key, id: "T456", ciphertext: sealed},
+		{name: "user token item id", key: key, id: "T123/U123", ciphertext: sealed},
+		{name: "other key", key: testDataKey(t), id: "T123", ciphertext: sealed},
+		{name: "truncated tag", key: key, id: "T123", ciphertext: sealed[:len(sealed)-1]},
+		{name: "only the nonce", key: key, id: "T123", ciphertext: sealed[:12]},
+		{name: "shorter than the nonce", key: key, id: "T123", ciphertext: sealed[:5]},
+		{name: "empty", key: key, id: "T123"},
+		{name: "modified", key: key, id: "T123", ciphertext: flipped},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := openToken(test.key, test.id, test.ciphertext)
+			if err == nil || err.Error() != errInvalidCiphertext {
+				t.Errorf("openToken = %q, %v, want %s", token, err, errInvalidCiphertext)
+			}
+		})
+	}
+}
+
+// dataKeyService generates and decrypts data keys in place of kms. Like kms
+// it only decrypts a data key with the encryption context it was generated
+// with.
+type dataKeyService struct {
+	mu       sync.Mutex
+	keys     map[string][]byte
+	contexts map[string]string
+	decrypts int
+}
+
+func (s *dataKeyService) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = make(map[string][]byte)
+		s.contexts = make(map[string]string)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	blob := fmt.Sprintf("data-key-%d", len(s.keys))
+	s.keys[blob] = key
+	s.contexts[blob] = params.EncryptionContext[KeyTeamID]
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          params.KeyId,
+		Plaintext:      key,
+		CiphertextBlob: []byte(blob),
+	}, nil
+}
+
+func (s *dataKeyService) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decrypts++
+	blob := string(params.CiphertextBlob)
+	key, ok := s.keys[blob]
+	if !ok || s.contexts[blob] != params.EncryptionContext[KeyTeamID] {
+		return nil, errors.New("InvalidCiphertextException")
+	}
+	return &kms.DecryptOutput{Plaintext: key}, nil
+}
+
+func (s *dataKeyService) decryptCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.decrypts
+}
+
+func TestKMSTokenCipher(t *testing.T) {
+	service := &dataKeyService{}
+	k := &KMSTokenCipher{Client: service, KeyID: "alias/tokens"}
+	enc, err := k.Encrypt("T123", "xoxb-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc.KeyID != "alias/tokens" || len(enc.DataKey) == 0 {
+		t.Fatalf("encrypted token = %+v, want the key and its data key", enc)
+	}
+	for n := 0; n < 3; n++ {
+		token, err := k.Decrypt("T123", enc)
+		if err != nil || token != "xoxb-123" {
+			t.Fatalf("Decrypt = %q, %v, want the token", token, err)
+		}
+	}
+	if got := service.decryptCount(); got != 1 {
+		t.Errorf("decrypted the data key %d times, want it cached after once", got)
+	}
+
+	// the cached data key does not open the token for another item
+	if token, err := k.Decrypt("T456", enc); err == nil {
+		t.Errorf("Decrypt under another item id = %q, want an error", token)
+	}
+	// nor does kms decrypt the data key for another item
+	if token, err := (&KMSTokenCipher{Client: service}).Decrypt("T456", enc); err == nil {
+		t.Errorf("Decrypt under another item id = %q, want an error", token)
+	}
+}
+
+func TestKMSTokenCipherEvictsDataKeys(t *testing.T) {
+	service := &dataKeyService{}
+	k := &KMSTokenCipher{Client: service, KeyID: "alias/tokens"}
+	first, err := k.Encrypt("T0", "xoxb-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Decrypt("T0", first); err != nil {
+		t.Fatal(err)
+	}
+	// filling the cache drops the data keys cached before
+	for n := 1; n <= maxCachedDataKeys; n++ {
+		id := fmt.Sprintf("T%d", n)
+		out, err := service.GenerateDataKey(context.Background(), &kms.GenerateDataKeyInput{
+			KeyId:             aws.String(k.KeyID),
+			EncryptionContext: map[string]string{KeyTeamID: id},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := k.dataKey(id, out.CiphertextBlob); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k.mu.Lock()
+	cached := len(k.dataKeys)
+	k.mu.Unlock()
+	if cached > maxCachedDataKeys {
+		t.Fatalf("cached %d data keys, want at most %d", cached, maxCachedDataKeys)
+	}
+	decrypts := service.decryptCount()
+	token, err := k.Decrypt("T0", first)
+	if err != nil || token != "xoxb-0" {
+		t.Fatalf("Decrypt after eviction = %q, %v, want the token", token, err)
+	}
+	if got := service.decryptCount(); got != decrypts+1 {
+		t.Errorf("decrypted the evicted data key %d times, want once", got-decrypts)
+	}
+}
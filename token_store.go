@@ -3,90 +3,413 @@ package jitsi
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/slack-go/slack"
 )
 
 const (
-	KeyTeamID      = "team-id"      // primary key; slack team id
+	KeyTeamID      = "team-id"      // primary key; slack team id or team/user for user tokens
 	KeyAccessToken = "access-token" // oauth access token
+	KeyUserIDs     = "user-ids"     // users of the team with a stored user token
+
+	errMissingUserToken   = "missing_user_token"
+	errMissingTokenCipher = "missing_token_cipher"
 )
 
+// tokenAttributes are the attributes of the token data of a team, which
+// Store replaces.
+var tokenAttributes = []string{KeyAccessToken, KeyTokenKeyID, KeyTokenDataKey, "scope", "bot-user-id", "app-id", "authed-user-id", "enterprise-id"}
+
 // TokenData is the access token data stored from oauth.
 type TokenData struct {
-	TeamID      string `json:"team-id"`
-	AccessToken string `json:"access-token"`
+	TeamID      string `json:"team-id" dynamodbav:"team-id"`
+	AccessToken string `json:"access-token" dynamodbav:"access-token"`
+	// Scope is the comma separated list of scopes granted to the app, e.g.
+	// commands,chat:write. It is empty for tokens stored before the scopes
+	// were recorded.
+	Scope string `json:"scope,omitempty" dynamodbav:"scope,omitempty"`
+	// BotUserID is the user id of the app's bot in the workspace.
+	BotUserID string `json:"bot-user-id,omitempty" dynamodbav:"bot-user-id,omitempty"`
+	// AppID is the id of the installed slack app.
+	AppID string `json:"app-id,omitempty" dynamodbav:"app-id,omitempty"`
+	// AuthedUserID is the user that installed the app.
+	AuthedUserID string `json:"authed-user-id,omitempty" dynamodbav:"authed-user-id,omitempty"`
+	// EnterpriseID is the enterprise grid organization of the workspace.
+	EnterpriseID string `json:"enterprise-id,omitempty" dynamodbav:"enterprise-id,omitempty"`
+}
+
+// UserTokenData is the user-scoped access token data stored from oauth for a
+// user that authorized the app. Tokens are stored next to the token of their
+// team, keyed by team and user.
+type UserTokenData struct {
+	TeamID      string `json:"team-id" dynamodbav:"-"`
+	UserID      string `json:"user-id" dynamodbav:"user-id"`
+	AccessToken string `json:"access-token" dynamodbav:"access-token"`
+	// Scope is the comma separated list of user scopes granted, e.g.
+	// dnd:read,users:read
+	Scope string `json:"scope,omitempty" dynamodbav:"scope,omitempty"`
+}
+
+// userTokenData creates the user token data of an oauth v2 install. It is
+// nil when the installing user granted no user scopes.
+func userTokenData(resp *slack.OAuthV2Response) *UserTokenData {
+	if resp.AuthedUser.AccessToken == "" {
+		return nil
+	}
+	return &UserTokenData{
+		TeamID:      resp.Team.ID,
+		UserID:      resp.AuthedUser.ID,
+		AccessToken: resp.AuthedUser.AccessToken,
+		Scope:       resp.AuthedUser.Scope,
+	}
+}
+
+// userTokenID is the key of the user token of a user in the token table.
+func userTokenID(teamID, userID string) string {
+	return fmt.Sprintf("%s/%s", teamID, userID)
+}
+
+// tokenData creates the token data of an oauth v2 install.
+func tokenData(resp *slack.OAuthV2Response) *TokenData {
+	return &TokenData{
+		TeamID:       resp.Team.ID,
+		AccessToken:  resp.AccessToken,
+		Scope:        resp.Scope,
+		BotUserID:    resp.BotUserID,
+		AppID:        resp.AppID,
+		AuthedUserID: resp.AuthedUser.ID,
+		EnterpriseID: resp.Enterprise.ID,
+	}
+}
+
+// missingScopes returns the required scopes that were not granted to the
+// token. Nothing is missing when the granted scopes are unknown.
+func (t *TokenData) missingScopes(required []string) []string {
+	if t.Scope == "" {
+		return nil
+	}
+	granted := make(map[string]bool)
+	for _, scope := range strings.Split(t.Scope, ",") {
+		granted[strings.TrimSpace(scope)] = true
+	}
+	var missing []string
+	for _, scope := range required {
+		if scope != "" && !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
 }
 
 // TokenStore stores and retrieves access tokens from aws dynamodb.
 type TokenStore struct {
 	TableName string
 	DB        *dynamodb.Client
+	// Cipher is optional and encrypts the access tokens that are stored.
+	// Tokens stored before they were encrypted are still read.
+	Cipher TokenCipher
+	// ConsistentRead is optional and reads tokens with strongly consistent
+	// reads, so a reinstall is seen at once at twice the read cost.
+	ConsistentRead bool
+	// DAX is optional and serves the item requests of the store instead of
+	// DB, e.g. a DAXClient caching the table.
+	DAX DynamoItemAPI
+}
+
+// items returns the client item requests are served by.
+func (t *TokenStore) items() DynamoItemAPI {
+	if t.DAX != nil {
+		return t.DAX
+	}
+	return t.DB
+}
+
+// encrypt replaces the access token of an item with its ciphertext when
+// tokens are encrypted.
+func (t *TokenStore) encrypt(id string, item map[string]types.AttributeValue) error {
+	if t.Cipher == nil {
+		return nil
+	}
+	var token string
+	err := attributevalue.Unmarshal(item[KeyAccessToken], &token)
+	if err != nil {
+		return err
+	}
+	enc, err := t.Cipher.Encrypt(id, token)
+	if err != nil {
+		return err
+	}
+	av, err := attributevalue.MarshalMap(enc)
+	if err != nil {
+		return err
+	}
+	for k, v := range av {
+		item[k] = v
+	}
+	return nil
+}
+
+// decrypt replaces the ciphertext of an item with its access token. Items
+// without a key id were stored in plaintext and are left as they are.
+func (t *TokenStore) decrypt(id string, item map[string]types.AttributeValue) error {
+	if _, ok := item[KeyTokenKeyID]; !ok {
+		return nil
+	}
+	if t.Cipher == nil {
+		return errors.New(errMissingTokenCipher)
+	}
+	var enc EncryptedToken
+	err := attributevalue.UnmarshalMap(item, &enc)
+	if err != nil {
+		return err
+	}
+	token, err := t.Cipher.Decrypt(id, &enc)
+	if err != nil {
+		return err
+	}
+	item[KeyAccessToken] = &types.AttributeValueMemberS{Value: token}
+	return nil
 }
 
 // GetToken retrieves the access token stored with the provided team id.
 func (t *TokenStore) GetTokenForTeam(teamID string) (*TokenData, error) {
-	keyCond := expression.Key(KeyTeamID).Equal(expression.Value(teamID))
-	builder := expression.NewBuilder().WithKeyCondition(keyCond)
-	expr, err := builder.Build()
+	result, err := t.items().GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName:      aws.String(t.TableName),
+		Key:            tokenKey(teamID),
+		ConsistentRead: aws.Bool(t.ConsistentRead),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Item) == 0 {
+		return nil, errors.New(errMissingAuthToken)
+	}
+	err = t.decrypt(teamID, result.Item)
 	if err != nil {
 		return nil, err
 	}
-	queryInput := &dynamodb.QueryInput{
-		KeyConditionExpression:    expr.KeyCondition(),
+
+	var data TokenData
+	err = attributevalue.UnmarshalMap(result.Item, &data)
+	if err != nil {
+		return nil, err
+	}
+	data.TeamID = teamID
+	return &data, nil
+}
+
+// Store will store access token data. The item is updated rather than
+// replaced so that the users of the team with a user token stay known.
+func (t *TokenStore) Store(data *TokenData) error {
+	av, err := attributevalue.MarshalMap(data)
+	if err != nil {
+		return err
+	}
+	err = t.encrypt(data.TeamID, av)
+	if err != nil {
+		return err
+	}
+	var update expression.UpdateBuilder
+	for _, name := range tokenAttributes {
+		if v, ok := av[name]; ok {
+			update = update.Set(expression.Name(name), expression.Value(v))
+		} else {
+			update = update.Remove(expression.Name(name))
+		}
+	}
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return err
+	}
+	_, err = t.items().UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(t.TableName),
+		Key:                       map[string]types.AttributeValue{KeyTeamID: av[KeyTeamID]},
+		UpdateExpression:          expr.Update(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
-		TableName:                 aws.String(t.TableName),
+	})
+	return err
+}
+
+// Remove will remove access token data for the team, including the user
+// tokens of its users.
+func (t *TokenStore) Remove(teamID string) error {
+	userIDs, err := t.UserIDs(teamID)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		_, err = t.items().DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+			TableName: aws.String(t.TableName),
+			Key:       tokenKey(userTokenID(teamID, userID)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = t.items().DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(t.TableName),
+		Key:       tokenKey(teamID),
+	})
+	return err
+}
+
+// UserIDs lists the users of a team with a stored user token.
+func (t *TokenStore) UserIDs(teamID string) ([]string, error) {
+	result, err := t.items().GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName:            aws.String(t.TableName),
+		Key:                  tokenKey(teamID),
+		ConsistentRead:       aws.Bool(t.ConsistentRead),
+		ProjectionExpression: aws.String("#u"),
+		ExpressionAttributeNames: map[string]string{
+			"#u": KeyUserIDs,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var item struct {
+		UserIDs []string `dynamodbav:"user-ids,stringset"`
 	}
-	result, err := t.DB.Query(context.TODO(), queryInput)
+	err = attributevalue.UnmarshalMap(result.Item, &item)
 	if err != nil {
 		return nil, err
 	}
+	return item.UserIDs, nil
+}
 
-	if len(result.Items) < 1 {
-		return nil, errors.New(errMissingAuthToken)
+// TeamIDs lists the teams with a stored token. The table is scanned, so it
+// is only used by the admin api.
+func (t *TokenStore) TeamIDs() ([]string, error) {
+	var teamIDs []string
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := t.DB.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:            aws.String(t.TableName),
+			ProjectionExpression: aws.String("#t"),
+			ExpressionAttributeNames: map[string]string{
+				"#t": KeyTeamID,
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Items {
+			id, ok := item[KeyTeamID].(*types.AttributeValueMemberS)
+			// user tokens are keyed by team/user
+			if ok && !strings.Contains(id.Value, "/") {
+				teamIDs = append(teamIDs, id.Value)
+			}
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return teamIDs, nil
+		}
+		startKey = result.LastEvaluatedKey
 	}
+}
 
-	var token string
-	err = attributevalue.Unmarshal(result.Items[0][KeyAccessToken], &token)
+// GetTokenForUser retrieves the user token stored for the user of a team.
+func (t *TokenStore) GetTokenForUser(teamID, userID string) (*UserTokenData, error) {
+	result, err := t.items().GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName:      aws.String(t.TableName),
+		Key:            tokenKey(userTokenID(teamID, userID)),
+		ConsistentRead: aws.Bool(t.ConsistentRead),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, errors.New(errMissingUserToken)
+	}
+	err = t.decrypt(userTokenID(teamID, userID), result.Item)
 	if err != nil {
 		return nil, err
 	}
 
-	return &TokenData{
-		TeamID:      teamID,
-		AccessToken: token,
-	}, nil
+	var data UserTokenData
+	err = attributevalue.UnmarshalMap(result.Item, &data)
+	if err != nil {
+		return nil, err
+	}
+	data.TeamID = teamID
+	return &data, nil
 }
 
-// Store will store access token data.
-func (t *TokenStore) Store(data *TokenData) error {
-	av, err := attributevalue.MarshalMap(map[string]string{
-		KeyTeamID:      data.TeamID,
-		KeyAccessToken: data.AccessToken,
+// StoreUserToken will store the user token of a user. The token of the team
+// must be stored first, since the team records which of its users have a
+// user token.
+func (t *TokenStore) StoreUserToken(data *UserTokenData) error {
+	_, err := t.items().UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:           aws.String(t.TableName),
+		Key:                 tokenKey(data.TeamID),
+		UpdateExpression:    aws.String("ADD #u :u"),
+		ConditionExpression: aws.String("attribute_exists(#t)"),
+		ExpressionAttributeNames: map[string]string{
+			"#t": KeyTeamID,
+			"#u": KeyUserIDs,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":u": &types.AttributeValueMemberSS{Value: []string{data.UserID}},
+		},
 	})
 	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return errors.New(errMissingAuthToken)
+		}
 		return err
 	}
-	_, err = t.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+
+	av, err := attributevalue.MarshalMap(data)
+	if err != nil {
+		return err
+	}
+	id := userTokenID(data.TeamID, data.UserID)
+	err = t.encrypt(id, av)
+	if err != nil {
+		return err
+	}
+	av[KeyTeamID] = &types.AttributeValueMemberS{Value: id}
+	_, err = t.items().PutItem(context.TODO(), &dynamodb.PutItemInput{
 		TableName: aws.String(t.TableName),
 		Item:      av,
 	})
 	return err
 }
 
-// Remove will remove access token data for the user.
-func (t *TokenStore) Remove(teamID string) error {
-	av, err := attributevalue.MarshalMap(map[string]string{
-		KeyTeamID: teamID,
-	})
-	dii := &dynamodb.DeleteItemInput{
+// RemoveUserToken will remove the user token of a user.
+func (t *TokenStore) RemoveUserToken(teamID, userID string) error {
+	_, err := t.items().DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
 		TableName: aws.String(t.TableName),
-		Key:       av,
+		Key:       tokenKey(userTokenID(teamID, userID)),
+	})
+	if err != nil {
+		return err
 	}
-	_, err = t.DB.DeleteItem(context.TODO(), dii)
+	_, err = t.items().UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:        aws.String(t.TableName),
+		Key:              tokenKey(teamID),
+		UpdateExpression: aws.String("DELETE #u :u"),
+		ExpressionAttributeNames: map[string]string{
+			"#u": KeyUserIDs,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":u": &types.AttributeValueMemberSS{Value: []string{userID}},
+		},
+	})
 	return err
 }
+
+// tokenKey is the key of an item of the token table.
+func tokenKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{KeyTeamID: &types.AttributeValueMemberS{Value: id}}
+}
@@ -0,0 +1,101 @@
+package jitsi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// featureTranscription is the meeting token feature allowing a
+	// participant to transcribe the meeting.
+	featureTranscription = "transcription"
+	// maxTranscriptLength limits the transcript text accepted from the
+	// transcriber.
+	maxTranscriptLength = 1 << 20
+)
+
+// TranscriptEvent is sent once the transcript of a meeting is finished, e.g.
+// by jigasi when the meeting ended.
+type TranscriptEvent struct {
+	RoomName string `json:"room_name"`
+	// URL is where the transcript can be read.
+	URL string `json:"url"`
+	// Text is the transcript. It is uploaded to the channel when the event
+	// has no url.
+	Text string `json:"text"`
+}
+
+// TranscriptHandler is used to deliver finished transcripts to the channels
+// their meetings were started from.
+type TranscriptHandler struct {
+	// Secret is the bearer token transcript events are authorized with.
+	Secret      string
+	Meetings    MeetingReadWriter
+	TokenReader TokenReader
+}
+
+// Handle handles transcript events posted by the transcriber.
+func (h *TranscriptHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if !authorizedEvent(r, h.Secret) {
+		hlog.FromRequest(r).Warn().Msg("transcript event unauthorized")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var event TranscriptEvent
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		hlog.FromRequest(r).Warn().Err(err).Msg("malformed transcript event")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	event.Text = strings.TrimSpace(event.Text)
+	if !validWebURL(event.URL) && (event.Text == "" || len(event.Text) > maxTranscriptLength) {
+		hlog.FromRequest(r).Warn().Msg("transcript event without url or text")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	meeting, ok := meetingForEvent(w, r, h.Meetings, event.RoomName)
+	if !ok {
+		return
+	}
+	if validWebURL(event.URL) {
+		err = postToMeetingChannel(h.TokenReader, meeting, tr(meeting.Locale, "transcript.ready", event.URL, meeting.URL, meeting.RoomName))
+	} else {
+		err = uploadTranscript(h.TokenReader, meeting, event.Text)
+	}
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Str("meeting_id", meeting.MeetingID).
+			Msg("delivering transcript")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadTranscript uploads the transcript of a meeting to the channel it was
+// started from, in the thread of its announcement when the app posted it.
+func uploadTranscript(tokens TokenReader, meeting *MeetingRecord, text string) error {
+	token, err := tokens.GetTokenForTeam(meeting.TeamID)
+	if err != nil {
+		return err
+	}
+	_, err = slack.New(token.AccessToken).UploadFile(slack.FileUploadParameters{
+		Content:         text,
+		Filetype:        "text",
+		Filename:        meeting.RoomName + "-transcript.txt",
+		Title:           tr(meeting.Locale, "transcript.title", meeting.RoomName),
+		InitialComment:  tr(meeting.Locale, "transcript.uploaded", meeting.URL, meeting.RoomName),
+		Channels:        []string{meeting.ChannelID},
+		ThreadTimestamp: meeting.MessageTS,
+	})
+	return err
+}
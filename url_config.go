@@ -0,0 +1,89 @@
+package jitsi
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	errInvalidURLConfig = "invalid_url_config"
+
+	// maxURLConfigOverrides limits the config overrides of a team.
+	maxURLConfigOverrides = 20
+	// maxURLConfigValueLength limits the length of a config override value.
+	maxURLConfigValueLength = 100
+)
+
+// urlConfigKeyRE matches the conference config keys teams may override, e.g.
+// config.p2p.enabled or interfaceConfig.SHOW_CHROME_EXTENSION_BANNER
+var urlConfigKeyRE = regexp.MustCompile(`^(config|interfaceConfig)(\.[a-zA-Z_][a-zA-Z0-9_]*)+$`)
+
+// parseURLConfig parses a config override for the url fragment of meeting
+// links, e.g. p2p.enabled=false or config.subject="Weekly sync". Values that
+// are not booleans or numbers are quoted strings.
+func parseURLConfig(override string) (key, value string, err error) {
+	i := strings.Index(override, "=")
+	if i < 1 {
+		return "", "", errors.New(errInvalidURLConfig)
+	}
+	key, err = parseURLConfigKey(override[:i])
+	if err != nil {
+		return "", "", err
+	}
+	value = strings.Trim(override[i+1:], `"`)
+	if value == "" || len(value) > maxURLConfigValueLength {
+		return "", "", errors.New(errInvalidURLConfig)
+	}
+	if _, err := strconv.ParseFloat(value, 64); err != nil && value != "true" && value != "false" {
+		value = url.PathEscape(strconv.Quote(value))
+	}
+	return key, value, nil
+}
+
+// parseURLConfigKey parses the key of a config override. Keys without a
+// prefix are config keys.
+func parseURLConfigKey(key string) (string, error) {
+	if !strings.HasPrefix(key, "config.") && !strings.HasPrefix(key, "interfaceConfig.") {
+		key = "config." + key
+	}
+	if !urlConfigKeyRE.MatchString(key) {
+		return "", errors.New(errInvalidURLConfig)
+	}
+	return key, nil
+}
+
+// setURLConfig returns the overrides with the value of the key replaced or
+// added.
+func setURLConfig(overrides []string, key, value string) []string {
+	updated := unsetURLConfig(overrides, key)
+	return append(updated, key+"="+value)
+}
+
+// unsetURLConfig returns the overrides without the key.
+func unsetURLConfig(overrides []string, key string) []string {
+	var updated []string
+	for _, o := range overrides {
+		if !strings.HasPrefix(o, key+"=") {
+			updated = append(updated, o)
+		}
+	}
+	return updated
+}
+
+// urlConfigSummary describes the config overrides of a team.
+func urlConfigSummary(locale string, overrides []string) string {
+	if len(overrides) == 0 {
+		return tr(locale, "config.none") + "\n" + tr(locale, "config.usage")
+	}
+	lines := make([]string, 0, len(overrides))
+	for _, o := range overrides {
+		if v, err := url.PathUnescape(o); err == nil {
+			o = v
+		}
+		lines = append(lines, "`"+o+"`")
+	}
+	return tr(locale, "config.current", strings.Join(lines, "\n")) + "\n" + tr(locale, "config.usage")
+}
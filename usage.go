@@ -0,0 +1,205 @@
+package jitsi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// KeyUsageTeamID is the dynamo key for the team of a usage event. This
+	// key is the partition key.
+	KeyUsageTeamID = "team-id"
+	// KeyUsageEventID is the dynamo key for the usage event id. This key is
+	// the sort key and sorts events by creation time.
+	KeyUsageEventID = "event-id"
+
+	// UsageMeetingStarted is the kind of event recorded for every meeting
+	// started from slack.
+	UsageMeetingStarted = "meeting_started"
+
+	// usageWeek and usageMonth are the periods usage is reported for.
+	usageWeek  = 7 * 24 * time.Hour
+	usageMonth = 30 * 24 * time.Hour
+	// maxTopChannels limits the channels listed in usage reports.
+	maxTopChannels = 3
+)
+
+// UsageEvent records the use of the app by a team.
+type UsageEvent struct {
+	TeamID  string `dynamodbav:"team-id"`
+	EventID string `dynamodbav:"event-id"`
+	Kind    string `dynamodbav:"kind"`
+	// ChannelID is the channel the app was used in.
+	ChannelID string `dynamodbav:"channel"`
+	// Invitees is the number of users personally invited to a meeting.
+	Invitees  int   `dynamodbav:"invitees"`
+	CreatedAt int64 `dynamodbav:"created-at"`
+}
+
+// UsageReadWriter provides an interface for recording and reading the usage
+// of teams.
+type UsageReadWriter interface {
+	Record(event *UsageEvent) error
+	Since(teamID string, since time.Time) ([]*UsageEvent, error)
+}
+
+// newMeetingStarted creates the usage event of a started meeting.
+func newMeetingStarted(teamID, channelID string, invitees int) *UsageEvent {
+	now := time.Now()
+	return &UsageEvent{
+		TeamID:    teamID,
+		EventID:   xid.NewWithTime(now).String(),
+		Kind:      UsageMeetingStarted,
+		ChannelID: channelID,
+		Invitees:  invitees,
+		CreatedAt: now.Unix(),
+	}
+}
+
+// recordUsage stores a usage event when usage reports are enabled. Failing
+// to record usage does not affect the meeting.
+func recordUsage(log *zerolog.Logger, usage UsageReadWriter, event *UsageEvent) {
+	if usage == nil {
+		return
+	}
+	err := usage.Record(event)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Msg("recording usage")
+	}
+}
+
+// usageReport summarizes the meetings a team started.
+type usageReport struct {
+	Week        int
+	Month       int
+	TopChannels []channelUsage
+	// AvgInvitees is the average number of personal invites per meeting in
+	// the last month.
+	AvgInvitees float64
+}
+
+// channelUsage is the number of meetings started in a channel.
+type channelUsage struct {
+	ChannelID string
+	Meetings  int
+}
+
+// newUsageReport summarizes the usage events of the last month.
+func newUsageReport(events []*UsageEvent, now time.Time) usageReport {
+	var report usageReport
+	var invitees int
+	channels := make(map[string]int)
+	for _, event := range events {
+		created := time.Unix(event.CreatedAt, 0)
+		if event.Kind != UsageMeetingStarted || now.Sub(created) > usageMonth {
+			continue
+		}
+		report.Month++
+		if now.Sub(created) <= usageWeek {
+			report.Week++
+		}
+		invitees += event.Invitees
+		if event.ChannelID != "" {
+			channels[event.ChannelID]++
+		}
+	}
+	if report.Month > 0 {
+		report.AvgInvitees = float64(invitees) / float64(report.Month)
+	}
+	for channelID, meetings := range channels {
+		report.TopChannels = append(report.TopChannels, channelUsage{ChannelID: channelID, Meetings: meetings})
+	}
+	sort.Slice(report.TopChannels, func(i, j int) bool {
+		a, b := report.TopChannels[i], report.TopChannels[j]
+		if a.Meetings != b.Meetings {
+			return a.Meetings > b.Meetings
+		}
+		return a.ChannelID < b.ChannelID
+	})
+	if len(report.TopChannels) > maxTopChannels {
+		report.TopChannels = report.TopChannels[:maxTopChannels]
+	}
+	return report
+}
+
+// usageSummary describes the usage report of a team.
+func usageSummary(locale string, report *usageReport) string {
+	lines := []string{tr(locale, "stats.meetings", report.Week, report.Month)}
+	if len(report.TopChannels) > 0 {
+		channels := make([]string, 0, len(report.TopChannels))
+		for _, c := range report.TopChannels {
+			channels = append(channels, tr(locale, "stats.channel", c.ChannelID, c.Meetings))
+		}
+		lines = append(lines, tr(locale, "stats.channels", strings.Join(channels, ", ")))
+	}
+	lines = append(lines, tr(locale, "stats.invitees", fmt.Sprintf("%.1f", report.AvgInvitees)))
+	return strings.Join(lines, "\n")
+}
+
+// UsageStore stores and retrieves usage events from aws dynamodb.
+type UsageStore struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+// Record will persist the usage event.
+func (u *UsageStore) Record(event *UsageEvent) error {
+	av, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		return err
+	}
+	_, err = u.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(u.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// Since retrieves the usage events of the team created since the provided
+// time.
+func (u *UsageStore) Since(teamID string, since time.Time) ([]*UsageEvent, error) {
+	keyCond := expression.Key(KeyUsageTeamID).Equal(expression.Value(teamID)).
+		And(expression.Key(KeyUsageEventID).GreaterThanEqual(expression.Value(xid.NewWithTime(since).String())))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*UsageEvent
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := u.DB.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:                 aws.String(u.TableName),
+			KeyConditionExpression:    expr.KeyCondition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var page []*UsageEvent
+		err = attributevalue.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return events, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,165 @@
+package jitsi
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const (
+	// KeyUserPrefsTeamID is the dynamo key for the team of a user. This key
+	// is the partition key.
+	KeyUserPrefsTeamID = "team-id"
+	// KeyUserPrefsUserID is the dynamo key for the user. This key is the
+	// sort key.
+	KeyUserPrefsUserID = "user-id"
+)
+
+// localeRE matches the locales users may prefer, e.g. de or pt-BR.
+var localeRE = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z]{2,4})?$`)
+
+// preferableFlags are the meeting flags users may set for every meeting they
+// start. Joining muted has a preference of its own. A preferred record flag
+// is checked against the record permission of the team for every meeting.
+var preferableFlags = []string{flagNoVideo, flagLobby, flagE2EE, flagRecord, flagTranscribe}
+
+// UserPrefs are the defaults a user prefers for their meetings. Empty fields
+// use the defaults of the team.
+type UserPrefs struct {
+	TeamID string `dynamodbav:"team-id"`
+	UserID string `dynamodbav:"user-id"`
+	// Server is the conference server meetings the user starts are hosted
+	// on.
+	Server string `dynamodbav:"server,omitempty"`
+	// StartMuted joins the user to meetings with their microphone muted.
+	StartMuted bool `dynamodbav:"start-muted,omitempty"`
+	// Locale is the language of the messages the user gets and of the
+	// conference interface.
+	Locale string `dynamodbav:"locale,omitempty"`
+	// Flags are the meeting flags set for every meeting the user starts,
+	// e.g. lobby.
+	Flags []string `dynamodbav:"flags,stringset,omitempty"`
+	// RoomName is the room the user chose for their personal room, which is
+	// used instead of the generated one.
+	RoomName string `dynamodbav:"room,omitempty"`
+}
+
+// UserPrefsReader provides an interface for reading the preferences of
+// users.
+type UserPrefsReader interface {
+	Get(teamID, userID string) (UserPrefs, error)
+}
+
+// UserPrefsReadWriter provides an interface for reading and writing the
+// preferences of users.
+type UserPrefsReadWriter interface {
+	UserPrefsReader
+	Store(prefs *UserPrefs) error
+}
+
+// config returns the conference config overrides applying the preferences,
+// e.g. config.startWithAudioMuted=true
+func (p *UserPrefs) config() []string {
+	var config []string
+	if p.StartMuted {
+		config = append(config, "config.startWithAudioMuted=true")
+	}
+	if p.Locale != "" {
+		lang := strings.SplitN(normalizeLocale(p.Locale), "-", 2)[0]
+		config = append(config, "config.defaultLanguage="+url.QueryEscape(`"`+lang+`"`))
+	}
+	return config
+}
+
+// parsePreferredFlags returns the meeting flags of the command, e.g.
+// /jitsi prefs flags --lobby --no-video, and whether every flag may be
+// preferred.
+func parsePreferredFlags(cmd *Command) ([]string, bool) {
+	var flags []string
+	for _, flag := range preferableFlags {
+		if cmd.Flag(flag) {
+			flags = append(flags, flag)
+		}
+	}
+	return flags, len(flags) > 0 && len(flags) == len(cmd.Flags)
+}
+
+// prefsSummary describes the preferences of a user.
+func prefsSummary(locale string, p *UserPrefs) string {
+	value := func(v string) string {
+		if v == "" {
+			return tr(locale, "template.default")
+		}
+		return v
+	}
+	muted := tr(locale, "prefs.off")
+	if p.StartMuted {
+		muted = tr(locale, "prefs.on")
+	}
+	var flags []string
+	for _, flag := range p.Flags {
+		flags = append(flags, "--"+flag)
+	}
+	return tr(locale, "prefs.usage") + "\n" + tr(
+		locale,
+		"prefs.current",
+		value(p.Server),
+		muted,
+		value(p.Locale),
+		value(strings.Join(flags, " ")),
+		value(p.RoomName),
+	)
+}
+
+// UserPrefsStore stores and retrieves user preferences from aws dynamodb.
+type UserPrefsStore struct {
+	TableName string
+	DB        *dynamodb.Client
+}
+
+// Get retrieves the preferences of a user. Empty preferences are provided
+// if none are stored for the user.
+func (u *UserPrefsStore) Get(teamID, userID string) (UserPrefs, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{
+		KeyUserPrefsTeamID: teamID,
+		KeyUserPrefsUserID: userID,
+	})
+	if err != nil {
+		return UserPrefs{}, err
+	}
+	result, err := u.DB.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(u.TableName),
+		Key:       key,
+	})
+	if err != nil {
+		return UserPrefs{}, err
+	}
+	if len(result.Item) == 0 {
+		return UserPrefs{TeamID: teamID, UserID: userID}, nil
+	}
+
+	var prefs UserPrefs
+	err = attributevalue.UnmarshalMap(result.Item, &prefs)
+	if err != nil {
+		return UserPrefs{}, err
+	}
+	return prefs, nil
+}
+
+// Store will persist the preferences of a user.
+func (u *UserPrefsStore) Store(prefs *UserPrefs) error {
+	av, err := attributevalue.MarshalMap(prefs)
+	if err != nil {
+		return err
+	}
+	_, err = u.DB.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(u.TableName),
+		Item:      av,
+	})
+	return err
+}
@@ -0,0 +1,289 @@
+package jitsi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// callbackWorkflowStep is the callback id of the workflow step as
+	// configured for the app and of the modal configuring it.
+	callbackWorkflowStep = "create_meeting"
+
+	// interactionWorkflowStepEdit is the interaction of a workflow builder
+	// adding or editing the step.
+	interactionWorkflowStepEdit = "workflow_step_edit"
+	// eventWorkflowStepExecute is the event of a workflow running the step.
+	eventWorkflowStepExecute = "workflow_step_execute"
+
+	blockWorkflowRoom  = "room_name"
+	actionWorkflowRoom = "room_name"
+
+	// The inputs and outputs of the step. Later steps refer to the outputs
+	// by name.
+	workflowInputRoom  = "room_name"
+	workflowOutputURL  = "meeting_url"
+	workflowOutputRoom = "room_name"
+	workflowOutputType = "text"
+)
+
+// workflowStepInput is an input of the step. The value may contain variables
+// of earlier steps which slack replaces when the step is executed.
+type workflowStepInput struct {
+	Value string `json:"value"`
+}
+
+// workflowStepOutput is an output of the step that later steps may use.
+type workflowStepOutput struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+// workflowStepEdit is the part of the payloads of editing the step that
+// slack-go does not parse.
+type workflowStepEdit struct {
+	WorkflowStep struct {
+		WorkflowStepEditID string                       `json:"workflow_step_edit_id"`
+		Inputs             map[string]workflowStepInput `json:"inputs"`
+	} `json:"workflow_step"`
+}
+
+// workflowStepExecute is the event callback of a workflow running the step.
+type workflowStepExecute struct {
+	Type   string `json:"type"`
+	TeamID string `json:"team_id"`
+	Event  struct {
+		Type         string `json:"type"`
+		CallbackID   string `json:"callback_id"`
+		WorkflowStep struct {
+			WorkflowStepExecuteID string                       `json:"workflow_step_execute_id"`
+			Inputs                map[string]workflowStepInput `json:"inputs"`
+		} `json:"workflow_step"`
+	} `json:"event"`
+}
+
+// parseWorkflowStepExecute parses the event body when it is the execution of
+// the step, which the slackevents package does not know about.
+func parseWorkflowStepExecute(body []byte) (*workflowStepExecute, bool) {
+	var event workflowStepExecute
+	err := json.Unmarshal(body, &event)
+	if err != nil || event.Event.Type != eventWorkflowStepExecute || event.Event.CallbackID != callbackWorkflowStep {
+		return nil, false
+	}
+	return &event, true
+}
+
+// WorkflowStep provides the "Create Jitsi meeting" step of workflow builder.
+// The step creates a meeting, optionally in a room named by the workflow,
+// and provides its url and room name to later steps.
+type WorkflowStep struct {
+	TokenReader      TokenReader
+	MeetingGenerator *MeetingGenerator
+	// Usage is optional and enables recording meetings started by
+	// workflows for usage reports.
+	Usage UsageReadWriter
+}
+
+// workflowStepView creates the modal configuring the step.
+func workflowStepView(locale, room string) map[string]interface{} {
+	input := slack.NewPlainTextInputBlockElement(nil, actionWorkflowRoom)
+	input.InitialValue = room
+	block := slack.NewInputBlock(
+		blockWorkflowRoom,
+		slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "workflow.room.label"), false, false),
+		input,
+	)
+	block.Optional = true
+	block.Hint = slack.NewTextBlockObject(slack.PlainTextType, tr(locale, "workflow.room.hint"), false, false)
+	return map[string]interface{}{
+		"type":        "workflow_step",
+		"callback_id": callbackWorkflowStep,
+		"blocks":      slack.Blocks{BlockSet: []slack.Block{block}},
+	}
+}
+
+// edit opens the modal configuring the step for the workflow builder.
+func (s *WorkflowStep) edit(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback) {
+	var edit workflowStepEdit
+	err := json.Unmarshal([]byte(r.PostFormValue("payload")), &edit)
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("parsing workflow step edit")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	token, err := s.TokenReader.GetTokenForTeam(payload.Team.ID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	locale := localeFor(token.AccessToken, payload.User.ID)
+	err = slackAPI(token.AccessToken, "views.open", map[string]interface{}{
+		"trigger_id": payload.TriggerID,
+		"view":       workflowStepView(locale, edit.WorkflowStep.Inputs[workflowInputRoom].Value),
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("opening workflow step")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// save stores the configuration of the step with the workflow.
+func (s *WorkflowStep) save(w http.ResponseWriter, r *http.Request, payload *slack.InteractionCallback) {
+	var edit workflowStepEdit
+	err := json.Unmarshal([]byte(r.PostFormValue("payload")), &edit)
+	if err != nil {
+		hlog.FromRequest(r).Warn().
+			Err(err).
+			Msg("parsing workflow step")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	token, err := s.TokenReader.GetTokenForTeam(payload.Team.ID)
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("retrieving token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	locale := localeFor(token.AccessToken, payload.User.ID)
+	room := strings.TrimSpace(setupValue(payload.View.State, blockWorkflowRoom, actionWorkflowRoom))
+	err = slackAPI(token.AccessToken, "workflows.updateStep", map[string]interface{}{
+		"workflow_step_edit_id": edit.WorkflowStep.WorkflowStepEditID,
+		"inputs": map[string]workflowStepInput{
+			workflowInputRoom: {Value: room},
+		},
+		"outputs": []workflowStepOutput{
+			{Name: workflowOutputURL, Type: workflowOutputType, Label: tr(locale, "workflow.output.url")},
+			{Name: workflowOutputRoom, Type: workflowOutputType, Label: tr(locale, "workflow.output.room")},
+		},
+	})
+	if err != nil {
+		hlog.FromRequest(r).Error().
+			Err(err).
+			Msg("saving workflow step")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// execute creates the meeting of a running workflow and completes the step
+// with its url and room name, or fails the step.
+func (s *WorkflowStep) execute(log *zerolog.Logger, event *workflowStepExecute) {
+	step := event.Event.WorkflowStep
+	token, err := s.TokenReader.GetTokenForTeam(event.TeamID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("retrieving token for workflow step")
+		return
+	}
+	meeting, err := s.meeting(token.AccessToken, event.TeamID, strings.TrimSpace(step.Inputs[workflowInputRoom].Value))
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("generating meeting for workflow step")
+		message := tr(DefaultLocale(), "error.meeting")
+		if err.Error() == errInvalidRoomName {
+			message = tr(DefaultLocale(), "room.invalid")
+		}
+		err = slackAPI(token.AccessToken, "workflows.stepFailed", map[string]interface{}{
+			"workflow_step_execute_id": step.WorkflowStepExecuteID,
+			"error":                    map[string]string{"message": message},
+		})
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Msg("failing workflow step")
+		}
+		return
+	}
+	recordUsage(log, s.Usage, newMeetingStarted(event.TeamID, "", 0))
+	err = slackAPI(token.AccessToken, "workflows.stepCompleted", map[string]interface{}{
+		"workflow_step_execute_id": step.WorkflowStepExecuteID,
+		"outputs": map[string]string{
+			workflowOutputURL:  meeting.URL,
+			workflowOutputRoom: meeting.RoomName,
+		},
+	})
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Msg("completing workflow step")
+	}
+}
+
+// meeting generates the meeting of a workflow, in the named room when the
+// workflow names one.
+func (s *WorkflowStep) meeting(token, teamID, room string) (Meeting, error) {
+	teamName, err := teamDomain(token)
+	if err != nil {
+		return Meeting{}, err
+	}
+	if room != "" {
+		return s.MeetingGenerator.Named(teamID, teamName, "", room)
+	}
+	return s.MeetingGenerator.New(teamID, teamName, "", "")
+}
+
+// teamDomain returns the slack subdomain of the team of the token, which
+// slash commands provide as team_domain.
+func teamDomain(token string) (string, error) {
+	resp, err := slack.New(token).AuthTest()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(resp.URL)
+	if err != nil {
+		return "", err
+	}
+	return strings.SplitN(u.Hostname(), ".", 2)[0], nil
+}
+
+// slackAPI calls a slack web api method that slack-go does not provide with a
+// json body.
+func slackAPI(token, method string, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, slack.APIURL+method, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result slack.SlackResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return err
+	}
+	if !result.Ok {
+		return errors.New(result.Error)
+	}
+	return nil
+}